@@ -6,7 +6,6 @@
 package main
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"os"
@@ -14,7 +13,9 @@ import (
 	"runtime"
 	"strings"
 
-	"github.com/goccy/go-yaml"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/advice"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/join"
+	aspectschema "github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/santhosh-tekuri/jsonschema/v6"
 )
 
@@ -34,12 +35,8 @@ func documentSchema(dir string) error {
 	if err := os.WriteFile(filepath.Join(joinDir, "_index.md"), []byte("---\ntitle: Join Points\ntype: docs\nweight: 1\n---\n\n{{<menu icon=\"search-circle\">}}\n"), 0o644); err != nil {
 		return err
 	}
-	for _, jp := range joinPointSchema.OneOf {
-		jp = jp.Ref
-		name := jp.Location[strings.LastIndex(jp.Location, "/")+1:]
-		if err := documentSchemaInstance(jp, filepath.Join(joinDir, name+".md")); err != nil {
-			return err
-		}
+	if err := documentRegistry(join.Schemas(), joinPointSchema, joinDir); err != nil {
+		return err
 	}
 
 	advDir := filepath.Join(dir, "advice")
@@ -52,48 +49,48 @@ func documentSchema(dir string) error {
 	if err := os.WriteFile(filepath.Join(advDir, "_index.md"), []byte("---\ntitle: Advice\ntype: docs\nweight: 2\n---\n\n{{<menu icon=\"pencil\">}}\n"), 0o644); err != nil {
 		return err
 	}
-	for _, adv := range adviceSchema.OneOf {
-		adv := adv.Ref
-		name := adv.Location[strings.LastIndex(adv.Location, "/")+1:]
-		if err := documentSchemaInstance(adv, filepath.Join(advDir, name+".md")); err != nil {
+	return documentRegistry(advice.Schemas(), adviceSchema, advDir)
+}
+
+// documentRegistry renders one page per entry in the registry. The compiled
+// union schema is used to make sure all documented examples are valid.
+func documentRegistry(registry aspectschema.Registry, union *jsonschema.Schema, dir string) error {
+	compiled := make(map[string]*jsonschema.Schema, len(union.OneOf))
+	for _, sch := range union.OneOf {
+		sch = sch.Ref
+		compiled[sch.Location[strings.LastIndex(sch.Location, "/")+1:]] = sch
+	}
+
+	for _, key := range registry.Keys() {
+		sch, found := compiled[key]
+		if !found {
+			return fmt.Errorf("%q is missing from schema.json, run `go generate ./internal/injector/config`", key)
+		}
+		if err := documentSchemaInstance(key, registry[key], sch, filepath.Join(dir, key+".md")); err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
-func documentSchemaInstance(schema *jsonschema.Schema, path string) error {
+func documentSchemaInstance(key string, entry aspectschema.Entry, schema *jsonschema.Schema, path string) error {
 	file, err := os.Create(path)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	var (
-		propName string
-		prop     *jsonschema.Schema
-	)
-	for name, p := range schema.Properties {
-		propName = name
-		prop = p
-		break
-	}
-	if prop == nil {
-		return errors.New("unexpected schema - no properties?")
-	}
-
 	_, _ = fmt.Fprintln(file, "---")
-	_, _ = fmt.Fprintf(file, "title: %q\n", propName)
-	_, _ = fmt.Fprintf(file, "subtitle: %q\n", prop.Title)
+	_, _ = fmt.Fprintf(file, "title: %q\n", key)
+	_, _ = fmt.Fprintf(file, "subtitle: %q\n", entry.Title)
 	_, _ = fmt.Fprintln(file, "type: docs")
 	_, _ = fmt.Fprintln(file, "---")
 	_, _ = fmt.Fprintln(file)
 
-	_, _ = fmt.Fprintln(file, prop.Description)
+	_, _ = fmt.Fprintln(file, entry.Description)
 	_, _ = fmt.Fprintln(file, "<!--more-->")
 
-	if prop.Deprecated {
+	if entry.Deprecated {
 		_, _ = fmt.Fprintln(file, `{{<callout type="warning">}}`)
 		_, _ = fmt.Fprintln(file, "This feature is deprecated and should not be used in new configurations, as it may be")
 		_, _ = fmt.Fprintln(file, "removed in future versions of Orchestrion.")
@@ -101,20 +98,17 @@ func documentSchemaInstance(schema *jsonschema.Schema, path string) error {
 	}
 	_, _ = fmt.Fprintln(file)
 
-	if len(schema.Examples) > 0 {
+	for idx, ex := range schema.Examples {
+		if err := schema.Validate(ex); err != nil {
+			return fmt.Errorf("%s: invalid example (index %d): %w", key, idx, err)
+		}
+	}
+
+	if len(entry.Examples) > 0 {
 		_, _ = fmt.Fprintln(file, "## Examples")
 		_, _ = fmt.Fprintln(file)
-		for idx, ex := range schema.Examples {
-			if err := schema.Validate(ex); err != nil {
-				return fmt.Errorf("invalid example (index %d): %w", idx, err)
-			}
-
-			yml, err := yaml.Marshal(ex)
-			if err != nil {
-				return err
-			}
-			yml = bytes.TrimSuffix(yml, []byte("\n"))
-			_, _ = fmt.Fprintf(file, "```yaml\n%s\n```\n", string(yml))
+		for _, ex := range entry.Examples {
+			_, _ = fmt.Fprintf(file, "```yaml\n%s\n```\n", strings.TrimSpace(ex))
 		}
 	}
 
@@ -0,0 +1,160 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package cacheprog implements the go toolchain's GOCACHEPROG protocol, so that
+// the go build cache can be observed (and eventually shared) by orchestrion.
+// Objects are stored on disk in a directory using a layout similar to that of
+// the default go build cache. Compile tasks instrumented by orchestrion record
+// metadata about the weaving (see [RecordMetadata]), keyed by the action part
+// of the build ID passed to the compiler. That same key is used by the job
+// server's never-build-twice service, and is derived from the action ID the go
+// toolchain uses to query the cache program; so cache hits and misses can be
+// reported in terms of instrumented packages.
+package cacheprog
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// Serve speaks the GOCACHEPROG protocol over r and w, until a "close" request
+// is received or r is exhausted. Objects are stored in the provided [Store].
+func Serve(ctx context.Context, store *Store, r io.Reader, w io.Writer) (resErr error) {
+	log := zerolog.Ctx(ctx)
+
+	var (
+		stats Stats
+		mu    sync.Mutex // Guards enc & stats
+		enc   = json.NewEncoder(w)
+		wg    sync.WaitGroup
+	)
+	respond := func(res *Response) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return enc.Encode(res)
+	}
+
+	defer func() {
+		wg.Wait()
+		log.Info().
+			Int64("gets", stats.Gets).
+			Int64("hits", stats.Hits).
+			Int64("misses", stats.Misses).
+			Int64("puts", stats.Puts).
+			Int64("woven.hits", stats.WovenHits).
+			Int64("woven.misses", stats.WovenMisses).
+			Msg("GOCACHEPROG session statistics")
+		if err := store.addStats(ctx, stats); err != nil {
+			resErr = errors.Join(resErr, fmt.Errorf("recording statistics: %w", err))
+		}
+	}()
+
+	if err := respond(&Response{KnownCommands: []Cmd{CmdGet, CmdPut, CmdClose}}); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var req Request
+		if err := dec.Decode(&req); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("decoding request: %w", err)
+		}
+
+		var body []byte
+		if req.Command == CmdPut && req.BodySize > 0 {
+			if err := dec.Decode(&body); err != nil {
+				return fmt.Errorf("decoding body of request %d: %w", req.ID, err)
+			}
+			if int64(len(body)) != req.BodySize {
+				return fmt.Errorf("request %d: body has %d bytes, expected %d", req.ID, len(body), req.BodySize)
+			}
+		}
+
+		if req.Command == CmdClose {
+			wg.Wait()
+			return respond(&Response{ID: req.ID})
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := handle(ctx, store, &req, body, &stats, &mu)
+			if err := respond(res); err != nil {
+				log.Error().Err(err).Int64("id", req.ID).Msg("Failed to send GOCACHEPROG response")
+			}
+		}()
+	}
+}
+
+func handle(ctx context.Context, store *Store, req *Request, body []byte, stats *Stats, mu *sync.Mutex) *Response {
+	log := zerolog.Ctx(ctx).With().Int64("id", req.ID).Str("command", string(req.Command)).Logger()
+
+	switch req.Command {
+	case CmdGet:
+		meta := store.metadata(req.ActionID)
+		entry, err := store.get(req.ActionID)
+		if err != nil {
+			log.Warn().Err(err).Hex("action", req.ActionID).Msg("Failed to read cache entry")
+		}
+
+		mu.Lock()
+		stats.record(entry != nil, meta != nil)
+		mu.Unlock()
+
+		evt := log.Debug()
+		if meta != nil {
+			evt = log.Info().Str("import-path", meta.ImportPath).Str("aspects", meta.Aspects).Strs("woven", meta.Woven)
+		}
+		if entry == nil {
+			evt.Hex("action", req.ActionID).Msg("Cache miss")
+			return &Response{ID: req.ID, Miss: true}
+		}
+		evt.Hex("action", req.ActionID).Msg("Cache hit")
+		return &Response{ID: req.ID, OutputID: entry.OutputID, Size: entry.Size, Time: &entry.Time, DiskPath: entry.DiskPath}
+
+	case CmdPut:
+		outputID := req.OutputID
+		if len(outputID) == 0 {
+			outputID = req.ObjectID
+		}
+		diskPath, err := store.put(req.ActionID, outputID, body)
+		if err != nil {
+			log.Error().Err(err).Hex("action", req.ActionID).Msg("Failed to store cache entry")
+			return &Response{ID: req.ID, Err: err.Error()}
+		}
+
+		mu.Lock()
+		stats.Puts++
+		mu.Unlock()
+
+		return &Response{ID: req.ID, DiskPath: diskPath}
+
+	default:
+		return &Response{ID: req.ID, Err: fmt.Sprintf("unknown command %q", req.Command)}
+	}
+}
+
+// buildIDKey returns the key under which metadata is recorded for the provided
+// action ID. This is the encoding the go toolchain uses for the action part of
+// build IDs, which is the first 120 bits of the action ID, encoded in URL-safe
+// base64.
+func buildIDKey(actionID []byte) string {
+	const size = 15
+	if len(actionID) < size {
+		return hex.EncodeToString(actionID)
+	}
+	return base64.RawURLEncoding.EncodeToString(actionID[:size])
+}
@@ -0,0 +1,125 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cacheprog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServe(t *testing.T) {
+	ctx := context.Background()
+	store, err := Open(t.TempDir())
+	require.NoError(t, err)
+
+	var (
+		woven    = sha256.Sum256([]byte("woven-action"))
+		plain    = sha256.Sum256([]byte("plain-action"))
+		body     = []byte("compiled archive content")
+		outputID = sha256.Sum256(body)
+	)
+
+	// Record metadata as a woven compile task would...
+	t.Setenv(EnvVarDir, store.Dir())
+	require.NoError(t, RecordMetadata(Metadata{
+		ImportPath: "example.com/woven",
+		BuildID:    buildIDKey(woven[:]) + "/" + buildIDKey(woven[:]),
+		Aspects:    "aspects-fingerprint",
+		Woven:      []string{"main.go"},
+	}))
+
+	type request struct {
+		Request
+		body []byte
+	}
+	// serve runs a cache program session with the provided requests, followed by
+	// a "close" request.
+	serve := func(requests ...request) map[int64]Response {
+		var input strings.Builder
+		for _, req := range append(requests, request{Request: Request{ID: int64(len(requests) + 1), Command: CmdClose}}) {
+			data, err := json.Marshal(req.Request)
+			require.NoError(t, err)
+			input.Write(data)
+			input.WriteByte('\n')
+			if len(req.body) > 0 {
+				fmt.Fprintf(&input, "%q\n", base64.StdEncoding.EncodeToString(req.body))
+			}
+		}
+
+		var output bytes.Buffer
+		require.NoError(t, Serve(ctx, store, strings.NewReader(input.String()), &output))
+		responses := decodeResponses(t, &output)
+		require.Len(t, responses, len(requests)+2)
+		assert.Equal(t, []Cmd{CmdGet, CmdPut, CmdClose}, responses[0].KnownCommands)
+		return responses
+	}
+
+	responses := serve(request{Request: Request{ID: 1, Command: CmdGet, ActionID: woven[:]}})
+	assert.True(t, responses[1].Miss)
+
+	responses = serve(request{Request: Request{ID: 1, Command: CmdPut, ActionID: woven[:], OutputID: outputID[:], BodySize: int64(len(body))}, body: body})
+	require.Empty(t, responses[1].Err)
+	require.NotEmpty(t, responses[1].DiskPath)
+	content, err := os.ReadFile(responses[1].DiskPath)
+	require.NoError(t, err)
+	assert.Equal(t, body, content)
+
+	responses = serve(
+		request{Request: Request{ID: 1, Command: CmdGet, ActionID: woven[:]}},
+		request{Request: Request{ID: 2, Command: CmdGet, ActionID: plain[:]}},
+	)
+	assert.False(t, responses[1].Miss)
+	assert.Equal(t, outputID[:], responses[1].OutputID)
+	assert.Equal(t, int64(len(body)), responses[1].Size)
+	assert.Equal(t, store.path(outputID[:], outputSuffix), responses[1].DiskPath)
+	assert.True(t, responses[2].Miss)
+
+	stats, err := store.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Gets: 3, Hits: 1, Misses: 2, Puts: 1, WovenHits: 1, WovenMisses: 1}, stats)
+}
+
+func TestPutIntegrity(t *testing.T) {
+	store, err := Open(t.TempDir())
+	require.NoError(t, err)
+
+	action := sha256.Sum256([]byte("action"))
+	wrong := sha256.Sum256([]byte("something else"))
+	_, err = store.put(action[:], wrong[:], []byte("content"))
+	require.ErrorContains(t, err, "does not match")
+}
+
+func TestBuildIDKey(t *testing.T) {
+	// The go toolchain encodes the first 120 bits of the action ID in build IDs
+	// using the URL-safe base64 alphabet.
+	actionID := make([]byte, sha256.Size)
+	for i := range actionID {
+		actionID[i] = byte(i * 17)
+	}
+	assert.Equal(t, "ABEiM0RVZneImaq7zN3u", buildIDKey(actionID))
+}
+
+func decodeResponses(t *testing.T, output *bytes.Buffer) map[int64]Response {
+	t.Helper()
+	res := make(map[int64]Response)
+	dec := json.NewDecoder(output)
+	for dec.More() {
+		var resp Response
+		require.NoError(t, dec.Decode(&resp))
+		res[resp.ID] = resp
+	}
+	return res
+}
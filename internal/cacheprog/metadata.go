@@ -0,0 +1,51 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cacheprog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// EnvVarDir is the environment variable set by `orchestrion go` when it
+	// configures orchestrion as the GOCACHEPROG. It designates the directory
+	// used by the cache program, where compile tasks record their metadata.
+	EnvVarDir = "ORCHESTRION_CACHEPROG_DIR"
+	// EnvVarEnable is the environment variable that can be set to a truthy
+	// value to have `orchestrion go` configure orchestrion as the GOCACHEPROG.
+	EnvVarEnable = "ORCHESTRION_GOCACHEPROG"
+)
+
+// Metadata describes how orchestrion instrumented a compile task.
+type Metadata struct {
+	// ImportPath is the import path of the package being compiled.
+	ImportPath string `json:"importPath"`
+	// BuildID is the build ID passed to the compiler.
+	BuildID string `json:"buildID"`
+	// Aspects is the fingerprint of the aspects applied to the package.
+	Aspects string `json:"aspects"`
+	// Woven is the list of source files that were modified by orchestrion.
+	Woven []string `json:"woven,omitempty"`
+}
+
+// RecordMetadata records the provided metadata for the cache program, keyed by
+// the action part of [Metadata.BuildID]. It does nothing unless orchestrion is
+// configured as the GOCACHEPROG (that is, [EnvVarDir] is set).
+func RecordMetadata(meta Metadata) error {
+	dir := os.Getenv(EnvVarDir)
+	if dir == "" || meta.BuildID == "" {
+		return nil
+	}
+	key, _, _ := strings.Cut(meta.BuildID, "/")
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, metaDir, key+".json"), data)
+}
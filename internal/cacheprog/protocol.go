@@ -0,0 +1,71 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cacheprog
+
+import "time"
+
+// The types in this file mirror those of the `cmd/go/internal/cacheprog`
+// package, which defines the JSON protocol spoken by the go toolchain over the
+// standard input & output of the GOCACHEPROG process.
+
+// Cmd is a command that can be issued to the cache program.
+type Cmd string
+
+const (
+	// CmdGet looks up an action ID in the cache.
+	CmdGet Cmd = "get"
+	// CmdPut stores an object in the cache. The object's content is sent as a
+	// separate JSON-encoded base64 string immediately following the request.
+	CmdPut Cmd = "put"
+	// CmdClose requests the cache program to exit gracefully.
+	CmdClose Cmd = "close"
+)
+
+type (
+	// Request is sent by the go toolchain to the cache program.
+	Request struct {
+		// ID is a unique number per process across all requests. It is echoed in
+		// the corresponding [Response].
+		ID int64
+		// Command is the type of request.
+		Command Cmd
+		// ActionID is the cache key for "put" and "get" requests.
+		ActionID []byte `json:",omitempty"`
+		// OutputID is the SHA-256 of the object being stored by "put" requests.
+		OutputID []byte `json:",omitempty"`
+		// ObjectID is the legacy name of OutputID, used by go toolchains prior to
+		// go1.24.
+		ObjectID []byte `json:",omitempty"`
+		// BodySize is the number of bytes of the object being stored by "put"
+		// requests.
+		BodySize int64 `json:",omitempty"`
+	}
+
+	// Response is sent by the cache program to the go toolchain.
+	Response struct {
+		// ID is the [Request.ID] this response is for, or 0 for the initial
+		// capabilities message.
+		ID int64
+		// Err is the error that occurred while processing the request, if any.
+		Err string `json:",omitempty"`
+		// KnownCommands is only set in the initial message, and lists the
+		// commands supported by the cache program.
+		KnownCommands []Cmd `json:",omitempty"`
+		// Miss is set by "get" requests that found no usable cache entry.
+		Miss bool `json:",omitempty"`
+		// OutputID is the [Request.OutputID] of the object found by "get"
+		// requests.
+		OutputID []byte `json:",omitempty"`
+		// Size is the size of the object found by "get" requests.
+		Size int64 `json:",omitempty"`
+		// Time is the time at which the object found by "get" requests was
+		// stored.
+		Time *time.Time `json:",omitempty"`
+		// DiskPath is the absolute path to a file containing the object's content,
+		// for both "get" and "put" requests.
+		DiskPath string `json:",omitempty"`
+	}
+)
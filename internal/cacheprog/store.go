@@ -0,0 +1,375 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cacheprog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/filelock"
+	"github.com/rs/zerolog"
+)
+
+const (
+	actionSuffix = "-a"
+	outputSuffix = "-d"
+	metaDir      = "meta"
+	statsFile    = "stats.json"
+)
+
+type (
+	// Store is the on-disk storage of the cache program.
+	Store struct {
+		dir string
+	}
+
+	// Stats holds cache usage statistics.
+	Stats struct {
+		// Gets is the number of "get" requests served.
+		Gets int64 `json:"gets"`
+		// Hits is the number of "get" requests that found a cache entry.
+		Hits int64 `json:"hits"`
+		// Misses is the number of "get" requests that found no cache entry.
+		Misses int64 `json:"misses"`
+		// Puts is the number of "put" requests served.
+		Puts int64 `json:"puts"`
+		// WovenHits is the number of hits on compile tasks instrumented by
+		// orchestrion.
+		WovenHits int64 `json:"wovenHits"`
+		// WovenMisses is the number of misses on compile tasks instrumented by
+		// orchestrion. Metadata is recorded while compiling, so this only counts
+		// tasks that were compiled before but whose output is no longer cached.
+		WovenMisses int64 `json:"wovenMisses"`
+	}
+
+	actionEntry struct {
+		OutputID string    `json:"output"`
+		Size     int64     `json:"size"`
+		Time     time.Time `json:"time"`
+	}
+
+	cacheEntry struct {
+		OutputID []byte
+		Size     int64
+		Time     time.Time
+		DiskPath string
+	}
+)
+
+// DefaultDir returns the default directory used by the cache program, which is
+// the `orchestrion` directory within the go toolchain's GOCACHE, so that it is
+// removed by `go clean -cache`.
+func DefaultDir(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, "go", "env", "GOCACHE")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running %q: %w", cmd.Args, err)
+	}
+	gocache := strings.TrimSpace(stdout.String())
+	if gocache == "" || gocache == "off" {
+		return "", errors.New("the go build cache is disabled (GOCACHE=off)")
+	}
+	return filepath.Join(gocache, "orchestrion"), nil
+}
+
+// Open returns a [Store] using the specified directory, creating it if needed.
+func Open(dir string) (*Store, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Dir returns the directory used by this store.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func (s *Store) path(id []byte, suffix string) string {
+	name := hex.EncodeToString(id)
+	return filepath.Join(s.dir, name[:2], name+suffix)
+}
+
+// get returns the cache entry for actionID, or nil if there is none.
+func (s *Store) get(actionID []byte) (*cacheEntry, error) {
+	if len(actionID) == 0 {
+		return nil, errors.New("missing action ID")
+	}
+	data, err := os.ReadFile(s.path(actionID, actionSuffix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entry actionEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	outputID, err := hex.DecodeString(entry.OutputID)
+	if err != nil || len(outputID) == 0 {
+		return nil, fmt.Errorf("invalid output ID %q", entry.OutputID)
+	}
+
+	diskPath := s.path(outputID, outputSuffix)
+	stat, err := os.Stat(diskPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if stat.Size() != entry.Size {
+		// Corrupted or truncated object; treat as a miss.
+		return nil, nil
+	}
+
+	// Record the use of this entry, so that trimming is based on last use.
+	now := time.Now()
+	_ = os.Chtimes(s.path(actionID, actionSuffix), now, now)
+
+	return &cacheEntry{OutputID: outputID, Size: entry.Size, Time: entry.Time, DiskPath: diskPath}, nil
+}
+
+// put stores body as the output for actionID, and returns the path to the file
+// containing it.
+func (s *Store) put(actionID []byte, outputID []byte, body []byte) (string, error) {
+	if len(actionID) == 0 || len(outputID) == 0 {
+		return "", errors.New("missing action or output ID")
+	}
+	if sum := sha256.Sum256(body); len(outputID) == sha256.Size && !bytes.Equal(sum[:], outputID) {
+		return "", fmt.Errorf("output ID %x does not match the body's SHA-256 (%x)", outputID, sum)
+	}
+
+	diskPath := s.path(outputID, outputSuffix)
+	if stat, err := os.Stat(diskPath); err != nil || stat.Size() != int64(len(body)) {
+		if err := writeFile(diskPath, body); err != nil {
+			return "", err
+		}
+	}
+
+	data, err := json.Marshal(actionEntry{OutputID: hex.EncodeToString(outputID), Size: int64(len(body)), Time: time.Now()})
+	if err != nil {
+		return "", err
+	}
+	if err := writeFile(s.path(actionID, actionSuffix), data); err != nil {
+		return "", err
+	}
+
+	return diskPath, nil
+}
+
+// metadata returns the orchestrion metadata recorded for actionID, if any.
+func (s *Store) metadata(actionID []byte) *Metadata {
+	data, err := os.ReadFile(filepath.Join(s.dir, metaDir, buildIDKey(actionID)+".json"))
+	if err != nil {
+		return nil
+	}
+	var meta Metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil
+	}
+	return &meta
+}
+
+// Stats returns the cumulative statistics of all cache program sessions that
+// used this store.
+func (s *Store) Stats(ctx context.Context) (Stats, error) {
+	mu := filelock.MutexAt(filepath.Join(s.dir, statsFile))
+	if err := mu.RLock(ctx); err != nil {
+		return Stats{}, err
+	}
+	defer func() { _ = mu.Unlock(ctx) }()
+	return readStats(mu)
+}
+
+// addStats adds the provided statistics to the store's cumulative statistics.
+func (s *Store) addStats(ctx context.Context, stats Stats) error {
+	mu := filelock.MutexAt(filepath.Join(s.dir, statsFile))
+	if err := mu.Lock(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		if err := mu.Unlock(ctx); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to unlock statistics file")
+		}
+	}()
+
+	total, err := readStats(mu)
+	if err != nil {
+		return err
+	}
+	total.Gets += stats.Gets
+	total.Hits += stats.Hits
+	total.Misses += stats.Misses
+	total.Puts += stats.Puts
+	total.WovenHits += stats.WovenHits
+	total.WovenMisses += stats.WovenMisses
+
+	data, err := json.Marshal(total)
+	if err != nil {
+		return err
+	}
+	// Counters never decrease, so the new content is never shorter than the
+	// previous one and can simply be written over it.
+	_, err = mu.WriteAt(data, 0)
+	return err
+}
+
+func readStats(rd io.Reader) (Stats, error) {
+	var stats Stats
+	data, err := io.ReadAll(rd)
+	if err != nil || len(data) == 0 {
+		return stats, err
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return Stats{}, fmt.Errorf("parsing statistics: %w", err)
+	}
+	return stats, nil
+}
+
+func (s *Stats) record(hit bool, woven bool) {
+	s.Gets++
+	switch {
+	case hit && woven:
+		s.Hits++
+		s.WovenHits++
+	case hit:
+		s.Hits++
+	case woven:
+		s.Misses++
+		s.WovenMisses++
+	default:
+		s.Misses++
+	}
+}
+
+// Trim removes action entries that were last used before the specified time,
+// along with outputs and metadata that are no longer referenced by any
+// remaining action entry. It returns the number of action entries removed and
+// the number of bytes freed.
+func (s *Store) Trim(before time.Time) (removed int, freed int64, err error) {
+	referenced := make(map[string]struct{})
+	var outputs []string
+
+	err = filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != s.dir && filepath.Dir(path) == s.dir && d.Name() == metaDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case strings.HasSuffix(path, outputSuffix):
+			outputs = append(outputs, path)
+		case strings.HasSuffix(path, actionSuffix):
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if info.ModTime().Before(before) {
+				if err := os.Remove(path); err != nil {
+					return err
+				}
+				removed++
+				freed += info.Size()
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			var entry actionEntry
+			if json.Unmarshal(data, &entry) == nil {
+				referenced[entry.OutputID] = struct{}{}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, freed, err
+	}
+
+	for _, path := range outputs {
+		if _, found := referenced[strings.TrimSuffix(filepath.Base(path), outputSuffix)]; found {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return removed, freed, err
+		}
+		freed += info.Size()
+	}
+
+	metas, err := os.ReadDir(filepath.Join(s.dir, metaDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return removed, freed, err
+	}
+	for _, meta := range metas {
+		info, err := meta.Info()
+		if err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, metaDir, meta.Name())); err != nil {
+			return removed, freed, err
+		}
+		freed += info.Size()
+	}
+
+	return removed, freed, nil
+}
+
+// Clean removes all entries from the store.
+func (s *Store) Clean() error {
+	return os.RemoveAll(s.dir)
+}
+
+// writeFile atomically writes data to path, creating parent directories as
+// needed.
+func writeFile(path string, data []byte) (resErr error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmp.Close()
+		if resErr != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
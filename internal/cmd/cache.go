@@ -0,0 +1,160 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/cacheprog"
+	"github.com/DataDog/orchestrion/internal/weavecache"
+	"github.com/urfave/cli/v2"
+)
+
+var Cache = &cli.Command{
+	Name:  "cache",
+	Usage: "Manages orchestrion's persistent weave cache and GOCACHEPROG storage",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "stats",
+			Usage: "Displays the location, number of entries and size of the weave cache",
+			Action: func(clictx *cli.Context) error {
+				cache, err := openWeaveCache()
+				if err != nil {
+					return err
+				}
+				stats, err := cache.Stats()
+				if err != nil {
+					return cli.Exit(fmt.Errorf("reading weave cache: %w", err), 1)
+				}
+
+				_, err = fmt.Fprintf(clictx.App.Writer, "Directory: %s\nEntries:   %d\nSize:      %s\n", stats.Dir, stats.Entries, formatSize(stats.Size))
+				if err != nil {
+					return err
+				}
+				if stats.Entries != 0 {
+					_, err = fmt.Fprintf(clictx.App.Writer, "Oldest:    %s\nNewest:    %s\n", stats.Oldest.Format(time.RFC3339), stats.Newest.Format(time.RFC3339))
+					if err != nil {
+						return err
+					}
+				}
+
+				store := existingCacheProgStore(clictx)
+				if store == nil {
+					return nil
+				}
+				progStats, err := store.Stats(clictx.Context)
+				if err != nil {
+					return cli.Exit(fmt.Errorf("reading GOCACHEPROG statistics: %w", err), 1)
+				}
+				_, err = fmt.Fprintf(clictx.App.Writer, "\nGOCACHEPROG directory: %s\nRequests:  %d get, %d put\nHits:      %d (%d instrumented)\nMisses:    %d (%d instrumented)\n",
+					store.Dir(), progStats.Gets, progStats.Puts, progStats.Hits, progStats.WovenHits, progStats.Misses, progStats.WovenMisses)
+				return err
+			},
+		},
+		{
+			Name:  "trim",
+			Usage: "Removes weave cache entries that have not been used recently",
+			Flags: []cli.Flag{
+				&cli.DurationFlag{
+					Name:  "older-than",
+					Usage: "Remove entries that were last used longer ago than this duration.",
+					Value: 7 * 24 * time.Hour,
+				},
+			},
+			Action: func(clictx *cli.Context) error {
+				cache, err := openWeaveCache()
+				if err != nil {
+					return err
+				}
+				before := time.Now().Add(-clictx.Duration("older-than"))
+				removed, freed, err := cache.Trim(before)
+				if err != nil {
+					return cli.Exit(fmt.Errorf("trimming weave cache: %w", err), 1)
+				}
+				if store := existingCacheProgStore(clictx); store != nil {
+					progRemoved, progFreed, err := store.Trim(before)
+					if err != nil {
+						return cli.Exit(fmt.Errorf("trimming GOCACHEPROG directory: %w", err), 1)
+					}
+					removed += progRemoved
+					freed += progFreed
+				}
+				_, err = fmt.Fprintf(clictx.App.Writer, "Removed %d entries (%s)\n", removed, formatSize(freed))
+				return err
+			},
+		},
+		{
+			Name:  "clean",
+			Usage: "Removes all entries from the weave cache",
+			Action: func(clictx *cli.Context) error {
+				cache, err := openWeaveCache()
+				if err != nil {
+					return err
+				}
+				if err := cache.Clean(); err != nil {
+					return cli.Exit(fmt.Errorf("cleaning weave cache: %w", err), 1)
+				}
+				if _, err := fmt.Fprintf(clictx.App.Writer, "Removed %s\n", cache.Dir()); err != nil {
+					return err
+				}
+				if store := existingCacheProgStore(clictx); store != nil {
+					if err := store.Clean(); err != nil {
+						return cli.Exit(fmt.Errorf("cleaning GOCACHEPROG directory: %w", err), 1)
+					}
+					_, err = fmt.Fprintf(clictx.App.Writer, "Removed %s\n", store.Dir())
+				}
+				return err
+			},
+		},
+	},
+}
+
+func openWeaveCache() (*weavecache.Cache, error) {
+	cache, err := weavecache.Open()
+	if err != nil {
+		return nil, cli.Exit(err, 1)
+	}
+	if cache == nil {
+		return nil, cli.Exit(errors.New("the weave cache is disabled ("+weavecache.EnvVarWeaveCache+"=off)"), 1)
+	}
+	return cache, nil
+}
+
+// existingCacheProgStore returns the GOCACHEPROG store, if it exists. The
+// store is never created by this function.
+func existingCacheProgStore(clictx *cli.Context) *cacheprog.Store {
+	dir := os.Getenv(cacheprog.EnvVarDir)
+	if dir == "" {
+		var err error
+		if dir, err = cacheprog.DefaultDir(clictx.Context); err != nil {
+			return nil
+		}
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil
+	}
+	store, err := cacheprog.Open(dir)
+	if err != nil {
+		return nil
+	}
+	return store
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,61 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/cacheprog"
+	"github.com/urfave/cli/v2"
+)
+
+var CacheProg = &cli.Command{
+	Name:        "cacheprog",
+	Usage:       "Implements the GOCACHEPROG protocol",
+	Description: "Serves the go toolchain's GOCACHEPROG protocol over standard input and output, storing objects in a directory within GOCACHE and reporting cache hits and misses on packages instrumented by orchestrion.\n\nUsers do not normally need to use this command directly, as 'orchestrion go' configures it automatically when the " + cacheprog.EnvVarEnable + " environment variable is set to true.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "dir",
+			Usage:       "The directory in which cache objects are stored.",
+			EnvVars:     []string{cacheprog.EnvVarDir},
+			DefaultText: "$GOCACHE/orchestrion",
+		},
+	},
+	Hidden: true,
+	Action: func(clictx *cli.Context) (err error) {
+		span, ctx := tracer.StartSpanFromContext(clictx.Context, "cacheprog")
+		defer func() { span.Finish(tracer.WithError(err)) }()
+
+		store, err := openCacheProgStore(clictx)
+		if err != nil {
+			return err
+		}
+		if err := cacheprog.Serve(ctx, store, os.Stdin, os.Stdout); err != nil {
+			return cli.Exit(fmt.Errorf("serving GOCACHEPROG protocol: %w", err), 1)
+		}
+		return nil
+	},
+}
+
+func openCacheProgStore(clictx *cli.Context) (*cacheprog.Store, error) {
+	dir := clictx.String("dir")
+	if dir == "" {
+		dir = os.Getenv(cacheprog.EnvVarDir)
+	}
+	if dir == "" {
+		var err error
+		if dir, err = cacheprog.DefaultDir(clictx.Context); err != nil {
+			return nil, cli.Exit(err, 1)
+		}
+	}
+	store, err := cacheprog.Open(dir)
+	if err != nil {
+		return nil, cli.Exit(fmt.Errorf("opening GOCACHEPROG directory: %w", err), 1)
+	}
+	return store, nil
+}
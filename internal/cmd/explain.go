@@ -0,0 +1,48 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"errors"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/explain"
+	"github.com/urfave/cli/v2"
+)
+
+var Explain = &cli.Command{
+	Name:      "explain",
+	Usage:     "Explains which aspects apply (or fail to apply) to a source location",
+	ArgsUsage: "<file>:<line>",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "aspect",
+			Usage: "Only report on the aspect with this ID (implies --verbose). Can be specified multiple times.",
+		},
+		&cli.BoolFlag{
+			Name:    "verbose",
+			Aliases: []string{"v"},
+			Usage:   "Print the full evaluation tree of each aspect's join point.",
+		},
+	},
+	Action: func(clictx *cli.Context) (err error) {
+		span, ctx := tracer.StartSpanFromContext(clictx.Context, "explain",
+			tracer.ResourceName(clictx.Args().First()),
+		)
+		defer func() { span.Finish(tracer.WithError(err)) }()
+
+		if clictx.NArg() != 1 {
+			return cli.Exit(errors.New("expected exactly one <file>:<line> argument"), 2)
+		}
+
+		return explain.Explain(ctx, explain.Options{
+			Writer:    clictx.App.Writer,
+			Location:  clictx.Args().First(),
+			AspectIDs: clictx.StringSlice("aspect"),
+			Verbose:   clictx.Bool("verbose"),
+		})
+	},
+}
@@ -7,21 +7,38 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
 	"github.com/DataDog/orchestrion/internal/binpath"
+	"github.com/DataDog/orchestrion/internal/cacheprog"
+	"github.com/DataDog/orchestrion/internal/goflags"
 	"github.com/DataDog/orchestrion/internal/goproxy"
 	"github.com/DataDog/orchestrion/internal/pin"
 	"github.com/urfave/cli/v2"
 )
 
+const (
+	// modeToolexec weaves packages during compilation, using the go command's
+	// -toolexec flag.
+	modeToolexec = "toolexec"
+	// modeOverlay weaves packages before running the go command, which is then
+	// provided the woven files using its -overlay flag.
+	modeOverlay = "overlay"
+)
+
 var (
 	Go = &cli.Command{
-		Name:            "go",
-		Usage:           "Executes standard go commands with automatic instrumentation enabled",
-		UsageText:       "orchestrion go [go command arguments...]",
+		Name:  "go",
+		Usage: "Executes standard go commands with automatic instrumentation enabled",
+		UsageText: "orchestrion go [--mode=" + modeToolexec + "|" + modeOverlay + "] [go command arguments...]\n\n" +
+			"The --mode flag selects how packages are woven: during compilation using -toolexec (the default), or\n" +
+			"ahead of the go command's execution using -overlay (for build drivers that already use -toolexec). It may\n" +
+			"precede the go command, or appear among its flags (e.g, orchestrion go build --mode=overlay ./...).",
 		Args:            true,
 		SkipFlagParsing: true,
 		Action: func(clictx *cli.Context) (err error) {
@@ -30,11 +47,24 @@ var (
 			)
 			defer func() { span.Finish(tracer.WithError(err)) }()
 
+			mode, args, err := parseMode(clictx.Args().Slice())
+			if err != nil {
+				return cli.Exit(err, 2)
+			}
+
 			if err := pin.AutoPinOrchestrion(ctx, clictx.App.Writer, clictx.App.ErrWriter); err != nil {
 				return cli.Exit(err, -1)
 			}
 
-			if err := goproxy.Run(ctx, clictx.Args().Slice(), goproxy.WithToolexec(binpath.Orchestrion, "toolexec")); err != nil {
+			opts := []goproxy.Option{goproxy.WithToolexec(binpath.Orchestrion, "toolexec")}
+			if mode == modeOverlay {
+				opts = append(opts, goproxy.WithOverlay())
+			}
+			if enabled, _ := strconv.ParseBool(os.Getenv(cacheprog.EnvVarEnable)); enabled {
+				opts = append(opts, goproxy.WithGoCacheProg(binpath.Orchestrion, "cacheprog"))
+			}
+
+			if err := goproxy.Run(ctx, args, opts...); err != nil {
 				var exitErr *exec.ExitError
 				if errors.As(err, &exitErr) {
 					return cli.Exit(err, exitErr.ExitCode())
@@ -45,3 +75,39 @@ var (
 		},
 	}
 )
+
+// parseMode extracts the --mode flag from the go command arguments, where it
+// may either precede the go command name or appear among the go command's own
+// flags (before the first package argument), and returns the selected mode
+// (defaulting to [modeToolexec]) together with the remaining arguments.
+func parseMode(args []string) (string, []string, error) {
+	if len(args) == 0 {
+		return modeToolexec, args, nil
+	}
+
+	var mode string
+	switch arg := args[0]; {
+	case arg == "--mode":
+		if len(args) < 2 {
+			return "", nil, errors.New("missing value for the --mode flag")
+		}
+		mode, args = args[1], args[2:]
+	case strings.HasPrefix(arg, "--mode="):
+		mode, args = strings.TrimPrefix(arg, "--mode="), args[1:]
+	default:
+		var found bool
+		if args, mode, found = goflags.Cut(args, "-mode"); !found {
+			return modeToolexec, args, nil
+		}
+		if mode == "" {
+			return "", nil, errors.New("missing value for the --mode flag")
+		}
+	}
+
+	switch mode {
+	case modeToolexec, modeOverlay:
+		return mode, args, nil
+	default:
+		return "", nil, fmt.Errorf("invalid value for the --mode flag: %q (expected %q or %q)", mode, modeToolexec, modeOverlay)
+	}
+}
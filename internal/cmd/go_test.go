@@ -0,0 +1,51 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMode(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args     []string
+		mode     string
+		expected []string
+		err      string
+	}{
+		"none":             {args: []string{"build", "./..."}, mode: modeToolexec, expected: []string{"build", "./..."}},
+		"empty":            {args: []string{}, mode: modeToolexec, expected: []string{}},
+		"leading":          {args: []string{"--mode", "overlay", "build", "./..."}, mode: modeOverlay, expected: []string{"build", "./..."}},
+		"leading-assigned": {args: []string{"--mode=overlay", "build", "./..."}, mode: modeOverlay, expected: []string{"build", "./..."}},
+		"after-command":    {args: []string{"build", "--mode=overlay", "./..."}, mode: modeOverlay, expected: []string{"build", "./..."}},
+		"among-flags": {
+			args:     []string{"test", "-tags", "foo", "--mode", "toolexec", "-race", "./...", "-run", "Test"},
+			mode:     modeToolexec,
+			expected: []string{"test", "-tags", "foo", "-race", "./...", "-run", "Test"},
+		},
+		"after-packages": {
+			args:     []string{"run", ".", "--mode=overlay"},
+			mode:     modeToolexec,
+			expected: []string{"run", ".", "--mode=overlay"},
+		},
+		"missing-value": {args: []string{"build", "--mode"}, err: "missing value for the --mode flag"},
+		"invalid":       {args: []string{"build", "--mode=bogus", "./..."}, err: `invalid value for the --mode flag: "bogus"`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mode, args, err := parseMode(tc.args)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.mode, mode)
+			assert.Equal(t, tc.expected, args)
+		})
+	}
+}
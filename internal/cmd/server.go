@@ -7,17 +7,24 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
 	"time"
 
 	"github.com/DataDog/orchestrion/internal/filelock"
 	"github.com/DataDog/orchestrion/internal/goflags"
 	"github.com/DataDog/orchestrion/internal/jobserver"
 	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/jobserver/nbt"
+	"github.com/DataDog/orchestrion/internal/jobserver/status"
+	"github.com/DataDog/orchestrion/internal/remotecache"
 	"github.com/fsnotify/fsnotify"
 	"github.com/goccy/go-yaml"
 	"github.com/rs/zerolog"
@@ -40,6 +47,15 @@ var Server = &cli.Command{
 			Value:       -1,
 			DefaultText: "random",
 		},
+		&cli.BoolFlag{
+			Name:  "daemon",
+			Usage: "Run as the long-lived, user-level daemon job server, which serves builds of any module and is discovered by orchestrion automatically. A daemon running a different version of orchestrion is replaced. Not supported on Windows.",
+		},
+		&cli.BoolFlag{
+			Name:  "unix-socket",
+			Usage: "Listen on a Unix domain socket that only the current user can access, instead of on the loopback interface. Ignored if --port is set.",
+			Value: jobserver.UnixSocketByDefault,
+		},
 		&cli.DurationFlag{
 			Name:  "inactivity-timeout",
 			Usage: "Automatically shut down after a period without any connected client.",
@@ -62,6 +78,33 @@ var Server = &cli.Command{
 				return nil
 			},
 		},
+		&cli.BoolFlag{
+			Name:    "nbt-store",
+			Usage:   "Persist compilation artifacts in a durable store, so they can be re-used by later job servers. The store is located in the 'nbt' directory of the orchestrion cache.",
+			EnvVars: []string{nbt.EnvVarStore},
+		},
+		&cli.Int64Flag{
+			Name:    "nbt-store-max-size",
+			Usage:   "Maximum size of the durable store, in MiB. Least recently used artifacts are evicted when the server shuts down.",
+			EnvVars: []string{nbt.EnvVarStoreMaxSize},
+			Value:   nbt.DefaultStoreMaxSize >> 20,
+		},
+		&cli.DurationFlag{
+			Name:    "nbt-store-max-age",
+			Usage:   "Evict artifacts from the durable store that have not been used for this long.",
+			EnvVars: []string{nbt.EnvVarStoreMaxAge},
+			Value:   nbt.DefaultStoreMaxAge,
+		},
+		&cli.StringFlag{
+			Name:    "remote-cache",
+			Usage:   "Consult a shared remote cache for compilation artifacts and version suffixes. This is an http(s):// URL, or a file:// URL or absolute path to a (possibly network-mounted) directory.",
+			EnvVars: []string{remotecache.EnvVarURL},
+		},
+		&cli.BoolFlag{
+			Name:    "remote-cache-read-only",
+			Usage:   "Do not upload new entries to the remote cache.",
+			EnvVars: []string{remotecache.EnvVarReadOnly},
+		},
 		&cli.IntFlag{
 			Name:        "parent-pid",
 			Usage:       "Specify which process created this server. This is useful when the server is started as a daemon, as it needs to be able to resolve the top-level go command line.",
@@ -71,14 +114,41 @@ var Server = &cli.Command{
 			},
 		},
 	},
-	Hidden: true,
+	Hidden:      true,
+	Subcommands: []*cli.Command{serverStatus},
 	Action: func(ctx *cli.Context) error {
 		log := zerolog.Ctx(ctx.Context)
 
 		opts := jobserver.Options{
-			Port:              ctx.Int("port"),
-			InactivityTimeout: ctx.Duration("inactivity-timeout"),
-			EnableLogging:     ctx.Bool("nats-logging"),
+			Port:                ctx.Int("port"),
+			UnixSocket:          ctx.Bool("unix-socket") && !ctx.IsSet("port"),
+			InactivityTimeout:   ctx.Duration("inactivity-timeout"),
+			EnableLogging:       ctx.Bool("nats-logging"),
+			RemoteCache:         ctx.String("remote-cache"),
+			RemoteCacheReadOnly: ctx.Bool("remote-cache-read-only"),
+		}
+
+		if ctx.Bool("nbt-store") {
+			dir, err := nbt.DefaultStoreDir()
+			if err != nil {
+				return cli.Exit(fmt.Errorf("resolving cache directory: %w", err), 1)
+			}
+			opts.NBTStore = &nbt.StoreOptions{
+				Dir:     dir,
+				MaxSize: ctx.Int64("nbt-store-max-size") << 20,
+				MaxAge:  ctx.Duration("nbt-store-max-age"),
+			}
+		}
+
+		if ctx.Bool("daemon") {
+			if !ctx.IsSet("inactivity-timeout") {
+				// The daemon is meant to outlive builds, so it should not shut down on its own by default.
+				opts.InactivityTimeout = 0
+			}
+			// The daemon serves many builds, whose flags are determined on a per-request basis. Its own
+			// process hierarchy is irrelevant.
+			goflags.SetFlags(ctx.Context, ".", []string{"build"})
+			return startDaemon(ctx.Context, ctx.App.Writer, &opts)
 		}
 
 		if urlFile := ctx.String("url-file"); urlFile != "" {
@@ -128,7 +198,7 @@ func startWithURLFile(ctx context.Context, opts *jobserver.Options, urlFile stri
 	if url, err := hasURLToRunningServer(file); err != nil {
 		return cli.Exit(err, 1)
 	} else if url != "" {
-		return cli.Exit(fmt.Sprintf("A server is already listening on %q", url), 2)
+		return cli.Exit(fmt.Sprintf("A server is already listening on %q", client.RedactURL(url)), 2)
 	}
 
 	// No existing server, so now we're actually going to try starting our own
@@ -143,7 +213,7 @@ func startWithURLFile(ctx context.Context, opts *jobserver.Options, urlFile stri
 	if url, err := hasURLToRunningServer(file); err != nil {
 		return cli.Exit(err, 1)
 	} else if url != "" {
-		return cli.Exit(fmt.Sprintf("A server is already listening on %q", url), 2)
+		return cli.Exit(fmt.Sprintf("A server is already listening on %q", client.RedactURL(url)), 2)
 	}
 
 	// This process "owns" the URL file, so it'll try had to remove it when it terminates...
@@ -159,16 +229,21 @@ func startWithURLFile(ctx context.Context, opts *jobserver.Options, urlFile stri
 	clientURL := server.ClientURL()
 	log.Trace().
 		Str("url-file", urlFile).
-		Str("url", clientURL).
+		Str("url", client.RedactURL(clientURL)).
 		Msg("Server component successfully started")
 
-	// Write the ClientURL into the urlFile
+	// Write the ClientURL into the urlFile; it contains the server's authentication token, so only
+	// the current user may read it.
+	if err := os.Chmod(urlFile, 0o600); err != nil {
+		server.Shutdown()
+		return cli.Exit(fmt.Errorf("failed to restrict access to URL file at %q: %w", urlFile, err), 1)
+	}
 	if _, err := file.Write([]byte(clientURL)); err != nil {
 		return cli.Exit(fmt.Errorf("failed to write URL file at %q: %w", urlFile, err), 1)
 	}
 	log.Trace().
 		Str("url-file", urlFile).
-		Str("url", clientURL).
+		Str("url", client.RedactURL(clientURL)).
 		Msg("Populated URL file with server URL")
 
 	// Release the URL File lock
@@ -179,7 +254,7 @@ func startWithURLFile(ctx context.Context, opts *jobserver.Options, urlFile stri
 	}
 	log.Trace().
 		Str("url-file", urlFile).
-		Str("url", clientURL).
+		Str("url", client.RedactURL(clientURL)).
 		Msg("Released lock on URL file")
 
 	// Try to watch for removal of the URL file, so we can shut down the server eagerly when that happens.
@@ -285,3 +360,137 @@ func shutdownOnRemove(ctx context.Context, server *jobserver.Server, urlFile str
 
 	return cancel
 }
+
+var serverStatus = &cli.Command{
+	Name:        "status",
+	Usage:       "Display live statistics of running job servers.",
+	Description: "Reports the connected clients, in-progress compilation tasks, cache hit rates and slowest packages of running job servers. By default, the job server designated by the " + client.EnvVarJobserverURL + " environment variable is used; otherwise the daemon job server and all job servers found in go build work directories are reported.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "url",
+			Usage:   "The URL of the job server to report on.",
+			EnvVars: []string{client.EnvVarJobserverURL},
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Output the status of each job server as JSON.",
+		},
+	},
+	Action: func(clictx *cli.Context) error {
+		var urls []string
+		if url := clictx.String("url"); url != "" {
+			urls = []string{url}
+		} else {
+			urls = findJobServerURLs()
+			if info, err := client.ReadDaemonInfo(); err == nil {
+				urls = append([]string{info.URL}, urls...)
+			}
+		}
+		if len(urls) == 0 {
+			return cli.Exit("No running job server was found.", 1)
+		}
+
+		enc := json.NewEncoder(clictx.App.Writer)
+		enc.SetIndent("", "  ")
+
+		var errs []error
+		for _, url := range urls {
+			res, err := requestStatus(clictx.Context, url)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", client.RedactURL(url), err))
+				continue
+			}
+			if clictx.Bool("json") {
+				err = enc.Encode(struct {
+					URL string `json:"url"`
+					*status.Response
+				}{URL: client.RedactURL(url), Response: res})
+			} else {
+				err = printStatus(clictx.App.Writer, client.RedactURL(url), res)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if len(errs) != 0 {
+			return cli.Exit(errors.Join(errs...), 1)
+		}
+		return nil
+	},
+}
+
+// findJobServerURLs returns the URLs of the job servers advertised by URL files
+// in go build work directories.
+func findJobServerURLs() []string {
+	dirs := []string{os.TempDir()}
+	if dir := os.Getenv("GOTMPDIR"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+
+	var urls []string
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "go-build*", client.URLFileName))
+		for _, match := range matches {
+			data, err := os.ReadFile(match)
+			if err != nil || len(data) == 0 || slices.Contains(urls, string(data)) {
+				continue
+			}
+			urls = append(urls, string(data))
+		}
+	}
+	return urls
+}
+
+func requestStatus(ctx context.Context, url string) (*status.Response, error) {
+	conn, err := client.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return client.Request(ctx, conn, status.Request{})
+}
+
+func printStatus(w io.Writer, url string, res *status.Response) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Job server %s (pid %d, up %s)\n", url, res.PID, time.Since(res.StartedAt).Round(time.Second))
+
+	fmt.Fprintf(tw, "\nClients: %d\n", len(res.Clients))
+	for _, c := range res.Clients {
+		fmt.Fprintf(tw, "  #%d\t%s\n", c.ID, c.Name)
+	}
+
+	names := make([]string, 0, len(res.Caches))
+	for name := range res.Caches {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	fmt.Fprintln(tw, "\nCaches:")
+	for _, name := range names {
+		cache := res.Caches[name]
+		fmt.Fprintf(tw, "  %s\t%d hits of %d\t(%.1f%%)\n", name, cache.Hits, cache.Count, 100*cache.HitRate())
+	}
+
+	fmt.Fprintf(tw, "\nIn-flight builds: %d\n", len(res.InFlight))
+	for _, build := range res.InFlight {
+		fmt.Fprintf(tw, "  %s\t%s\n", build.ImportPath, time.Since(build.Since).Round(time.Millisecond))
+	}
+
+	if len(res.SlowestBuilds) != 0 {
+		fmt.Fprintln(tw, "\nSlowest builds:")
+		for _, timing := range res.SlowestBuilds {
+			fmt.Fprintf(tw, "  %s\t%s\n", timing.ImportPath, timing.Duration.Round(time.Millisecond))
+		}
+	}
+
+	fmt.Fprintf(tw, "\nWoven packages: %d (%s total)\n", res.Weaves.Count, res.Weaves.Total.Round(time.Millisecond))
+	for _, timing := range res.Weaves.Slowest {
+		fmt.Fprintf(tw, "  %s\t%s\n", timing.ImportPath, timing.Duration.Round(time.Millisecond))
+	}
+	fmt.Fprintln(tw)
+
+	return tw.Flush()
+}
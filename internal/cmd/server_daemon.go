@@ -0,0 +1,149 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/filelock"
+	"github.com/DataDog/orchestrion/internal/jobserver"
+	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/version"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+// daemonReplaceTimeout is the maximum time to wait for a daemon job server
+// running a different version of orchestrion to shut down.
+const daemonReplaceTimeout = 10 * time.Second
+
+// startDaemon starts the user-level daemon job server, which is discovered by
+// clients using the well-known files in [client.DaemonDir]. If a daemon is
+// already running the same version of orchestrion, it is left alone; if it is
+// running a different version, it is asked to shut down and is replaced.
+func startDaemon(ctx context.Context, w io.Writer, opts *jobserver.Options) cli.ExitCoder {
+	log := zerolog.Ctx(ctx)
+
+	if runtime.GOOS == "windows" {
+		// Windows does not restrict access to Unix domain sockets based on file system permissions.
+		return cli.Exit("The daemon job server is not supported on Windows.", 2)
+	}
+
+	dir := client.DaemonDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return cli.Exit(fmt.Errorf("creating %q: %w", dir, err), 1)
+	}
+	// The directory may pre-exist with broader permissions; this fails if it is owned by another user.
+	if err := os.Chmod(dir, 0o700); err != nil {
+		return cli.Exit(fmt.Errorf("restricting access to %q: %w", dir, err), 1)
+	}
+	// Clients refuse to use a daemon whose directory could have been tampered with (e.g, it is a symbolic link, or is
+	// owned by another user and we are privileged enough to change its mode anyway).
+	if err := client.CheckDaemonDir(); err != nil {
+		return cli.Exit(err, 1)
+	}
+
+	// The lock is only held while starting up, so that concurrent invocations don't both start a daemon.
+	lock := filelock.MutexAt(filepath.Join(dir, "jobserver.lock"))
+	if err := lock.Lock(ctx); err != nil {
+		return cli.Exit(fmt.Errorf("failed to acquire lock in %q: %w", dir, err), 1)
+	}
+	unlock := sync.OnceFunc(func() {
+		if err := lock.Unlock(ctx); err != nil {
+			log.Warn().Err(err).Str("dir", dir).Msg("Failed to release daemon lock")
+		}
+	})
+	defer unlock()
+
+	c, info, err := client.ConnectDaemon()
+	switch {
+	case err == nil:
+		c.Close()
+		_, err := fmt.Fprintf(w, "A daemon job server is already running (pid %d).\n", info.PID)
+		if err != nil {
+			return cli.Exit(err, 1)
+		}
+		return nil
+	case errors.Is(err, client.ErrDaemonVersionMismatch):
+		log.Info().Str("version", info.Version).Int("pid", info.PID).Msg("Replacing daemon job server running a different version")
+		if err := replaceDaemon(ctx, info); err != nil {
+			return cli.Exit(fmt.Errorf("failed to shut down the daemon job server (pid %d) running %s: %w", info.PID, info.Version, err), 1)
+		}
+	case errors.Is(err, client.ErrDaemonUntrusted):
+		// The directory is ours, but the information file has unexpected permissions; it'll be replaced by ours.
+		log.Warn().Err(err).Msg("Ignoring untrusted daemon job server information")
+	case !errors.Is(err, client.ErrNoServerAvailable):
+		// The information file is unreadable (or stale); it'll be replaced by ours.
+		log.Warn().Err(err).Msg("Ignoring invalid daemon job server information")
+	}
+
+	opts.UnixSocket = true
+	opts.SocketPath = client.DaemonSocket()
+	opts.Daemon = true
+	server, exitErr := start(ctx, opts, false)
+	if exitErr != nil {
+		return exitErr
+	}
+
+	infoFile := client.DaemonInfoFile()
+	cancelDeleteOnInterrupt := deleteOnInterrupt(ctx, infoFile)
+	defer cancelDeleteOnInterrupt()
+	defer os.Remove(infoFile)
+
+	if err := client.WriteDaemonInfo(&client.DaemonInfo{URL: server.ClientURL(), Version: version.Tag(), PID: os.Getpid()}); err != nil {
+		server.Shutdown()
+		return cli.Exit(fmt.Errorf("failed to write %q: %w", infoFile, err), 1)
+	}
+	log.Info().Str("url", client.RedactURL(server.ClientURL())).Msg("Daemon job server ready")
+	unlock()
+
+	// Removing the information file is the conventional way to stop the daemon.
+	cancelShutdownOnRemove := shutdownOnRemove(ctx, server, infoFile)
+	defer cancelShutdownOnRemove()
+
+	server.WaitForShutdown()
+	return nil
+}
+
+// replaceDaemon asks the daemon job server described by info to shut down,
+// and waits for it to have removed its information file.
+func replaceDaemon(ctx context.Context, info *client.DaemonInfo) error {
+	ctx, cancel := context.WithTimeout(ctx, daemonReplaceTimeout)
+	defer cancel()
+
+	c, err := client.Connect(info.URL)
+	if err != nil {
+		// The daemon is no longer reachable, so it has most likely died.
+		return nil
+	}
+	defer c.Close()
+
+	if _, err := client.Request(ctx, c, jobserver.ShutdownRequest{}); err != nil {
+		return err
+	}
+
+	const retryDelay = 100 * time.Millisecond
+	for {
+		current, err := client.ReadDaemonInfo()
+		if errors.Is(err, client.ErrNoServerAvailable) || (err == nil && current.PID != info.PID) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryDelay):
+		}
+	}
+}
@@ -6,10 +6,13 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
 	"github.com/DataDog/orchestrion/internal/pin"
@@ -30,7 +33,13 @@ var Toolexec = &cli.Command{
 		log := zerolog.Ctx(clictx.Context)
 		importPath := os.Getenv("TOOLEXEC_IMPORTPATH")
 
-		span, ctx := tracer.StartSpanFromContext(clictx.Context, "toolexec",
+		// If the build is aborted, cancel any in-flight job server request, so that the job server
+		// stops spawning child builds on our behalf. A second signal terminates the process as usual.
+		ctx, stop := signal.NotifyContext(clictx.Context, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		context.AfterFunc(ctx, stop)
+
+		span, ctx := tracer.StartSpanFromContext(ctx, "toolexec",
 			tracer.ResourceName(strings.Join(clictx.Args().Slice(), " ")),
 		)
 		defer func() { span.Finish(tracer.WithError(resErr)) }()
@@ -0,0 +1,136 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/overlay"
+	"github.com/DataDog/orchestrion/internal/vet"
+	"github.com/DataDog/orchestrion/internal/weavecache"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	Vet = &cli.Command{
+		Name:  "vet",
+		Usage: "Runs the go vet analyzers over woven source code, reporting diagnostics against the original source files",
+		UsageText: "orchestrion vet [build flags] [packages]\n\n" +
+			"Findings in code woven by orchestrion are reported at the closest preceding location of the original\n" +
+			"source file. The exit code is 1 if any finding was reported.",
+		Args:            true,
+		SkipFlagParsing: true,
+		Action: func(clictx *cli.Context) (err error) {
+			span, ctx := tracer.StartSpanFromContext(clictx.Context, "vet",
+				tracer.ResourceName(strings.Join(clictx.Args().Slice(), " ")),
+			)
+			defer func() { span.Finish(tracer.WithError(err)) }()
+
+			diags, err := vet.Run(ctx, clictx.Args().Slice())
+			if err != nil {
+				return cli.Exit(err, -1)
+			}
+			for _, diag := range diags {
+				fmt.Fprintln(clictx.App.ErrWriter, diag)
+			}
+			if len(diags) != 0 {
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+
+	GoplsOverlay = &cli.Command{
+		Name:  "gopls-overlay",
+		Usage: "Weaves packages into a persistent overlay, so that gopls and other tools can see woven code",
+		UsageText: "orchestrion gopls-overlay [--out=<dir>] [build flags] [packages]\n\n" +
+			"Packages (including their tests) are woven into <dir> (by default, a directory within orchestrion's cache\n" +
+			"that is specific to the working directory), and the path to the resulting overlay file is printed. It can\n" +
+			"be used with the -overlay flag of the go command, for example in gopls' \"build.buildFlags\" setting.\n" +
+			"The --out directory must not exist, be empty, or have been written by a previous orchestrion gopls-overlay.",
+		Args:            true,
+		SkipFlagParsing: true,
+		Action: func(clictx *cli.Context) (err error) {
+			span, ctx := tracer.StartSpanFromContext(clictx.Context, "gopls-overlay",
+				tracer.ResourceName(strings.Join(clictx.Args().Slice(), " ")),
+			)
+			defer func() { span.Finish(tracer.WithError(err)) }()
+
+			dir, args, err := parseOut(clictx.Args().Slice())
+			if err != nil {
+				return cli.Exit(err, 2)
+			}
+			if dir == "" {
+				if dir, err = defaultGoplsOverlayDir(); err != nil {
+					return cli.Exit(err, -1)
+				}
+			}
+
+			ov, err := overlay.PrepareDir(ctx, dir, append([]string{"test"}, args...))
+			if err != nil {
+				return cli.Exit(err, -1)
+			}
+			// Recent go toolchains refuse overlays that replace files of the module
+			// cache.
+			wd, err := os.Getwd()
+			if err != nil {
+				return cli.Exit(err, -1)
+			}
+			modCache, err := goenv.GOMODCACHE(wd)
+			if err != nil {
+				return cli.Exit(err, -1)
+			}
+			if err := ov.Exclude(modCache); err != nil {
+				return cli.Exit(err, -1)
+			}
+			fmt.Fprintln(clictx.App.Writer, ov.File)
+			return nil
+		},
+	}
+)
+
+// parseOut extracts the --out flag from the leading arguments, and returns its
+// value (blank if absent) together with the remaining arguments.
+func parseOut(args []string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", args, nil
+	}
+
+	switch arg := args[0]; {
+	case arg == "--out":
+		if len(args) < 2 {
+			return "", nil, errors.New("missing value for the --out flag")
+		}
+		return args[1], args[2:], nil
+	case strings.HasPrefix(arg, "--out="):
+		return strings.TrimPrefix(arg, "--out="), args[1:], nil
+	default:
+		return "", args, nil
+	}
+}
+
+// defaultGoplsOverlayDir returns the directory within orchestrion's cache
+// where the gopls overlay for the current working directory is written.
+func defaultGoplsOverlayDir() (string, error) {
+	root, err := weavecache.Root()
+	if err != nil {
+		return "", err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(wd))
+	return filepath.Join(root, "gopls", hex.EncodeToString(sum[:8])), nil
+}
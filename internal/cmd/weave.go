@@ -0,0 +1,138 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/weave"
+	"github.com/urfave/cli/v2"
+)
+
+var Weave = &cli.Command{
+	Name:      "weave",
+	Usage:     "Weaves a single package without using the go command, for use by other build systems (e.g, Bazel)",
+	ArgsUsage: "<file.go>...",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "importpath",
+			Usage:    "The import path of the package being woven.",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "importcfg",
+			Usage:    "The importcfg file listing the archives of the package's dependencies.",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "out",
+			Usage:    "The directory where woven files are written.",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "manifest",
+			Usage: "The file where the manifest describing the woven files and their new dependencies is written. (default: " + weave.ManifestFilename + " in the output directory)",
+		},
+		&cli.StringFlag{
+			Name:  "config",
+			Usage: "The directory containing the orchestrion.tool.go and orchestrion.yml configuration files.",
+			Value: ".",
+		},
+		&cli.StringSliceFlag{
+			Name:  "package",
+			Usage: "An <import-path>=<dir> mapping used to locate packages referenced by the configuration. Can be specified multiple times.",
+		},
+		&cli.StringSliceFlag{
+			Name:  "module",
+			Usage: "A <module-path>=<version> mapping used to evaluate module requirements of aspects and configuration. Can be specified multiple times.",
+		},
+		&cli.StringFlag{
+			Name:  "lang",
+			Usage: "The Go language version the package is compiled with (e.g, go1.22).",
+		},
+		&cli.BoolFlag{
+			Name:  "test-main",
+			Usage: "Set when weaving the generated test main package.",
+		},
+		&cli.StringFlag{
+			Name:    "goos",
+			Usage:   "The operating system the package is compiled for.",
+			EnvVars: []string{"GOOS"},
+			Value:   runtime.GOOS,
+		},
+		&cli.StringFlag{
+			Name:    "goarch",
+			Usage:   "The architecture the package is compiled for.",
+			EnvVars: []string{"GOARCH"},
+			Value:   runtime.GOARCH,
+		},
+		&cli.BoolFlag{
+			Name:    "cgo",
+			Usage:   "Whether cgo is enabled for the package.",
+			EnvVars: []string{"CGO_ENABLED"},
+			Value:   true,
+		},
+		&cli.StringSliceFlag{
+			Name:  "tags",
+			Usage: "A custom build tag the package is compiled with. Can be specified multiple times.",
+		},
+	},
+	Action: func(clictx *cli.Context) (err error) {
+		span, ctx := tracer.StartSpanFromContext(clictx.Context, "weave",
+			tracer.ResourceName(clictx.String("importpath")),
+		)
+		defer func() { span.Finish(tracer.WithError(err)) }()
+
+		if clictx.NArg() == 0 {
+			return cli.Exit(errors.New("expected at least one <file.go> argument"), 2)
+		}
+		packageDirs, err := parseMapping(clictx.StringSlice("package"))
+		if err != nil {
+			return cli.Exit(fmt.Errorf("--package: %w", err), 2)
+		}
+		modules, err := parseMapping(clictx.StringSlice("module"))
+		if err != nil {
+			return cli.Exit(fmt.Errorf("--module: %w", err), 2)
+		}
+
+		return weave.Weave(ctx, weave.Options{
+			ImportPath:  clictx.String("importpath"),
+			ImportCfg:   clictx.String("importcfg"),
+			GoFiles:     clictx.Args().Slice(),
+			OutDir:      clictx.String("out"),
+			Manifest:    clictx.String("manifest"),
+			ConfigDir:   clictx.String("config"),
+			PackageDirs: packageDirs,
+			Modules:     modules,
+			GoVersion:   clictx.String("lang"),
+			TestMain:    clictx.Bool("test-main"),
+			Target: goenv.Target{
+				GOOS:       clictx.String("goos"),
+				GOARCH:     clictx.String("goarch"),
+				CgoEnabled: clictx.Bool("cgo"),
+				Tags:       clictx.StringSlice("tags"),
+			},
+		})
+	},
+}
+
+// parseMapping parses a list of `<key>=<value>` entries.
+func parseMapping(entries []string) (map[string]string, error) {
+	res := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		key, val, ok := strings.Cut(entry, "=")
+		if !ok || key == "" || val == "" {
+			return nil, fmt.Errorf("invalid entry %q, expected <key>=<value>", entry)
+		}
+		res[key] = val
+	}
+	return res, nil
+}
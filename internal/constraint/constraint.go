@@ -0,0 +1,166 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package constraint implements parsing and evaluation of semantic version
+// constraints such as `>= v1.2.0, < v2`.
+package constraint
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/DataDog/orchestrion/internal/fingerprint"
+	"github.com/DataDog/orchestrion/internal/yaml"
+	"github.com/goccy/go-yaml/ast"
+	"golang.org/x/mod/semver"
+)
+
+// Constraint is a conjunction of version comparisons. The zero value is
+// satisfied by any version.
+type Constraint struct {
+	clauses []clause
+	text    string
+}
+
+type clause struct {
+	op      operator
+	version string
+}
+
+type operator string
+
+const (
+	opEQ operator = "="
+	opNE operator = "!="
+	opGT operator = ">"
+	opGE operator = ">="
+	opLT operator = "<"
+	opLE operator = "<="
+)
+
+// Parse parses a comma-separated list of comparisons, each made of an optional
+// operator (one of `=`, `==`, `!=`, `>`, `>=`, `<`, `<=`; defaults to `=`)
+// followed by a semantic version. The leading `v` of versions is optional, and
+// partial versions such as `v1.2` are accepted.
+func Parse(text string) (Constraint, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return Constraint{}, fmt.Errorf("invalid version constraint %q: empty constraint", text)
+	}
+
+	parts := strings.Split(text, ",")
+	clauses := make([]clause, len(parts))
+	for idx, part := range parts {
+		part = strings.TrimSpace(part)
+
+		var op operator
+		for _, candidate := range []operator{opGE, opLE, opNE, "==", opGT, opLT, opEQ} {
+			if rest, found := strings.CutPrefix(part, string(candidate)); found {
+				op, part = candidate, strings.TrimSpace(rest)
+				break
+			}
+		}
+		switch op {
+		case "", "==":
+			op = opEQ
+		}
+
+		version := part
+		if !strings.HasPrefix(version, "v") {
+			version = "v" + version
+		}
+		if !semver.IsValid(version) {
+			return Constraint{}, fmt.Errorf("invalid version constraint %q: %q is not a valid semantic version", text, part)
+		}
+
+		clauses[idx] = clause{op: op, version: version}
+	}
+
+	return Constraint{clauses: clauses, text: text}, nil
+}
+
+// MustParse is like [Parse] but panics if the constraint cannot be parsed.
+func MustParse(text string) Constraint {
+	c, err := Parse(text)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Check returns true if version satisfies all comparisons of this constraint.
+// Invalid versions never satisfy a non-zero constraint.
+func (c Constraint) Check(version string) bool {
+	if len(c.clauses) == 0 {
+		return true
+	}
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	if !semver.IsValid(version) {
+		return false
+	}
+
+	for _, cl := range c.clauses {
+		cmp := semver.Compare(version, cl.version)
+		var ok bool
+		switch cl.op {
+		case opEQ:
+			ok = cmp == 0
+		case opNE:
+			ok = cmp != 0
+		case opGT:
+			ok = cmp > 0
+		case opGE:
+			ok = cmp >= 0
+		case opLT:
+			ok = cmp < 0
+		case opLE:
+			ok = cmp <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// IsZero returns true if this constraint has no comparisons, and is hence
+// satisfied by any version.
+func (c Constraint) IsZero() bool {
+	return len(c.clauses) == 0
+}
+
+// String returns the text this constraint was parsed from.
+func (c Constraint) String() string {
+	return c.text
+}
+
+func (c Constraint) Hash(h *fingerprint.Hasher) error {
+	return h.Named(
+		"constraint",
+		fingerprint.Cast(c.clauses, func(cl clause) fingerprint.String {
+			return fingerprint.String(string(cl.op) + cl.version)
+		}),
+	)
+}
+
+func (c *Constraint) UnmarshalYAML(ctx context.Context, node ast.Node) error {
+	var text string
+	if err := yaml.NodeToValueContext(ctx, node, &text); err != nil {
+		return err
+	}
+
+	parsed, err := Parse(text)
+	if err != nil {
+		return err
+	}
+
+	*c = parsed
+	return nil
+}
+
+var _ yaml.NodeUnmarshalerContext = (*Constraint)(nil)
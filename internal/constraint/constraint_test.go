@@ -0,0 +1,81 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package constraint_test
+
+import (
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/constraint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	for _, text := range []string{"", ">=", ">= banana", "v1.2.0,", "~> v1.2"} {
+		t.Run(text, func(t *testing.T) {
+			_, err := constraint.Parse(text)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	type testCase struct {
+		constraint string
+		matches    []string
+		rejects    []string
+	}
+	for _, tc := range []testCase{
+		{
+			constraint: ">= v1.2.0",
+			matches:    []string{"v1.2.0", "v1.2.1", "v2.0.0", "1.3.0", "v1.4.0-rc.3+devel"},
+			rejects:    []string{"v1.1.9", "v1.2.0-rc.1", "not-a-version"},
+		},
+		{
+			constraint: ">= 5.1",
+			matches:    []string{"v5.1.0", "v5.2.1"},
+			rejects:    []string{"v5.0.12", "v4.9.9"},
+		},
+		{
+			constraint: ">= v1.2.0, < v2",
+			matches:    []string{"v1.2.0", "v1.99.0"},
+			rejects:    []string{"v1.1.0", "v2.0.0", "v2.0.1"},
+		},
+		{
+			constraint: "v1.2.3",
+			matches:    []string{"v1.2.3"},
+			rejects:    []string{"v1.2.4"},
+		},
+		{
+			constraint: "== 1.2.3",
+			matches:    []string{"v1.2.3"},
+			rejects:    []string{"v1.2.2"},
+		},
+		{
+			constraint: "!= v1.2.3, <= v1.3.0, > v1.0.0",
+			matches:    []string{"v1.2.2", "v1.3.0"},
+			rejects:    []string{"v1.2.3", "v1.3.1", "v1.0.0"},
+		},
+	} {
+		t.Run(tc.constraint, func(t *testing.T) {
+			c, err := constraint.Parse(tc.constraint)
+			require.NoError(t, err)
+			assert.Equal(t, tc.constraint, c.String())
+			for _, v := range tc.matches {
+				assert.True(t, c.Check(v), "%q should satisfy %q", v, tc.constraint)
+			}
+			for _, v := range tc.rejects {
+				assert.False(t, c.Check(v), "%q should not satisfy %q", v, tc.constraint)
+			}
+		})
+	}
+
+	t.Run("zero", func(t *testing.T) {
+		var c constraint.Constraint
+		assert.True(t, c.IsZero())
+		assert.True(t, c.Check("v0.0.1"))
+	})
+}
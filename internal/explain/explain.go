@@ -0,0 +1,258 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package explain implements the `orchestrion explain` command, which reports
+// how each configured aspect evaluates against a given source location.
+package explain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/injector"
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/join"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/may"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	toolexecaspect "github.com/DataDog/orchestrion/internal/toolexec/aspect"
+	"github.com/rs/zerolog"
+	"golang.org/x/tools/go/packages"
+)
+
+type Options struct {
+	// Writer is the writer to send output of the command to. Defaults to
+	// [os.Stdout].
+	Writer io.Writer
+	// Location is the source location to explain, in the `<file>:<line>` format.
+	Location string
+	// AspectIDs restricts the output to the aspects with the specified IDs. All
+	// aspects are reported if empty.
+	AspectIDs []string
+	// Verbose enables printing the full evaluation tree of each join point, as
+	// opposed to only a single summary line per aspect. It is implied when
+	// [Options.AspectIDs] is not empty.
+	Verbose bool
+}
+
+// Explain loads the project's configuration, parses and type-checks the
+// package containing the requested location, and reports how each aspect
+// evaluates against the AST nodes starting at that location.
+func Explain(ctx context.Context, opts Options) (err error) {
+	span, ctx := tracer.StartSpanFromContext(ctx, "explain",
+		tracer.ResourceName(opts.Location),
+	)
+	defer func() { span.Finish(tracer.WithError(err)) }()
+
+	if opts.Writer == nil {
+		opts.Writer = os.Stdout
+	}
+	log := zerolog.Ctx(ctx)
+
+	filename, line, err := parseLocation(opts.Location)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(filename)
+
+	goMod, err := goenv.GOMOD(dir)
+	if err != nil {
+		return fmt.Errorf("go env GOMOD: %w", err)
+	}
+	cfg, err := config.NewLoader(nil, filepath.Dir(goMod), false).Load(ctx)
+	if err != nil {
+		return fmt.Errorf("loading injector configuration: %w", err)
+	}
+	aspects := cfg.Aspects()
+	if len(opts.AspectIDs) > 0 {
+		aspects = slices.DeleteFunc(aspects, func(a *aspect.Aspect) bool {
+			return !slices.Contains(opts.AspectIDs, a.ID)
+		})
+		if len(aspects) == 0 {
+			return fmt.Errorf("no aspect matches the requested IDs: %s", strings.Join(opts.AspectIDs, ", "))
+		}
+		opts.Verbose = true
+	}
+
+	pkg, err := loadPackage(ctx, dir, filename)
+	if err != nil {
+		return err
+	}
+	log.Debug().Str("import-path", pkg.PkgPath).Str("id", pkg.ID).Msg("Loaded package containing the target file")
+
+	inj := injector.Injector{
+		ImportPath: pkg.PkgPath,
+		Name:       pkg.Name,
+		ImportMap:  make(map[string]string, len(pkg.Imports)),
+		Lookup:     lookup(pkg),
+		RootConfig: toolexecaspect.RootConfig,
+	}
+	if pkg.Module != nil && pkg.Module.GoVersion != "" {
+		inj.GoVersion = "go" + pkg.Module.GoVersion
+	}
+	for path, dep := range pkg.Imports {
+		inj.ImportMap[path] = dep.ExportFile
+	}
+
+	results, err := inj.Explain(ctx, pkg.GoFiles, filename, line, aspects)
+	if err != nil {
+		return err
+	}
+
+	return report(opts, pkg.PkgPath, results)
+}
+
+// parseLocation splits a `<file>:<line>` location into its components. The
+// returned filename is absolute.
+func parseLocation(location string) (string, int, error) {
+	idx := strings.LastIndexByte(location, ':')
+	if idx < 0 {
+		return "", 0, fmt.Errorf("invalid location %q: expected <file>:<line>", location)
+	}
+	line, err := strconv.Atoi(location[idx+1:])
+	if err != nil || line < 1 {
+		return "", 0, fmt.Errorf("invalid location %q: %q is not a valid line number", location, location[idx+1:])
+	}
+	filename, err := filepath.Abs(location[:idx])
+	if err != nil {
+		return "", 0, fmt.Errorf("resolving %q: %w", location[:idx], err)
+	}
+	if _, err := os.Stat(filename); err != nil {
+		return "", 0, err
+	}
+	return filename, line, nil
+}
+
+// loadPackage loads the package (or test package variant) that contains the
+// specified file, together with the export data of all its dependencies.
+func loadPackage(ctx context.Context, dir string, filename string) (*packages.Package, error) {
+	pkgs, err := packages.Load(
+		&packages.Config{
+			Context: ctx,
+			Dir:     dir,
+			Mode:    packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps | packages.NeedExportFile | packages.NeedModule,
+			Tests:   strings.HasSuffix(filename, "_test.go"),
+			// Make sure we're type-checking against un-instrumented dependencies.
+			BuildFlags: []string{"-toolexec="},
+		},
+		".",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("loading package in %q: %w", dir, err)
+	}
+
+	var errs []error
+	for _, pkg := range pkgs {
+		for _, err := range pkg.Errors {
+			errs = append(errs, err)
+		}
+		if slices.Contains(pkg.GoFiles, filename) {
+			return pkg, nil
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return nil, fmt.Errorf("no package in %q contains %q (is it excluded by build constraints?)", dir, filename)
+}
+
+// lookup returns an [importer.Lookup] function that resolves the export data
+// of all transitive dependencies of pkg.
+func lookup(pkg *packages.Package) func(string) (io.ReadCloser, error) {
+	exports := make(map[string]string)
+	packages.Visit([]*packages.Package{pkg}, nil, func(dep *packages.Package) {
+		if dep != pkg && dep.ExportFile != "" {
+			exports[dep.PkgPath] = dep.ExportFile
+		}
+	})
+	return func(path string) (io.ReadCloser, error) {
+		file, found := exports[path]
+		if !found {
+			return nil, fmt.Errorf("no export data found for %q", path)
+		}
+		return os.Open(file)
+	}
+}
+
+func report(opts Options, importPath string, results []injector.AspectExplanation) error {
+	w := &errWriter{w: opts.Writer}
+
+	w.printf("Package %s (%s)\n", importPath, opts.Location)
+	if len(results) > 0 && len(results[0].Nodes) == 0 {
+		w.printf("No AST node starts on this line; only package and file pre-filters are reported.\n")
+	}
+
+	for _, res := range results {
+		status := "no"
+		if res.Matched() {
+			status = "yes"
+		} else if slices.ContainsFunc(res.Nodes, func(n injector.NodeExplanation) bool { return n.Ignored && n.Evaluation.Matched }) {
+			status = "ignored"
+		}
+		w.printf("%s\n  package: %s  file: %s  matches: %s\n", res.Aspect.ID, describeMatch(res.PackageMayMatch), describeMatch(res.FileMayMatch), status)
+
+		if !opts.Verbose {
+			continue
+		}
+		for _, node := range res.Nodes {
+			var suffix string
+			if node.Ignored {
+				suffix = " (//orchestrion:ignore)"
+			}
+			w.printf("  %T at %d:%d%s\n", node.Node, node.Position.Line, node.Position.Column, suffix)
+			printEvaluation(w, node.Evaluation, 2)
+		}
+	}
+
+	return w.err
+}
+
+func describeMatch(m may.MatchType) string {
+	switch m {
+	case may.Match:
+		return "yes"
+	case may.NeverMatch:
+		return "no"
+	default:
+		return "maybe"
+	}
+}
+
+func printEvaluation(w *errWriter, eval join.Evaluation, depth int) {
+	mark := "✗"
+	if eval.Matched {
+		mark = "✓"
+	}
+	var suffix string
+	if eval.Culprit {
+		suffix = "  <-- first failing condition"
+	}
+	w.printf("%s%s %s%s\n", strings.Repeat("  ", depth), mark, eval.Description, suffix)
+	for _, child := range eval.Children {
+		printEvaluation(w, child, depth+1)
+	}
+}
+
+// errWriter is an [io.Writer] wrapper that retains the first error
+// encountered, so that it can be checked only once all output was written.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *errWriter) printf(format string, args ...any) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, args...)
+}
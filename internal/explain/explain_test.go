@@ -0,0 +1,78 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package explain_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/explain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "off")
+
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.23\n",
+		"main.go": "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n",
+		"orchestrion.yml": `aspects:
+  - id: main-body
+    join-point: { function-body: { function: [{ name: main }] } }
+    advice:
+      - prepend-statements: { template: println("woven") }
+  - id: other-body
+    join-point: { function-body: { function: [{ name: other }] } }
+    advice:
+      - prepend-statements: { template: println("woven") }
+`,
+	})
+	location := filepath.Join(tmp, "main.go") + ":3"
+
+	t.Run("summary", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, explain.Explain(context.Background(), explain.Options{Writer: &out, Location: location}))
+
+		assert.Equal(t, "Package example.com/app ("+location+")\n"+
+			"main-body\n  package: maybe  file: yes  matches: yes\n"+
+			"other-body\n  package: maybe  file: no  matches: no\n",
+			out.String())
+	})
+
+	t.Run("aspect", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, explain.Explain(context.Background(), explain.Options{Writer: &out, Location: location, AspectIDs: []string{"other-body"}}))
+
+		assert.NotContains(t, out.String(), "main-body")
+		assert.Contains(t, out.String(), "other-body\n")
+		assert.Contains(t, out.String(), "<-- first failing condition")
+	})
+
+	t.Run("no such aspect", func(t *testing.T) {
+		err := explain.Explain(context.Background(), explain.Options{Writer: &bytes.Buffer{}, Location: location, AspectIDs: []string{"missing"}})
+		require.ErrorContains(t, err, "no aspect matches the requested IDs: missing")
+	})
+
+	t.Run("invalid location", func(t *testing.T) {
+		err := explain.Explain(context.Background(), explain.Options{Writer: &bytes.Buffer{}, Location: filepath.Join(tmp, "main.go")})
+		require.ErrorContains(t, err, "expected <file>:<line>")
+	})
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0o755))
+		require.NoError(t, os.WriteFile(filename, []byte(content), 0o644))
+	}
+}
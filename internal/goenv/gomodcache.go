@@ -0,0 +1,30 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package goenv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// GOMODCACHE returns the path to the module cache used in the provided
+// directory (from running `go env GOMODCACHE`).
+func GOMODCACHE(dir string) (string, error) {
+	cmd := exec.Command("go", "env", "GOMODCACHE")
+	cmd.Dir = dir
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running %q: %w", cmd.Args, err)
+	}
+	if modCache := strings.TrimSpace(stdout.String()); modCache != "" {
+		return modCache, nil
+	}
+	return "", errors.New("`go env GOMODCACHE` returned a blank string")
+}
@@ -0,0 +1,80 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package goenv
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// GOWORK returns the path to the `go.work` file in use in the provided
+// directory (from running `go env GOWORK`), or a blank string if workspace mode
+// is not enabled there.
+func GOWORK(dir string) (string, error) {
+	cmd := exec.Command("go", "env", "GOWORK")
+	cmd.Dir = dir
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running %q: %w", cmd.Args, err)
+	}
+	if goWork := strings.TrimSpace(stdout.String()); goWork != "" && goWork != "off" {
+		return goWork, nil
+	}
+	return "", nil
+}
+
+// WorkspaceModules returns the absolute paths to the directories of all
+// modules listed in `use` directives of the designated `go.work` file, in the
+// order they are listed.
+func WorkspaceModules(goWork string) ([]string, error) {
+	data, err := os.ReadFile(goWork)
+	if err != nil {
+		return nil, err
+	}
+	work, err := modfile.ParseWork(goWork, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", goWork, err)
+	}
+
+	root := filepath.Dir(goWork)
+	dirs := make([]string, 0, len(work.Use))
+	for _, use := range work.Use {
+		dir := filepath.FromSlash(use.Path)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(root, dir)
+		}
+		dirs = append(dirs, filepath.Clean(dir))
+	}
+	return dirs, nil
+}
+
+// OwningModule returns the directory of the module that contains the provided
+// file, out of the provided module directories, or a blank string if none of
+// them does. When modules are nested, the innermost one is returned.
+func OwningModule(moduleDirs []string, filename string) string {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return ""
+	}
+
+	var owner string
+	for _, dir := range moduleDirs {
+		if rel, err := filepath.Rel(dir, filename); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(dir) > len(owner) {
+			owner = dir
+		}
+	}
+	return owner
+}
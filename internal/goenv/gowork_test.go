@@ -0,0 +1,46 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package goenv
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspace(t *testing.T) {
+	// Workspace mode is not available with `-mod=mod`.
+	t.Setenv("GOFLAGS", "")
+
+	tmp := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "go.work"), []byte("go 1.23\n\nuse (\n\t./b\n\t./a\n\t./a/nested\n)\n"), 0o644))
+	for _, dir := range []string{"a", "b", filepath.Join("a", "nested")} {
+		require.NoError(t, os.MkdirAll(filepath.Join(tmp, dir), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, dir, "go.mod"), []byte("module example.com/"+filepath.ToSlash(dir)+"\n\ngo 1.23\n"), 0o644))
+	}
+
+	goWork, err := GOWORK(filepath.Join(tmp, "a"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(tmp, "go.work"), goWork)
+
+	modules, err := WorkspaceModules(goWork)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(tmp, "b"), filepath.Join(tmp, "a"), filepath.Join(tmp, "a", "nested")}, modules)
+
+	assert.Equal(t, filepath.Join(tmp, "a"), OwningModule(modules, filepath.Join(tmp, "a", "main.go")))
+	assert.Equal(t, filepath.Join(tmp, "a", "nested"), OwningModule(modules, filepath.Join(tmp, "a", "nested", "pkg", "pkg.go")))
+	assert.Empty(t, OwningModule(modules, filepath.Join(tmp, "ab", "main.go")))
+
+	t.Run("off", func(t *testing.T) {
+		t.Setenv("GOWORK", "off")
+		goWork, err := GOWORK(filepath.Join(tmp, "a"))
+		require.NoError(t, err)
+		assert.Empty(t, goWork)
+	})
+}
@@ -0,0 +1,124 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package goenv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/DataDog/orchestrion/internal/fingerprint"
+)
+
+// Target describes the platform packages are built for, and the custom build
+// tags in effect. Together, these determine which files are part of packages.
+type Target struct {
+	GOOS       string   `json:"goos"`
+	GOARCH     string   `json:"goarch"`
+	CgoEnabled bool     `json:"cgo"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+// unixOS is the list of GOOS values satisfying the `unix` build constraint.
+var unixOS = []string{"aix", "android", "darwin", "dragonfly", "freebsd", "hurd", "illumos", "ios", "linux", "netbsd", "openbsd", "solaris"}
+
+// TargetOf returns the target of builds made from dir with the provided
+// environment (nil meaning the current process' environment), using the
+// provided custom build tags. The go command sets `GOOS`, `GOARCH` and
+// `CGO_ENABLED` in the environment of all processes it runs, so `go env` is only
+// invoked if any of these is missing from env.
+func TargetOf(dir string, env []string, tags []string) (Target, error) {
+	vals := map[string]string{"GOOS": "", "GOARCH": "", "CGO_ENABLED": ""}
+	missing := len(vals)
+	lookup := env
+	if lookup == nil {
+		lookup = os.Environ()
+	}
+	for _, kv := range lookup {
+		name, val, _ := strings.Cut(kv, "=")
+		if old, found := vals[name]; found && val != "" {
+			if old == "" {
+				missing--
+			}
+			vals[name] = val // The last occurrence wins, as with [os/exec.Cmd.Env]
+		}
+	}
+
+	if missing != 0 {
+		cmd := exec.Command("go", "env", "-json", "GOOS", "GOARCH", "CGO_ENABLED")
+		cmd.Dir = dir
+		cmd.Env = env
+		var stdout bytes.Buffer
+		cmd.Stdout = &stdout
+		if err := cmd.Run(); err != nil {
+			return Target{}, fmt.Errorf("running %q: %w", cmd.Args, err)
+		}
+		if err := json.Unmarshal(stdout.Bytes(), &vals); err != nil {
+			return Target{}, fmt.Errorf("parsing output of %q: %w", cmd.Args, err)
+		}
+	}
+
+	return Target{
+		GOOS:       vals["GOOS"],
+		GOARCH:     vals["GOARCH"],
+		CgoEnabled: vals["CGO_ENABLED"] == "1",
+		Tags:       slices.Clip(tags),
+	}, nil
+}
+
+// Env returns the environment variables that select this target's platform.
+func (t Target) Env() []string {
+	cgo := "0"
+	if t.CgoEnabled {
+		cgo = "1"
+	}
+	return []string{"GOOS=" + t.GOOS, "GOARCH=" + t.GOARCH, "CGO_ENABLED=" + cgo}
+}
+
+// BuildFlags returns the go command flags that select this target's custom
+// build tags.
+func (t Target) BuildFlags() []string {
+	if len(t.Tags) == 0 {
+		return nil
+	}
+	return []string{"-tags=" + strings.Join(t.Tags, ",")}
+}
+
+// HasTag returns true if the provided build tag is satisfied by this target,
+// following the same rules as `//go:build` constraints: the tag may be one of
+// the custom build tags, the target's GOOS or GOARCH, `unix` (on unix-like
+// systems), or `cgo` (when cgo is enabled).
+func (t Target) HasTag(tag string) bool {
+	switch tag {
+	case t.GOOS, t.GOARCH:
+		return true
+	case "unix":
+		return slices.Contains(unixOS, t.GOOS)
+	case "cgo":
+		return t.CgoEnabled
+	case "linux":
+		return t.GOOS == "android"
+	case "solaris":
+		return t.GOOS == "illumos"
+	case "darwin":
+		return t.GOOS == "ios"
+	default:
+		return slices.Contains(t.Tags, tag)
+	}
+}
+
+func (t Target) Hash(h *fingerprint.Hasher) error {
+	return h.Named("target",
+		fingerprint.String(t.GOOS),
+		fingerprint.String(t.GOARCH),
+		fingerprint.Bool(t.CgoEnabled),
+		fingerprint.Cast(t.Tags, func(tag string) fingerprint.String { return fingerprint.String(tag) }),
+	)
+}
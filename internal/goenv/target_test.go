@@ -0,0 +1,54 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package goenv
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetOf(t *testing.T) {
+	t.Run("from environment", func(t *testing.T) {
+		// The PATH is cleared so that `go env` cannot be run.
+		target, err := TargetOf(t.TempDir(), []string{"PATH=", "GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=1", "GOOS=windows"}, []string{"foo"})
+		require.NoError(t, err)
+		assert.Equal(t, Target{GOOS: "windows", GOARCH: "amd64", CgoEnabled: true, Tags: []string{"foo"}}, target)
+	})
+
+	t.Run("from go env", func(t *testing.T) {
+		target, err := TargetOf(t.TempDir(), append(os.Environ(), "GOOS=plan9", "GOARCH=arm", "CGO_ENABLED="), nil)
+		require.NoError(t, err)
+		assert.Equal(t, Target{GOOS: "plan9", GOARCH: "arm", CgoEnabled: false}, target)
+	})
+}
+
+func TestTarget(t *testing.T) {
+	target := Target{GOOS: "android", GOARCH: "arm64", CgoEnabled: true, Tags: []string{"foo", "bar"}}
+	assert.Equal(t, []string{"GOOS=android", "GOARCH=arm64", "CGO_ENABLED=1"}, target.Env())
+	assert.Equal(t, []string{"-tags=foo,bar"}, target.BuildFlags())
+	assert.Nil(t, Target{}.BuildFlags())
+
+	for tag, expected := range map[string]bool{
+		"android": true,
+		"linux":   true,
+		"unix":    true,
+		"arm64":   true,
+		"cgo":     true,
+		"foo":     true,
+		"bar":     true,
+		"windows": false,
+		"amd64":   false,
+		"darwin":  false,
+		"baz":     false,
+	} {
+		assert.Equal(t, expected, target.HasTag(tag), "tag %q", tag)
+	}
+	assert.False(t, Target{GOOS: "windows"}.HasTag("unix"))
+	assert.False(t, Target{GOOS: "linux"}.HasTag("cgo"))
+}
@@ -33,6 +33,7 @@ type CommandFlags struct {
 	Long    map[string]string
 	Short   map[string]struct{}
 	Unknown []string // flags we don't process but store anyway
+	Args    []string // positional arguments following the flags (e.g, package patterns)
 }
 
 var (
@@ -65,6 +66,18 @@ var (
 		"-tags":       {}, // Set build tags
 		"-toolexec":   {}, // Set the command to run around tool execution
 	}
+	// untrackedShortFlags are flags that do not take a value, and which are not
+	// tracked in [CommandFlags.Short] as they do not affect build outputs.
+	untrackedShortFlags = map[string]struct{}{
+		"-benchmem": {}, // Print memory allocation statistics for benchmarks (go test)
+		"-c":        {}, // Compile the test binary but do not run it (go test)
+		"-failfast": {}, // Do not start new tests after the first failure (go test)
+		"-json":     {}, // Print JSON output (go test)
+		"-n":        {}, // Print the commands but do not run them
+		"-short":    {}, // Tell long-running tests to shorten their run time (go test)
+		"-v":        {}, // Print the names of packages as they are compiled
+		"-x":        {}, // Print the commands
+	}
 )
 
 // Get returns the value of the specified long-form flag if present. The name is
@@ -74,11 +87,43 @@ func (f CommandFlags) Get(flag string) (val string, found bool) {
 	return
 }
 
+// Coverage returns true if the go command builds packages with coverage
+// instrumentation, which is the case if any of the `-cover`, `-covermode` or
+// `-coverpkg` flags is present.
+func (f CommandFlags) Coverage() bool {
+	if _, found := f.Short["-cover"]; found {
+		return true
+	}
+	if _, found := f.Long["-covermode"]; found {
+		return true
+	}
+	_, found := f.Long["-coverpkg"]
+	return found
+}
+
+// Tags returns the custom build tags set by the `-tags` flag. Like the go
+// command, it accepts comma-separated lists as well as the legacy
+// space-separated form.
+func (f CommandFlags) Tags() []string {
+	val := f.Long["-tags"]
+	sep := ","
+	if !strings.Contains(val, ",") {
+		sep = " "
+	}
+	var tags []string
+	for _, tag := range strings.Split(val, sep) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
 // Except returns a copy of this CommandFlags with the specified flags removed.
 // The [CommandFlags.Unknown] field is not modified, even if it is in the list
 // of flags to be removed.
 func (f CommandFlags) Except(remove ...string) CommandFlags {
-	res := CommandFlags{Unknown: f.Unknown}
+	res := CommandFlags{Unknown: f.Unknown, Args: f.Args}
 
 	res.Short = make(map[string]struct{}, len(f.Short))
 	for k, v := range f.Short {
@@ -118,6 +163,72 @@ func (f CommandFlags) Slice() []string {
 // and returns its flags. Direct arguments to the command are ignored. The value
 // of $GOFLAGS is also included in the returned flags.
 func ParseCommandFlags(ctx context.Context, wd string, args []string) (CommandFlags, error) {
+	return parseCommandFlags(ctx, wd, args, os.Getenv("GOFLAGS"))
+}
+
+// Cut removes all occurrences of the designated long-form flag (and their
+// values) from the flags of the go command invocation represented by args
+// (e.g, `build -toolexec=foo ./...`). It returns the remaining arguments, the
+// value of the last occurrence of the flag, and whether it was found at all.
+// Arguments following the flags (package patterns, program arguments, etc...)
+// are never removed.
+func Cut(args []string, flag string) (rest []string, val string, found bool) {
+	rest = make([]string, 0, len(args))
+
+	// The `-C` flag must immediately follow the `go` command, and is itself
+	// followed by the go command name ("build", "test", etc...).
+	start := 1
+	if len(args) > 0 && args[0] == "-C" {
+		start = 3
+	} else if len(args) > 0 && strings.HasPrefix(args[0], "-C=") {
+		start = 2
+	}
+	start = min(start, len(args))
+	rest = append(rest, args[:start]...)
+
+	for i := start; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			// We have reached the positional arguments.
+			rest = append(rest, args[i:]...)
+			break
+		}
+
+		normArg := arg
+		if strings.HasPrefix(arg, "--") {
+			normArg = arg[1:]
+		}
+		key, value, isAssigned := strings.Cut(normArg, "=")
+
+		if key == flag {
+			found = true
+			if isAssigned {
+				val = value
+			} else if len(args) > i+1 {
+				val = args[i+1]
+				i++
+			}
+			continue
+		}
+
+		rest = append(rest, arg)
+		if isAssigned {
+			continue
+		}
+		// Consume the value of the flag, if it has one; consistently with [ParseCommandFlags].
+		_, noValue := untrackedShortFlags[normArg]
+		if len(args) > i+1 && (isLong(normArg) || (!isShort(normArg) && !noValue && !strings.HasPrefix(args[i+1], "-"))) {
+			rest = append(rest, args[i+1])
+			i++
+		}
+	}
+
+	return rest, val, found
+}
+
+// parseCommandFlags is the implementation of [ParseCommandFlags], using the
+// provided value of $GOFLAGS.
+func parseCommandFlags(ctx context.Context, wd string, args []string, goflags string) (CommandFlags, error) {
 	log := zerolog.Ctx(ctx)
 
 	flags := CommandFlags{
@@ -125,7 +236,6 @@ func ParseCommandFlags(ctx context.Context, wd string, args []string) (CommandFl
 		Short: make(map[string]struct{}, len(shortFlags)),
 	}
 
-	goflags := os.Getenv("GOFLAGS")
 	goflagsArgs, err := quoted.Split(goflags)
 	if err != nil {
 		log.Warn().Str("GOFLAGS", goflags).Err(err).Msg("Failed to interpret quoted strings in GOFLAGS")
@@ -200,14 +310,18 @@ func ParseCommandFlags(ctx context.Context, wd string, args []string) (CommandFl
 			// Intentionally the un-normalized variant in Unknown flags.
 			flags.Unknown = append(flags.Unknown, arg)
 			// If there's more args, and the next one does not have a leading -, we'll assume this is the value of this
-			// unknown flag and consume it.
-			if len(args) > i+1 && !strings.HasPrefix(args[i+1], "-") {
+			// unknown flag and consume it; unless this flag is known not to take any value.
+			if _, noValue := untrackedShortFlags[normArg]; !noValue && len(args) > i+1 && !strings.HasPrefix(args[i+1], "-") {
 				flags.Unknown = append(flags.Unknown, args[i+1])
 				i++
 			}
 		}
 	}
 
+	flags.Args = positional
+
+	flags.absPGO(wd)
+
 	if err := flags.inferCoverpkg(ctx, wd, positional); err != nil {
 		return flags, err
 	}
@@ -216,6 +330,28 @@ func ParseCommandFlags(ctx context.Context, wd string, args []string) (CommandFl
 	return flags, nil
 }
 
+// PGOProfile returns the path to the profile used for profile-guided
+// optimization, as set by the `-pgo` flag. It is blank if the flag is absent,
+// or set to "auto" or "off", as the profile used in "auto" mode depends on
+// which main package is being built.
+func (f CommandFlags) PGOProfile() string {
+	switch val := f.Long["-pgo"]; val {
+	case "auto", "off":
+		return ""
+	default:
+		return val
+	}
+}
+
+// absPGO makes the `-pgo` flag's value absolute if it is a relative path, so
+// that sub-commands triggered with these flags do not interpret it relative to
+// a different directory.
+func (f *CommandFlags) absPGO(wd string) {
+	if val := f.PGOProfile(); val != "" && !filepath.IsAbs(val) {
+		f.Long["-pgo"] = filepath.Join(wd, val)
+	}
+}
+
 // inferCoverpkg will add the necessary `-coverpkg` argument if the `-cover` flags is present and
 // `-coverpkg` is not, as otherwise, sub-commands triggered with these flags will not apply coverage
 // to the intended packages.
@@ -291,12 +427,7 @@ func (f *CommandFlags) inferCoverpkg(ctx context.Context, wd string, positionalA
 		return nil
 	}
 
-	_, isCover := f.Short["-cover"]
-	if !isCover {
-		// -covermode implies -cover
-		_, isCover = f.Long["-covermode"]
-	}
-	if !isCover {
+	if !f.Coverage() {
 		return nil
 	}
 
@@ -324,8 +455,13 @@ func (f *CommandFlags) inferCoverpkg(ctx context.Context, wd string, positionalA
 	return nil
 }
 
-// Flags return the top level go command flags
+// Flags return the top level go command flags. If ctx carries flags (see
+// [WithFlags]), those are returned instead.
 func Flags(ctx context.Context) (CommandFlags, error) {
+	if flags, found := ctx.Value(contextKey{}).(CommandFlags); found {
+		return flags, nil
+	}
+
 	once.Do(func() {
 		flags, flagsErr = parentGoCommandFlags(ctx, os.Getpid())
 	})
@@ -355,6 +491,48 @@ func SetFlags(ctx context.Context, wd string, args []string) {
 	})
 }
 
+type contextKey struct{}
+
+// WithFlags returns a context that carries the provided flags, which are then
+// returned by [Flags] instead of this process' top level go command flags.
+// This is used by job servers that serve multiple builds.
+func WithFlags(ctx context.Context, flags CommandFlags) context.Context {
+	return context.WithValue(ctx, contextKey{}, flags)
+}
+
+// FromProcess returns the flags of the first go command found by looking up
+// the process tree from the specified PID, using the provided value of
+// $GOFLAGS (which should be that of the go command's environment). Results are
+// cached for the lifetime of each go command process.
+func FromProcess(ctx context.Context, pid int, goflags string) (CommandFlags, error) {
+	p, args, wd, err := parentGoCommand(ctx, pid)
+	if err != nil {
+		return CommandFlags{}, err
+	}
+	created, err := p.CreateTimeWithContext(ctx)
+	if err != nil {
+		return CommandFlags{}, fmt.Errorf("failed to get creation time of %d: %w", p.Pid, err)
+	}
+
+	// The creation time ensures re-used PIDs do not get stale results.
+	key := fmt.Sprintf("%d\x00%d\x00%s", p.Pid, created, goflags)
+	rawEntry, _ := processFlags.LoadOrStore(key, &processFlagsEntry{})
+	entry, _ := rawEntry.(*processFlagsEntry)
+	entry.once.Do(func() {
+		entry.flags, entry.err = parseCommandFlags(ctx, wd, args[1:], goflags)
+	})
+	return entry.flags, entry.err
+}
+
+type processFlagsEntry struct {
+	once  sync.Once
+	flags CommandFlags
+	err   error
+}
+
+// processFlags caches the results of [FromProcess].
+var processFlags sync.Map
+
 func isLong(str string) bool {
 	_, ok := longFlags[str]
 	return ok
@@ -367,19 +545,30 @@ func isShort(str string) bool {
 
 // parentGoCommandFlags backtracks through the process tree
 // to find a parent go command invocation and returns its arguments
-func parentGoCommandFlags(ctx context.Context, pid int) (flags CommandFlags, err error) {
+func parentGoCommandFlags(ctx context.Context, pid int) (CommandFlags, error) {
+	_, args, wd, err := parentGoCommand(ctx, pid)
+	if err != nil {
+		return CommandFlags{}, err
+	}
+	return ParseCommandFlags(ctx, wd, args[1:])
+}
+
+// parentGoCommand backtracks through the process tree to find a parent go
+// command process, and returns it together with its command line and working
+// directory.
+func parentGoCommand(ctx context.Context, pid int) (_ *process.Process, _ []string, _ string, err error) {
 	log := zerolog.Ctx(ctx)
 	log.Trace().Msg("Attempting to parse parent Go command arguments")
 
 	goBin, err := goenv.GoBinPath()
 	if err != nil {
-		return flags, fmt.Errorf("failed to resolve go command path: %w", err)
+		return nil, nil, "", fmt.Errorf("failed to resolve go command path: %w", err)
 	}
 	log.Trace().Str("go.bin", goBin).Msg("Resolved go command path")
 
 	p, err := process.NewProcessWithContext(ctx, int32(pid))
 	if err != nil {
-		return flags, fmt.Errorf("failed to get handle of the process with pid %d: %w", pid, err)
+		return nil, nil, "", fmt.Errorf("failed to get handle of the process with pid %d: %w", pid, err)
 	}
 
 	// Backtrack through the process stack until we find the parent Go command
@@ -387,11 +576,11 @@ func parentGoCommandFlags(ctx context.Context, pid int) (flags CommandFlags, err
 	for {
 		p, err = p.ParentWithContext(ctx)
 		if err != nil {
-			return flags, fmt.Errorf("failed to find parent process of %d: %w", p.Pid, err)
+			return nil, nil, "", fmt.Errorf("failed to find parent process of %d: %w", p.Pid, err)
 		}
 		args, err = p.CmdlineSliceWithContext(ctx)
 		if err != nil {
-			return flags, fmt.Errorf("failed to get command line of %d: %w", p.Pid, err)
+			return nil, nil, "", fmt.Errorf("failed to get command line of %d: %w", p.Pid, err)
 		}
 
 		cmd, err := exec.LookPath(args[0])
@@ -416,7 +605,7 @@ func parentGoCommandFlags(ctx context.Context, pid int) (flags CommandFlags, err
 			}
 		}
 		if err != nil {
-			return flags, fmt.Errorf("failed to resolve argv0 (%q) of %d: %w", args[0], p.Pid, err)
+			return nil, nil, "", fmt.Errorf("failed to resolve argv0 (%q) of %d: %w", args[0], p.Pid, err)
 		}
 
 		// Found the go command process, break out of backtracking
@@ -430,10 +619,10 @@ func parentGoCommandFlags(ctx context.Context, pid int) (flags CommandFlags, err
 	log.Trace().Int32("go.pid", p.Pid).Strs("arguments", args).Msg("Found parent go command process")
 	wd, err := p.Cwd()
 	if err != nil {
-		return flags, fmt.Errorf("failed to get working directory of %d: %w", p.Pid, err)
+		return nil, nil, "", fmt.Errorf("failed to get working directory of %d: %w", p.Pid, err)
 	}
 
-	return ParseCommandFlags(ctx, wd, args[1:])
+	return p, args, wd, nil
 }
 
 var (
@@ -91,6 +91,10 @@ func TestParse(t *testing.T) {
 				Short: map[string]struct{}{"-short1": {}, "-short2": {}},
 			},
 		},
+		"untracked": {
+			flags:    []string{"test", "-v", "-x", "./...", "-run", "TestFoo"},
+			expected: CommandFlags{Args: []string{"./...", "-run", "TestFoo"}},
+		},
 		"cover": {
 			flags: []string{"run", "-cover", "-covermode=atomic"},
 			expected: CommandFlags{
@@ -111,6 +115,7 @@ func TestParse(t *testing.T) {
 			expected: CommandFlags{
 				Long:  map[string]string{"-covermode": "atomic", "-coverpkg": "std,github.com/DataDog/orchestrion/internal/goflags,github.com/DataDog/orchestrion/internal/goflags/quoted"},
 				Short: map[string]struct{}{"-cover": {}},
+				Args:  []string{"-some.go"},
 			},
 		},
 		"cover-dash-c": {
@@ -127,8 +132,21 @@ func TestParse(t *testing.T) {
 				// Note - the "-C" flags has no effect at this stage, so it's expected coverpkg is this package.
 				Long:  map[string]string{"-covermode": "atomic", "-coverpkg": "github.com/DataDog/orchestrion/internal/goflags"},
 				Short: map[string]struct{}{"-cover": {}},
+				Args:  []string{"."},
 			},
 		},
+		"pgo-relative": {
+			flags:    []string{"build", "-pgo=default.pgo", "."},
+			expected: CommandFlags{Long: map[string]string{"-pgo": filepath.Join(thisDir, "default.pgo")}},
+		},
+		"pgo-absolute": {
+			flags:    []string{"build", "-pgo", "/path/to/cpu.pprof", "."},
+			expected: CommandFlags{Long: map[string]string{"-pgo": "/path/to/cpu.pprof"}},
+		},
+		"pgo-auto": {
+			flags:    []string{"build", "-pgo=auto", "."},
+			expected: CommandFlags{Long: map[string]string{"-pgo": "auto"}},
+		},
 		"goflags": {
 			flags:   []string{"run", "."},
 			goflags: "-cover -covermode=atomic -tags=integration '-toolexec=foo bar'",
@@ -167,6 +185,84 @@ func TestParse(t *testing.T) {
 				flags.Long = make(map[string]string)
 			}
 			assert.True(t, reflect.DeepEqual(tc.expected.Long, flags.Long), "expected:\n%#v\nactual:\n%#v", tc.expected.Long, flags.Long)
+
+			if tc.expected.Args != nil {
+				assert.Equal(t, tc.expected.Args, flags.Args)
+			}
+		})
+	}
+}
+
+func TestCut(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args  []string
+		rest  []string
+		val   string
+		found bool
+	}{
+		"absent": {
+			args: []string{"build", "-tags", "integration", "./..."},
+			rest: []string{"build", "-tags", "integration", "./..."},
+		},
+		"assigned": {
+			args:  []string{"build", "-toolexec=/usr/bin/wrapper -v", "./..."},
+			rest:  []string{"build", "./..."},
+			val:   "/usr/bin/wrapper -v",
+			found: true,
+		},
+		"separate": {
+			args:  []string{"-C", "dir", "test", "-v", "--toolexec", "wrapper", "-race", "."},
+			rest:  []string{"-C", "dir", "test", "-v", "-race", "."},
+			val:   "wrapper",
+			found: true,
+		},
+		"last-wins": {
+			args:  []string{"build", "-toolexec=first", "-o", "out", "-toolexec=second"},
+			rest:  []string{"build", "-o", "out"},
+			val:   "second",
+			found: true,
+		},
+		"positional": {
+			args: []string{"run", ".", "-toolexec=program-argument"},
+			rest: []string{"run", ".", "-toolexec=program-argument"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rest, val, found := Cut(tc.args, "-toolexec")
+			assert.Equal(t, tc.rest, rest)
+			assert.Equal(t, tc.val, val)
+			assert.Equal(t, tc.found, found)
+		})
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	for name, tc := range map[string]struct {
+		flags    CommandFlags
+		expected bool
+	}{
+		"none":      {flags: CommandFlags{Short: map[string]struct{}{"-v": {}}, Long: map[string]string{"-tags": "integration"}}},
+		"cover":     {flags: CommandFlags{Short: map[string]struct{}{"-cover": {}}}, expected: true},
+		"covermode": {flags: CommandFlags{Long: map[string]string{"-covermode": "atomic"}}, expected: true},
+		"coverpkg":  {flags: CommandFlags{Long: map[string]string{"-coverpkg": "all"}}, expected: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.flags.Coverage())
+		})
+	}
+}
+
+func TestTags(t *testing.T) {
+	for val, expected := range map[string][]string{
+		"":                 nil,
+		"integration":      {"integration"},
+		"foo,bar":          {"foo", "bar"},
+		"foo bar":          {"foo", "bar"},
+		" foo, ,bar ":      {"foo", "bar"},
+		"netgo osusergo  ": {"netgo", "osusergo"},
+	} {
+		t.Run(val, func(t *testing.T) {
+			assert.Equal(t, expected, CommandFlags{Long: map[string]string{"-tags": val}}.Tags())
 		})
 	}
 }
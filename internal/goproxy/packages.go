@@ -0,0 +1,190 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/rs/zerolog"
+)
+
+// prepareVersionedPackages handles `go install` and `go run` commands naming
+// packages at a specific version (`pkg@version`). The go command builds these
+// outside of the current module, where the project's orchestrion configuration
+// is not in scope, so they would not be woven. Instead, they are built as part
+// of the current module, using a temporary copy of its `go.mod` file (selected
+// with the `-modfile` flag) to which they are added using `go get`. This means
+// the versions of their dependencies are selected together with those of the
+// current module's requirements.
+//
+// It returns the updated go command arguments (without the `go` binary itself),
+// and a function that removes the temporary files, which must be called once
+// the go command has completed.
+func prepareVersionedPackages(ctx context.Context, goBin string, args []string) (_ []string, cleanup func(), err error) {
+	cleanup = func() {}
+	if len(args) == 0 || (args[0] != "install" && args[0] != "run") {
+		return args, cleanup, nil
+	}
+	cmd := args[0]
+	// Parsing flags may be costly (and can fail), so it is only done if an
+	// argument could be a package@version.
+	if !slices.ContainsFunc(args[1:], isVersioned) {
+		return args, cleanup, nil
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, nil, err
+	}
+	flags, err := goflags.ParseCommandFlags(ctx, wd, args)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing go command flags: %w", err)
+	}
+
+	// Positional arguments are always at the end of the command line.
+	start := len(args) - len(flags.Args)
+	packages := flags.Args
+	if cmd == "run" && len(packages) > 1 {
+		// Arguments following the package are passed to the program.
+		packages = packages[:1]
+	}
+	versioned := slices.IndexFunc(packages, isVersioned)
+	if versioned < 0 {
+		return args, cleanup, nil
+	}
+	if slices.ContainsFunc(packages, func(arg string) bool { return !isVersioned(arg) }) {
+		return nil, nil, fmt.Errorf("go %s: package@version arguments cannot be mixed with other packages", cmd)
+	}
+	if _, found := flags.Get("-modfile"); found {
+		return nil, nil, fmt.Errorf("go %s %s: package@version arguments cannot be combined with the -modfile flag", cmd, packages[versioned])
+	}
+
+	goWork, err := goenv.GOWORK(wd)
+	if err != nil {
+		return nil, nil, err
+	}
+	if goWork != "" {
+		return nil, nil, fmt.Errorf("go %s %s: package@version arguments are not supported in workspace mode (set GOWORK=off to use the configuration of the current module)", cmd, packages[versioned])
+	}
+	goMod, err := goenv.GOMOD(wd)
+	if errors.Is(err, goenv.ErrNoGoMod) {
+		return nil, nil, fmt.Errorf("go %s %s: package@version arguments are woven using the configuration of the current module, but there is none: %w", cmd, packages[versioned], err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmp, err := os.MkdirTemp("", "orchestrion-modfile-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup = func() {
+		if err := os.RemoveAll(tmp); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("dir", tmp).Msg("Failed to remove temporary module files")
+		}
+	}
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+
+	modFile := filepath.Join(tmp, "go.mod")
+	if err := copyFile(goMod, modFile); err != nil {
+		return nil, nil, err
+	}
+	if err := copyFile(strings.TrimSuffix(goMod, ".mod")+".sum", filepath.Join(tmp, "go.sum")); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	get := exec.CommandContext(ctx, goBin, append([]string{"get", "-modfile=" + modFile}, packages...)...)
+	get.Stdout = os.Stderr
+	get.Stderr = os.Stderr
+	zerolog.Ctx(ctx).Debug().Strs("command", get.Args).Msg("Adding versioned packages to a temporary copy of go.mod")
+	if err := get.Run(); err != nil {
+		return nil, nil, fmt.Errorf("running %q: %w", get.Args, err)
+	}
+
+	res := make([]string, 0, len(args)+1)
+	res = append(res, cmd, "-modfile="+modFile)
+	res = append(res, args[1:start]...)
+	for _, pkg := range packages {
+		path, _, _ := strings.Cut(pkg, "@")
+		res = append(res, path)
+	}
+	res = append(res, flags.Args[len(packages):]...)
+	return res, cleanup, nil
+}
+
+// checkFileArguments returns an error if the go command builds an ad-hoc
+// package from `.go` files named on the command line (e.g, `go run main.go`)
+// outside of any module. Such packages are woven using the configuration of
+// the current module, so there is none to apply.
+func checkFileArguments(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	switch args[0] {
+	case "build", "install", "run", "test":
+	default:
+		return nil
+	}
+	// Parsing flags may be costly (and can fail), so it is only done if an
+	// argument could be a `.go` file.
+	if !slices.ContainsFunc(args[1:], isGoFile) {
+		return nil
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	flags, err := goflags.ParseCommandFlags(ctx, wd, args)
+	if err != nil {
+		return fmt.Errorf("parsing go command flags: %w", err)
+	}
+	if len(flags.Args) == 0 || !isGoFile(flags.Args[0]) {
+		return nil
+	}
+
+	goWork, err := goenv.GOWORK(wd)
+	if err != nil || goWork != "" {
+		return err
+	}
+	if _, err := goenv.GOMOD(wd); errors.Is(err, goenv.ErrNoGoMod) {
+		return fmt.Errorf("go %s %s: files named on the command line are woven using the configuration of the current module, but there is none: %w", args[0], flags.Args[0], err)
+	}
+	return nil
+}
+
+// isVersioned returns true if arg is a package path with a version query (e.g,
+// `example.com/cmd@v1.2.3`).
+func isVersioned(arg string) bool {
+	return strings.Contains(arg, "@")
+}
+
+// isGoFile returns true if arg names a `.go` file.
+func isGoFile(arg string) bool {
+	return strings.HasSuffix(arg, ".go")
+}
+
+func copyFile(from, to string) error {
+	data, err := os.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(to, data, 0o644)
+}
@@ -0,0 +1,146 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package goproxy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareVersionedPackages(t *testing.T) {
+	goBin, err := goenv.GoBinPath()
+	require.NoError(t, err)
+
+	// The versioned module is replaced by a local directory, so that it can be added without network access.
+	const goMod = "module example.com/app\n\ngo 1.23\n\nreplace example.com/tool v1.2.3 => ./tool\n"
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.mod"), goMod)
+	writeFile(t, filepath.Join(dir, "tool", "go.mod"), "module example.com/tool\n\ngo 1.23\n")
+	writeFile(t, filepath.Join(dir, "tool", "main.go"), "package main\n\nfunc main() {}\n")
+	chdir(t, dir)
+	t.Setenv("GOPROXY", "off")
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "")
+
+	ctx := context.Background()
+
+	t.Run("install", func(t *testing.T) {
+		args, cleanup, err := prepareVersionedPackages(ctx, goBin, []string{"install", "-v", "example.com/tool@v1.2.3"})
+		require.NoError(t, err)
+		defer cleanup()
+
+		require.Len(t, args, 4)
+		modFile, ok := strings.CutPrefix(args[1], "-modfile=")
+		require.True(t, ok)
+		assert.Equal(t, []string{"install", args[1], "-v", "example.com/tool"}, args)
+
+		content, err := os.ReadFile(modFile)
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "example.com/tool v1.2.3")
+
+		// The project's own go.mod file is not modified.
+		content, err = os.ReadFile(filepath.Join(dir, "go.mod"))
+		require.NoError(t, err)
+		assert.Equal(t, goMod, string(content))
+
+		cleanup()
+		assert.NoFileExists(t, modFile)
+	})
+
+	t.Run("run", func(t *testing.T) {
+		args, cleanup, err := prepareVersionedPackages(ctx, goBin, []string{"run", "example.com/tool@v1.2.3", "arg@1", "-flag"})
+		require.NoError(t, err)
+		defer cleanup()
+
+		require.Len(t, args, 5)
+		assert.Equal(t, []string{"run", args[1], "example.com/tool", "arg@1", "-flag"}, args)
+	})
+
+	t.Run("unversioned", func(t *testing.T) {
+		orig := []string{"run", "./tool", "arg@1"}
+		args, cleanup, err := prepareVersionedPackages(ctx, goBin, orig)
+		require.NoError(t, err)
+		defer cleanup()
+		assert.Equal(t, orig, args)
+	})
+
+	t.Run("mixed", func(t *testing.T) {
+		_, _, err := prepareVersionedPackages(ctx, goBin, []string{"install", "example.com/tool@v1.2.3", "./tool"})
+		require.ErrorContains(t, err, "cannot be mixed")
+	})
+
+	t.Run("modfile", func(t *testing.T) {
+		_, _, err := prepareVersionedPackages(ctx, goBin, []string{"install", "-modfile=other.mod", "example.com/tool@v1.2.3"})
+		require.ErrorContains(t, err, "-modfile")
+	})
+
+	t.Run("workspace", func(t *testing.T) {
+		writeFile(t, filepath.Join(dir, "go.work"), "go 1.23\n\nuse .\n")
+		defer os.Remove(filepath.Join(dir, "go.work"))
+
+		_, _, err := prepareVersionedPackages(ctx, goBin, []string{"install", "example.com/tool@v1.2.3"})
+		require.ErrorContains(t, err, "workspace mode")
+	})
+
+	t.Run("no module", func(t *testing.T) {
+		chdir(t, t.TempDir())
+
+		_, _, err := prepareVersionedPackages(ctx, goBin, []string{"install", "example.com/tool@v1.2.3"})
+		require.ErrorIs(t, err, goenv.ErrNoGoMod)
+	})
+
+	t.Run("flags not parsed", func(t *testing.T) {
+		// Parsing -cover runs `go list`, which fails outside of a module; flags
+		// must not be parsed when no argument names a versioned package.
+		chdir(t, t.TempDir())
+
+		orig := []string{"run", "-cover", "."}
+		args, cleanup, err := prepareVersionedPackages(ctx, goBin, orig)
+		require.NoError(t, err)
+		defer cleanup()
+		assert.Equal(t, orig, args)
+	})
+}
+
+func TestCheckFileArguments(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "")
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/app\n\ngo 1.23\n")
+	chdir(t, dir)
+	require.NoError(t, checkFileArguments(ctx, []string{"run", "main.go"}))
+
+	chdir(t, t.TempDir())
+	require.NoError(t, checkFileArguments(ctx, []string{"run", "."}))
+	require.NoError(t, checkFileArguments(ctx, []string{"generate", "main.go"}))
+	require.ErrorIs(t, checkFileArguments(ctx, []string{"run", "-v", "main.go"}), goenv.ErrNoGoMod)
+	// Parsing -cover runs `go list`, which fails outside of a module; flags must
+	// not be parsed when no argument names a `.go` file.
+	require.NoError(t, checkFileArguments(ctx, []string{"test", "-cover", "."}))
+}
+
+func writeFile(t *testing.T, filename string, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0o755))
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0o644))
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { require.NoError(t, os.Chdir(wd)) })
+}
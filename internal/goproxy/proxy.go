@@ -8,22 +8,30 @@ package goproxy
 import (
 	"context"
 	"fmt"
+	goversion "go/version"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/cacheprog"
 	"github.com/DataDog/orchestrion/internal/goenv"
 	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/DataDog/orchestrion/internal/goflags/quoted"
 	"github.com/DataDog/orchestrion/internal/jobserver"
 	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/overlay"
+	"github.com/DataDog/orchestrion/internal/toolexec/proxy"
 	"github.com/DataDog/orchestrion/internal/traceutil"
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
 )
 
 type config struct {
-	toolexec string
+	toolexec  string
+	cacheprog string
+	overlay   bool
 }
 
 type Option func(*config)
@@ -31,6 +39,34 @@ type Option func(*config)
 // WithToolexec forces a call to Run() to build with the -toolexec option when
 // wrapping a build command
 func WithToolexec(bin string, args ...string) Option {
+	toolexec := quoteCommand(bin, args...)
+	return func(c *config) {
+		c.toolexec = toolexec
+	}
+}
+
+// WithOverlay forces a call to Run() to weave packages before running the
+// wrapped build command, which then uses the -overlay option instead of
+// -toolexec. This takes precedence over [WithToolexec].
+func WithOverlay() Option {
+	return func(c *config) {
+		c.overlay = true
+	}
+}
+
+// WithGoCacheProg configures the GOCACHEPROG environment variable when wrapping
+// a build command, unless it is already set or the go toolchain does not
+// support it (it was introduced in go1.24).
+func WithGoCacheProg(bin string, args ...string) Option {
+	cacheprog := quoteCommand(bin, args...)
+	return func(c *config) {
+		c.cacheprog = cacheprog
+	}
+}
+
+// quoteCommand quotes the provided command line so that it is suitable for use
+// in the value of -toolexec or GOCACHEPROG.
+func quoteCommand(bin string, args ...string) string {
 	var buffer strings.Builder
 	if _, err := fmt.Fprintf(&buffer, "%q", bin); err != nil {
 		// This is expected to never happen (short of running OOM, maybe?)
@@ -47,11 +83,7 @@ func WithToolexec(bin string, args ...string) Option {
 			panic(err)
 		}
 	}
-	toolexec := buffer.String()
-	buffer.Reset() // Dispose of the buffer's content so its memory can be recclaimed.
-	return func(c *config) {
-		c.toolexec = toolexec
-	}
+	return buffer.String()
 }
 
 // Run takes a go command ("build", "install", etc...) with its arguments, and
@@ -75,6 +107,18 @@ func Run(ctx context.Context, goArgs []string, opts ...Option) error {
 		return fmt.Errorf("locating 'go' binary: %w", err)
 	}
 
+	if cfg.overlay || cfg.toolexec != "" {
+		if err := checkFileArguments(ctx, goArgs); err != nil {
+			return err
+		}
+		var cleanup func()
+		goArgs, cleanup, err = prepareVersionedPackages(ctx, goBin, goArgs)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+	}
+
 	// Pre-allocate space for extra arguments...
 	argv := append(
 		append(
@@ -87,9 +131,41 @@ func Run(ctx context.Context, goArgs []string, opts ...Option) error {
 	env := os.Environ()
 	if len(argv) > 1 {
 		switch cmd := argv[1]; cmd {
-		// "go build" arguments are shared by build, clean, get, install, list, run, and test.
+		// "go build" arguments are shared by build, clean, get, install, list, run, and test. Other
+		// commands (e.g, "go generate") do not build anything, and are forwarded as-is; in particular,
+		// the code generators run by "go generate" are build tools, and are not woven.
 		case "build", "clean", "get", "install", "list", "run", "test":
-			if cfg.toolexec != "" {
+			if cfg.overlay {
+				if cmd == "clean" || cmd == "get" || cmd == "list" {
+					// These commands do not compile anything, so there is nothing to weave.
+					break
+				}
+
+				ov, err := overlay.Prepare(ctx, argv[1:])
+				if err != nil {
+					return fmt.Errorf("weaving packages: %w", err)
+				}
+				defer func() {
+					if err := ov.Close(); err != nil {
+						log.Warn().Err(err).Msg("Failed to remove overlay files")
+					}
+				}()
+
+				log.Debug().Str("-overlay", ov.File).Msg("Adding -overlay argument")
+				argv = slices.Insert(argv, 2, "-overlay", ov.File)
+
+				if cfg.cacheprog != "" {
+					env = withGoCacheProg(ctx, goBin, env, cfg.cacheprog)
+				}
+			} else if cfg.toolexec != "" {
+				// If the user provided their own -toolexec command, it is chained after ours instead of
+				// being overridden by it (or overriding it).
+				var wrapper string
+				argv, wrapper = cutToolexecWrapper(ctx, argv, cfg.toolexec)
+				if wrapper != "" {
+					env = append(env, fmt.Sprintf("%s=%s", proxy.EnvVarToolexecWrapper, wrapper))
+				}
+
 				log.Debug().Str("-toolexec", cfg.toolexec).Msg("Adding -toolexec argument")
 
 				oldLen := len(argv)
@@ -101,19 +177,28 @@ func Run(ctx context.Context, goArgs []string, opts ...Option) error {
 				argv[2] = "-toolexec"
 				argv[3] = cfg.toolexec
 
-				// We'll need a job server to support toolexec operations
-				server, err := jobserver.New(ctx, nil)
-				if err != nil {
-					return err
+				// We'll need a job server to support toolexec operations, unless job servers are disabled; in
+				// which case each toolexec process uses its own in-process job server.
+				if !client.Disabled() {
+					server, err := jobserver.New(ctx, jobserver.OptionsFromEnvironment(ctx))
+					if err != nil {
+						log.Warn().Err(err).Msg("Failed to start the job server; toolexec processes will use in-process job servers instead")
+						env = append(env, client.EnvVarJobserver+"=off")
+					} else {
+						defer func() {
+							server.Shutdown()
+							log.Trace().Msg(server.CacheStats.String())
+						}()
+						env = append(env, fmt.Sprintf("%s=%s", client.EnvVarJobserverURL, server.ClientURL()))
+					}
 				}
-				defer func() {
-					server.Shutdown()
-					log.Trace().Msg(server.CacheStats.String())
-				}()
-				env = append(env, fmt.Sprintf("%s=%s", client.EnvVarJobserverURL, server.ClientURL()))
 
 				// Set the process' goflags, since we know them already...
 				goflags.SetFlags(ctx, "", argv[1:])
+
+				if cfg.cacheprog != "" {
+					env = withGoCacheProg(ctx, goBin, env, cfg.cacheprog)
+				}
 			}
 		}
 	}
@@ -140,3 +225,67 @@ func Run(ctx context.Context, goArgs []string, opts ...Option) error {
 
 	return nil
 }
+
+// cutToolexecWrapper removes any user-provided -toolexec flag from argv, and
+// returns the resulting arguments together with the user-provided -toolexec
+// command, if any. That command is looked up in GOFLAGS if it is not present on
+// the command line, consistently with the go command. The toolexec command used
+// by orchestrion itself is ignored.
+func cutToolexecWrapper(ctx context.Context, argv []string, toolexec string) ([]string, string) {
+	log := zerolog.Ctx(ctx)
+
+	rest, wrapper, found := goflags.Cut(argv[1:], "-toolexec")
+	argv = append(argv[:1:1], rest...)
+	if !found {
+		goflagsArgs, err := quoted.Split(os.Getenv("GOFLAGS"))
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to interpret quoted strings in GOFLAGS")
+		}
+		for _, arg := range goflagsArgs {
+			// The Go CLI accepts flags with two hyphens instead of one.
+			if val, ok := strings.CutPrefix(strings.TrimLeft(arg, "-"), "toolexec="); ok {
+				wrapper = val
+			}
+		}
+	}
+
+	if wrapper == "" || wrapper == toolexec {
+		return argv, ""
+	}
+	log.Info().Str("-toolexec", wrapper).Msg("Chaining user-provided -toolexec command after orchestrion")
+	return argv, wrapper
+}
+
+// withGoCacheProg returns env with GOCACHEPROG set to cacheprog, and the
+// cache program's directory set, unless GOCACHEPROG is already set or the go
+// toolchain does not support it.
+func withGoCacheProg(ctx context.Context, goBin string, env []string, cacheprogCmd string) []string {
+	log := zerolog.Ctx(ctx)
+
+	if os.Getenv("GOCACHEPROG") != "" {
+		log.Debug().Msg("GOCACHEPROG is already set; not overriding it")
+		return env
+	}
+
+	out, err := exec.Command(goBin, "env", "GOVERSION").Output()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to determine the go toolchain version; not setting GOCACHEPROG")
+		return env
+	}
+	if goVersion := strings.TrimSpace(string(out)); !goversion.IsValid(goVersion) || goversion.Compare(goVersion, "go1.24") < 0 {
+		log.Info().Str("go.version", goVersion).Msg("The go toolchain does not support GOCACHEPROG; not setting it")
+		return env
+	}
+
+	dir, err := cacheprog.DefaultDir(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to determine the GOCACHEPROG directory; not setting GOCACHEPROG")
+		return env
+	}
+
+	log.Debug().Str("GOCACHEPROG", cacheprogCmd).Str("dir", dir).Msg("Setting GOCACHEPROG")
+	return append(env,
+		"GOCACHEPROG="+cacheprogCmd,
+		fmt.Sprintf("%s=%s", cacheprog.EnvVarDir, dir),
+	)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/advice/code"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/dave/dst"
 	"github.com/goccy/go-yaml/ast"
@@ -55,6 +56,23 @@ func (a *assignValue) Hash(h *fingerprint.Hasher) error {
 }
 
 func init() {
+	schemas["assign-value"] = schema.Entry{
+		Title:       "Change the initial value of a `var` or `const`",
+		Description: "The `assign-value` advice changes the initial value of a package-level `var` or `const` declaration matched by `value-declaration`.\n\nIf the value is susceptible to match a `const`, the template must produce only compile-time constant values.",
+		Schema: `
+$ref: '#/$defs/code-template'
+unevaluatedProperties: false`,
+		Examples: []string{`
+assign-value:
+  template: 'true'`, `
+assign-value:
+  imports:
+    regexp: regexp
+  template: regexp.MustCompile("^.?$|^(..+?)\\1+$")
+  lang: go1.18`,
+		},
+	}
+
 	unmarshalers["assign-value"] = func(ctx gocontext.Context, node ast.Node) (Advice, error) {
 		var template *code.Template
 		if err := yaml.NodeToValueContext(ctx, node, &template); err != nil {
@@ -12,6 +12,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/advice/code"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/dave/dst"
 	"github.com/goccy/go-yaml/ast"
@@ -58,6 +59,25 @@ func (a *prependStatements) AddedImports() []string {
 }
 
 func init() {
+	schemas["prepend-statements"] = schema.Entry{
+		Title:       "Add new logic before a node",
+		Description: "The `prepend-statements` advice inserts new statements rendered by the provided code template before the matched AST node. This is often used to add logic in the preamble of function implementations, and the `defer` keyword can be used to also introduce epilogue logic.",
+		Schema: `
+$ref: '#/$defs/code-template'
+unevaluatedProperties: false`,
+		Examples: []string{`
+prepend-statements:
+  imports:
+    tracer: gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer
+  template: |-
+    {{- $ctx := .Function.Argument 0 -}}
+    {{- $name := .Function.Name -}}
+    var span tracer.Span
+    span, {{ $ctx }} = tracer.StartSpanFromContext({{ $ctx }}, {{ printf "%q" $name }})
+    defer span.Finish()`,
+		},
+	}
+
 	unmarshalers["prepend-statements"] = func(ctx gocontext.Context, node ast.Node) (Advice, error) {
 		var template code.Template
 		if err := yaml.NodeToValueContext(ctx, node, &template); err != nil {
@@ -15,6 +15,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/injector/aspect/advice/code"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/join"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/dave/dst"
 	"github.com/goccy/go-yaml/ast"
@@ -158,6 +159,39 @@ func (r *redirectCall) AddedImports() []string {
 }
 
 func init() {
+	schemas["append-args"] = schema.Entry{
+		Title:       "Append new arguments to a variadic call",
+		Description: "The `append-args` advice adds new arguments at the tail of a function call. This can only be used on `Call` nodes (typically matched by `function-call`), and usually requires the called function to have a variadic signature.\n\nThe `type` attribute must match the function's signature, and is used to compose the complete viardic arguments slice in cases where the original argument list includes a splat expression (`slice...`).",
+		Schema: `
+type: object
+additionalProperties: false
+required: [type, values]
+properties:
+  type:
+    description: The type of the function's variadic argument. This is used in cases when arguments need to be appended through a slice.
+    $ref: '#/$defs/go/type-ref'
+  values:
+    description: The list of argument values to add, in order.
+    type: array
+    items:
+      $ref: '#/$defs/code-template'
+      unevaluatedProperties: false
+    minItems: 1`,
+		Examples: []string{`
+append-args:
+  type: google.golang.org/grpc.DialOption
+  values:
+    - imports:
+        grpc: google.golang.org/grpc
+        grpctrace: gopkg.in/DataDog/dd-trace-go.v1/contrib/google.golang.org/grpc
+      template: grpc.WithStreamInterceptor(grpctrace.StreamClientInterceptor())
+    - imports:
+        grpc: google.golang.org/grpc
+        grpctrace: gopkg.in/DataDog/dd-trace-go.v1/contrib/google.golang.org/grpc
+      template: grpc.WithUnaryInterceptor(grpctrace.UnaryClientInterceptor())`,
+		},
+	}
+
 	unmarshalers["append-args"] = func(ctx gocontext.Context, node ast.Node) (Advice, error) {
 		var args struct {
 			TypeName string           `yaml:"type"`
@@ -175,6 +209,13 @@ func init() {
 
 		return AppendArgs(tn, args.Values...), nil
 	}
+	schemas["replace-function"] = schema.Entry{
+		Title:       "Drop-in replace a called function",
+		Description: "The `replace-function` advice replaces the callee of a `Call` node (typically matched by `function-call`) with the designated function. The current & replacement functions must have compatible signatures.",
+		Schema:      `$ref: '#/$defs/go/qualified-identifier'`,
+		Examples:    []string{`replace-function: gopkg.in/DataDog/dd-trace-go.v1/contrib/gorm.io/gorm.v1.Open`},
+	}
+
 	unmarshalers["replace-function"] = func(ctx gocontext.Context, node ast.Node) (Advice, error) {
 		var (
 			fqn  string
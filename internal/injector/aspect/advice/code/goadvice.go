@@ -0,0 +1,376 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package code
+
+import (
+	"bytes"
+	gocontext "context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// GoAdviceBuildTag is the build tag that Go source files containing advice
+// functions must be constrained by, so that they are excluded from normal
+// builds while still being type-checked by tools that enable it.
+const GoAdviceBuildTag = "orchestrion_advice"
+
+const goAdviceDirective = "//orchestrion:advice"
+
+type (
+	// GoAdvice associates advice identifiers (as specified in the
+	// `//orchestrion:advice <id>` directive) to the template source lifted from
+	// the corresponding function's body.
+	GoAdvice map[string]LiftedAdvice
+
+	// LiftedAdvice is the template source lifted from a Go advice function.
+	LiftedAdvice struct {
+		// Source is the template text.
+		Source string
+		// Imports maps the package names used by Source to their import paths.
+		Imports map[string]string
+	}
+)
+
+type goAdviceContextKey struct{}
+
+// WithGoAdviceDir returns a new [gocontext.Context] that carries the directory
+// in which Go advice files are looked up when a [Template] refers to one using
+// the `go-advice` key. The directory is only parsed on first use.
+func WithGoAdviceDir(ctx gocontext.Context, dir string) gocontext.Context {
+	return gocontext.WithValue(ctx, goAdviceContextKey{}, sync.OnceValues(func() (GoAdvice, error) {
+		return ParseGoAdvice(dir)
+	}))
+}
+
+// goAdvice returns the [LiftedAdvice] for the Go advice function with the
+// specified identifier, in the directory registered in ctx.
+func goAdvice(ctx gocontext.Context, id string) (LiftedAdvice, error) {
+	load, _ := ctx.Value(goAdviceContextKey{}).(func() (GoAdvice, error))
+	if load == nil {
+		return LiftedAdvice{}, fmt.Errorf("go-advice %q: no Go advice directory available in this context", id)
+	}
+	advice, err := load()
+	if err != nil {
+		return LiftedAdvice{}, fmt.Errorf("go-advice %q: %w", id, err)
+	}
+	lifted, found := advice[id]
+	if !found {
+		return LiftedAdvice{}, fmt.Errorf("go-advice %q: no function annotated with %s %s", id, goAdviceDirective, id)
+	}
+	return lifted, nil
+}
+
+// ParseGoAdvice parses all Go source files in dir that are constrained by the
+// [GoAdviceBuildTag] build tag, and lifts the body of every function annotated
+// with an `//orchestrion:advice <id>` directive into a [LiftedAdvice].
+//
+// Within the lifted body, references to the advice function's receiver,
+// parameters and named results are replaced with the corresponding
+// `{{ .Function.Receiver }}`, `{{ .Function.Argument N }}` and
+// `{{ .Function.Result N }}` placeholders, so that they refer to the
+// function the advice is applied to. Packages referenced by the body are added
+// to the template's imports. A bare `return` statement ending the body, which
+// functions with named results need to be valid Go, is not part of the lifted
+// template.
+func ParseGoAdvice(dir string) (GoAdvice, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(GoAdvice)
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".go" {
+			continue
+		}
+
+		filename := filepath.Join(dir, entry.Name())
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if !isGoAdviceFile(file) {
+			continue
+		}
+
+		if err := liftFile(fset, file, src, res); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// isGoAdviceFile returns true if the file's build constraint requires
+// [GoAdviceBuildTag], meaning the file is excluded from all builds that do not
+// set it, and is included in some builds that do.
+func isGoAdviceFile(file *ast.File) bool {
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, comment := range group.List {
+			if !constraint.IsGoBuild(comment.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(comment.Text)
+			if err != nil {
+				return false
+			}
+			return requiresTag(expr, GoAdviceBuildTag)
+		}
+	}
+	return false
+}
+
+// maxConstraintTags is the maximum number of distinct tags in a build
+// constraint that [requiresTag] evaluates exhaustively.
+const maxConstraintTags = 16
+
+// requiresTag returns true if expr is never satisfied when tag is not set, and
+// is satisfied by at least one combination of tags that includes tag.
+func requiresTag(expr constraint.Expr, tag string) bool {
+	var others []string
+	expr.Eval(func(name string) bool {
+		if name != tag && !slices.Contains(others, name) {
+			others = append(others, name)
+		}
+		return false
+	})
+	if len(others) > maxConstraintTags {
+		return false
+	}
+
+	satisfiable := false
+	for set := 0; set < 1<<len(others); set++ {
+		eval := func(withTag bool) bool {
+			return expr.Eval(func(name string) bool {
+				if name == tag {
+					return withTag
+				}
+				return set&(1<<slices.Index(others, name)) != 0
+			})
+		}
+		if eval(false) {
+			return false
+		}
+		satisfiable = satisfiable || eval(true)
+	}
+	return satisfiable
+}
+
+func liftFile(fset *token.FileSet, file *ast.File, src []byte, res GoAdvice) error {
+	imports := make(map[string]string, len(file.Imports))
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return err
+		}
+		name := importName(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		switch name {
+		case "_":
+			continue
+		case ".":
+			return fmt.Errorf("%s: dot-imports are not supported in Go advice files", fset.Position(spec.Pos()))
+		}
+		imports[name] = importPath
+	}
+
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		id, ok := adviceID(fn.Doc)
+		if !ok {
+			continue
+		}
+		if id == "" {
+			return fmt.Errorf("%s: missing advice identifier in %s directive", fset.Position(fn.Pos()), goAdviceDirective)
+		}
+		if _, dup := res[id]; dup {
+			return fmt.Errorf("%s: duplicate advice identifier %q", fset.Position(fn.Pos()), id)
+		}
+		if fn.Body == nil {
+			return fmt.Errorf("%s: advice function %s has no body", fset.Position(fn.Pos()), fn.Name.Name)
+		}
+
+		lifted, err := liftFunc(fset, fn, src, imports)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fset.Position(fn.Pos()), err)
+		}
+		res[id] = lifted
+	}
+
+	return nil
+}
+
+// adviceID returns the identifier specified by the `//orchestrion:advice`
+// directive in doc, if there is one.
+func adviceID(doc *ast.CommentGroup) (string, bool) {
+	if doc == nil {
+		return "", false
+	}
+	for _, comment := range doc.List {
+		rest, found := strings.CutPrefix(comment.Text, goAdviceDirective)
+		if !found || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+			continue
+		}
+		return strings.TrimSpace(rest), true
+	}
+	return "", false
+}
+
+// templateEscaper escapes text/template delimiters found in Go source code.
+var templateEscaper = strings.NewReplacer("{{", `{{ "{{" }}`, "}}", `{{ "}}" }}`)
+
+func liftFunc(fset *token.FileSet, fn *ast.FuncDecl, src []byte, imports map[string]string) (LiftedAdvice, error) {
+	// Map each declared receiver, parameter & named result to its placeholder.
+	placeholders := make(map[*ast.Object]string)
+	bind := func(fields *ast.FieldList, placeholder func(int) string) {
+		if fields == nil {
+			return
+		}
+		idx := 0
+		for _, field := range fields.List {
+			if len(field.Names) == 0 {
+				idx++
+				continue
+			}
+			for _, name := range field.Names {
+				if name.Obj != nil && name.Name != "_" {
+					placeholders[name.Obj] = placeholder(idx)
+				}
+				idx++
+			}
+		}
+	}
+	bind(fn.Recv, func(int) string { return "{{ .Function.Receiver }}" })
+	bind(fn.Type.Params, func(idx int) string { return fmt.Sprintf("{{ .Function.Argument %d }}", idx) })
+	bind(fn.Type.Results, func(idx int) string { return fmt.Sprintf("{{ .Function.Result %d }}", idx) })
+
+	type replacement struct {
+		start, end int
+		text       string
+	}
+	var (
+		replacements []replacement
+		used         = make(map[string]string)
+		file         = fset.File(fn.Pos())
+	)
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.SelectorExpr:
+			// Unresolved identifiers used as a selector's operand are package names.
+			if ident, ok := node.X.(*ast.Ident); ok && ident.Obj == nil {
+				if importPath, found := imports[ident.Name]; found {
+					used[ident.Name] = importPath
+				}
+			}
+		case *ast.Ident:
+			if placeholder, found := placeholders[node.Obj]; found && node.Obj != nil {
+				replacements = append(replacements, replacement{
+					start: file.Offset(node.Pos()),
+					end:   file.Offset(node.End()),
+					text:  placeholder,
+				})
+			}
+		}
+		return true
+	})
+	slices.SortFunc(replacements, func(l, r replacement) int { return l.start - r.start })
+
+	var (
+		buf   bytes.Buffer
+		start = file.Offset(fn.Body.Lbrace) + 1
+		end   = file.Offset(fn.Body.Rbrace)
+	)
+	if count := len(fn.Body.List); count > 0 {
+		if ret, ok := fn.Body.List[count-1].(*ast.ReturnStmt); ok && len(ret.Results) == 0 {
+			end = file.Offset(ret.Pos())
+		}
+	}
+	for _, repl := range replacements {
+		buf.WriteString(templateEscaper.Replace(string(src[start:repl.start])))
+		buf.WriteString(repl.text)
+		start = repl.end
+	}
+	buf.WriteString(templateEscaper.Replace(string(src[start:end])))
+
+	text := dedent(buf.String())
+	if text == "" {
+		return LiftedAdvice{}, errors.New("advice function body is empty")
+	}
+
+	return LiftedAdvice{Source: text, Imports: used}, nil
+}
+
+var majorVersionSuffix = regexp.MustCompile(`^v[0-9]+$`)
+
+// importName returns the conventional name of the package with the specified
+// import path. Packages whose name does not follow the usual conventions must
+// be imported with an explicit name in Go advice files.
+func importName(importPath string) string {
+	name := path.Base(importPath)
+	if majorVersionSuffix.MatchString(name) && path.Dir(importPath) != "." {
+		name = path.Base(path.Dir(importPath))
+	}
+	if idx := strings.LastIndex(name, ".v"); idx > 0 && majorVersionSuffix.MatchString(name[idx+1:]) {
+		// gopkg.in style: gopkg.in/yaml.v3
+		name = name[:idx]
+	}
+	name = strings.TrimPrefix(name, "go-")
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// dedent removes leading and trailing blank lines from text, as well as the
+// indentation that is common to all of its non-blank lines.
+func dedent(text string) string {
+	lines := strings.Split(strings.Trim(text, "\n"), "\n")
+
+	var (
+		prefix string
+		found  bool
+	)
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if !found {
+			prefix, found = indent, true
+			continue
+		}
+		for !strings.HasPrefix(line, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	for idx, line := range lines {
+		lines[idx] = strings.TrimPrefix(line, prefix)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
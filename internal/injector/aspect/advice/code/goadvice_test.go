@@ -0,0 +1,135 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package code_test
+
+import (
+	"context"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/injector/aspect/advice/code"
+	"github.com/DataDog/orchestrion/internal/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const adviceFile = `//go:build orchestrion_advice
+
+package advice
+
+import (
+	"context"
+	"net/http"
+	rtrace "runtime/trace"
+)
+
+//orchestrion:advice start-span
+func _(ctx context.Context, _ int, req *http.Request) (err error) {
+	ctx, task := rtrace.NewTask(ctx, req.URL.Path)
+	defer func() { task.End(); _ = err }()
+	_ = map[string][]int{"a": {1}}
+	return
+}
+
+//orchestrion:advice use-router
+func (r *router) _() {
+	if r.mux == nil {
+		r.mux = http.NewServeMux()
+	}
+}
+
+type router struct{ mux *http.ServeMux }
+`
+
+func TestParseGoAdvice(t *testing.T) {
+	// Advice files are meant to be compile-checked, so the fixture must be valid Go.
+	typeCheck(t, adviceFile)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "advice.go"), []byte(adviceFile), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "regular.go"), []byte("package advice\n\n//orchestrion:advice start-span\nfunc _() { panic(nil) }\n"), 0o644))
+
+	advice, err := code.ParseGoAdvice(dir)
+	require.NoError(t, err)
+	require.Len(t, advice, 2)
+
+	assert.Equal(t, code.LiftedAdvice{
+		Source: `{{ .Function.Argument 0 }}, task := rtrace.NewTask({{ .Function.Argument 0 }}, {{ .Function.Argument 2 }}.URL.Path)
+defer func() { task.End(); _ = {{ .Function.Result 0 }} }()
+_ = map[string][]int{"a": {1{{ "}}" }}`,
+		Imports: map[string]string{"rtrace": "runtime/trace"},
+	}, advice["start-span"])
+
+	assert.Equal(t, code.LiftedAdvice{
+		Source: `if {{ .Function.Receiver }}.mux == nil {
+	{{ .Function.Receiver }}.mux = http.NewServeMux()
+}`,
+		Imports: map[string]string{"http": "net/http"},
+	}, advice["use-router"])
+}
+
+func TestParseGoAdviceConstraints(t *testing.T) {
+	for _, tc := range []struct {
+		constraint string
+		expected   bool
+	}{
+		{"orchestrion_advice", true},
+		{"orchestrion_advice && linux", true},
+		{"(orchestrion_advice && cgo) || (orchestrion_advice && !windows)", true},
+		{"orchestrion_advice || linux", false},
+		{"!orchestrion_advice", false},
+		{"orchestrion_advice && !orchestrion_advice", false},
+		{"linux", false},
+	} {
+		t.Run(tc.constraint, func(t *testing.T) {
+			src := "//go:build " + tc.constraint + "\n\npackage advice\n\n//orchestrion:advice noop\nfunc _() { println() }\n"
+			typeCheck(t, src)
+
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "advice.go"), []byte(src), 0o644))
+
+			advice, err := code.ParseGoAdvice(dir)
+			require.NoError(t, err)
+			_, found := advice["noop"]
+			assert.Equal(t, tc.expected, found)
+		})
+	}
+}
+
+func TestTemplateGoAdvice(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "advice.go"), []byte(adviceFile), 0o644))
+	ctx := code.WithGoAdviceDir(context.Background(), dir)
+
+	var tmpl code.Template
+	require.NoError(t, yaml.UnmarshalContext(ctx, strings.NewReader("go-advice: use-router\nimports: { http: net/http }\nlang: go1.22"), &tmpl))
+	assert.Equal(t, map[string]string{"http": "net/http"}, tmpl.Imports)
+	assert.Contains(t, tmpl.Source, "http.NewServeMux()")
+
+	err := yaml.UnmarshalContext(ctx, strings.NewReader("go-advice: missing"), &tmpl)
+	require.ErrorContains(t, err, `go-advice "missing": no function annotated with //orchestrion:advice missing`)
+
+	err = yaml.UnmarshalContext(ctx, strings.NewReader("go-advice: use-router\ntemplate: foo()"), &tmpl)
+	require.ErrorContains(t, err, "only one of 'template' and 'go-advice' may be specified")
+}
+
+// typeCheck fails the test if src is not a valid Go file.
+func typeCheck(t *testing.T, src string) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "advice.go", src, parser.ParseComments)
+	require.NoError(t, err)
+	cfg := types.Config{Importer: importer.Default()}
+	_, err = cfg.Check("example.com/advice", fset, []*ast.File{file}, nil)
+	require.NoError(t, err)
+}
@@ -11,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 	"go/token"
+	"maps"
 	"strconv"
 	"strings"
 	"text/template"
@@ -218,6 +219,7 @@ var _ yaml.NodeUnmarshalerContext = (*Template)(nil)
 func (t *Template) UnmarshalYAML(ctx gocontext.Context, node ast.Node) (err error) {
 	var cfg struct {
 		Template string
+		GoAdvice string `yaml:"go-advice"`
 		Imports  map[string]string
 		Links    []string
 		Lang     context.GoLangVersion
@@ -226,6 +228,21 @@ func (t *Template) UnmarshalYAML(ctx gocontext.Context, node ast.Node) (err erro
 		return
 	}
 
+	if cfg.GoAdvice != "" {
+		if cfg.Template != "" {
+			return errors.New("only one of 'template' and 'go-advice' may be specified")
+		}
+		lifted, err := goAdvice(ctx, cfg.GoAdvice)
+		if err != nil {
+			return err
+		}
+		cfg.Template = lifted.Source
+		imports := make(map[string]string, len(lifted.Imports)+len(cfg.Imports))
+		maps.Copy(imports, lifted.Imports)
+		maps.Copy(imports, cfg.Imports)
+		cfg.Imports = imports
+	}
+
 	newT, err := NewTemplate(cfg.Template, cfg.Imports, cfg.Lang)
 	if err != nil {
 		return err
@@ -12,6 +12,7 @@ import (
 
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/goccy/go-yaml/ast"
 )
@@ -36,6 +37,15 @@ func (a addBlankImport) Hash(h *fingerprint.Hasher) error {
 }
 
 func init() {
+	schemas["add-blank-import"] = schema.Entry{
+		Title:       "Import packages for side-effects",
+		Description: "The `add-blank-import` advice inserts a new blank (`_`) import in the matched node's parent `File` node. This does nothing if the target package is already imported in the file.\n\nThis can be used to ensure `unsafe` is imported when using `//go:linkname` directives.",
+		Schema: `
+type: string
+minLength: 1`,
+		Examples: []string{`add-blank-import: unsafe`},
+	}
+
 	unmarshalers["add-blank-import"] = func(ctx gocontext.Context, node ast.Node) (Advice, error) {
 		var path string
 		if err := yaml.NodeToValueContext(ctx, node, &path); err != nil {
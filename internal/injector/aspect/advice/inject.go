@@ -12,6 +12,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/advice/code"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/goccy/go-yaml/ast"
 )
@@ -67,6 +68,41 @@ func (a injectDeclarations) AddedImports() []string {
 }
 
 func init() {
+	schemas["inject-declarations"] = schema.Entry{
+		Title:       "Introduce new declarations in the package",
+		Description: "The `inject-declarations` advice merges declarations produced by a code template into the matched node's compilation unit.\n\nThis is often used to introduce new type definitions or declare foreign functions linked via `//go:linkname` to avoid creating dependency cycles.",
+		Schema: `
+unevaluatedProperties: false
+allOf:
+  - $ref: '#/$defs/code-template'
+  - properties:
+      links:
+        description: An optional list of packages that need to be linked with the injected code in order to satisfy //go:linkname directives.
+        type: array
+        items: { type: string, minLength: 1 }
+        uniqueItems: true`,
+		Examples: []string{`
+inject-declarations:
+  imports:
+    context: context
+    ddtrace: gopkg.in/DataDog/dd-trace-go.v1/ddtrace
+  links:
+    - gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer
+  template: |-
+    //go:linkname __dd_tracer_StartSpanFromContext gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer.StartSpanFromContext
+    func __dd_tracer_StartSpanFromContext(context.Context, string, ...ddtrace.StartSpanOption) (ddtrace.Span, context.Context)`, `
+inject-declarations:
+  imports:
+    telemetry: gopkg.in/DataDog/dd-trace-go.v1/internal/telemetry
+    tracer: gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer
+  template: |-
+    func init() {
+      telemetry.LoadIntegration("gorilla/mux")
+      tracer.MarkIntegrationImported("github.com/gorilla/mux")
+    }`,
+		},
+	}
+
 	unmarshalers["inject-declarations"] = func(ctx gocontext.Context, node ast.Node) (Advice, error) {
 		var config struct {
 			Template *code.Template `yaml:",inline"`
@@ -12,6 +12,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/join"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/dave/dst"
 	"github.com/goccy/go-yaml/ast"
@@ -67,6 +68,30 @@ func (a *addStructField) AddedImports() []string {
 }
 
 func init() {
+	schemas["add-struct-field"] = schema.Entry{
+		Title:       "Add new fields to struct types",
+		Description: "The `add-struct-field` advice inserts a new field in a `struct` type declaration (typically matched by `struct-definition`).\n\nThis is typically used to insert new state to `struct`s when instrumenting libraries that return `struct` pointers (as opposed to interface values).",
+		Schema: `
+type: object
+additionalProperties: false
+required: [name, type]
+properties:
+  name:
+    description: The name of the field to add.
+    $ref: '#/$defs/go/identifier'
+  type:
+    description: The type of the field to add.
+    $ref: '#/$defs/go/type-ref'`,
+		Examples: []string{`
+add-struct-field:
+  name: __dd_configuration
+  type: any`, `
+add-struct-field:
+  name: clientOptions
+  type: gopkg.in/DataDog/dd-trace-go.v1/contrib/elastic/go-elasticsearch.v6.ClientOption`,
+		},
+	}
+
 	unmarshalers["add-struct-field"] = func(ctx gocontext.Context, node ast.Node) (Advice, error) {
 		var spec struct {
 			Name string
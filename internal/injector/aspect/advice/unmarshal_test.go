@@ -0,0 +1,19 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package advice
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemas(t *testing.T) {
+	// Every registered advice type must be documented.
+	require.NoError(t, schemas.Check(slices.Sorted(maps.Keys(unmarshalers))))
+}
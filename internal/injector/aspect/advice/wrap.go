@@ -12,6 +12,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/advice/code"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/dave/dst"
 	"github.com/goccy/go-yaml/ast"
@@ -63,6 +64,31 @@ func (a *wrapExpression) AddedImports() []string {
 }
 
 func init() {
+	schemas["wrap-expression"] = schema.Entry{
+		Title:       "Add behavior around an expression",
+		Description: "The `wrap-expression` advice replaces the matched node with the one produced by the provided code template. Care must be taken to not change the type of the expression, as this could result in breaking surrounding code.\n\nIt is commonly used to wrap values in immediately-invoked function expressions (IIFE).",
+		Schema: `
+$ref: '#/$defs/code-template'
+unevaluatedProperties: false`,
+		Examples: []string{`
+wrap-expression:
+  imports:
+    options: go.mongodb.org/mongo-driver/mongo/options
+    mongotrace: gopkg.in/DataDog/dd-trace-go.v1/contrib/go.mongodb.org/mongo-driver/mongo
+  template: '{{ . }}.SetMonitor(mongotrace.NewMonitor())'`, `
+wrap-expression:
+  imports:
+    chi: github.com/go-chi/chi
+    chitrace: gopkg.in/DataDog/dd-trace-go.v1/contrib/go-chi/chi
+  template: |-
+    func() *chi.Mux {
+      mux := {{ . }}
+      mux.Use(chitrace.Middleware())
+      return mux
+    }()`,
+		},
+	}
+
 	unmarshalers["wrap-expression"] = func(ctx gocontext.Context, node ast.Node) (Advice, error) {
 		var template code.Template
 		if err := yaml.NodeToValueContext(ctx, node, &template); err != nil {
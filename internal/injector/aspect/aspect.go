@@ -8,12 +8,17 @@ package aspect
 import (
 	"context"
 	"errors"
+	"slices"
+	"strings"
 
+	"github.com/DataDog/orchestrion/internal/constraint"
 	"github.com/DataDog/orchestrion/internal/fingerprint"
+	"github.com/DataDog/orchestrion/internal/goenv"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/advice"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/join"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/goccy/go-yaml/ast"
+	"github.com/rs/zerolog"
 )
 
 // Aspect binds advice.Advice to a join.Point, effectively defining a complete
@@ -27,18 +32,155 @@ type Aspect struct {
 	TracerInternal bool
 	// ID is the identifier of the aspect within its configuration file.
 	ID string
+	// Requires optionally restricts this aspect to builds where the specified
+	// module is selected at a version satisfying the constraint.
+	Requires *Requirement
+	// When optionally restricts this aspect to builds for a matching target
+	// platform and build tags.
+	When *Condition
+}
+
+// Requirement is a constraint on the version of a module that must be part of
+// the build's module graph for an aspect to be applied.
+type Requirement struct {
+	// Module is the path of the required module.
+	Module string `yaml:"module"`
+	// Version is the constraint the selected version of the module must satisfy.
+	// A zero constraint accepts any version.
+	Version constraint.Constraint `yaml:"version"`
+}
+
+// Condition is a constraint on the target platform and build tags of the build
+// for an aspect to be applied. Empty lists are always satisfied.
+type Condition struct {
+	// GOOS lists the operating systems the aspect applies to.
+	GOOS []string `yaml:"goos"`
+	// GOARCH lists the architectures the aspect applies to.
+	GOARCH []string `yaml:"goarch"`
+	// Tags lists build tags that must all be satisfied for the aspect to apply.
+	// Tags prefixed with `!` must not be satisfied instead.
+	Tags []string `yaml:"tags"`
 }
 
 func (a *Aspect) Hash(h *fingerprint.Hasher) error {
-	return h.Named(
-		"aspect",
+	vals := []fingerprint.Hashable{
 		fingerprint.String(a.ID),
 		fingerprint.Bool(a.TracerInternal),
 		a.JoinPoint,
 		fingerprint.List[advice.Advice](a.Advice),
+	}
+	if a.Requires != nil {
+		vals = append(vals, a.Requires)
+	}
+	if a.When != nil {
+		vals = append(vals, a.When)
+	}
+	return h.Named("aspect", vals...)
+}
+
+func (r *Requirement) Hash(h *fingerprint.Hasher) error {
+	return h.Named("requires", fingerprint.String(r.Module), r.Version)
+}
+
+// Satisfied returns true if the provided module version satisfies this
+// requirement. An empty version denotes a module that is part of the main
+// module set (e.g, the main module itself or a workspace module), which has no
+// version and is always considered to satisfy the requirement.
+func (r *Requirement) Satisfied(version string) bool {
+	return version == "" || r.Version.Check(version)
+}
+
+func (c *Condition) Hash(h *fingerprint.Hasher) error {
+	str := func(s string) fingerprint.String { return fingerprint.String(s) }
+	return h.Named("when",
+		fingerprint.Cast(c.GOOS, str),
+		fingerprint.Cast(c.GOARCH, str),
+		fingerprint.Cast(c.Tags, str),
 	)
 }
 
+// Satisfied returns true if the provided target satisfies this condition.
+func (c *Condition) Satisfied(target goenv.Target) bool {
+	if len(c.GOOS) != 0 && !slices.ContainsFunc(c.GOOS, target.HasTag) {
+		return false
+	}
+	if len(c.GOARCH) != 0 && !slices.Contains(c.GOARCH, target.GOARCH) {
+		return false
+	}
+	for _, tag := range c.Tags {
+		if neg, isNeg := strings.CutPrefix(tag, "!"); isNeg {
+			if target.HasTag(neg) {
+				return false
+			}
+		} else if !target.HasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// Conditional returns true if any of the supplied aspects has a [Aspect.When]
+// condition, meaning the target of the build is needed to filter them.
+func Conditional(list []*Aspect) bool {
+	return slices.ContainsFunc(list, func(a *Aspect) bool { return a.When != nil })
+}
+
+// FilterTarget removes aspects whose [Aspect.When] condition is not satisfied
+// by the provided target from list, which is modified in place.
+func FilterTarget(ctx context.Context, target goenv.Target, list []*Aspect) []*Aspect {
+	log := zerolog.Ctx(ctx)
+	return slices.DeleteFunc(list, func(a *Aspect) bool {
+		if a.When == nil || a.When.Satisfied(target) {
+			return false
+		}
+		log.Debug().Str("aspect", a.ID).Str("goos", target.GOOS).Str("goarch", target.GOARCH).Strs("tags", target.Tags).Msg("Skipping aspect: condition is not satisfied by the build target")
+		return true
+	})
+}
+
+// FilterRequirements removes aspects whose [Aspect.Requires] is not satisfied by
+// the provided module versions (keyed by module path) from list, which is
+// modified in place. Modules absent from versions are not part of the build.
+func FilterRequirements(ctx context.Context, versions map[string]string, list []*Aspect) []*Aspect {
+	log := zerolog.Ctx(ctx)
+	return slices.DeleteFunc(list, func(a *Aspect) bool {
+		if a.Requires == nil {
+			return false
+		}
+		version, found := versions[a.Requires.Module]
+		if !found {
+			log.Debug().Str("aspect", a.ID).Str("module", a.Requires.Module).Msg("Skipping aspect: required module is not part of the build")
+			return true
+		}
+		if !a.Requires.Satisfied(version) {
+			log.Debug().Str("aspect", a.ID).Str("module", a.Requires.Module).Str("requires", a.Requires.Version.String()).Str("version", version).Msg("Skipping aspect: required module version is not satisfied")
+			return true
+		}
+		return false
+	})
+}
+
+// RequiredModules returns the list of module paths that are referenced by the
+// [Aspect.Requires] of the supplied aspects. The output list is not sorted in
+// any particular way but does not contain duplicated entries.
+func RequiredModules(list []*Aspect) []string {
+	var res []string
+	dedup := make(map[string]struct{})
+
+	for _, a := range list {
+		if a.Requires == nil {
+			continue
+		}
+		if _, dup := dedup[a.Requires.Module]; dup {
+			continue
+		}
+		dedup[a.Requires.Module] = struct{}{}
+		res = append(res, a.Requires.Module)
+	}
+
+	return res
+}
+
 func (a *Aspect) AddedImports() (imports []string) {
 	// "unsafe" is always implied, because it's special-cased in the go toolchain, and is not a "normal" module.
 	implied := map[string]struct{}{"unsafe": {}}
@@ -79,10 +221,12 @@ func InjectedPaths(list []*Aspect) []string {
 
 func (a *Aspect) UnmarshalYAML(ctx context.Context, node ast.Node) error {
 	var ti struct {
-		JoinPoint      ast.Node `yaml:"join-point"`
-		Advice         ast.Node `yaml:"advice"`
-		ID             string   `yaml:"id"`
-		TracerInternal bool     `yaml:"tracer-internal"`
+		JoinPoint      ast.Node     `yaml:"join-point"`
+		Advice         ast.Node     `yaml:"advice"`
+		ID             string       `yaml:"id"`
+		TracerInternal bool         `yaml:"tracer-internal"`
+		Requires       *Requirement `yaml:"requires"`
+		When           *Condition   `yaml:"when"`
 	}
 	if err := yaml.NodeToValueContext(ctx, node, &ti); err != nil {
 		return err
@@ -95,8 +239,14 @@ func (a *Aspect) UnmarshalYAML(ctx context.Context, node ast.Node) error {
 		return errors.New("missing required key 'advice'")
 	}
 
+	if ti.Requires != nil && ti.Requires.Module == "" {
+		return errors.New("missing required key 'module' in 'requires'")
+	}
+
 	a.ID = ti.ID
 	a.TracerInternal = ti.TracerInternal
+	a.Requires = ti.Requires
+	a.When = ti.When
 
 	var err error
 	if a.JoinPoint, err = join.FromYAML(ctx, ti.JoinPoint); err != nil {
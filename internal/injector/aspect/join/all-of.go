@@ -11,6 +11,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/may"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/goccy/go-yaml/ast"
 )
@@ -65,6 +66,21 @@ func (o allOf) Hash(h *fingerprint.Hasher) error {
 }
 
 func init() {
+	schemas["all-of"] = schema.Entry{
+		Title:       "Intersection of multiple join points",
+		Description: "The `all-of` join point matches any AST node that maches **all** of the children join points. This is typically useful to combine node-agnostic join points (`import-path`, `package`, `directive`, ...) with another join point.",
+		Schema: `
+type: array
+items: { $ref: '#/$defs/JoinPoint' }
+minItems: 2`,
+		Examples: []string{`
+all-of:
+  - directive: dd:span
+  - function:
+      - receiver: '*net/http.RoundTripper'`,
+		},
+	}
+
 	unmarshalers["all-of"] = func(ctx gocontext.Context, node ast.Node) (Point, error) {
 		var nodes []ast.Node
 		if err := yaml.NodeToValueContext(ctx, node, &nodes); err != nil {
@@ -11,6 +11,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/may"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/goccy/go-yaml/ast"
 
@@ -50,6 +51,22 @@ func (jp configuration) Hash(h *fingerprint.Hasher) error {
 }
 
 func init() {
+	schemas["configuration"] = schema.Entry{
+		Title:       "Allows external configuration",
+		Description: "The `configuration` join point is node-agnostic. It matches all AST nodes if the associated configuration object includes all the specified key-value pairs.",
+		Deprecated:  true,
+		Schema: `
+type: object
+additionalProperties: false
+patternProperties:
+  '^.*$': { type: string }
+minProperties: 1`,
+		Examples: []string{
+			`configuration: { httpmode: report }`,
+			`configuration: { httpmode: wrap }`,
+		},
+	}
+
 	unmarshalers["configuration"] = func(ctx gocontext.Context, node ast.Node) (Point, error) {
 		var c configuration
 		return c, yaml.NodeToValueContext(ctx, node, &c)
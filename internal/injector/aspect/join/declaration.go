@@ -13,6 +13,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/may"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/dave/dst"
 	"github.com/goccy/go-yaml/ast"
@@ -120,6 +121,13 @@ func (i *valueDeclaration) Hash(h *fingerprint.Hasher) error {
 var symbolNamePattern = regexp.MustCompile(`\A(.+)\.([\p{L}_][\p{L}_\p{Nd}]*)\z`)
 
 func init() {
+	schemas["declaration-of"] = schema.Entry{
+		Description: "The `declaration-of` join point matches top-level declarations. It matches only `ValueSpec` and `FuncDecl` nodes.",
+		Schema: `
+type: string
+pattern: '^.+\.[\p{L}_][\p{L}_\p{Nd}]*$'`,
+	}
+
 	unmarshalers["declaration-of"] = func(ctx gocontext.Context, node ast.Node) (Point, error) {
 		var symbol string
 		if err := yaml.NodeToValueContext(ctx, node, &symbol); err != nil {
@@ -134,6 +142,16 @@ func init() {
 		return DeclarationOf(matches[1], matches[2]), nil
 	}
 
+	schemas["value-declaration"] = schema.Entry{
+		Title:       "Package-level `var` and `const` declarations",
+		Description: "The `value-declaration` join point matches package-level `var` and `const` declarations of the specifid type. It is often used in combination with `directive`, to replace the initial value of these declarations. This join point only matches `GenDecl` nodes.",
+		Schema:      `$ref: '#/$defs/go/type-ref'`,
+		Examples: []string{
+			`value-declaration: int`,
+			`value-declaration: '*regexp.Regexp'`,
+		},
+	}
+
 	unmarshalers["value-declaration"] = func(ctx gocontext.Context, node ast.Node) (Point, error) {
 		var typeName string
 		if err := yaml.NodeToValueContext(ctx, node, &typeName); err != nil {
@@ -15,6 +15,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/may"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/dave/dst"
 	"github.com/goccy/go-yaml/ast"
@@ -132,6 +133,15 @@ func (d directive) Hash(h *fingerprint.Hasher) error {
 }
 
 func init() {
+	schemas["directive"] = schema.Entry{
+		Title:       "Declarative join points",
+		Description: "The `directive` join point is node-agnostic. It matches any AST node that is annotated with the specified directive.\n\nA directive is a special single-line comment such as `//go:linkname`. In order for a comment to be considered a directive, there must be no white space between the `//` and the directive name.",
+		Schema: `
+type: string
+pattern: '[\w:]+'`,
+		Examples: []string{`directive: dd:span`},
+	}
+
 	unmarshalers["directive"] = func(ctx gocontext.Context, node ast.Node) (Point, error) {
 		var name string
 		if err := yaml.NodeToValueContext(ctx, node, &name); err != nil {
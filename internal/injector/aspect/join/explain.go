@@ -0,0 +1,207 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package join
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
+	"github.com/dave/dst"
+)
+
+// Evaluation is the detailed outcome of evaluating a [Point] against a node. It
+// mirrors the structure of composite join points so that the reason for a
+// match (or lack thereof) can be reported to users.
+type Evaluation struct {
+	// Description is a human-readable description of the evaluated condition.
+	Description string
+	// Matched is true if the condition matched the node.
+	Matched bool
+	// Culprit is true if this is the first failing sub-condition responsible
+	// for its parent condition not matching.
+	Culprit bool
+	// Children holds the evaluations of the sub-conditions of composite join
+	// points (all-of, one-of, not, function, function-body).
+	Children []Evaluation
+}
+
+// Explain evaluates the provided [Point] against the node represented by ctx,
+// and returns a detailed [Evaluation]. The [Evaluation.Matched] value of the
+// result is always the same as that returned by [Point.Matches].
+func Explain(pt Point, ctx context.AspectContext) Evaluation {
+	switch pt := pt.(type) {
+	case allOf:
+		eval := Evaluation{Description: describe(pt), Children: make([]Evaluation, len(pt))}
+		for i, candidate := range pt {
+			eval.Children[i] = Explain(candidate, ctx)
+		}
+		eval.Matched = len(pt) > 0 && !slices.ContainsFunc(eval.Children, failed)
+		markCulprit(eval.Matched, eval.Children)
+		return eval
+
+	case oneOf:
+		eval := Evaluation{Description: describe(pt), Children: make([]Evaluation, len(pt))}
+		for i, candidate := range pt {
+			eval.Children[i] = Explain(candidate, ctx)
+		}
+		eval.Matched = slices.ContainsFunc(eval.Children, func(e Evaluation) bool { return e.Matched })
+		markCulprit(eval.Matched, eval.Children)
+		return eval
+
+	case not:
+		eval := Evaluation{Description: describe(pt), Children: []Evaluation{Explain(pt.JoinPoint, ctx)}}
+		eval.Matched = !eval.Children[0].Matched
+		// The child is responsible for the failure if it matched.
+		eval.Children[0].Culprit = !eval.Matched
+		return eval
+
+	case *functionDeclaration:
+		return explainFunction(pt, ctx)
+
+	case *functionBody:
+		eval := Evaluation{Description: describe(pt)}
+		parent := ctx.Parent()
+		if parent == nil {
+			eval.Children = []Evaluation{{Description: "node has a parent", Culprit: true}}
+			return eval
+		}
+		defer parent.Release()
+
+		fn := Explain(pt.Function, parent)
+		body := Evaluation{Description: "node is the body of the function"}
+		switch parent := parent.Node().(type) {
+		case *dst.FuncDecl:
+			body.Matched = ctx.Node() == parent.Body
+		case *dst.FuncLit:
+			body.Matched = ctx.Node() == parent.Body
+		}
+		eval.Children = []Evaluation{fn, body}
+		eval.Matched = fn.Matched && body.Matched
+		markCulprit(eval.Matched, eval.Children)
+		return eval
+
+	default:
+		return Evaluation{Description: describe(pt), Matched: pt.Matches(ctx)}
+	}
+}
+
+func explainFunction(pt *functionDeclaration, ctx context.AspectContext) Evaluation {
+	eval := Evaluation{Description: describe(pt)}
+
+	info := functionInformation{ImportPath: ctx.ImportPath()}
+	switch node := ctx.Node().(type) {
+	case *dst.FuncDecl:
+		if node.Recv != nil && len(node.Recv.List) == 1 {
+			info.Receiver = node.Recv.List[0].Type
+		}
+		info.Name = node.Name.Name
+		info.Type = node.Type
+	case *dst.FuncLit:
+		info.Type = node.Type
+	default:
+		eval.Children = []Evaluation{{Description: "node is a function declaration or literal", Culprit: true}}
+		return eval
+	}
+
+	eval.Children = make([]Evaluation, len(pt.Options))
+	for i, opt := range pt.Options {
+		eval.Children[i] = Evaluation{Description: describeOption(opt), Matched: opt.evaluate(info)}
+	}
+	eval.Matched = !slices.ContainsFunc(eval.Children, failed)
+	markCulprit(eval.Matched, eval.Children)
+	return eval
+}
+
+// markCulprit flags the first failing evaluation in children as the culprit, if
+// the parent did not match.
+func markCulprit(matched bool, children []Evaluation) {
+	if matched {
+		return
+	}
+	if idx := slices.IndexFunc(children, failed); idx >= 0 {
+		children[idx].Culprit = true
+	}
+}
+
+func failed(e Evaluation) bool {
+	return !e.Matched
+}
+
+// describe returns a human-readable description of the provided [Point], using
+// the same vocabulary as the YAML configuration files.
+func describe(pt Point) string {
+	switch pt := pt.(type) {
+	case allOf:
+		return "all-of"
+	case oneOf:
+		return "one-of"
+	case not:
+		return "not"
+	case *functionDeclaration:
+		return "function"
+	case *functionBody:
+		return "function-body"
+	case configuration:
+		keys := make([]string, 0, len(pt))
+		for k := range pt {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			pairs[i] = fmt.Sprintf("%s=%s", k, pt[k])
+		}
+		return "configuration: " + strings.Join(pairs, ", ")
+	case *declarationOf:
+		return fmt.Sprintf("declaration-of: %s.%s", pt.ImportPath, pt.Name)
+	case *valueDeclaration:
+		return fmt.Sprintf("value-declaration: %s", pt.TypeName)
+	case directive:
+		return fmt.Sprintf("directive: //%s", string(pt))
+	case *functionCall:
+		return fmt.Sprintf("function-call: %s.%s", pt.ImportPath, pt.Name)
+	case importPath:
+		return fmt.Sprintf("import-path: %s", string(pt))
+	case packageName:
+		return fmt.Sprintf("package-name: %s", string(pt))
+	case *structDefinition:
+		return fmt.Sprintf("struct-definition: %s", pt.TypeName)
+	case *structLiteral:
+		if pt.Field != "" {
+			return fmt.Sprintf("struct-literal: %s (field %s)", pt.TypeName, pt.Field)
+		}
+		return fmt.Sprintf("struct-literal: %s (%s)", pt.TypeName, pt.Match)
+	case testMain:
+		return fmt.Sprintf("test-main: %v", bool(pt))
+	default:
+		return fmt.Sprintf("%T", pt)
+	}
+}
+
+func describeOption(opt FunctionOption) string {
+	switch opt := opt.(type) {
+	case functionName:
+		return fmt.Sprintf("name: %s", string(opt))
+	case *signature:
+		return fmt.Sprintf("signature: (%s) (%s)", joinTypeNames(opt.Arguments), joinTypeNames(opt.Results))
+	case *signatureContains:
+		return fmt.Sprintf("signature-contains: (%s) (%s)", joinTypeNames(opt.Arguments), joinTypeNames(opt.Results))
+	case *receiver:
+		return fmt.Sprintf("receiver: %s", opt.TypeName)
+	default:
+		return fmt.Sprintf("%T", opt)
+	}
+}
+
+func joinTypeNames(names []TypeName) string {
+	strs := make([]string, len(names))
+	for i, name := range names {
+		strs[i] = name.String()
+	}
+	return strings.Join(strs, ", ")
+}
@@ -0,0 +1,114 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package join
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/dave/dst/dstutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	const source = "package main\nfunc handle(s string) error { return nil }\n"
+
+	type testCase struct {
+		point    Point
+		expected Evaluation
+	}
+	tests := map[string]testCase{
+		"function-match": {
+			point: Function(Name("handle"), Signature([]TypeName{MustTypeName("string")}, []TypeName{MustTypeName("error")})),
+			expected: Evaluation{
+				Description: "function",
+				Matched:     true,
+				Children: []Evaluation{
+					{Description: "name: handle", Matched: true},
+					{Description: "signature: (string) (error)", Matched: true},
+				},
+			},
+		},
+		"function-culprit": {
+			point: Function(Name("other"), Receiver(MustTypeName("*example.com/pkg.T"))),
+			expected: Evaluation{
+				Description: "function",
+				Children: []Evaluation{
+					{Description: "name: other", Culprit: true},
+					{Description: "receiver: *example.com/pkg.T"},
+				},
+			},
+		},
+		"all-of": {
+			point: AllOf(ImportPath("main"), Function(Name("other")), FunctionCall("net/http", "Get")),
+			expected: Evaluation{
+				Description: "all-of",
+				Children: []Evaluation{
+					{Description: "import-path: main", Matched: true},
+					{
+						Description: "function",
+						Culprit:     true,
+						Children:    []Evaluation{{Description: "name: other", Culprit: true}},
+					},
+					{Description: "function-call: net/http.Get"},
+				},
+			},
+		},
+		"one-of": {
+			point: OneOf(ImportPath("other"), Not(ImportPath("main"))),
+			expected: Evaluation{
+				Description: "one-of",
+				Children: []Evaluation{
+					{Description: "import-path: other", Culprit: true},
+					{
+						Description: "not",
+						Children:    []Evaluation{{Description: "import-path: main", Matched: true, Culprit: true}},
+					},
+				},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			astFile, err := parser.ParseFile(fset, "input.go", source, parser.ParseComments)
+			require.NoError(t, err)
+			dstFile, err := decorator.NewDecorator(fset).DecorateFile(astFile)
+			require.NoError(t, err)
+
+			var (
+				chain *context.NodeChain
+				eval  *Evaluation
+			)
+			dstutil.Apply(dstFile, func(csor *dstutil.Cursor) bool {
+				if csor.Node() == nil {
+					return false
+				}
+				chain = chain.Child(csor)
+				if _, ok := csor.Node().(*dst.FuncDecl); ok {
+					ctx := chain.Context(context.ContextArgs{Cursor: csor, ImportPath: "main", File: dstFile})
+					defer ctx.Release()
+					res := Explain(tc.point, ctx)
+					assert.Equal(t, tc.point.Matches(ctx), res.Matched)
+					eval = &res
+				}
+				return true
+			}, func(*dstutil.Cursor) bool {
+				chain = chain.Parent()
+				return true
+			})
+
+			require.NotNil(t, eval)
+			assert.Equal(t, tc.expected, *eval)
+		})
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/may"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/dave/dst"
 	"github.com/goccy/go-yaml/ast"
@@ -72,6 +73,16 @@ func (i *functionCall) Hash(h *fingerprint.Hasher) error {
 var funcNamePattern = regexp.MustCompile(`\A(?:(.+)\.)?([\p{L}_][\p{L}_\p{Nd}]*)\z`)
 
 func init() {
+	schemas["function-call"] = schema.Entry{
+		Title:       "Target function calls",
+		Description: "The `function-call` join point matches function call nodes that represent a call to the specified function. It only mathces `Call` nodes.",
+		Schema:      `$ref: '#/$defs/go/qualified-identifier'`,
+		Examples: []string{
+			`function-call: net/http.Get`,
+			`function-call: net/http.Post`,
+		},
+	}
+
 	unmarshalers["function-call"] = func(ctx gocontext.Context, node ast.Node) (Point, error) {
 		var symbol string
 		if err := yaml.NodeToValueContext(ctx, node, &symbol); err != nil {
@@ -14,6 +14,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/may"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/dave/dst"
 	"github.com/goccy/go-yaml/ast"
@@ -351,6 +352,19 @@ func (s *functionBody) Hash(h *fingerprint.Hasher) error {
 }
 
 func init() {
+	schemas["function-body"] = schema.Entry{
+		Title:       "Targets a function's body",
+		Description: "The `function-body` join point matches the block of code that constitutes the body of a function declaration, or a function literal expression. It only matches `Block` nodes.",
+		Schema:      `$ref: '#/$defs/JoinPoint'`,
+		Examples: []string{`
+function-body:
+  all-of:
+    - directive: annotation
+    - function:
+        - name: ServeHTTP`,
+		},
+	}
+
 	unmarshalers["function-body"] = func(ctx gocontext.Context, node ast.Node) (Point, error) {
 		up, err := FromYAML(ctx, node)
 		if err != nil {
@@ -359,6 +373,63 @@ func init() {
 		return FunctionBody(up), nil
 	}
 
+	schemas["function"] = schema.Entry{
+		Title:       "Select function and method signatures",
+		Description: "The `function` join point selects function and method declarations or function literal expressions that match the provided criteria.",
+		Schema: `
+type: array
+items: { $ref: '#/$defs/join-point/function/$defs/option' }
+minItems: 1`,
+		Defs: `
+option:
+  type: object
+  unevaluatedProperties: false
+  oneOf:
+    - required: [name]
+      unevaluatedProperties: false
+      properties:
+        name:
+          description: Matches only functions with the provided name. A blank name matches only function literal expressions.
+          oneOf:
+            - $ref: '#/$defs/go/identifier'
+            - const: ''
+    - required: [receiver]
+      unevaluatedProperties: false
+      properties:
+        receiver:
+          description: Matches only method declarations for the provided receiver type.
+          $ref: '#/$defs/go/qualified-identifier'
+    - required: [signature]
+      unevaluatedProperties: false
+      properties:
+        signature:
+          description: Matches only functions with the specified signature.
+          $ref: '#/$defs/join-point/function/$defs/signature'
+    - required: [signature-contains]
+      unevaluatedProperties: false
+      properties:
+        signature-contains:
+          description: Matches only functions whose signature includes at least one of the specified argument or return value types.
+          $ref: '#/$defs/join-point/function/$defs/signature'
+signature:
+  type: object
+  properties:
+    args:
+      description: The types of arguments accepted by the function.
+      type: array
+      items: { $ref: '#/$defs/go/qualified-identifier' }
+    returns:
+      description: The types of values returned by the function.
+      type: array
+      items: { $ref: '#/$defs/go/qualified-identifier' }
+  additionalProperties: false`,
+		Examples: []string{`
+function:
+  - name: main
+  - signature: {}`,
+		},
+	}
+
 	unmarshalers["function"] = func(ctx gocontext.Context, node ast.Node) (Point, error) {
 		var unmarshalOpts []unmarshalFuncDeclOption
 		if err := yaml.NodeToValueContext(ctx, node, &unmarshalOpts); err != nil {
@@ -10,6 +10,7 @@ package join
 import (
 	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
@@ -89,6 +90,21 @@ func (n TypeName) Pointer() bool {
 	return n.pointer
 }
 
+// String returns the type name in the same syntax as accepted by
+// [NewTypeName].
+func (n TypeName) String() string {
+	var sb strings.Builder
+	if n.pointer {
+		sb.WriteByte('*')
+	}
+	if n.path != "" {
+		sb.WriteString(n.path)
+		sb.WriteByte('.')
+	}
+	sb.WriteString(n.name)
+	return sb.String()
+}
+
 // Matches determines whether the provided node represents the same type as this
 // TypeName.
 func (n TypeName) Matches(node dst.Expr) bool {
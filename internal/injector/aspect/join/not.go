@@ -11,6 +11,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/may"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/goccy/go-yaml/ast"
 )
 
@@ -43,6 +44,16 @@ func (n not) Hash(h *fingerprint.Hasher) error {
 }
 
 func init() {
+	schemas["not"] = schema.Entry{
+		Title:       "Negation of a join point",
+		Description: "The `not` join point is node-agnostic. It matches any node **not** matched by the specified join point.",
+		Schema:      `$ref: '#/$defs/JoinPoint'`,
+		Examples: []string{
+			`not: { directive: dd:span }`,
+			`not: { function: [{ receiver: net/http.Server }] }`,
+		},
+	}
+
 	unmarshalers["not"] = func(ctx gocontext.Context, node ast.Node) (Point, error) {
 		jp, err := FromYAML(ctx, node)
 		if err != nil {
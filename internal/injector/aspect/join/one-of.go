@@ -11,6 +11,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/may"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/goccy/go-yaml/ast"
 )
@@ -76,6 +77,21 @@ func (o oneOf) Hash(h *fingerprint.Hasher) error {
 }
 
 func init() {
+	schemas["one-of"] = schema.Entry{
+		Title:       "Union of join points",
+		Description: "The `one-of` join point is node-agnostic. It matches any node that is matched by **at least one** of the children join points. This is typically used with multiple instances of the same join point, to match multiple alternative conditions.",
+		Schema: `
+type: array
+items: { $ref: '#/$defs/JoinPoint' }
+minItems: 2`,
+		Examples: []string{`
+one-of:
+  - function-call: google.golang.org/grpc.Dial
+  - function-call: google.golang.org/grpc.DialContext
+  - function-call: google.golang.org/grpc.NewClientConn`,
+		},
+	}
+
 	unmarshalers["one-of"] = func(ctx gocontext.Context, node ast.Node) (Point, error) {
 		var nodes []ast.Node
 		if err := yaml.NodeToValueContext(ctx, node, &nodes); err != nil {
@@ -11,6 +11,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/may"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/goccy/go-yaml/ast"
 )
@@ -76,6 +77,18 @@ func (p packageName) Hash(h *fingerprint.Hasher) error {
 }
 
 func init() {
+	schemas["import-path"] = schema.Entry{
+		Title:       "Limit to certain packages",
+		Description: "The `import-path` join point is node-agnostic. It matches any node within an AST that belongs to the specified import path. This is often used together with `not` to avoid creating infinitely recursive instrumentation.",
+		Schema: `
+type: string
+minLength: 1`,
+		Examples: []string{
+			`import-path: net/http`,
+			`import-path: github.com/gorilla/mux`,
+		},
+	}
+
 	unmarshalers["import-path"] = func(ctx gocontext.Context, node ast.Node) (Point, error) {
 		var name string
 		if err := yaml.NodeToValueContext(ctx, node, &name); err != nil {
@@ -84,6 +97,13 @@ func init() {
 		return ImportPath(name), nil
 	}
 
+	schemas["package-name"] = schema.Entry{
+		Title:       "Limit to certain package names",
+		Description: "The `package-name` join point is node-agnostic. It matches any node that is within a package of the given name. This is typically used to instrument things in the `main` package.",
+		Schema:      `$ref: '#/$defs/go/identifier'`,
+		Examples:    []string{`package-name: main`},
+	}
+
 	unmarshalers["package-name"] = func(ctx gocontext.Context, node ast.Node) (Point, error) {
 		var name string
 		if err := yaml.NodeToValueContext(ctx, node, &name); err != nil {
@@ -13,6 +13,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/may"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/dave/dst"
 	"github.com/goccy/go-yaml/ast"
@@ -179,6 +180,13 @@ func (s *structLiteral) Hash(h *fingerprint.Hasher) error {
 }
 
 func init() {
+	schemas["struct-definition"] = schema.Entry{
+		Title:       "Match struct type definitions",
+		Description: "The `struct-definition` join point matches the struct type definition that declares the designated type. It only matches `TypeSpec` nodes.",
+		Schema:      `$ref: '#/$defs/go/qualified-identifier'`,
+		Examples:    []string{`struct-definition: github.com/gorilla/mux.Router`},
+	}
+
 	unmarshalers["struct-definition"] = func(ctx gocontext.Context, node ast.Node) (Point, error) {
 		var spec string
 		if err := yaml.NodeToValueContext(ctx, node, &spec); err != nil {
@@ -195,6 +203,43 @@ func init() {
 
 		return StructDefinition(tn), nil
 	}
+	schemas["struct-literal"] = schema.Entry{
+		Title:       "Match struct literal expressions",
+		Description: "The `struct-literal` join point matches struct literal expressions that create an instance of the named struct. In case of `match` being equal to `value-only` or `any`, the matched node will be of type `CompositeLit`, and in case of being `pointer-only`, it will be of type `UnaryExpr` (the node itself will be available in the `{{ .X }}` field). If `field` is specified, it only matches the value explicitly associated to the named field.\n\nWhen using `match: any`, the struct literal may have its address immediately taken (`&SomeType{/*...*/}`), and associated advice must be carefully designed to avoid breaking this (for example, wrapping it in an immediately-invoked function expression makes it impossible to take the value's address without first assigning it to a variable).",
+		Schema: `
+oneOf:
+  - type: object
+    required: [type, field]
+    properties:
+      type:
+        description: The fully qualified type name of the struct to match.
+        $ref: '#/$defs/go/qualified-identifier'
+      field:
+        description: Only match struct literal expressions that include the specified field name.
+        $ref: '#/$defs/go/identifier'
+    additionalProperties: false
+  - type: object
+    required: [type]
+    properties:
+      type:
+        description: The fully qualified type name of the struct to match.
+        $ref: '#/$defs/go/qualified-identifier'
+      match:
+        description: The struct literal expression style to match (value-only, pointer-only or any)
+        type: string
+        enum: [value-only, pointer-only, any]
+        default: any
+    additionalProperties: false`,
+		Examples: []string{`
+struct-literal:
+  type: net/http.Server
+  field: Handler`, `
+struct-literal:
+  type: net/http.Transport
+  match: pointer-only`,
+		},
+	}
+
 	unmarshalers["struct-literal"] = func(ctx gocontext.Context, node ast.Node) (Point, error) {
 		var spec struct {
 			Type  string
@@ -11,6 +11,7 @@ import (
 	"github.com/DataDog/orchestrion/internal/fingerprint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/may"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/goccy/go-yaml/ast"
 )
@@ -48,6 +49,12 @@ func (t testMain) Hash(h *fingerprint.Hasher) error {
 }
 
 func init() {
+	schemas["test-main"] = schema.Entry{
+		Title:       "Synthetic test main package",
+		Description: "The `test-main` join point can be used to only (or never) match nodes included in the synthetic main package generated by `go test`.",
+		Schema:      `type: boolean`,
+	}
+
 	unmarshalers["test-main"] = func(ctx gocontext.Context, node ast.Node) (Point, error) {
 		var val bool
 		if err := yaml.NodeToValueContext(ctx, node, &val); err != nil {
@@ -9,13 +9,24 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/DataDog/orchestrion/internal/injector/singleton"
 	"github.com/goccy/go-yaml/ast"
 )
 
 type unmarshalerFn func(context.Context, ast.Node) (Point, error)
 
-var unmarshalers = make(map[string]unmarshalerFn)
+var (
+	unmarshalers = make(map[string]unmarshalerFn)
+	// schemas documents the YAML shape of each entry in unmarshalers.
+	schemas = make(schema.Registry)
+)
+
+// Schemas returns the registry describing the YAML shape of all supported
+// join point types.
+func Schemas() schema.Registry {
+	return schemas
+}
 
 func FromYAML(ctx context.Context, node ast.Node) (Point, error) {
 	key, value, err := singleton.Unmarshal(ctx, node)
@@ -0,0 +1,175 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package schema provides the registry types used by join points and advice to
+// self-describe their YAML shape. The `schema.json` file used to validate
+// configuration files, as well as the reference documentation, are generated
+// from these registries.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Entry describes the YAML shape of a single join point or advice type.
+type Entry struct {
+	// Title is a short, user-friendly title.
+	Title string
+	// Description is a markdown description of the behavior.
+	Description string
+	// Deprecated marks types that should not be used in new configurations.
+	Deprecated bool
+	// Schema is the JSON schema (written in YAML syntax) that the value
+	// associated to the type's key must conform to.
+	Schema string
+	// Defs are additional JSON schema definitions (written in YAML syntax) that
+	// are local to this type, and can be referred to from [Entry.Schema] as
+	// `#/$defs/<registry>/<key>/$defs/<name>`.
+	Defs string
+	// Examples are complete YAML snippets demonstrating the use of this type.
+	Examples []string
+}
+
+// Registry associates YAML keys to the [Entry] describing their shape.
+type Registry map[string]Entry
+
+// Keys returns the keys of this [Registry], in lexicographic order.
+func (r Registry) Keys() []string {
+	return slices.Sorted(maps.Keys(r))
+}
+
+// Check verifies that this [Registry] has exactly one entry for each of the
+// provided keys, and that all entries have a description and a valid schema.
+func (r Registry) Check(keys []string) error {
+	var errs []error
+	for _, key := range keys {
+		if _, found := r[key]; !found {
+			errs = append(errs, fmt.Errorf("%s: no schema entry", key))
+		}
+	}
+	for _, key := range r.Keys() {
+		if !slices.Contains(keys, key) {
+			errs = append(errs, fmt.Errorf("%s: schema entry for an unknown key", key))
+			continue
+		}
+		entry := r[key]
+		if entry.Description == "" {
+			errs = append(errs, fmt.Errorf("%s: no description", key))
+		}
+		if _, err := entry.JSONSchema(key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// JSONSchema returns the JSON schema object for the provided key, which is an
+// object having a single property named after key.
+func (e *Entry) JSONSchema(key string) (map[string]any, error) {
+	prop := make(map[string]any)
+	if err := yaml.Unmarshal([]byte(e.Schema), &prop); err != nil {
+		return nil, fmt.Errorf("%s: parsing schema: %w", key, err)
+	}
+	if e.Title != "" {
+		prop["title"] = e.Title
+	}
+	if e.Description != "" {
+		prop["markdownDescription"] = e.Description
+	}
+	if e.Deprecated {
+		prop["deprecated"] = true
+	}
+
+	obj := map[string]any{
+		"required":              []any{key},
+		"unevaluatedProperties": false,
+		"properties":            map[string]any{key: prop},
+	}
+
+	if e.Defs != "" {
+		var defs map[string]any
+		if err := yaml.Unmarshal([]byte(e.Defs), &defs); err != nil {
+			return nil, fmt.Errorf("%s: parsing $defs: %w", key, err)
+		}
+		obj["$defs"] = defs
+	}
+
+	if len(e.Examples) > 0 {
+		examples := make([]any, len(e.Examples))
+		for idx, ex := range e.Examples {
+			if err := yaml.Unmarshal([]byte(ex), &examples[idx]); err != nil {
+				return nil, fmt.Errorf("%s: parsing example %d: %w", key, idx, err)
+			}
+		}
+		obj["examples"] = examples
+	}
+
+	return obj, nil
+}
+
+// Generate produces a complete JSON schema document by adding definitions for
+// all the entries in the join point and advice registries to the provided base
+// JSON document. The entries are added under `$defs/join-point/<key>` and
+// `$defs/advice/<key>` respectively, and `$defs/JoinPoint` and `$defs/Advice`
+// are set to accept exactly one of the registered shapes.
+func Generate(base []byte, joinPoints Registry, advice Registry) ([]byte, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(base, &doc); err != nil {
+		return nil, fmt.Errorf("parsing base schema: %w", err)
+	}
+	defs, _ := doc["$defs"].(map[string]any)
+	if defs == nil {
+		return nil, errors.New("base schema has no $defs object")
+	}
+
+	for _, reg := range []struct {
+		registry    Registry
+		name        string
+		union       string
+		description string
+	}{
+		{joinPoints, "join-point", "JoinPoint", "A join point determines whether advice should be applied to a given AST node or not."},
+		{advice, "advice", "Advice", "An Advice describes an AST node transformation."},
+	} {
+		var (
+			keys    = reg.registry.Keys()
+			entries = make(map[string]any, len(keys))
+			oneOf   = make([]any, len(keys))
+		)
+		for idx, key := range keys {
+			entry := reg.registry[key]
+			obj, err := entry.JSONSchema(key)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", reg.name, err)
+			}
+			entries[key] = obj
+			oneOf[idx] = map[string]any{"$ref": fmt.Sprintf("#/$defs/%s/%s", reg.name, key)}
+		}
+
+		defs[reg.name] = entries
+		defs[reg.union] = map[string]any{
+			"description":           reg.description,
+			"type":                  "object",
+			"unevaluatedProperties": false,
+			"oneOf":                 oneOf,
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
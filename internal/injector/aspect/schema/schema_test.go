@@ -0,0 +1,38 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package schema_test
+
+import (
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	valid := schema.Entry{Description: "Valid entry.", Schema: "type: string"}
+
+	for name, tc := range map[string]struct {
+		registry schema.Registry
+		keys     []string
+		err      string
+	}{
+		"complete":       {registry: schema.Registry{"a": valid, "b": valid}, keys: []string{"a", "b"}},
+		"missing":        {registry: schema.Registry{"a": valid}, keys: []string{"a", "b"}, err: "b: no schema entry"},
+		"unknown":        {registry: schema.Registry{"a": valid, "b": valid}, keys: []string{"a"}, err: "b: schema entry for an unknown key"},
+		"no description": {registry: schema.Registry{"a": {Schema: "type: string"}}, keys: []string{"a"}, err: "a: no description"},
+		"invalid schema": {registry: schema.Registry{"a": {Description: "Invalid.", Schema: "[ not: yaml"}}, keys: []string{"a"}, err: "a: parsing schema"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := tc.registry.Check(tc.keys)
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
@@ -12,11 +12,17 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/constraint"
 	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/advice/code"
+	"github.com/DataDog/orchestrion/internal/version"
 	"github.com/DataDog/orchestrion/internal/yaml"
 	"github.com/goccy/go-yaml/ast"
+	"github.com/rs/zerolog"
+	"golang.org/x/mod/semver"
 )
 
 const FilenameOrchestrionYML = "orchestrion.yml"
@@ -47,10 +53,27 @@ func (l *Loader) loadYMLFile(ctx context.Context, dir string, name string) (_ *c
 	if err != nil {
 		return nil, err
 	}
+	if yml == nil {
+		// Skipped due to unsatisfied requirements...
+		return nil, nil
+	}
 
 	dir = filepath.Dir(filename)
 	extends := make([]Config, 0, len(yml.Extends))
 	for _, ext := range yml.Extends {
+		if !isRelativePath(ext) {
+			cfg, err := l.loadExtendsImport(ctx, ext)
+			if err != nil {
+				return nil, fmt.Errorf("extends %q: %w", ext, maskErrNotExist(err))
+			}
+			if cfg.empty() {
+				// Already loaded or empty, nothing to do...
+				continue
+			}
+			extends = append(extends, cfg)
+			continue
+		}
+
 		extFilename := filepath.Join(dir, ext)
 
 		if stat, err := os.Stat(extFilename); err != nil {
@@ -97,6 +120,59 @@ func (l *Loader) loadYMLFile(ctx context.Context, dir string, name string) (_ *c
 	return cfg, nil
 }
 
+// isRelativePath returns true if ext is a relative file system path (i.e, it
+// starts with `./` or `../`), as opposed to a package import path.
+func isRelativePath(ext string) bool {
+	for _, prefix := range []string{"./", "../", ".\\", "..\\"} {
+		if strings.HasPrefix(ext, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadExtendsImport loads configuration from the package designated by ref,
+// which is an import path optionally followed by `@<version>`. It must designate
+// a single package (i.e, not be a `...` pattern). The package is resolved using
+// the project's module graph; if a version is specified, the selected version of
+// the module providing the package must be compatible with it (i.e, have the
+// same major version, and be greater or equal to it).
+func (l *Loader) loadExtendsImport(ctx context.Context, ref string) (*configGo, error) {
+	importPath, query, hasQuery := strings.Cut(ref, "@")
+	if hasQuery && !semver.IsValid(query) {
+		return nil, fmt.Errorf("invalid version %q: must be a semantic version such as v1, v1.2 or v1.2.3", query)
+	}
+	if strings.Contains(importPath, "...") {
+		return nil, fmt.Errorf("extends %q: package patterns are not supported, an import path must designate a single package", ref)
+	}
+
+	pkgs, err := l.packages(ctx, importPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("extends %q: expected exactly one package, got %d", ref, len(pkgs))
+	}
+	pkg := pkgs[0]
+
+	if hasQuery {
+		if pkg.Module == nil {
+			return nil, fmt.Errorf("package %q is not provided by any module (is it required by go.mod?)", importPath)
+		}
+		if selected := pkg.Module.Version; selected != "" && !compatibleVersion(selected, query) {
+			return nil, fmt.Errorf("module %s is selected at %s, which is not compatible with %s (run `go get %s@%s` to upgrade it)", pkg.Module.Path, selected, query, pkg.Module.Path, query)
+		}
+	}
+
+	return l.loadGoPackage(ctx, pkg)
+}
+
+// compatibleVersion returns true if selected has the same major version as
+// query, and is greater than or equal to it.
+func compatibleVersion(selected string, query string) bool {
+	return semver.Major(selected) == semver.Major(query) && semver.Compare(selected, query) >= 0
+}
+
 type (
 	configYML struct {
 		extends []Config
@@ -148,16 +224,25 @@ func (c *configYML) empty() bool {
 	return c == nil || (len(c.extends) == 0 && len(c.aspects) == 0)
 }
 
-type ymlFile struct {
-	Aspects []*aspect.Aspect
-	Extends []string
-	Meta    struct {
+type (
+	ymlFile struct {
+		Aspects []*aspect.Aspect
+		Extends []string
+		Meta    ymlMeta
+	}
+	ymlMeta struct {
 		Name        string
 		Description string
-		Icon        string // Optional
-		Caveats     string // Optional
+		Icon        string      // Optional
+		Caveats     string      // Optional
+		Requires    ymlRequires // Optional
 	}
-}
+	ymlRequires struct {
+		// Orchestrion is a constraint on the version of orchestrion that is able to
+		// use the configuration file.
+		Orchestrion constraint.Constraint
+	}
+)
 
 func (l *Loader) parseYMLFile(ctx context.Context, filename string) (*ymlFile, error) {
 	file, err := os.Open(filename)
@@ -166,23 +251,39 @@ func (l *Loader) parseYMLFile(ctx context.Context, filename string) (*ymlFile, e
 	}
 	defer file.Close()
 
-	// In validation mode, we will pre-parse the YAML into a [yaml.Node] tree,
-	// which can then be cheaply decoded into a value type that validation
-	// supports; and then re-decoded into the actual data structure.
+	// We always pre-parse the YAML into a [yaml.Node] tree, which can then be
+	// cheaply decoded into the file's metadata (so that we can check version
+	// requirements before attempting to decode the rest of the document, which
+	// may use features this version of orchestrion does not support); and then
+	// re-decoded into the actual data structure. In validation mode, it is also
+	// decoded into a value type that validation supports.
 	// This dance is significantly cheaper (both in time & allocations) than doing
-	// a full blown [yaml.Decoder.Decode] twice (as it internally transits through
-	// the [yaml.Node] representation anyway).
+	// a full blown [yaml.Decoder.Decode] several times (as it internally transits
+	// through the [yaml.Node] representation anyway).
+	ctx = code.WithGoAdviceDir(ctx, filepath.Dir(filename))
 	ctx, yamlDec := yaml.NewDecoderContext(ctx, file)
-	var dec interface {
-		DecodeContext(context.Context, any) error
-	} = yamlDec
-	if l.validate {
-		var node ast.Node
-		if err := dec.DecodeContext(ctx, &node); err != nil {
-			return nil, fmt.Errorf("yaml.Decode %q -> yaml.Node: %w", filename, err)
-		}
-		dec = decodedNode{yamlDec, node}
+	var node ast.Node
+	if err := yamlDec.DecodeContext(ctx, &node); err != nil {
+		return nil, fmt.Errorf("yaml.Decode %q -> yaml.Node: %w", filename, err)
+	}
+	dec := decodedNode{yamlDec, node}
 
+	var header struct {
+		Meta struct{ Requires ymlRequires }
+	}
+	if err := dec.DecodeContext(ctx, &header); err != nil {
+		return nil, fmt.Errorf("yaml.Decode %q -> meta.requires: %w", filename, err)
+	}
+	if req := header.Meta.Requires.Orchestrion; !req.Check(version.Tag()) {
+		zerolog.Ctx(ctx).Warn().
+			Str("file", filename).
+			Str("requires", req.String()).
+			Str("version", version.Tag()).
+			Msg("Skipping configuration file: it requires a different version of orchestrion")
+		return nil, nil
+	}
+
+	if l.validate {
 		var simple map[string]any
 		if err := dec.DecodeContext(ctx, &simple); err != nil {
 			return nil, fmt.Errorf("yaml.Decode %q -> map[string]any: %w", filename, err)
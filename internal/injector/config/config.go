@@ -9,10 +9,14 @@ package config
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"path/filepath"
 	"strings"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goenv"
 	"github.com/DataDog/orchestrion/internal/injector/aspect"
 	"golang.org/x/tools/go/packages"
 )
@@ -53,9 +57,14 @@ type Loader struct {
 	loaded    map[string]struct{}
 	dir       string
 	validate  bool
+	target    *goenv.Target
+	goWork    *string
 }
 
-func defaultPackageLoader(ctx context.Context, dir string, patterns ...string) ([]*packages.Package, error) {
+// defaultPackageLoader loads packages using the go command. If target is not
+// nil, packages are loaded for the designated platform and build tags instead
+// of those of the current environment.
+func defaultPackageLoader(ctx context.Context, dir string, target *goenv.Target, patterns ...string) ([]*packages.Package, error) {
 	span, ctx := tracer.StartSpanFromContext(ctx, "Load",
 		tracer.ServiceName("golang.org/x/tools/go/packages"),
 		tracer.ResourceName(strings.Join(patterns, " ")),
@@ -65,7 +74,11 @@ func defaultPackageLoader(ctx context.Context, dir string, patterns ...string) (
 	cfg := &packages.Config{
 		Context: ctx,
 		Dir:     dir,
-		Mode:    packages.NeedName | packages.NeedFiles,
+		Mode:    packages.NeedName | packages.NeedFiles | packages.NeedModule,
+	}
+	if target != nil {
+		cfg.Env = target.Env()
+		cfg.BuildFlags = target.BuildFlags()
 	}
 	return packages.Load(cfg, patterns...)
 }
@@ -79,9 +92,6 @@ func defaultPackageLoader(ctx context.Context, dir string, patterns ...string) (
 // [Loader.validate] is true, the YAML documents will be validated against the
 // JSON schema.
 func NewLoader(pkgLoader PackageLoader, dir string, validate bool) *Loader {
-	if pkgLoader == nil {
-		pkgLoader = defaultPackageLoader
-	}
 	return &Loader{
 		pkgLoader: pkgLoader,
 		loaded:    make(map[string]struct{}),
@@ -90,7 +100,28 @@ func NewLoader(pkgLoader PackageLoader, dir string, validate bool) *Loader {
 	}
 }
 
-// Load proceeds to load the configuration from this loader's directory.
+// WithTarget sets the platform and build tags packages are loaded for by the
+// default [PackageLoader], so that configuration guarded by build constraints
+// is resolved as it is for the build. Custom [PackageLoader] implementations
+// are responsible for loading packages for the appropriate target. It returns
+// the receiver.
+func (l *Loader) WithTarget(target goenv.Target) *Loader {
+	l.target = &target
+	return l
+}
+
+// WithGOWORK sets the path to the `go.work` file in use (blank if workspace
+// mode is not enabled), so that it does not need to be resolved by running
+// `go env GOWORK` when loading configuration. It returns the receiver.
+func (l *Loader) WithGOWORK(goWork string) *Loader {
+	l.goWork = &goWork
+	return l
+}
+
+// Load proceeds to load the configuration from this loader's directory. In
+// workspace mode, the configuration located in the workspace's root directory
+// (next to the `go.work` file) is merged with that of the loader's directory;
+// which then does not need to have any configuration of its own.
 func (l *Loader) Load(ctx context.Context) (_ Config, err error) {
 	span, ctx := tracer.StartSpanFromContext(ctx, "Load",
 		tracer.ServiceName("github.com/DataDog/orchestrion/internal/injector/config"),
@@ -99,6 +130,88 @@ func (l *Loader) Load(ctx context.Context) (_ Config, err error) {
 	)
 	defer func() { span.Finish(tracer.WithError(err)) }()
 
+	goWork, err := l.gowork()
+	if err != nil {
+		return nil, err
+	}
+	if goWork == "" {
+		return l.loadPackage(ctx, false)
+	}
+
+	wsCfg, err := l.loadWorkspaceRoot(ctx, goWork)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := l.loadPackage(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	return merged(wsCfg, cfg), nil
+}
+
+// LoadPackage loads the configuration from the package in this loader's
+// directory only, regardless of any workspace it may belong to. Unlike
+// [Loader.Load], it does not invoke the go command (unless the loader's
+// [PackageLoader] does), which makes it suitable for hermetic build systems.
+func (l *Loader) LoadPackage(ctx context.Context) (_ Config, err error) {
+	span, ctx := tracer.StartSpanFromContext(ctx, "LoadPackage",
+		tracer.ServiceName("github.com/DataDog/orchestrion/internal/injector/config"),
+		tracer.ResourceName(l.dir),
+		tracer.Tag("validate", l.validate),
+	)
+	defer func() { span.Finish(tracer.WithError(err)) }()
+
+	return l.loadPackage(ctx, false)
+}
+
+// LoadAll loads the configuration applicable to all packages of the build. In
+// workspace mode, this merges the configuration of the workspace's root
+// directory with that of all modules of the workspace, as packages are woven
+// according to the configuration of the workspace module they belong to.
+// Otherwise, this is the same as [Loader.Load].
+func (l *Loader) LoadAll(ctx context.Context) (_ Config, err error) {
+	span, ctx := tracer.StartSpanFromContext(ctx, "LoadAll",
+		tracer.ServiceName("github.com/DataDog/orchestrion/internal/injector/config"),
+		tracer.ResourceName(l.dir),
+		tracer.Tag("validate", l.validate),
+	)
+	defer func() { span.Finish(tracer.WithError(err)) }()
+
+	goWork, err := l.gowork()
+	if err != nil {
+		return nil, err
+	}
+	if goWork == "" {
+		return l.loadPackage(ctx, false)
+	}
+
+	dirs, err := goenv.WorkspaceModules(goWork)
+	if err != nil {
+		return nil, err
+	}
+	span.SetTag("modules", len(dirs))
+
+	wsCfg, err := l.loadWorkspaceRoot(ctx, goWork)
+	if err != nil {
+		return nil, err
+	}
+	cfgs := []*configGo{wsCfg}
+	for _, dir := range dirs {
+		// Modules share this loader's state, so that configuration files are only loaded once.
+		modLoader := &Loader{pkgLoader: l.pkgLoader, loaded: l.loaded, dir: dir, validate: l.validate, target: l.target, goWork: l.goWork}
+		cfg, err := modLoader.loadPackage(ctx, true)
+		if err != nil {
+			return nil, fmt.Errorf("in workspace module %q: %w", dir, err)
+		}
+		cfgs = append(cfgs, cfg)
+	}
+	return merged(cfgs...), nil
+}
+
+// loadPackage loads the configuration from the package in this loader's
+// directory. If optional is true, a directory that does not contain any Go
+// package results in a nil configuration instead of an error.
+func (l *Loader) loadPackage(ctx context.Context, optional bool) (*configGo, error) {
 	pkgs, err := l.packages(ctx, l.dir)
 	if err != nil {
 		return nil, err
@@ -107,10 +220,57 @@ func (l *Loader) Load(ctx context.Context) (_ Config, err error) {
 		// This is not supposed to happen if `err == nil`.
 		panic(fmt.Errorf("no package returned by packages.Load(%q)", l.dir))
 	}
+	if optional && packageRoot(pkgs[0]) == "" {
+		return nil, nil
+	}
 
 	return l.loadGoPackage(ctx, pkgs[0])
 }
 
+// loadWorkspaceRoot loads the configuration from the root directory of the
+// workspace defined by the designated `go.work` file. This directory is usually
+// not part of any module, so its [FilenameOrchestrionToolGo] file is not loaded
+// as a Go package, and its imports are resolved from this loader's directory.
+func (l *Loader) loadWorkspaceRoot(ctx context.Context, goWork string) (*configGo, error) {
+	root := filepath.Dir(goWork)
+
+	imports, err := l.loadGoFile(ctx, filepath.Join(root, FilenameOrchestrionToolGo))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	ymlCfg, err := l.loadYMLFile(ctx, root, FilenameOrchestrionYML)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return &configGo{imports: imports, yaml: ymlCfg}, nil
+}
+
+// merged returns a configuration that contains all non-empty provided ones.
+func merged(cfgs ...*configGo) *configGo {
+	res := &configGo{}
+	for _, cfg := range cfgs {
+		if cfg.empty() {
+			continue
+		}
+		if res.pkgPath == "" {
+			res.pkgPath = cfg.pkgPath
+		}
+		res.imports = append(res.imports, cfg)
+	}
+	return res
+}
+
+// gowork returns the path to the `go.work` file in use in this loader's
+// directory, or a blank string if workspace mode is not enabled there.
+func (l *Loader) gowork() (string, error) {
+	if l.goWork != nil {
+		return *l.goWork, nil
+	}
+	return goenv.GOWORK(l.dir)
+}
+
 // markLoaded marks the specified file as loaded. Return true if the file was
 // not already marked previously.
 func (l *Loader) markLoaded(filename string) bool {
@@ -122,5 +282,8 @@ func (l *Loader) markLoaded(filename string) bool {
 }
 
 func (l *Loader) packages(ctx context.Context, patterns ...string) ([]*packages.Package, error) {
+	if l.pkgLoader == nil {
+		return defaultPackageLoader(ctx, l.dir, l.target, patterns...)
+	}
 	return l.pkgLoader(ctx, l.dir, patterns...)
 }
@@ -8,13 +8,16 @@ package config
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"testing"
 
+	"github.com/DataDog/orchestrion/internal/goenv"
 	"github.com/goccy/go-yaml"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/tools/go/packages"
 	"gotest.tools/v3/golden"
@@ -238,6 +241,229 @@ func TestLoad(t *testing.T) {
 	})
 }
 
+func TestLoadWorkspace(t *testing.T) {
+	// Workspace mode is not available with `-mod=mod`.
+	t.Setenv("GOFLAGS", "")
+
+	tmp := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "go.work"), []byte("go 1.23\n\nuse (\n\t./a\n\t./b\n)\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, FilenameOrchestrionYML), []byte(`
+meta: { name: workspace, description: workspace }
+aspects: [{ id: workspace, join-point: { package-name: main }, advice: [add-blank-import: unsafe] }]
+`), 0o644))
+	for _, name := range []string{"a", "b"} {
+		dir := filepath.Join(tmp, name)
+		require.NoError(t, os.Mkdir(dir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/"+name+"\n\ngo 1.23\n"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, FilenameOrchestrionYML), []byte(`
+meta: { name: `+name+`, description: `+name+` }
+aspects: [{ id: `+name+`, join-point: { package-name: main }, advice: [add-blank-import: unsafe] }]
+`), 0o644))
+	}
+
+	aspectIDs := func(t *testing.T, cfg Config) []string {
+		aspects := cfg.Aspects()
+		ids := make([]string, len(aspects))
+		for i, a := range aspects {
+			ids[i] = a.ID
+		}
+		return ids
+	}
+
+	t.Run("module", func(t *testing.T) {
+		cfg, err := NewLoader(nil, filepath.Join(tmp, "a"), true).Load(context.Background())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"workspace", "a"}, aspectIDs(t, cfg))
+	})
+
+	t.Run("root", func(t *testing.T) {
+		cfg, err := NewLoader(nil, tmp, true).Load(context.Background())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"workspace"}, aspectIDs(t, cfg))
+	})
+
+	t.Run("all", func(t *testing.T) {
+		cfg, err := NewLoader(nil, filepath.Join(tmp, "b"), true).LoadAll(context.Background())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"workspace", "a", "b"}, aspectIDs(t, cfg))
+	})
+
+	t.Run("known GOWORK", func(t *testing.T) {
+		// The provided go.work file is used as-is, instead of being resolved with `go env GOWORK`.
+		cfg, err := NewLoader(nil, filepath.Join(tmp, "a"), true).WithGOWORK("").Load(context.Background())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"a"}, aspectIDs(t, cfg))
+
+		cfg, err = NewLoader(nil, filepath.Join(tmp, "b"), true).WithGOWORK(filepath.Join(tmp, "go.work")).LoadAll(context.Background())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"workspace", "a", "b"}, aspectIDs(t, cfg))
+	})
+}
+
+func TestLoadRequires(t *testing.T) {
+	load := func(t *testing.T, content string) (*configYML, error) {
+		tmp := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, FilenameOrchestrionYML), []byte(content), 0o644))
+		return NewLoader(nil, tmp, true).loadYMLFile(context.Background(), tmp, FilenameOrchestrionYML)
+	}
+
+	t.Run("satisfied", func(t *testing.T) {
+		cfg, err := load(t, `
+meta:
+  name: name
+  description: description
+  requires:
+    orchestrion: '>= v0.1.0'
+aspects:
+  - id: ID
+    requires:
+      module: github.com/go-chi/chi/v5
+      version: '>= 5.1'
+    join-point: { package-name: main }
+    advice: [add-blank-import: unsafe]
+`)
+		require.NoError(t, err)
+		require.Len(t, cfg.Aspects(), 1)
+
+		req := cfg.Aspects()[0].Requires
+		require.NotNil(t, req)
+		assert.Equal(t, "github.com/go-chi/chi/v5", req.Module)
+		assert.True(t, req.Satisfied("v5.1.0"))
+		assert.True(t, req.Satisfied(""))
+		assert.False(t, req.Satisfied("v5.0.14"))
+	})
+
+	t.Run("unsatisfied", func(t *testing.T) {
+		cfg, err := load(t, `
+meta:
+  name: name
+  description: description
+  requires:
+    orchestrion: '>= v999.0.0'
+aspects:
+  - id: ID
+    join-point: { some-future-join-point: true }
+    advice: [add-blank-import: unsafe]
+`)
+		require.NoError(t, err)
+		assert.True(t, cfg.empty())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := load(t, `
+meta:
+  name: name
+  description: description
+  requires:
+    orchestrion: 'latest'
+aspects: [{ id: ID, join-point: { package-name: main }, advice: [add-blank-import: unsafe] }]
+`)
+		require.ErrorContains(t, err, "invalid version constraint")
+	})
+}
+
+func TestLoadWhen(t *testing.T) {
+	load := func(t *testing.T, when string) (*configYML, error) {
+		tmp := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, FilenameOrchestrionYML), []byte(`
+meta: { name: name, description: description }
+aspects:
+  - id: ID
+    when: `+when+`
+    join-point: { package-name: main }
+    advice: [add-blank-import: unsafe]
+`), 0o644))
+		return NewLoader(nil, tmp, true).loadYMLFile(context.Background(), tmp, FilenameOrchestrionYML)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		cfg, err := load(t, `{ goos: [linux, darwin], tags: [cgo, "!nodd"] }`)
+		require.NoError(t, err)
+		require.Len(t, cfg.Aspects(), 1)
+
+		when := cfg.Aspects()[0].When
+		require.NotNil(t, when)
+		assert.True(t, when.Satisfied(goenv.Target{GOOS: "linux", CgoEnabled: true}))
+		assert.True(t, when.Satisfied(goenv.Target{GOOS: "android", CgoEnabled: true, Tags: []string{"other"}}))
+		assert.False(t, when.Satisfied(goenv.Target{GOOS: "linux", CgoEnabled: true, Tags: []string{"nodd"}}))
+		assert.False(t, when.Satisfied(goenv.Target{GOOS: "linux"}))
+		assert.False(t, when.Satisfied(goenv.Target{GOOS: "windows", CgoEnabled: true}))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		_, err := load(t, `{}`)
+		require.Error(t, err)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		_, err := load(t, `{ goversion: [go1.23] }`)
+		require.Error(t, err)
+	})
+}
+
+func TestLoadExtendsImport(t *testing.T) {
+	tmp := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "go.mod"), []byte(`module example.com/app
+
+go 1.23
+
+require example.com/shared v1.2.0
+
+replace example.com/shared v1.2.0 => ./shared
+`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "main.go"), []byte("package main\n"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(tmp, "shared"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "shared", "go.mod"), []byte("module example.com/shared\n\ngo 1.23\n"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(tmp, "shared", "http"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "shared", "http", "http.go"), []byte("package http\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "shared", "http", FilenameOrchestrionYML), []byte(`
+meta: { name: shared, description: shared }
+aspects: [{ id: shared, join-point: { package-name: main }, advice: [add-blank-import: unsafe] }]
+`), 0o644))
+
+	load := func(t *testing.T, extends string, validate bool) (*configYML, error) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, FilenameOrchestrionYML), []byte(`
+meta: { name: name, description: description }
+extends: ['`+extends+`']
+`), 0o644))
+		return NewLoader(nil, tmp, validate).loadYMLFile(context.Background(), dir, FilenameOrchestrionYML)
+	}
+
+	for _, extends := range []string{"example.com/shared/http", "example.com/shared/http@v1", "example.com/shared/http@v1.2.0"} {
+		t.Run(extends, func(t *testing.T) {
+			cfg, err := load(t, extends, true)
+			require.NoError(t, err)
+			require.Len(t, cfg.Aspects(), 1)
+			assert.Equal(t, "shared", cfg.Aspects()[0].ID)
+		})
+	}
+
+	t.Run("incompatible", func(t *testing.T) {
+		_, err := load(t, "example.com/shared/http@v1.3", true)
+		require.ErrorContains(t, err, "module example.com/shared is selected at v1.2.0, which is not compatible with v1.3")
+	})
+
+	t.Run("invalid version", func(t *testing.T) {
+		_, err := load(t, "example.com/shared/http@latest", true)
+		require.ErrorContains(t, err, "object does not conform to schema")
+
+		_, err = load(t, "example.com/shared/http@latest", false)
+		require.ErrorContains(t, err, `invalid version "latest"`)
+	})
+
+	for _, extends := range []string{"example.com/shared/...", "example.com/shared/...@v1", "example.com/.../http"} {
+		t.Run("wildcard "+extends, func(t *testing.T) {
+			_, err := load(t, extends, true)
+			require.ErrorContains(t, err, "object does not conform to schema")
+
+			_, err = load(t, extends, false)
+			require.ErrorContains(t, err, fmt.Sprintf("extends %q: package patterns are not supported", extends))
+		})
+	}
+}
+
 func runGo(t *testing.T, tmp string, args ...string) {
 	cmd := exec.Command("go", args...)
 	cmd.Dir = tmp
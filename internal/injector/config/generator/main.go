@@ -0,0 +1,46 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package main generates the configuration JSON schema from the base document
+// and the join point and advice schema registries.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/DataDog/orchestrion/internal/injector/aspect/advice"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/join"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/schema"
+)
+
+func main() {
+	var (
+		base   string
+		output string
+	)
+	flag.StringVar(&base, "base", "", "The base JSON schema document to augment")
+	flag.StringVar(&output, "o", "", "The path of the file to write the generated schema to")
+	flag.Parse()
+
+	if base == "" || output == "" {
+		log.Fatalln("Missing value for required -base and -o flags")
+	}
+
+	baseBytes, err := os.ReadFile(base)
+	if err != nil {
+		log.Fatalf("reading %q: %v\n", base, err)
+	}
+
+	generated, err := schema.Generate(baseBytes, join.Schemas(), advice.Schemas())
+	if err != nil {
+		log.Fatalf("generating schema: %v\n", err)
+	}
+
+	if err := os.WriteFile(output, generated, 0o644); err != nil {
+		log.Fatalf("writing %q: %v\n", output, err)
+	}
+}
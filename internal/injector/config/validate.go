@@ -5,6 +5,8 @@
 
 package config
 
+//go:generate go run ./generator -base generator/schema.base.json -o schema.json
+
 import (
 	_ "embed" // For go:embed
 	"errors"
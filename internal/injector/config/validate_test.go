@@ -9,13 +9,26 @@ import (
 	"bytes"
 	_ "embed"
 	"fmt"
+	"os"
 	"sync"
 	"testing"
 
+	"github.com/DataDog/orchestrion/internal/injector/aspect/advice"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/join"
+	aspectschema "github.com/DataDog/orchestrion/internal/injector/aspect/schema"
 	"github.com/santhosh-tekuri/jsonschema/v6"
 	"github.com/stretchr/testify/require"
 )
 
+func TestSchemaUpToDate(t *testing.T) {
+	base, err := os.ReadFile("generator/schema.base.json")
+	require.NoError(t, err)
+
+	generated, err := aspectschema.Generate(base, join.Schemas(), advice.Schemas())
+	require.NoError(t, err)
+	require.Equal(t, string(generated), string(schemaBytes), "schema.json is out of date, run `go generate ./internal/injector/config`")
+}
+
 func TestSchemaValidity(t *testing.T) {
 	count := validateExamples(t, getSchema(), "", nil)
 	// Make sure we verified some examples...
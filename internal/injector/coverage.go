@@ -0,0 +1,67 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package injector
+
+import (
+	"go/token"
+	"strings"
+
+	"github.com/dave/dst"
+)
+
+// isCoverageInstrumentation returns true if the node was inserted by `go tool
+// cover` when the package is built with coverage instrumentation (e.g, `go test
+// -cover`): either a coverage counter update, or the declaration of coverage
+// variables. The go command names coverage variables with a `goCover_` prefix
+// (or `GoCover_` before Go 1.20).
+func isCoverageInstrumentation(node dst.Node) bool {
+	switch node := node.(type) {
+	case *dst.AssignStmt:
+		// goCover_xxx_[n] = 1 (or GoCover_xxx.Count[n] = 1)
+		return len(node.Lhs) == 1 && isCoverageVar(node.Lhs[0])
+	case *dst.IncDecStmt:
+		// GoCover_xxx.Count[n]++
+		return isCoverageVar(node.X)
+	case *dst.ExprStmt:
+		// _cover_atomic_.AddUint32(&goCover_xxx_[n], 1)
+		call, ok := node.X.(*dst.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return false
+		}
+		addr, ok := call.Args[0].(*dst.UnaryExpr)
+		return ok && addr.Op == token.AND && isCoverageVar(addr.X)
+	case *dst.ValueSpec:
+		for _, name := range node.Names {
+			if !isCoverageVarName(name.Name) {
+				return false
+			}
+		}
+		return len(node.Names) > 0
+	default:
+		return false
+	}
+}
+
+// isCoverageVar returns true if expr designates (an element of) a coverage
+// variable.
+func isCoverageVar(expr dst.Expr) bool {
+	for {
+		switch e := expr.(type) {
+		case *dst.IndexExpr:
+			expr = e.X
+		case *dst.SelectorExpr:
+			expr = e.X
+		case *dst.Ident:
+			return e.Path == "" && isCoverageVarName(e.Name)
+		default:
+			return false
+		}
+	}
+}
+
+func isCoverageVarName(name string) bool {
+	return strings.HasPrefix(name, "goCover_") || strings.HasPrefix(name, "GoCover_")
+}
@@ -0,0 +1,48 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package injector
+
+import (
+	"testing"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsCoverageInstrumentation(t *testing.T) {
+	for stmt, expected := range map[string]bool{
+		// Go 1.20+ (pkgcfg mode)
+		"goCover_0123456789ab_[0] = 1":                                  true,
+		"goCover_0123456789ab_[1] = goCover_0123456789ab_P":             true,
+		"_cover_atomic_.AddUint32(&goCover_0123456789ab_[0], 1)":        true,
+		"_cover_atomic_.StoreUint32(&goCover_0123456789ab_[0], 1)":      true,
+		"GoCover_0_0123456789ab.Count[0] = 1":                           true,
+		"GoCover_0_0123456789ab.Count[0]++":                             true,
+		"_cover_atomic_.AddUint32(&GoCover_0_0123456789ab.Count[0], 1)": true,
+		// Regular statements
+		"counters[0] = 1":                    false,
+		"counters[0]++":                      false,
+		"x, goCover_0123456789ab_[0] = 1, 1": false,
+		"atomic.AddUint32(&counters[0], 1)":  false,
+		"println(goCover_0123456789ab_[0])":  false,
+	} {
+		t.Run(stmt, func(t *testing.T) {
+			file, err := decorator.Parse("package test\n\nfunc _() {\n\t" + stmt + "\n}\n")
+			require.NoError(t, err)
+			node := file.Decls[0].(*dst.FuncDecl).Body.List[0]
+			require.Equal(t, expected, isCoverageInstrumentation(node))
+		})
+	}
+
+	t.Run("var", func(t *testing.T) {
+		file, err := decorator.Parse("package test\n\nvar goCover_0123456789ab_P uint32\nvar goCover_0123456789ab__0 [5]uint32\nvar counters [5]uint32\n")
+		require.NoError(t, err)
+		for i, expected := range []bool{true, true, false} {
+			require.Equal(t, expected, isCoverageInstrumentation(file.Decls[i].(*dst.GenDecl).Specs[0]))
+		}
+	})
+}
@@ -0,0 +1,188 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package injector
+
+import (
+	gocontext "context"
+	"fmt"
+	goparser "go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/join"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/may"
+	"github.com/DataDog/orchestrion/internal/injector/parse"
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/dave/dst/decorator/resolver/gotypes"
+	"github.com/dave/dst/dstutil"
+)
+
+type (
+	// AspectExplanation details how a single aspect evaluates against a source
+	// location.
+	AspectExplanation struct {
+		// Aspect is the aspect being explained.
+		Aspect *aspect.Aspect
+		// PackageMayMatch is the result of the package-level pre-filter.
+		PackageMayMatch may.MatchType
+		// FileMayMatch is the result of the file-level pre-filter.
+		FileMayMatch may.MatchType
+		// Nodes contains the evaluation of the aspect's join point against each
+		// AST node starting on the requested line.
+		Nodes []NodeExplanation
+	}
+
+	// NodeExplanation is the evaluation of a join point against a single AST
+	// node.
+	NodeExplanation struct {
+		// Node is the AST node that was evaluated.
+		Node dst.Node
+		// Position is the position of the node in the source file.
+		Position token.Position
+		// Ignored is true if the node is covered by an `//orchestrion:ignore`
+		// directive, in which case no aspect is ever applied to it.
+		Ignored bool
+		// Evaluation is the detailed outcome of the join point evaluation.
+		Evaluation join.Evaluation
+	}
+)
+
+// Matched returns true if the aspect's join point matched at least one node
+// that is not ignored.
+func (e *AspectExplanation) Matched() bool {
+	for _, node := range e.Nodes {
+		if !node.Ignored && node.Evaluation.Matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Explain evaluates all provided aspects against the AST nodes starting on the
+// specified line of filename, which must be one of the package's files. Unlike
+// [Injector.InjectFiles], it does not stop at the first pre-filter failure, and
+// it never modifies any file.
+func (i *Injector) Explain(ctx gocontext.Context, files []string, filename string, line int, aspects []*aspect.Aspect) (_ []AspectExplanation, err error) {
+	span, ctx := tracer.StartSpanFromContext(ctx, "Injector.Explain",
+		tracer.ResourceName(i.ImportPath),
+	)
+	defer func() { span.Finish(tracer.WithError(err)) }()
+
+	if err := i.validate(); err != nil {
+		return nil, err
+	}
+
+	target, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %q: %w", filename, err)
+	}
+
+	var (
+		fset        = token.NewFileSet()
+		parsedFiles = make([]parse.File, len(files))
+		targetFile  *parse.File
+		content     []byte
+	)
+	for idx, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading %q: %w", file, err)
+		}
+		astFile, err := goparser.ParseFile(fset, file, src, goparser.ParseComments)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %q: %w", file, err)
+		}
+		parsedFiles[idx] = parse.File{Name: file, AstFile: astFile, Aspects: aspects}
+		if abs, _ := filepath.Abs(file); abs == target {
+			targetFile = &parsedFiles[idx]
+			content = src
+		}
+	}
+	if targetFile == nil {
+		return nil, fmt.Errorf("%q is not part of package %q", filename, i.ImportPath)
+	}
+
+	typeInfo, err := i.typeCheck(ctx, fset, parsedFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	pkgCtx := &may.PackageContext{ImportPath: i.ImportPath, ImportMap: i.ImportMap, TestMain: i.TestMain}
+	fileCtx := &may.FileContext{FileContent: content, PackageName: targetFile.AstFile.Name.Name}
+	result := make([]AspectExplanation, len(aspects))
+	for idx, asp := range aspects {
+		result[idx] = AspectExplanation{
+			Aspect:          asp,
+			PackageMayMatch: asp.JoinPoint.PackageMayMatch(pkgCtx),
+			FileMayMatch:    asp.JoinPoint.FileMayMatch(fileCtx),
+		}
+	}
+
+	decorator := decorator.NewDecoratorWithImports(fset, i.ImportPath, gotypes.New(typeInfo.Uses))
+	file, err := decorator.DecorateFile(targetFile.AstFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		chain     *context.NodeChain
+		ignored   []bool
+		minGoLang context.GoLangVersion
+	)
+	pre := func(csor *dstutil.Cursor) bool {
+		if csor.Node() == nil {
+			return false
+		}
+
+		root := chain == nil
+		chain = chain.Child(csor)
+		if root {
+			chain.SetConfig(i.RootConfig)
+		}
+		ignored = append(ignored, (len(ignored) > 0 && ignored[len(ignored)-1]) || isIgnored(ctx, csor.Node()))
+
+		astNode := decorator.Ast.Nodes[csor.Node()]
+		if astNode == nil || fset.PositionFor(astNode.Pos(), false).Line != line {
+			return true
+		}
+
+		aspectCtx := chain.Context(context.ContextArgs{
+			Cursor:       csor,
+			ImportPath:   i.ImportPath,
+			File:         file,
+			SourceParser: decorator,
+			MinGoLang:    &minGoLang,
+			TestMain:     i.TestMain,
+		})
+		defer aspectCtx.Release()
+
+		for idx, asp := range aspects {
+			result[idx].Nodes = append(result[idx].Nodes, NodeExplanation{
+				Node:       csor.Node(),
+				Position:   fset.Position(astNode.Pos()),
+				Ignored:    ignored[len(ignored)-1],
+				Evaluation: join.Explain(asp.JoinPoint, aspectCtx),
+			})
+		}
+
+		return true
+	}
+	post := func(*dstutil.Cursor) bool {
+		old := chain
+		chain = chain.Parent()
+		old.Release()
+		ignored = ignored[:len(ignored)-1]
+		return true
+	}
+	dstutil.Apply(file, pre, post)
+
+	return result, nil
+}
@@ -53,6 +53,9 @@ type (
 		Lookup importer.Lookup
 		// RootConfig is the root configuration value to use.
 		RootConfig map[string]string
+		// SkipFunction is called with the symbol name of each function declaration (e.g, `example.com/pkg.(*T).Method`).
+		// If it returns true, no aspect is applied within that function. If nil, no function is skipped.
+		SkipFunction func(symbol string) bool
 
 		// restorerResolver is used to restore modified files. It's created on-demand then re-used.
 		restorerResolver resolver.RestorerResolver
@@ -223,6 +226,9 @@ func (i *Injector) applyAspects(ctx gocontext.Context, params parameters) (resul
 		if err != nil || csor.Node() == nil || isIgnored(ctx, csor.Node()) {
 			return false
 		}
+		if decl, ok := csor.Node().(*dst.FuncDecl); ok && i.SkipFunction != nil && i.SkipFunction(funcSymbol(params.Decorator.Path, params.File.Name.Name, decl)) {
+			return false
+		}
 
 		root := chain == nil
 		chain = chain.Child(csor)
@@ -7,9 +7,13 @@ package injector_test
 
 import (
 	gocontext "context"
+	"encoding/json"
 	"fmt"
+	"go/ast"
+	"go/importer"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"io"
 	"os"
 	"os/exec"
@@ -36,6 +40,8 @@ type testConfig struct {
 	GoLang              context.GoLangVersion          `yaml:"required-lang"`
 	Code                string                         `yaml:"code"`
 	ImportPath          string                         `yaml:"import-path"`
+	Cgo                 bool                           `yaml:"cgo"`
+	Cover               bool                           `yaml:"cover"`
 }
 
 const testModuleName = "dummy/test/module"
@@ -98,14 +104,28 @@ func Test(t *testing.T) {
 				config.ImportPath = testModuleName
 			}
 
-			astFile, err := parser.ParseFile(token.NewFileSet(), inputFile, []byte(original), parser.ParseComments)
-			require.NoError(t, err, "failed to parse input file")
+			// The files actually being compiled; for cgo packages and packages instrumented for coverage, these are
+			// generated by `go tool cgo` or `go tool cover`: the first one is produced from the input file, and the
+			// others are glue that must never be modified.
+			compiledFiles := []string{inputFile}
+			switch {
+			case config.Cgo:
+				objDir := filepath.Join(tmp, "_cgo")
+				runGo(t, tmp, "tool", "cgo", "-objdir", objDir, inputFile)
+				compiledFiles = []string{filepath.Join(objDir, "input.cgo1.go"), filepath.Join(objDir, "_cgo_gotypes.go")}
+			case config.Cover:
+				compiledFiles = coverFile(t, tmp, config.ImportPath, inputFile)
+			}
 
 			importMap := make(map[string]string)
-			for _, a := range astFile.Imports {
-				ax, err := strconv.Unquote(a.Path.Value)
-				require.NoError(t, err, "failed to unquote import path: %q", a.Path.Value)
-				importMap[ax] = ""
+			for _, file := range compiledFiles {
+				astFile, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly)
+				require.NoError(t, err, "failed to parse input file")
+				for _, a := range astFile.Imports {
+					ax, err := strconv.Unquote(a.Path.Value)
+					require.NoError(t, err, "failed to unquote import path: %q", a.Path.Value)
+					importMap[ax] = ""
+				}
 			}
 
 			inj := injector.Injector{
@@ -115,10 +135,13 @@ func Test(t *testing.T) {
 				ImportMap:    importMap,
 			}
 
-			res, resGoLang, err := inj.InjectFiles(gocontext.Background(), []string{inputFile}, config.Aspects)
+			res, resGoLang, err := inj.InjectFiles(gocontext.Background(), compiledFiles, config.Aspects)
 			require.NoError(t, err, "failed to inject file")
+			for _, glue := range compiledFiles[1:] {
+				assert.NotContains(t, res, glue, "cgo glue file was modified")
+			}
 
-			resFile, modified := res[inputFile]
+			resFile, modified := res[compiledFiles[0]]
 			if !modified {
 				golden.Assert(t, "<no changes>", filepath.Join(dirName, testName, "modified.go.snap"))
 				return
@@ -134,6 +157,12 @@ func Test(t *testing.T) {
 
 			golden.Assert(t, normalized, filepath.Join(dirName, testName, "modified.go.snap"))
 
+			if len(compiledFiles) > 1 {
+				// Files generated by cgo or cover cannot be built by the go command, so only verify they type-check...
+				typeCheck(t, testLookup, append([]string{resFile.Filename}, compiledFiles[1:]...)...)
+				return
+			}
+
 			// Verify that the modified code compiles...
 			os.Rename(resFile.Filename, inputFile)
 			runGo(t, tmp, "mod", "tidy")
@@ -153,6 +182,55 @@ func runGo(t *testing.T, dir string, args ...string) {
 	require.NoError(t, cmd.Run(), "failed running go %s", strings.Join(args, " "))
 }
 
+// coverFile instruments inputFile for coverage the same way the go command does
+// for `go test -cover`, and returns the paths to the instrumented file and to
+// the file declaring coverage variables.
+func coverFile(t *testing.T, dir string, importPath string, inputFile string) []string {
+	t.Helper()
+
+	astFile, err := parser.ParseFile(token.NewFileSet(), inputFile, nil, parser.PackageClauseOnly)
+	require.NoError(t, err, "failed to parse input file")
+
+	coverDir := filepath.Join(dir, "_cover")
+	require.NoError(t, os.MkdirAll(coverDir, 0o755))
+
+	pkgCfg, err := json.Marshal(map[string]any{
+		"OutConfig":   filepath.Join(coverDir, "coveragecfg"),
+		"PkgPath":     importPath,
+		"PkgName":     astFile.Name.Name,
+		"Granularity": "perblock",
+		"ModulePath":  testModuleName,
+	})
+	require.NoError(t, err)
+	pkgCfgFile := filepath.Join(coverDir, "pkgcfg.txt")
+	require.NoError(t, os.WriteFile(pkgCfgFile, pkgCfg, 0o644))
+
+	varsFile := filepath.Join(coverDir, "covervars.go")
+	coveredFile := filepath.Join(coverDir, "input.cover.go")
+	outFileList := filepath.Join(coverDir, "coveroutfiles.txt")
+	require.NoError(t, os.WriteFile(outFileList, []byte(varsFile+"\n"+coveredFile+"\n"), 0o644))
+
+	runGo(t, dir, "tool", "cover", "-pkgcfg", pkgCfgFile, "-mode", "set", "-var", "goCover_test_", "-outfilelist", outFileList, inputFile)
+	return []string{coveredFile, varsFile}
+}
+
+// typeCheck verifies that the provided files type-check together, resolving imports using lookup.
+func typeCheck(t *testing.T, lookup importer.Lookup, files ...string) {
+	t.Helper()
+
+	fset := token.NewFileSet()
+	astFiles := make([]*ast.File, len(files))
+	for i, file := range files {
+		var err error
+		astFiles[i], err = parser.ParseFile(fset, file, nil, parser.ParseComments)
+		require.NoError(t, err, "failed to parse %q", file)
+	}
+
+	cfg := types.Config{Importer: importer.ForCompiler(fset, "gc", lookup)}
+	_, err := cfg.Check(testModuleName, fset, astFiles, nil)
+	require.NoError(t, err, "failed to type-check modified files")
+}
+
 // normalize replaces all tabulation characters with two spaces, matching the indentation style found in YAML documents,
 // and cleans up line directives to remove the temporary file name.
 func normalize(in []byte, filename string) string {
@@ -21,8 +21,12 @@ const (
 
 var warnOnce sync.Once
 
-// isIgnored returns true if the node is prefixed by an `//orchestrion:ignore` (or the legacy `//dd:ignore`) directive.
+// isIgnored returns true if the node is prefixed by an `//orchestrion:ignore` (or the legacy `//dd:ignore`) directive,
+// or if it is coverage instrumentation inserted by `go tool cover`.
 func isIgnored(ctx context.Context, node dst.Node) bool {
+	if isCoverageInstrumentation(node) {
+		return true
+	}
 	for _, cmt := range node.Decorations().Start.All() {
 		if cmt == orchestrionIgnore || strings.HasPrefix(cmt, orchestrionIgnore+" ") {
 			return true
@@ -15,7 +15,9 @@ import (
 	"github.com/dave/dst/decorator"
 )
 
-const generated = "<generated>"
+// GeneratedFilename is the file name `//line` directives attribute synthetic
+// (woven) code to.
+const GeneratedFilename = "<generated>"
 
 type (
 	// annotationVisitor is an ast.Visitor that adds `//line` directives to the visited nodes to
@@ -93,9 +95,9 @@ func (v *annotationVisitor) Visit(node ast.Node) ast.Visitor {
 		}
 
 		// This is a synthetic node...
-		v.adjFile, v.adjLine = generated, 1
+		v.adjFile, v.adjLine = GeneratedFilename, 1
 
-		if prevInfo.adjFile != generated {
+		if prevInfo.adjFile != GeneratedFilename {
 			decs := dstNode.Decorations()
 			decs.Start.Append(v.directive(false))
 			if decs.Before == dst.None {
@@ -55,18 +55,24 @@ func (v *canonicalizationVisitor) Visit(node dst.Node) dst.Visitor {
 		return v
 	}
 
-	if node.Decorations().Before != dst.None {
-		return v
-	}
 	if _, isStmt := node.(dst.Stmt); !isStmt {
 		return v
 	}
 
 	// Don't space up the statements if they're not within a *dst.Block, or if the block contains exactly 1 statement.
-	if block, isBlock := parent.node.(*dst.BlockStmt); !isBlock || len(block.List) == 1 {
+	block, isBlock := parent.node.(*dst.BlockStmt)
+	if !isBlock || len(block.List) == 1 {
 		return v
 	}
 
-	node.Decorations().Before = dst.NewLine
+	// The canonical go format puts the closing brace of a block with several statements on its own line, even if the
+	// original block was written on a single line (e.g, `func() int { return 0 }`).
+	if node == block.List[len(block.List)-1] && node.Decorations().After == dst.None {
+		node.Decorations().After = dst.NewLine
+	}
+
+	if node.Decorations().Before == dst.None {
+		node.Decorations().Before = dst.NewLine
+	}
 	return v
 }
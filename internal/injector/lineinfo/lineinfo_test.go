@@ -0,0 +1,244 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package lineinfo_test
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/injector/lineinfo"
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// source contains calls to `mark(N)`, where N is the line number the call is
+// on. Function declarations are named after the line they start on.
+const source = `package test
+
+func mark(int) int { return 0 }
+
+func wrap(v int) int { return v }
+
+func line7() {
+	mark(8)
+	if mark(9) > 0 {
+		mark(10)
+	}
+
+	for i := 0; i < mark(13); i++ {
+		mark(14)
+		_ = mark(15) + mark(15)
+	}
+}
+
+func line19(a, b int) int {
+	defer mark(20)
+	return mark(21) +
+		mark(22)
+}
+
+type line25 struct{}
+
+func (line25) line27() {
+	mark(28)
+}
+`
+
+var indentedDirective = regexp.MustCompile(`(?m)^[ \t]+//line `)
+
+func TestAnnotateMovedNodes(t *testing.T) {
+	for name, modify := range map[string]func(t *testing.T, file *dst.File){
+		"unmodified": func(*testing.T, *dst.File) {},
+		"prepend-statements": func(t *testing.T, file *dst.File) {
+			for _, decl := range file.Decls {
+				if fn, ok := decl.(*dst.FuncDecl); ok && fn.Body != nil {
+					stmts := parseStmts(t, "println(\"before\")\nprintln(\"again\")")
+					fn.Body.List = append(stmts, fn.Body.List...)
+				}
+			}
+		},
+		"prepend-nested-statements": func(t *testing.T, file *dst.File) {
+			dst.Inspect(file, func(node dst.Node) bool {
+				if stmt, ok := node.(*dst.IfStmt); ok {
+					stmt.Body.List = append(parseStmts(t, "println(\"nested\")"), stmt.Body.List...)
+				}
+				return true
+			})
+		},
+		"append-statements": func(t *testing.T, file *dst.File) {
+			for _, decl := range file.Decls {
+				if fn, ok := decl.(*dst.FuncDecl); ok && fn.Body != nil {
+					fn.Body.List = append(fn.Body.List, parseStmts(t, "println(\"after\")")...)
+				}
+			}
+		},
+		"wrap-calls": func(t *testing.T, file *dst.File) {
+			dst.Inspect(file, func(node dst.Node) bool {
+				stmt, ok := node.(*dst.ExprStmt)
+				if !ok {
+					return true
+				}
+				stmt.X = &dst.CallExpr{Fun: dst.NewIdent("wrap"), Args: []dst.Expr{stmt.X}}
+				return false
+			})
+		},
+		"wrap-body": func(t *testing.T, file *dst.File) {
+			for _, decl := range file.Decls {
+				if fn, ok := decl.(*dst.FuncDecl); ok && fn.Body != nil && fn.Type.Results == nil {
+					stmts := parseStmts(t, "func() {}()")
+					lit := stmts[0].(*dst.ExprStmt).X.(*dst.CallExpr).Fun.(*dst.FuncLit)
+					lit.Body.List = fn.Body.List
+					fn.Body.List = stmts
+				}
+			}
+		},
+		"insert-declarations": func(t *testing.T, file *dst.File) {
+			decls := make([]dst.Decl, 0, 2*len(file.Decls))
+			for _, decl := range file.Decls {
+				synthetic, err := decorator.Parse("package test\n\nfunc synthetic() {\n\tprintln(\"synthetic\")\n}\n")
+				require.NoError(t, err)
+				decls = append(decls, synthetic.Decls[0], decl)
+			}
+			file.Decls = decls
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dec := decorator.NewDecorator(token.NewFileSet())
+			file, err := dec.ParseFile("/path/to/test.go", source, parser.ParseComments)
+			require.NoError(t, err)
+
+			modify(t, file)
+
+			newRestorer := func(filename string) *decorator.FileRestorer {
+				return &decorator.FileRestorer{Restorer: decorator.NewRestorer(), Name: filename}
+			}
+			require.NoError(t, lineinfo.AnnotateMovedNodes(dec, file, newRestorer))
+
+			res := newRestorer("/path/to/test.go")
+			astFile, err := res.RestoreFile(file)
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			require.NoError(t, format.Node(&buf, res.Fset, astFile))
+			// The injector removes leading white space ahead of `//line` directives, which are otherwise ignored.
+			code := indentedDirective.ReplaceAll(buf.Bytes(), []byte("//line "))
+
+			fset := token.NewFileSet()
+			woven, err := parser.ParseFile(fset, "/path/to/test.go.edited.go", code, parser.ParseComments)
+			require.NoError(t, err, "woven code:\n%s", code)
+
+			var marks, funcs int
+			ast.Inspect(woven, func(node ast.Node) bool {
+				switch node := node.(type) {
+				case *ast.CallExpr:
+					if fun, ok := node.Fun.(*ast.Ident); !ok || fun.Name != "mark" {
+						return true
+					}
+					expected, err := strconv.Atoi(node.Args[0].(*ast.BasicLit).Value)
+					require.NoError(t, err)
+					pos := fset.Position(node.Pos())
+					assert.Equal(t, "/path/to/test.go", pos.Filename, "mark(%d) is attributed to the wrong file", expected)
+					assert.Equal(t, expected, pos.Line, "mark(%d) is attributed to the wrong line", expected)
+					marks++
+
+				case *ast.FuncDecl:
+					suffix, found := strings.CutPrefix(node.Name.Name, "line")
+					if !found {
+						return true
+					}
+					expected, err := strconv.Atoi(suffix)
+					require.NoError(t, err)
+					for _, pos := range []token.Position{fset.Position(node.Pos()), fset.Position(node.Name.Pos())} {
+						assert.Equal(t, "/path/to/test.go", pos.Filename, "%s is attributed to the wrong file", node.Name.Name)
+						assert.Equal(t, expected, pos.Line, "%s is attributed to the wrong line", node.Name.Name)
+					}
+					funcs++
+				}
+				return true
+			})
+			assert.Equal(t, 11, marks)
+			assert.Equal(t, 3, funcs)
+			if t.Failed() {
+				t.Logf("woven code:\n%s", code)
+			}
+		})
+	}
+}
+
+// TestAnnotateMovedNodesSingleLineBlock checks that nodes following a block
+// written on a single line keep their position when statements are added to
+// that block, which causes the canonical go format to spread it over several
+// lines (including the closing brace).
+func TestAnnotateMovedNodesSingleLineBlock(t *testing.T) {
+	for name, source := range map[string]string{
+		"one-statement":    "package test\n\nfunc mark(int) int { return 0 }\n\nfunc line5() { mark(5) }\n\nfunc line7() { mark(7) }\n",
+		"two-statements":   "package test\n\nfunc mark(int) int { return 0 }\n\nfunc line5() { mark(5); mark(5) }\n\nfunc line7() { mark(7) }\n",
+		"return-statement": "package test\n\nfunc mark(int) int { return 0 }\n\nfunc line5() int { return mark(5) }\n\nfunc line7() { mark(7) }\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			dec := decorator.NewDecorator(token.NewFileSet())
+			file, err := dec.ParseFile("/path/to/test.go", source, parser.ParseComments)
+			require.NoError(t, err)
+
+			// Only the first function is modified, so the second one is not otherwise annotated.
+			fn := file.Decls[1].(*dst.FuncDecl)
+			fn.Body.List = append(parseStmts(t, "println(\"before\")"), fn.Body.List...)
+
+			newRestorer := func(filename string) *decorator.FileRestorer {
+				return &decorator.FileRestorer{Restorer: decorator.NewRestorer(), Name: filename}
+			}
+			require.NoError(t, lineinfo.AnnotateMovedNodes(dec, file, newRestorer))
+
+			res := newRestorer("/path/to/test.go")
+			astFile, err := res.RestoreFile(file)
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			require.NoError(t, format.Node(&buf, res.Fset, astFile))
+			code := indentedDirective.ReplaceAll(buf.Bytes(), []byte("//line "))
+
+			fset := token.NewFileSet()
+			woven, err := parser.ParseFile(fset, "/path/to/test.go.edited.go", code, parser.ParseComments)
+			require.NoError(t, err, "woven code:\n%s", code)
+
+			for _, decl := range woven.Decls {
+				decl := decl.(*ast.FuncDecl)
+				suffix, found := strings.CutPrefix(decl.Name.Name, "line")
+				if !found {
+					continue
+				}
+				expected, err := strconv.Atoi(suffix)
+				require.NoError(t, err)
+				assert.Equal(t, expected, fset.Position(decl.Pos()).Line, "%s is attributed to the wrong line", decl.Name.Name)
+				ast.Inspect(decl.Body, func(node ast.Node) bool {
+					if call, ok := node.(*ast.CallExpr); ok && call.Fun.(*ast.Ident).Name == "mark" {
+						assert.Equal(t, expected, fset.Position(call.Pos()).Line, "mark(%d) is attributed to the wrong line", expected)
+					}
+					return true
+				})
+			}
+			if t.Failed() {
+				t.Logf("woven code:\n%s", code)
+			}
+		})
+	}
+}
+
+func parseStmts(t *testing.T, code string) []dst.Stmt {
+	t.Helper()
+	file, err := decorator.Parse("package test\n\nfunc _() {\n" + code + "\n}\n")
+	require.NoError(t, err)
+	stmts := file.Decls[0].(*dst.FuncDecl).Body.List
+	file.Decls[0].(*dst.FuncDecl).Body.List = nil
+	return stmts
+}
@@ -0,0 +1,40 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package parse
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// cgoGeneratedHeader is the header written by `go tool cgo` at the top of the
+// `*.cgo1.go` files it produces from user sources. It is followed by a
+// "//line" directive mapping the file back to the original source file.
+const cgoGeneratedHeader = "// Code generated by cmd/cgo; DO NOT EDIT.\n\n"
+
+// IsCgoGlue returns true if filename is one of the glue files generated by
+// `go tool cgo` (e.g, `_cgo_gotypes.go`, `_cgo_import.go`), as opposed to a
+// `*.cgo1.go` file produced from a user source file. Glue files must be
+// type-checked with the rest of the package, but are never modified.
+func IsCgoGlue(filename string) bool {
+	return strings.HasPrefix(filepath.Base(filename), "_cgo_")
+}
+
+// consumeCgoHeader consumes the [cgoGeneratedHeader] from r if it is present.
+// Otherwise, the reader is rewinded to its original position.
+func consumeCgoHeader(r io.ReadSeeker) error {
+	var buf [len(cgoGeneratedHeader)]byte
+	n, err := io.ReadFull(r, buf[:])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	if string(buf[:n]) == cgoGeneratedHeader {
+		return nil
+	}
+	_, err = r.Seek(0, io.SeekStart)
+	return err
+}
@@ -8,6 +8,8 @@ package parse
 import (
 	"bytes"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -70,3 +72,45 @@ func TestConsumeLineDirective(t *testing.T) {
 		})
 	}
 }
+
+func TestReadFileCgo(t *testing.T) {
+	tmp := t.TempDir()
+
+	cases := map[string]struct {
+		content        string
+		mappedFilename string
+		rest           string
+	}{
+		"cgo1": {
+			content:        cgoGeneratedHeader + "//line /path/to/file.go:1:1\npackage main\n",
+			mappedFilename: "/path/to/file.go",
+			rest:           "package main\n",
+		},
+		"no-directive": {
+			content:        cgoGeneratedHeader + "package main\n",
+			mappedFilename: "",
+			rest:           cgoGeneratedHeader + "package main\n",
+		},
+		"short": {
+			content:        "package main\n",
+			mappedFilename: "",
+			rest:           "package main\n",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(tmp, name+".go")
+			require.NoError(t, os.WriteFile(filename, []byte(tc.content), 0o644))
+
+			raw, err := readFile(filename)
+			require.NoError(t, err)
+
+			expectedMappedFilename := tc.mappedFilename
+			if expectedMappedFilename == "" {
+				expectedMappedFilename = filename
+			}
+			require.Equal(t, expectedMappedFilename, raw.mappedName)
+			require.Equal(t, tc.rest, string(raw.content))
+		})
+	}
+}
@@ -86,6 +86,10 @@ func (p *Parser) ParseFiles(ctx context.Context, files []string, aspects []*aspe
 			}
 
 			fileAspects := aspects
+			if IsCgoGlue(file) {
+				// Glue code generated by cgo is only needed for type-checking.
+				fileAspects = nil
+			}
 			p.filesBytesCount.Add(uint64(len(p.rawFiles[idx].content)))
 			if !p.hasApplicableAspects() {
 				// While the current packae still has a chance to not require all files to be parsed, we can try to filter out
@@ -195,8 +199,12 @@ func readFile(filename string) (rawFile, error) {
 	// If the file begins with a "//line <path>:1:1" directive, we consume it and
 	// then pretend the "<path>" was our filename all along. This simplifies
 	// handling of line offsets further down the line and removes some duplicated
-	// effort to do it early.
+	// effort to do it early. Files produced by `go tool cgo` have the directive
+	// right after a "Code generated" header, which we also consume.
 	mappedFilename := filename
+	if err := consumeCgoHeader(file); err != nil {
+		return rawFile{}, fmt.Errorf("peeking at first line of %q: %w", filename, err)
+	}
 	if mapped, err := consumeLineDirective(file); err != nil {
 		return rawFile{}, fmt.Errorf("peeking at first line of %q: %w", filename, err)
 	} else if mapped != "" {
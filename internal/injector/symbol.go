@@ -0,0 +1,56 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package injector
+
+import (
+	"github.com/dave/dst"
+)
+
+// funcSymbol returns the linker symbol name of the function declared by decl,
+// in the package identified by importPath and pkgName, as it appears in CPU
+// profiles (e.g, `example.com/pkg.(*T).Method`, `main.main`, `example.com/pkg.F[...]`).
+func funcSymbol(importPath string, pkgName string, decl *dst.FuncDecl) string {
+	prefix := importPath
+	if pkgName == "main" {
+		prefix = "main"
+	}
+
+	name := decl.Name.Name
+	if decl.Type.TypeParams != nil && len(decl.Type.TypeParams.List) > 0 {
+		name += "[...]"
+	}
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return prefix + "." + name
+	}
+
+	recv := decl.Recv.List[0].Type
+	var ptr bool
+	if star, ok := recv.(*dst.StarExpr); ok {
+		ptr = true
+		recv = star.X
+	}
+	var generic bool
+	switch expr := recv.(type) {
+	case *dst.IndexExpr:
+		generic = true
+		recv = expr.X
+	case *dst.IndexListExpr:
+		generic = true
+		recv = expr.X
+	}
+
+	typeName := "_"
+	if ident, ok := recv.(*dst.Ident); ok {
+		typeName = ident.Name
+	}
+	if generic {
+		typeName += "[...]"
+	}
+	if ptr {
+		typeName = "(*" + typeName + ")"
+	}
+	return prefix + "." + typeName + "." + decl.Name.Name
+}
@@ -0,0 +1,39 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package injector
+
+import (
+	"testing"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuncSymbol(t *testing.T) {
+	for decl, expected := range map[string]string{
+		"func F() {}":                    "example.com/pkg.F",
+		"func F[T any]() {}":             "example.com/pkg.F[...]",
+		"func (T) M() {}":                "example.com/pkg.T.M",
+		"func (t *T) M() {}":             "example.com/pkg.(*T).M",
+		"func (g G[T]) M() {}":           "example.com/pkg.G[...].M",
+		"func (g *G[K, V]) M() {}":       "example.com/pkg.(*G[...]).M",
+		"func init() {}":                 "example.com/pkg.init",
+		"func (t *T) String() string {}": "example.com/pkg.(*T).String",
+	} {
+		t.Run(decl, func(t *testing.T) {
+			file, err := decorator.Parse("package pkg\n\n" + decl + "\n")
+			require.NoError(t, err)
+			require.Equal(t, expected, funcSymbol("example.com/pkg", file.Name.Name, file.Decls[0].(*dst.FuncDecl)))
+		})
+	}
+
+	t.Run("main", func(t *testing.T) {
+		file, err := decorator.Parse("package main\n\nfunc main() {}\n")
+		require.NoError(t, err)
+		require.Equal(t, "main.main", funcSymbol("example.com/cmd", file.Name.Name, file.Decls[0].(*dst.FuncDecl)))
+	})
+}
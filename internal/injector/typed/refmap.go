@@ -6,6 +6,7 @@
 package typed
 
 import (
+	"encoding/json"
 	"fmt"
 	"go/ast"
 	"go/token"
@@ -227,6 +228,28 @@ func (r *ReferenceMap) add(path string, kind ReferenceKind) bool {
 	return false
 }
 
+type referenceMapJSON struct {
+	Refs    map[string]ReferenceKind `json:"refs,omitempty"`
+	Aliases map[string]string        `json:"aliases,omitempty"`
+}
+
+// MarshalJSON encodes the references and aliases held by this [ReferenceMap].
+// The AST node maps and scopes are only relevant while injecting, and are not
+// encoded.
+func (r ReferenceMap) MarshalJSON() ([]byte, error) {
+	return json.Marshal(referenceMapJSON{Refs: r.refs, Aliases: r.aliases})
+}
+
+func (r *ReferenceMap) UnmarshalJSON(data []byte) error {
+	var val referenceMapJSON
+	if err := json.Unmarshal(data, &val); err != nil {
+		return err
+	}
+	r.refs = val.Refs
+	r.aliases = val.Aliases
+	return nil
+}
+
 func (k ReferenceKind) String() string {
 	if k == ImportStatement {
 		return "ImportStatement"
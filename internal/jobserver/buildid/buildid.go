@@ -7,10 +7,11 @@ package buildid
 
 import (
 	"context"
-	"sync"
 
 	"github.com/DataDog/orchestrion/internal/injector/config"
 	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/DataDog/orchestrion/internal/jobserver/pkgs"
+	"github.com/DataDog/orchestrion/internal/remotecache"
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog"
 )
@@ -22,14 +23,19 @@ const (
 )
 
 type service struct {
-	packageLoader   config.PackageLoader
-	stats           *common.CacheStats
-	resolvedVersion VersionSuffixResponse
-	mu              sync.Mutex
+	packageLoader  config.PackageLoader
+	moduleResolver pkgs.ModuleResolver
+	remote         *remotecache.Cache
+	resolved       common.Cache[VersionSuffixResponse] // Keyed by [common.BuildKey]
 }
 
-func Subscribe(ctx context.Context, conn *nats.Conn, pkgLoader config.PackageLoader, stats *common.CacheStats) error {
-	s := &service{packageLoader: pkgLoader, stats: stats}
+func Subscribe(ctx context.Context, conn *nats.Conn, pkgLoader config.PackageLoader, modResolver pkgs.ModuleResolver, remote *remotecache.Cache, stats *common.CacheStats) error {
+	s := &service{
+		packageLoader:  pkgLoader,
+		moduleResolver: modResolver,
+		remote:         remote,
+		resolved:       common.NewCache[VersionSuffixResponse](stats.Named("buildid")),
+	}
 	ctx = zerolog.Ctx(ctx).With().Str("nats.subject", versionSubject).Logger().WithContext(ctx)
 	_, err := conn.Subscribe(versionSubject, common.HandleRequest(ctx, s.versionSuffix))
 	return err
@@ -0,0 +1,446 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package buildid
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/DataDog/orchestrion/internal/remotecache"
+	"github.com/DataDog/orchestrion/internal/weavecache"
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/errgroup"
+)
+
+// moduleGraphFormat is the version of the on-disk module graph cache format. It
+// must be changed whenever [moduleGraph] changes in incompatible ways.
+const moduleGraphFormat = "1"
+
+type (
+	// moduleGraph is the list of modules in the build list of the main module(s),
+	// as reported by `go list -m -json all`.
+	moduleGraph struct {
+		Modules []*graphModule `json:"modules"`
+		// GoMods holds the hash of the `go.mod` file of each local module that is
+		// not a main module. These influence the build list, but are not part of
+		// the inputs used to compute the cache key, so they are verified when
+		// re-using a cached module graph.
+		GoMods map[string]string `json:"goMods,omitempty"`
+	}
+
+	graphModule struct {
+		Path    string       `json:"path"`
+		Version string       `json:"version,omitempty"`
+		Main    bool         `json:"main,omitempty"`
+		Dir     string       `json:"dir,omitempty"`
+		GoMod   string       `json:"goMod,omitempty"`
+		Replace *graphModule `json:"replace,omitempty"`
+	}
+)
+
+// isLocal determines whether this module is provided by a local directory, in
+// which case its content must be hashed, as its version (if any) does not
+// reflect changes made to it. This mirrors [moduleInfo.shouldHashContent].
+func (m *graphModule) isLocal() bool {
+	return m.Version == "" || (m.Replace != nil && m.Replace.Version == "")
+}
+
+// dir returns the directory containing this module's files.
+func (m *graphModule) dir() string {
+	if m.Replace != nil && m.Replace.Dir != "" {
+		return m.Replace.Dir
+	}
+	return m.Dir
+}
+
+// goMod returns the path to this module's `go.mod` file.
+func (m *graphModule) goMod() string {
+	if m.Replace != nil && m.Replace.GoMod != "" {
+		return m.Replace.GoMod
+	}
+	return m.GoMod
+}
+
+// provides returns true if the module's path is a prefix of importPath.
+func (m *graphModule) provides(importPath string) bool {
+	return importPath == m.Path || strings.HasPrefix(importPath, m.Path+"/")
+}
+
+// fingerprintJSON returns the JSON document used to fingerprint this module.
+// Directories are omitted, so that the fingerprint does not depend on the
+// location of the module cache.
+func (m *graphModule) fingerprintJSON() ([]byte, error) {
+	type module struct {
+		Path    string  `json:"path"`
+		Version string  `json:"version,omitempty"`
+		Replace *module `json:"replace,omitempty"`
+	}
+	val := module{Path: m.Path, Version: m.Version}
+	if m.Replace != nil {
+		val.Replace = &module{Path: m.Replace.Path, Version: m.Replace.Version}
+	}
+	return json.Marshal(val)
+}
+
+// loadModuleGraph returns the module graph of the main module(s). The graph is
+// cached on disk (and in the remote cache, if one is configured), keyed by all
+// inputs that determine it, so that it only needs to be computed using the go
+// toolchain when these change.
+func (s *service) loadModuleGraph(ctx context.Context) (graph *moduleGraph, err error) {
+	span, ctx := tracer.StartSpanFromContext(ctx, "buildid.moduleGraph")
+	defer func() { span.Finish(tracer.WithError(err)) }()
+
+	log := zerolog.Ctx(ctx)
+
+	flags, err := goflags.Flags(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to obtain go build flags")
+	}
+	var args []string
+	// Only the flags that affect the module graph are relevant here.
+	for _, flag := range []string{"-mod", "-modfile"} {
+		if val, found := flags.Get(flag); found {
+			args = append(args, fmt.Sprintf("%s=%s", flag, val))
+		}
+	}
+
+	key, err := moduleGraphKey(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	span.SetTag("cache.key", key)
+
+	filename, err := moduleGraphCacheFile(key)
+	if err != nil {
+		log.Debug().Err(err).Msg("Module graph disk cache is unavailable")
+	} else if graph := readModuleGraph(filename); graph != nil && graph.valid() {
+		span.SetTag("cache.source", "disk")
+		return graph, nil
+	}
+
+	remoteKey := remotecache.Key("module-graph", key)
+	if s.remote != nil {
+		var cached moduleGraph
+		if found, err := s.remote.GetValue(ctx, remoteKey, &cached); err != nil {
+			log.Warn().Err(err).Msg("Failed to look up the module graph in the remote cache")
+		} else if found && cached.valid() {
+			span.SetTag("cache.source", "remote")
+			writeModuleGraph(ctx, filename, &cached)
+			return &cached, nil
+		}
+	}
+
+	span.SetTag("cache.source", "go list")
+	graph, err = listModuleGraph(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	writeModuleGraph(ctx, filename, graph)
+	if s.remote != nil {
+		if err := s.remote.PutValue(ctx, remoteKey, graph); err != nil {
+			log.Warn().Err(err).Msg("Failed to upload the module graph to the remote cache")
+		}
+	}
+
+	return graph, nil
+}
+
+// moduleGraphKey computes the cache key for the module graph. It accounts for
+// the relevant go environment, the provided flags (and the file designated by
+// `-modfile`, if any), and the content of the go.mod, go.sum, go.work and
+// go.work.sum files.
+func moduleGraphKey(ctx context.Context, flags []string) (string, error) {
+	goBin, err := goenv.GoBinPath()
+	if err != nil {
+		return "", fmt.Errorf("resolving go command path: %w", err)
+	}
+
+	cmd := common.ConfigureCommand(ctx, exec.CommandContext(ctx, goBin, "env", "-json", "GOMOD", "GOWORK", "GOOS", "GOARCH", "GOVERSION", "GOEXPERIMENT", "GOFLAGS", "GOPROXY", "GONOSUMDB", "GOPRIVATE", "CGO_ENABLED"))
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running %q: %w", cmd.Args, err)
+	}
+	var env map[string]string
+	if err := json.Unmarshal(stdout.Bytes(), &env); err != nil {
+		return "", fmt.Errorf("parsing output of %q: %w", cmd.Args, err)
+	}
+
+	filenames := []string{env["GOMOD"], env["GOWORK"]}
+	parts := []string{"module-graph", moduleGraphFormat, stdout.String()}
+	for _, flag := range flags {
+		parts = append(parts, flag)
+		if modfile, found := strings.CutPrefix(flag, "-modfile="); found {
+			if !filepath.IsAbs(modfile) {
+				modfile = filepath.Join(common.BuildDir(ctx), modfile)
+			}
+			filenames = append(filenames, modfile)
+		}
+	}
+	for _, filename := range filenames {
+		if filename == "" || filename == os.DevNull || filename == "off" {
+			continue
+		}
+		sumFile := strings.TrimSuffix(filename, ".mod") + ".sum" // go.mod => go.sum; go.work => go.work.sum
+		for _, name := range []string{filename, sumFile} {
+			content, err := os.ReadFile(name)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return "", err
+			}
+			parts = append(parts, name, string(content))
+		}
+	}
+
+	return remotecache.Key(parts...), nil
+}
+
+// listModuleGraph runs `go list -m -json all` to obtain the module graph. Only
+// the fields that are needed are requested, so that the go toolchain does not
+// need to fetch additional module metadata (e.g, publication times).
+func listModuleGraph(ctx context.Context, flags []string) (*moduleGraph, error) {
+	log := zerolog.Ctx(ctx)
+
+	goBin, err := goenv.GoBinPath()
+	if err != nil {
+		return nil, fmt.Errorf("resolving go command path: %w", err)
+	}
+
+	args := append([]string{"list", "-m", "-e", "-json=Path,Version,Main,Dir,GoMod,Replace,Error"}, flags...)
+	args = append(args, "all")
+
+	var stdout, stderr bytes.Buffer
+	cmd := common.ConfigureCommand(ctx, exec.CommandContext(ctx, goBin, args...))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("running %q: %w\n%s", cmd.Args, err, stderr.String())
+	}
+
+	graph := &moduleGraph{}
+	dec := json.NewDecoder(&stdout)
+	for {
+		var info struct {
+			graphModule
+			Error *struct{ Err string }
+		}
+		if err := dec.Decode(&info); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("parsing output of %q: %w", cmd.Args, err)
+		}
+		if info.Error != nil {
+			// The module's path and version are known, which is all that is needed
+			// unless it is a local module, in which case hashing its content will
+			// report any actual problem.
+			log.Debug().Str("module", info.Path).Str("error", info.Error.Err).Msg("Module has errors")
+		}
+		mod := info.graphModule
+		graph.Modules = append(graph.Modules, &mod)
+
+		if mod.Main || !mod.isLocal() {
+			continue
+		}
+		if goMod := mod.goMod(); goMod != "" {
+			sum, err := hashFile(goMod)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+			if graph.GoMods == nil {
+				graph.GoMods = make(map[string]string)
+			}
+			graph.GoMods[goMod] = sum
+		}
+	}
+
+	return graph, nil
+}
+
+// valid returns true if the `go.mod` files of local modules are unchanged since
+// the graph was computed.
+func (g *moduleGraph) valid() bool {
+	for filename, expected := range g.GoMods {
+		if actual, err := hashFile(filename); (err != nil && !errors.Is(err, fs.ErrNotExist)) || actual != expected {
+			return false
+		}
+	}
+	return true
+}
+
+func moduleGraphCacheFile(key string) (string, error) {
+	root, err := weavecache.Root()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, "buildid", key+".json"), nil
+}
+
+func readModuleGraph(filename string) *moduleGraph {
+	if filename == "" {
+		return nil
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	var graph moduleGraph
+	if err := json.Unmarshal(data, &graph); err != nil {
+		return nil
+	}
+	return &graph
+}
+
+func writeModuleGraph(ctx context.Context, filename string, graph *moduleGraph) {
+	if filename == "" {
+		return
+	}
+	log := zerolog.Ctx(ctx)
+
+	data, err := json.Marshal(graph)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to marshal module graph")
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		log.Warn().Err(err).Msg("Failed to create module graph cache directory")
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to create module graph cache file")
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("path", filename).Msg("Failed to write module graph cache file")
+	}
+}
+
+// hashModuleContent returns the hashes of all files that are part of the
+// module rooted in dir, sorted by file name. Test files, as well as directories
+// ignored by the go toolchain and nested modules are skipped.
+func hashModuleContent(ctx context.Context, modulePath string, dir string) (files [][2]string, err error) {
+	span, _ := tracer.StartSpanFromContext(ctx, "buildid.hashModuleContent",
+		tracer.ResourceName(modulePath),
+	)
+	defer func() {
+		span.SetTag("files", len(files))
+		span.Finish(tracer.WithError(err))
+	}()
+
+	var filenames []string
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path == dir {
+				return nil
+			}
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor" {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				// This is a nested module, which is not part of this one.
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+		filenames = append(filenames, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hashFiles(filenames)
+}
+
+// hashFiles returns the hashes of the provided files, sorted by file name.
+func hashFiles(filenames []string) ([][2]string, error) {
+	var (
+		files  = make([][2]string, 0, len(filenames))
+		errGrp errgroup.Group
+		mu     sync.Mutex
+	)
+	for _, filename := range filenames {
+		errGrp.Go(func() error {
+			hash, err := hashFile(filename)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			files = append(files, [2]string{filename, hash})
+
+			return nil
+		})
+	}
+
+	if err := errGrp.Wait(); err != nil {
+		return nil, err
+	}
+
+	// Ensure a consistent ordering on file names...
+	slices.SortFunc(files, func(i, j [2]string) int {
+		return strings.Compare(i[0], j[0])
+	})
+
+	return files, nil
+}
+
+var shaPool = sync.Pool{New: func() any { return sha512.New() }}
+
+// hashFile returns the base64-encoded SHA-512 hash of the provided file.
+func hashFile(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	sha, _ := shaPool.Get().(hash.Hash)
+	defer func() {
+		sha.Reset()
+		shaPool.Put(sha)
+	}()
+
+	if _, err := io.Copy(sha, file); err != nil {
+		return "", err
+	}
+
+	var buf [sha512.Size]byte
+	return base64.URLEncoding.EncodeToString(sha.Sum(buf[:0])), nil
+}
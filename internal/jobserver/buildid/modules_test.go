@@ -0,0 +1,99 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package buildid
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/DataDog/orchestrion/internal/weavecache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModuleGraph(t *testing.T) {
+	ctx := context.Background()
+	goflags.SetFlags(ctx, ".", []string{"build"})
+
+	tmp := t.TempDir()
+	t.Setenv(weavecache.EnvVarCacheDir, filepath.Join(tmp, "cache"))
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOPROXY", "off")
+	t.Setenv("GOWORK", "off")
+
+	writeFiles(t, tmp, map[string]string{
+		"app/go.mod":            "module example.com/app\n\ngo 1.23\n\nrequire example.com/lib v0.0.0\n\nreplace example.com/lib => ../lib\n",
+		"app/main.go":           "package main\n\nfunc main() {}\n",
+		"lib/go.mod":            "module example.com/lib\n\ngo 1.23\n",
+		"lib/lib.go":            "package lib\n",
+		"lib/lib_test.go":       "package lib\n",
+		"lib/sub/sub.go":        "package sub\n",
+		"lib/sub/data.txt":      "embedded\n",
+		"lib/testdata/input.go": "package ignored\n",
+		"lib/_ignored/file.go":  "package ignored\n",
+		"lib/nested/go.mod":     "module example.com/lib/nested\n\ngo 1.23\n",
+		"lib/nested/nested.go":  "package nested\n",
+	})
+	chdir(t, filepath.Join(tmp, "app"))
+
+	svc := &service{}
+	graph, err := svc.loadModuleGraph(ctx)
+	require.NoError(t, err)
+	require.Len(t, graph.Modules, 2)
+
+	app, lib := graph.Modules[0], graph.Modules[1]
+	assert.Equal(t, "example.com/app", app.Path)
+	assert.True(t, app.Main)
+	assert.Equal(t, "example.com/lib", lib.Path)
+	assert.True(t, lib.isLocal())
+	assert.Equal(t, filepath.Join(tmp, "lib"), lib.dir())
+	assert.Contains(t, graph.GoMods, filepath.Join(tmp, "lib", "go.mod"))
+
+	// The module graph is cached on disk...
+	key, err := moduleGraphKey(ctx, []string{"-mod=mod"})
+	require.NoError(t, err)
+	filename, err := moduleGraphCacheFile(key)
+	require.NoError(t, err)
+	require.FileExists(t, filename)
+	cached := readModuleGraph(filename)
+	require.NotNil(t, cached)
+	assert.True(t, cached.valid())
+
+	// ... but is invalidated when a local module's go.mod file changes.
+	writeFiles(t, tmp, map[string]string{"lib/go.mod": "module example.com/lib\n\ngo 1.23.1\n"})
+	assert.False(t, cached.valid())
+
+	files, err := hashModuleContent(ctx, lib.Path, lib.dir())
+	require.NoError(t, err)
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		rel, err := filepath.Rel(lib.dir(), file[0])
+		require.NoError(t, err)
+		names = append(names, filepath.ToSlash(rel))
+		assert.NotEmpty(t, file[1])
+	}
+	assert.Equal(t, []string{"go.mod", "lib.go", "sub/data.txt", "sub/sub.go"}, names)
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { require.NoError(t, os.Chdir(wd)) })
+}
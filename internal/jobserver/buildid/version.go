@@ -6,27 +6,33 @@
 package buildid
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha512"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"hash"
 	"io"
+	"io/fs"
 	"os"
+	"os/exec"
 	"runtime/debug"
 	"slices"
 	"sort"
 	"strings"
 	"sync"
 
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
 	"github.com/DataDog/orchestrion/internal/fingerprint"
+	"github.com/DataDog/orchestrion/internal/goenv"
 	"github.com/DataDog/orchestrion/internal/goflags"
 	"github.com/DataDog/orchestrion/internal/injector/aspect"
 	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/DataDog/orchestrion/internal/remotecache"
 	"github.com/DataDog/orchestrion/internal/version"
 	"github.com/rs/zerolog"
-	"golang.org/x/sync/errgroup"
 	"golang.org/x/tools/go/packages"
 )
 
@@ -40,22 +46,26 @@ func (VersionSuffixRequest) ResponseIs(VersionSuffixResponse) {}
 func (VersionSuffixRequest) ForeachSpanTag(func(string, any)) {}
 
 func (s *service) versionSuffix(ctx context.Context, _ VersionSuffixRequest) (VersionSuffixResponse, error) {
-	log := zerolog.Ctx(ctx)
+	// The version suffix depends on the build's module and settings, which only
+	// vary across requests if this server serves multiple builds.
+	return s.resolved.Load(common.BuildKey(ctx), func() (VersionSuffixResponse, error) {
+		return s.resolveVersionSuffix(ctx)
+	})
+}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (s *service) resolveVersionSuffix(ctx context.Context) (VersionSuffixResponse, error) {
+	log := zerolog.Ctx(ctx)
 
-	if s.resolvedVersion != "" {
-		s.stats.RecordHit()
-		return s.resolvedVersion, nil
+	aspects, err := s.loadAspects(ctx)
+	if err != nil {
+		return "", err
 	}
-	s.stats.RecordMiss()
 
-	cfg, err := config.NewLoader(s.packageLoader, ".", false).Load(ctx)
+	target, err := buildTarget(ctx)
 	if err != nil {
-		return "", fmt.Errorf("loading injector configuration: %w", err)
+		return "", fmt.Errorf("determining build target: %w", err)
 	}
-	aspects := cfg.Aspects()
+	aspects = aspect.FilterTarget(ctx, target, aspects)
 
 	fptr := fingerprint.New()
 	defer fptr.Close()
@@ -63,26 +73,197 @@ func (s *service) versionSuffix(ctx context.Context, _ VersionSuffixRequest) (Ve
 		return "", fmt.Errorf("computing injector configuration fingerprint: %w", err)
 	}
 
-	var pkgs []*packages.Package
+	// The target determines which aspects apply, and which files make up the
+	// injected packages, so it must be part of the fingerprint.
+	if err := target.Hash(fptr); err != nil {
+		return "", fmt.Errorf("computing build target fingerprint: %w", err)
+	}
+
+	// Aspects may be enabled or disabled depending on the versions of modules
+	// they require, so these versions must be part of the fingerprint.
+	if err := s.fingerprintRequiredModules(ctx, fptr, aspects); err != nil {
+		return "", err
+	}
+
+	var (
+		remoteKey string
+		cacheable bool
+	)
 	if paths := aspect.InjectedPaths(aspects); len(paths) != 0 {
 		flags, err := goflags.Flags(ctx)
 		if err != nil {
 			return "", err
 		}
 
-		pkgs, err = packages.Load(
-			&packages.Config{
-				Mode:       packages.NeedDeps | packages.NeedEmbedFiles | packages.NeedFiles | packages.NeedImports | packages.NeedModule,
-				BuildFlags: append(flags.Except("-toolexec").Slice(), "-toolexec="), // Explicitly disable toolexec to avoid infinite recursion
-				Logf:       func(format string, args ...any) { log.Trace().Str("operation", "packages.Load").Msgf(format, args...) },
-			},
-			paths...,
-		)
+		// Resolving injected packages is expensive, so a remote cache is consulted
+		// first, if one is configured.
+		if s.remote != nil {
+			remoteKey, err = versionSuffixRemoteKey(ctx, aspects, flags.Except("-toolexec").Slice())
+			if err != nil {
+				log.Warn().Err(err).Msg("Failed to compute remote cache key for the version suffix")
+			} else {
+				var cached VersionSuffixResponse
+				if found, err := s.remote.GetValue(ctx, remoteKey, &cached); err != nil {
+					log.Warn().Err(err).Msg("Failed to look up the version suffix in the remote cache")
+				} else if found {
+					log.Debug().Str("version-suffix", string(cached)).Msg("Using version suffix from the remote cache")
+					return cached, nil
+				}
+			}
+		}
+
+		cacheable, err = s.fingerprintModules(ctx, fptr, paths)
 		if err != nil {
-			return "", err
+			log.Warn().Err(err).Msg("Failed to fingerprint the module graph; falling back to loading injected packages")
+			cacheable, err = fingerprintInjectedPackages(ctx, fptr, paths, flags)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	resolved := VersionSuffixResponse(fmt.Sprintf("orchestrion@%s%s;%s", version.Tag(), getTagSuffix(ctx), fptr.Finish()))
+
+	// Modules that are replaced by local directories are fingerprinted by
+	// content, which the remote cache key does not account for.
+	if remoteKey != "" && cacheable {
+		if err := s.remote.PutValue(ctx, remoteKey, resolved); err != nil {
+			log.Warn().Err(err).Msg("Failed to upload the version suffix to the remote cache")
 		}
 	}
 
+	return resolved, nil
+}
+
+func (s *service) loadAspects(ctx context.Context) (_ []*aspect.Aspect, err error) {
+	span, ctx := tracer.StartSpanFromContext(ctx, "buildid.loadConfig")
+	defer func() { span.Finish(tracer.WithError(err)) }()
+
+	cfg, err := config.NewLoader(s.packageLoader, common.BuildDir(ctx), false).LoadAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading injector configuration: %w", err)
+	}
+	aspects := cfg.Aspects()
+	span.SetTag("aspects", len(aspects))
+	return aspects, nil
+}
+
+// buildTarget returns the platform and build tags of the build on whose behalf
+// the current request is made.
+func buildTarget(ctx context.Context) (goenv.Target, error) {
+	flags, err := goflags.Flags(ctx)
+	if err != nil {
+		return goenv.Target{}, err
+	}
+	return goenv.TargetOf(common.BuildDir(ctx), common.BuildEnv(ctx), flags.Tags())
+}
+
+func (s *service) fingerprintRequiredModules(ctx context.Context, fptr *fingerprint.Hasher, aspects []*aspect.Aspect) (err error) {
+	required := aspect.RequiredModules(aspects)
+	if len(required) == 0 {
+		return nil
+	}
+
+	span, ctx := tracer.StartSpanFromContext(ctx, "buildid.requiredModules")
+	defer func() { span.Finish(tracer.WithError(err)) }()
+
+	versions, err := s.moduleResolver(ctx, common.BuildDir(ctx), required...)
+	if err != nil {
+		return fmt.Errorf("resolving required module versions: %w", err)
+	}
+	if err := fptr.Named("requires", fingerprint.Map(versions, func(path string, version string) (string, fingerprint.String) {
+		return path, fingerprint.String(version)
+	})); err != nil {
+		return fmt.Errorf("computing required modules fingerprint: %w", err)
+	}
+	return nil
+}
+
+// fingerprintModules adds all modules of the module graph that may provide
+// injected packages (or their dependencies) to the fingerprint. Modules are
+// fingerprinted by path and version, except for local modules, which are
+// fingerprinted by content. Main modules are only included if they provide
+// some of the injected packages, so that changes to the application's own code
+// do not invalidate the whole build cache. It returns false if any module was
+// fingerprinted by content.
+func (s *service) fingerprintModules(ctx context.Context, fptr *fingerprint.Hasher, injectedPaths []string) (cacheable bool, err error) {
+	log := zerolog.Ctx(ctx)
+
+	graph, err := s.loadModuleGraph(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	span, ctx := tracer.StartSpanFromContext(ctx, "buildid.fingerprintModules")
+	defer func() { span.Finish(tracer.WithError(err)) }()
+
+	modules := slices.Clone(graph.Modules)
+	slices.SortFunc(modules, func(i, j *graphModule) int { return strings.Compare(i.Path, j.Path) })
+
+	var fingerprinted, local int
+	cacheable = true
+	for _, mod := range modules {
+		if mod.Main && !slices.ContainsFunc(injectedPaths, mod.provides) {
+			continue
+		}
+
+		jsonMod, err := mod.fingerprintJSON()
+		if err != nil {
+			return false, err
+		}
+		if mod.isLocal() {
+			cacheable = false
+			local++
+			files, err := hashModuleContent(ctx, mod.Path, mod.dir())
+			if err != nil {
+				return false, fmt.Errorf("hashing content of module %q: %w", mod.Path, err)
+			}
+			jsonMod, err = json.Marshal(struct {
+				Module json.RawMessage `json:"module"`
+				Files  [][2]string     `json:"files"`
+			}{Module: jsonMod, Files: files})
+			if err != nil {
+				return false, err
+			}
+		}
+
+		log.Trace().RawJSON("module", jsonMod).Msg("Adding module to fingerprint...")
+		if err := fptr.Named(mod.Path, fingerprint.String(jsonMod)); err != nil {
+			return false, err
+		}
+		fingerprinted++
+	}
+	span.SetTag("modules", fingerprinted)
+	span.SetTag("modules.local", local)
+
+	return cacheable, nil
+}
+
+// fingerprintInjectedPackages adds the modules providing the injected packages
+// and all their dependencies to the fingerprint, using [packages.Load]. This is
+// used when the module graph cannot be listed (e.g, in GOPATH mode). It returns
+// false if any module was fingerprinted by content.
+func fingerprintInjectedPackages(ctx context.Context, fptr *fingerprint.Hasher, injectedPaths []string, flags goflags.CommandFlags) (cacheable bool, err error) {
+	span, ctx := tracer.StartSpanFromContext(ctx, "buildid.fingerprintInjectedPackages")
+	defer func() { span.Finish(tracer.WithError(err)) }()
+
+	log := zerolog.Ctx(ctx)
+
+	pkgs, err := packages.Load(
+		&packages.Config{
+			Context:    ctx,
+			Mode:       packages.NeedDeps | packages.NeedEmbedFiles | packages.NeedFiles | packages.NeedImports | packages.NeedModule,
+			BuildFlags: append(flags.Except("-toolexec").Slice(), "-toolexec="), // Explicitly disable toolexec to avoid infinite recursion
+			Logf:       func(format string, args ...any) { log.Trace().Str("operation", "packages.Load").Msgf(format, args...) },
+			Dir:        common.BuildDir(ctx),
+			Env:        common.BuildEnv(ctx),
+		},
+		injectedPaths...,
+	)
+	if err != nil {
+		return false, err
+	}
+
 	modules := make(map[string]*moduleInfo, len(pkgs))
 	for _, pkg := range pkgs {
 		collectModules(pkg, modules, nil)
@@ -93,20 +274,62 @@ func (s *service) versionSuffix(ctx context.Context, _ VersionSuffixRequest) (Ve
 	}
 	sort.Strings(names)
 
+	cacheable = true
 	for _, name := range names {
 		mod := modules[name]
 		jsonMod, err := json.Marshal(mod)
 		if err != nil {
-			return "", err
+			return false, err
 		}
 		log.Trace().RawJSON("module", jsonMod).Msg("Adding module to fingerprint...")
 		if err := fptr.Named(name, fingerprint.String(jsonMod)); err != nil {
-			return "", err
+			return false, err
 		}
+		cacheable = cacheable && !mod.shouldHashContent()
 	}
+	span.SetTag("modules", len(names))
 
-	s.resolvedVersion = VersionSuffixResponse(fmt.Sprintf("orchestrion@%s%s;%s", version.Tag(), getTagSuffix(ctx), fptr.Finish()))
-	return s.resolvedVersion, nil
+	return cacheable, nil
+}
+
+// versionSuffixRemoteKey computes the remote cache key for the version suffix.
+// It accounts for everything that influences the resolution of the injected
+// packages: the aspects, the build flags, the relevant go environment, and the
+// content of the go.mod, go.sum, go.work and go.work.sum files.
+func versionSuffixRemoteKey(ctx context.Context, aspects []*aspect.Aspect, flags []string) (string, error) {
+	aspectsHash, err := fingerprint.Fingerprint(fingerprint.List[*aspect.Aspect](aspects))
+	if err != nil {
+		return "", err
+	}
+
+	cmd := common.ConfigureCommand(ctx, exec.CommandContext(ctx, "go", "env", "-json", "GOMOD", "GOWORK", "GOOS", "GOARCH", "GOVERSION", "GOEXPERIMENT", "GOFLAGS", "CGO_ENABLED"))
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running %q: %w", cmd.Args, err)
+	}
+	var env map[string]string
+	if err := json.Unmarshal(stdout.Bytes(), &env); err != nil {
+		return "", fmt.Errorf("parsing output of %q: %w", cmd.Args, err)
+	}
+
+	parts := []string{"version-suffix", version.Tag(), getTagSuffix(ctx), aspectsHash, stdout.String()}
+	parts = append(parts, flags...)
+	for _, filename := range []string{env["GOMOD"], env["GOWORK"]} {
+		if filename == "" || filename == os.DevNull || filename == "off" {
+			continue
+		}
+		sumFile := strings.TrimSuffix(filename, ".mod") + ".sum" // go.mod => go.sum; go.work => go.work.sum
+		for _, name := range []string{filename, sumFile} {
+			content, err := os.ReadFile(name)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return "", err
+			}
+			parts = append(parts, name, string(content))
+		}
+	}
+
+	return remotecache.Key(parts...), nil
 }
 
 type moduleInfo struct {
@@ -164,50 +387,15 @@ func (m *moduleInfo) MarshalJSON() ([]byte, error) {
 	}{Module: m.Module}
 
 	if m.shouldHashContent() {
-		toMarshal.Files = make([][2]string, 0, len(m.Files))
-
-		var (
-			pool   = sync.Pool{New: func() any { return sha512.New() }}
-			errGrp errgroup.Group
-			mu     sync.Mutex
-		)
+		filenames := make([]string, 0, len(m.Files))
 		for filename := range m.Files {
-			errGrp.Go(func() error {
-				file, err := os.Open(filename)
-				if err != nil {
-					return err
-				}
-				defer file.Close()
-
-				sha, _ := pool.Get().(hash.Hash)
-				defer func() {
-					sha.Reset()
-					pool.Put(sha)
-				}()
-
-				if _, err := io.Copy(sha, file); err != nil {
-					return err
-				}
-
-				var buf [sha512.Size]byte
-				hash := base64.URLEncoding.EncodeToString(sha.Sum(buf[:0]))
-
-				mu.Lock()
-				defer mu.Unlock()
-				toMarshal.Files = append(toMarshal.Files, [2]string{filename, hash})
-
-				return nil
-			})
+			filenames = append(filenames, filename)
 		}
-
-		if err := errGrp.Wait(); err != nil {
+		files, err := hashFiles(filenames)
+		if err != nil {
 			return nil, err
 		}
-
-		// Ensure a consistent ordering on file names...
-		slices.SortFunc(toMarshal.Files, func(i, j [2]string) int {
-			return strings.Compare(i[0], j[0])
-		})
+		toMarshal.Files = files
 	}
 
 	return json.Marshal(toMarshal)
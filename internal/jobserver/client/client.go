@@ -9,38 +9,89 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/ext"
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
 	"github.com/DataDog/orchestrion/internal/jobserver/common"
 	"github.com/DataDog/orchestrion/internal/traceutil"
+	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 )
 
 const (
-	Username   = "orchestrion"
-	NoPassword = "" // We only use account management to have access to system events, not for security.
+	// Username is the name of the user clients authenticate as. The password is
+	// the server's random token, which is part of its URL.
+	Username = "orchestrion"
 )
 
 type Client struct {
-	conn *nats.Conn
+	conn   *nats.Conn
+	daemon bool // Whether this client is connected to the daemon job server
+
+	// buildID is the value of the [common.BuildHeader] of requests, once the
+	// build has been registered (see [RegisterBuild]).
+	buildID string
+	buildMu sync.Mutex
 }
 
 // Connect creates a new client connected to the NATS server at the specified
-// address.
+// address. The address includes the credentials to authenticate with, and is
+// either a `nats://` URL for servers listening on TCP, or a `unix://` URL for
+// servers listening on a Unix domain socket.
 func Connect(addr string) (*Client, error) {
-	conn, err := nats.Connect(addr, nats.Name(fmt.Sprintf("orchestrion[%d]", os.Getpid())), nats.UserInfo(Username, NoPassword))
+	opts := []nats.Option{nats.Name(fmt.Sprintf("orchestrion[%d]", os.Getpid()))}
+
+	var daemon bool
+	if u, err := url.Parse(addr); err == nil && u.Scheme == "unix" {
+		socket := filepath.FromSlash(u.Path)
+		opts = append(opts, nats.SetCustomDialer(unixDialer(socket)))
+		// The host is not used by the dialer, but NATS requires one to be present.
+		addr = (&url.URL{Scheme: "nats", User: u.User, Host: "localhost"}).String()
+		daemon = isDaemonSocket(socket)
+	}
+
+	conn, err := nats.Connect(addr, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return New(conn), nil
+	c := New(conn)
+	c.daemon = daemon
+	return c, nil
+}
+
+// RedactURL returns addr with its password (the server's token) masked, so that
+// it can be logged or displayed.
+func RedactURL(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return addr
+	}
+	return u.Redacted()
+}
+
+// unixDialer dials the Unix domain socket at the designated path, regardless of
+// the address it is asked to dial.
+type unixDialer string
+
+func (d unixDialer) Dial(string, string) (net.Conn, error) {
+	return net.Dial("unix", string(d))
 }
 
 func New(conn *nats.Conn) *Client {
 	return &Client{conn: conn}
 }
 
+// ID returns the ID assigned to this client's connection by the job server.
+func (c *Client) ID() (uint64, error) {
+	return c.conn.GetClientID()
+}
+
 func (c *Client) Close() {
 	c.conn.Close()
 }
@@ -53,6 +104,49 @@ type (
 )
 
 func Request[Res any, Req request[Res]](ctx context.Context, client *Client, req Req) (Res, error) {
+	if client.daemon {
+		// The daemon serves many builds, so it needs to be told which one requests are for.
+		if err := client.registerCurrentBuild(ctx); err != nil {
+			var zero Res
+			return zero, err
+		}
+	}
+	return send(ctx, client, req)
+}
+
+// registerCurrentBuild registers the build of the current process, unless a
+// build was already registered with this client.
+func (c *Client) registerCurrentBuild(ctx context.Context) error {
+	c.buildMu.Lock()
+	defer c.buildMu.Unlock()
+	if c.buildID != "" {
+		return nil
+	}
+	build, err := currentBuild()
+	if err != nil {
+		return err
+	}
+	return RegisterBuild(ctx, c, build)
+}
+
+// RegisterBuild registers the build on whose behalf all subsequent requests
+// made with this client are made. This is only relevant for job servers that
+// serve multiple builds, and is done automatically for the daemon job server.
+// It must be called before any other request is made with this client.
+func RegisterBuild(ctx context.Context, client *Client, build common.Build) error {
+	id, err := client.ID()
+	if err != nil {
+		return fmt.Errorf("obtaining client ID: %w", err)
+	}
+	if _, err := send(ctx, client, common.RegisterBuildRequest{ClientID: id, Build: build}); err != nil {
+		return fmt.Errorf("registering build: %w", err)
+	}
+	client.buildID = strconv.FormatUint(id, 10)
+	return nil
+}
+
+// send sends req to the job server, on behalf of the registered build, if any.
+func send[Res any, Req request[Res]](ctx context.Context, client *Client, req Req) (Res, error) {
 	span, ctx := tracer.StartSpanFromContext(ctx, "nats.client",
 		tracer.ResourceName(req.Subject()),
 		tracer.Tag(ext.SpanKind, ext.SpanKindClient),
@@ -76,9 +170,19 @@ func Request[Res any, Req request[Res]](ctx context.Context, client *Client, req
 	msg := nats.NewMsg(req.Subject())
 	msg.Data = reqData
 	tracer.Inject(span.Context(), traceutil.NATSCarrier{Msg: msg})
+	id := uuid.NewString()
+	msg.Header.Set(common.RequestIDHeader, id)
+	if client.buildID != "" {
+		msg.Header.Set(common.BuildHeader, client.buildID)
+	}
 
 	resp, err := client.conn.RequestMsgWithContext(ctx, msg)
 	if err != nil {
+		if ctx.Err() != nil {
+			// Let the job server know we are no longer waiting for this, so it can stop processing it
+			// (e.g, stop spawning child builds for an aborted build).
+			_ = client.conn.Publish(common.CancelSubject, []byte(id))
+		}
 		var zero Res
 		return zero, err
 	}
@@ -0,0 +1,204 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/DataDog/orchestrion/internal/version"
+)
+
+const (
+	// envVarRuntimeDir is the XDG base directory for user-specific runtime files
+	// (e.g, sockets).
+	envVarRuntimeDir = "XDG_RUNTIME_DIR"
+
+	daemonSocketName = "jobserver.sock"
+	daemonInfoName   = "jobserver.json"
+)
+
+var (
+	// ErrDaemonVersionMismatch is returned by [ConnectDaemon] when the running
+	// daemon job server is not the same version as this process.
+	ErrDaemonVersionMismatch = errors.New("the daemon job server is running a different version of orchestrion")
+	// ErrDaemonUntrusted is returned (together with [ErrNoServerAvailable]) by
+	// [ReadDaemonInfo] and [ConnectDaemon] when the daemon job server's files
+	// could have been written by another user, who could then impersonate it.
+	ErrDaemonUntrusted = errors.New("the daemon job server's files are not private to the current user")
+)
+
+// DaemonInfo is the content of the daemon job server's information file, which
+// clients use to discover it.
+type DaemonInfo struct {
+	// URL is the client URL of the daemon job server.
+	URL string `json:"url"`
+	// Version is the orchestrion version of the daemon job server.
+	Version string `json:"version"`
+	// PID is the process ID of the daemon job server.
+	PID int `json:"pid"`
+}
+
+// DaemonDir returns the directory containing the daemon job server's socket
+// and information file. This is the `orchestrion` directory under
+// $XDG_RUNTIME_DIR if it is set, or a user-specific directory under the system
+// temporary directory otherwise.
+func DaemonDir() string {
+	if dir := os.Getenv(envVarRuntimeDir); dir != "" {
+		return filepath.Join(dir, "orchestrion")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("orchestrion-%d", os.Getuid()))
+}
+
+// DaemonSocket returns the path to the daemon job server's Unix domain socket.
+func DaemonSocket() string {
+	return filepath.Join(DaemonDir(), daemonSocketName)
+}
+
+// DaemonInfoFile returns the path to the daemon job server's information file.
+func DaemonInfoFile() string {
+	return filepath.Join(DaemonDir(), daemonInfoName)
+}
+
+// CheckDaemonDir returns an error wrapping [ErrDaemonUntrusted] if
+// [DaemonDir] is not a directory owned by the current user, and only
+// accessible to them. The error wraps [fs.ErrNotExist] if it does not exist.
+func CheckDaemonDir() error {
+	return checkPrivate(DaemonDir(), fs.ModeDir|0o700)
+}
+
+// ReadDaemonInfo reads the daemon job server's information file. It returns
+// [ErrNoServerAvailable] if there is no such file, or if it (or its directory)
+// is not private to the current user, in which case the error also wraps
+// [ErrDaemonUntrusted].
+func ReadDaemonInfo() (*DaemonInfo, error) {
+	for _, check := range []struct {
+		path string
+		mode fs.FileMode
+	}{{DaemonDir(), fs.ModeDir | 0o700}, {DaemonInfoFile(), 0o600}} {
+		err := checkPrivate(check.path, check.mode)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNoServerAvailable
+		}
+		if errors.Is(err, ErrDaemonUntrusted) {
+			return nil, fmt.Errorf("%w: %w", ErrNoServerAvailable, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(DaemonInfoFile())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNoServerAvailable
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var info DaemonInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", DaemonInfoFile(), err)
+	}
+	return &info, nil
+}
+
+// WriteDaemonInfo atomically replaces the daemon job server's information
+// file. The file contains the server's authentication token, so only the
+// current user may read it.
+func WriteDaemonInfo(info *DaemonInfo) (err error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	filename := DaemonInfoFile()
+	tmp, err := os.CreateTemp(filepath.Dir(filename), daemonInfoName+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, os.Remove(tmp.Name()))
+		}
+	}()
+
+	// [os.CreateTemp] already uses mode 0600, but we make sure the umask did not get in the way.
+	if err := tmp.Chmod(0o600); err != nil {
+		return errors.Join(err, tmp.Close())
+	}
+	if _, err := tmp.Write(data); err != nil {
+		return errors.Join(err, tmp.Close())
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// ConnectDaemon returns a client connected to the daemon job server, if one is
+// running. It returns [ErrNoServerAvailable] if there is none (or if it cannot
+// be trusted, see [ReadDaemonInfo]), and [ErrDaemonVersionMismatch] if it is
+// not the same version as this process.
+func ConnectDaemon() (*Client, *DaemonInfo, error) {
+	info, err := ReadDaemonInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Version != version.Tag() {
+		return nil, info, fmt.Errorf("%w (%s, expected %s)", ErrDaemonVersionMismatch, info.Version, version.Tag())
+	}
+
+	c, err := Connect(info.URL)
+	if err != nil {
+		return nil, info, errors.Join(ErrNoServerAvailable, err)
+	}
+	return c, info, nil
+}
+
+// checkPrivate returns an error wrapping [ErrDaemonUntrusted] unless the file
+// at path is owned by the current user, and has exactly the designated type and
+// permissions. Symbolic links are not followed.
+func checkPrivate(path string, mode fs.FileMode) error {
+	stat, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if stat.Mode() != mode {
+		return fmt.Errorf("%w: %q has mode %s, expected %s", ErrDaemonUntrusted, path, stat.Mode(), mode)
+	}
+	if uid, ok := fileOwner(stat); !ok || uid != os.Getuid() {
+		return fmt.Errorf("%w: %q is not owned by the current user", ErrDaemonUntrusted, path)
+	}
+	return nil
+}
+
+// isDaemonSocket returns true if the provided path is the daemon job server's
+// socket.
+func isDaemonSocket(path string) bool {
+	return filepath.Clean(path) == DaemonSocket()
+}
+
+// currentBuild returns the [common.Build] describing this process. Only the
+// environment variables that affect the build are included, so that unrelated
+// secrets (e.g, credentials) are never sent to the job server.
+func currentBuild() (common.Build, error) {
+	build := common.Build{PID: os.Getpid()}
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); common.IsBuildEnv(name) {
+			build.Env = append(build.Env, kv)
+		}
+	}
+	var err error
+	build.Dir, err = os.Getwd()
+	return build, err
+}
@@ -0,0 +1,96 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package client_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadDaemonInfo(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The daemon job server is not supported on Windows")
+	}
+
+	for name, tc := range map[string]struct {
+		setup     func(t *testing.T, dir string)
+		untrusted bool
+	}{
+		"missing": {
+			setup: func(*testing.T, string) {},
+		},
+		"no-info": {
+			setup: func(t *testing.T, dir string) { mkdir(t, dir, 0o700) },
+		},
+		"private": {
+			setup: func(t *testing.T, dir string) {
+				mkdir(t, dir, 0o700)
+				writeInfo(t, dir, 0o600)
+			},
+		},
+		"shared-dir": {
+			setup: func(t *testing.T, dir string) {
+				mkdir(t, dir, 0o755)
+				writeInfo(t, dir, 0o600)
+			},
+			untrusted: true,
+		},
+		"shared-info": {
+			setup: func(t *testing.T, dir string) {
+				mkdir(t, dir, 0o700)
+				writeInfo(t, dir, 0o644)
+			},
+			untrusted: true,
+		},
+		"symlink": {
+			setup: func(t *testing.T, dir string) {
+				target := filepath.Join(filepath.Dir(dir), "elsewhere")
+				mkdir(t, target, 0o700)
+				writeInfo(t, target, 0o600)
+				require.NoError(t, os.Symlink(target, dir))
+			},
+			untrusted: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+			tc.setup(t, client.DaemonDir())
+
+			info, err := client.ReadDaemonInfo()
+			if name == "private" {
+				require.NoError(t, err)
+				assert.Equal(t, &client.DaemonInfo{URL: "unix:///jobserver.sock", Version: "v1.2.3", PID: 42}, info)
+				require.NoError(t, client.CheckDaemonDir())
+				return
+			}
+			require.ErrorIs(t, err, client.ErrNoServerAvailable)
+			if tc.untrusted {
+				require.ErrorIs(t, err, client.ErrDaemonUntrusted)
+			} else {
+				require.NotErrorIs(t, err, client.ErrDaemonUntrusted)
+			}
+		})
+	}
+}
+
+func mkdir(t *testing.T, dir string, mode os.FileMode) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(dir, mode))
+	require.NoError(t, os.Chmod(dir, mode))
+}
+
+func writeInfo(t *testing.T, dir string, mode os.FileMode) {
+	t.Helper()
+	filename := filepath.Join(dir, "jobserver.json")
+	require.NoError(t, os.WriteFile(filename, []byte(`{"url":"unix:///jobserver.sock","version":"v1.2.3","pid":42}`), mode))
+	require.NoError(t, os.Chmod(filename, mode))
+}
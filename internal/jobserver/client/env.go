@@ -23,7 +23,13 @@ import (
 
 const (
 	EnvVarJobserverURL = "ORCHESTRION_JOBSERVER_URL"
-	urlFileName        = ".orchestrion-jobserver"
+	// EnvVarJobserver can be set to "off" to prevent connecting to (or starting)
+	// job servers in other processes, for example in sandboxed build systems that
+	// restrict process spawning. Work is then performed in-process instead.
+	EnvVarJobserver = "ORCHESTRION_JOBSERVER"
+	// URLFileName is the name of the file containing the URL of the job server
+	// started in a go build work directory.
+	URLFileName = ".orchestrion-jobserver"
 )
 
 var (
@@ -34,8 +40,13 @@ var (
 
 // FromEnvironment returns a client connected to the current environment's
 // job server, using the following process:
+//   - If job servers are disabled (see [Disabled]), the ErrNoServerAvailable
+//     error is returned.
 //   - If the ORCHESTRION_JOBSERVER_URL environment variable is set, a client
 //     connected to this URL is returned.
+//   - Otherwise, if a daemon job server (see `orchestrion server --daemon`) of
+//     the same version is running, a client connected to it is returned. A
+//     daemon running a different version of orchestrion is not used.
 //   - Otherwise, if workDir is not empty, a server will be identified based on
 //     a `.orchestrion-jobserver` file; or a new server will be started using
 //     that url file, and a connection will be established to it. The started
@@ -52,8 +63,13 @@ func FromEnvironment(ctx context.Context, workDir string) (*Client, error) {
 
 	log := zerolog.Ctx(ctx)
 
+	if Disabled() {
+		log.Debug().Str(EnvVarJobserver, os.Getenv(EnvVarJobserver)).Msg("Job servers are disabled")
+		return nil, ErrNoServerAvailable
+	}
+
 	if url := os.Getenv(EnvVarJobserverURL); url != "" {
-		log.Debug().Str(EnvVarJobserverURL, url).Msg("Connecting to job server")
+		log.Debug().Str(EnvVarJobserverURL, RedactURL(url)).Msg("Connecting to job server")
 		c, err := Connect(url)
 		if err != nil {
 			return nil, err
@@ -62,13 +78,23 @@ func FromEnvironment(ctx context.Context, workDir string) (*Client, error) {
 		return client, nil
 	}
 
+	if c, info, err := ConnectDaemon(); err == nil {
+		log.Debug().Int("daemon.pid", info.PID).Msg("Connected to daemon job server")
+		client = c
+		// Set it in the current environment so that child processes don't have to go through the same dance again.
+		_ = os.Setenv(EnvVarJobserverURL, info.URL)
+		return client, nil
+	} else if errors.Is(err, ErrDaemonUntrusted) || !errors.Is(err, ErrNoServerAvailable) {
+		log.Warn().Err(err).Msg("Not using the daemon job server")
+	}
+
 	if workDir == "" {
 		log.Debug().Msg("Unable to connect to relevant job server (no environment, no work tree)...")
 		return nil, ErrNoServerAvailable
 	}
 
 	log.Debug().Str("workdir", workDir).Msg("Connecting to job server rooted in working directory")
-	urlFilePath := filepath.Join(workDir, urlFileName)
+	urlFilePath := filepath.Join(workDir, URLFileName)
 
 	// Try to start a server. The server process is idempotent if the `-url-file` flag is used, so we do not check the
 	// command's exit status, because another process might act as our server down the line.
@@ -120,6 +146,17 @@ func FromEnvironment(ctx context.Context, workDir string) (*Client, error) {
 	return client, nil
 }
 
+// Disabled returns true if job servers are disabled for the current process
+// and its children, as per the ORCHESTRION_JOBSERVER environment variable.
+func Disabled() bool {
+	return os.Getenv(EnvVarJobserver) == "off"
+}
+
+// Disable disables job servers for the current process and its children.
+func Disable() {
+	_ = os.Setenv(EnvVarJobserver, "off")
+}
+
 func clientFromURLFile(ctx context.Context, path string) (*Client, string, error) {
 	log := zerolog.Ctx(ctx)
 
@@ -147,7 +184,7 @@ func clientFromURLFile(ctx context.Context, path string) (*Client, string, error
 	log.Trace().
 		Err(err).
 		Str("url-file", path).
-		Str("url", url).
+		Str("url", RedactURL(url)).
 		Msg("Connected to job server from URL file")
 	return client, url, err
 }
@@ -172,7 +209,7 @@ func waitForURLFile(ctx context.Context, path string, cmd *exec.Cmd, exitChan <-
 		if url != "" {
 			log.Error().Err(err).
 				Str("url-file", path).
-				Str("url", url).
+				Str("url", RedactURL(url)).
 				Msg("Failed to connect to job server at specified URL")
 			return nil, err
 		}
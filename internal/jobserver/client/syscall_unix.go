@@ -7,8 +7,20 @@
 
 package client
 
-import "syscall"
+import (
+	"io/fs"
+	"syscall"
+)
 
 var sysProcAttrDaemon = syscall.SysProcAttr{
 	Foreground: false,
 }
+
+// fileOwner returns the user ID of the owner of the file described by stat.
+func fileOwner(stat fs.FileInfo) (int, bool) {
+	sys, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(sys.Uid), true
+}
@@ -7,9 +7,18 @@
 
 package client
 
-import "syscall"
+import (
+	"io/fs"
+	"syscall"
+)
 
 var sysProcAttrDaemon = syscall.SysProcAttr{
 	HideWindow:    true,
 	ParentProcess: 0,
 }
+
+// fileOwner returns the user ID of the owner of the file described by stat.
+// File ownership is not represented by user IDs on Windows.
+func fileOwner(fs.FileInfo) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,270 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/DataDog/orchestrion/internal/remotecache"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+)
+
+// BuildHeader is the NATS message header carrying the ID of the build (see
+// [RegisterBuildRequest]) on whose behalf a request is made. Job servers that
+// serve many builds (see [SubscribeBuilds]) use it to determine the build's
+// settings.
+const BuildHeader = "Orchestrion-Build"
+
+// RegisterBuildSubject is the subject of [RegisterBuildRequest].
+const RegisterBuildSubject = "builds.register"
+
+// Build describes the process on whose behalf a request is made.
+type Build struct {
+	// Dir is the working directory of the process.
+	Dir string `json:"dir"`
+	// PID is the process ID of the process, which is used to locate the go
+	// command it is a child of.
+	PID int `json:"pid"`
+	// Env contains the variables of the process' environment that affect the
+	// build (see [IsBuildEnv]).
+	Env []string `json:"env"`
+}
+
+type (
+	// RegisterBuildRequest is a request to register the build on whose behalf a
+	// client makes requests, so that it is only sent once per connection. The
+	// client's subsequent requests designate it by setting their [BuildHeader] to
+	// the client's ID. The registration is forgotten when the client disconnects
+	// (see [Builds.Forget]).
+	RegisterBuildRequest struct {
+		// ClientID is the ID assigned by the NATS server to the client's
+		// connection.
+		ClientID uint64 `json:"clientID"`
+		// Build describes the client's build.
+		Build Build `json:"build"`
+	}
+	// RegisterBuildResponse is the response to a [RegisterBuildRequest].
+	RegisterBuildResponse struct{}
+)
+
+func (RegisterBuildRequest) Subject() string                   { return RegisterBuildSubject }
+func (RegisterBuildRequest) ResponseIs(*RegisterBuildResponse) {}
+func (r RegisterBuildRequest) ForeachSpanTag(set func(key string, value any)) {
+	set("request.clientID", r.ClientID)
+	set("request.dir", r.Build.Dir)
+}
+
+// IsBuildEnv returns true if the environment variable with the designated name
+// affects builds. Only these are sent by clients of job servers that serve many
+// builds; other variables are taken from the job server's own environment.
+func IsBuildEnv(name string) bool {
+	switch name {
+	case "CC", "CXX", "PKG_CONFIG", "PATH":
+		return true
+	default:
+		return strings.HasPrefix(name, "GO") || strings.HasPrefix(name, "CGO_") || strings.HasPrefix(name, "ORCHESTRION_")
+	}
+}
+
+// Builds is the registry of builds served by a job server that serves many
+// builds, keyed by the ID of the client connection that registered them.
+type Builds struct {
+	mu       sync.Mutex
+	byClient map[uint64]*buildContext
+}
+
+type (
+	multipleBuildsKey struct{}
+	buildKey          struct{}
+
+	// buildContext is the per-request information derived from a [Build].
+	buildContext struct {
+		root  string               // The module root directory
+		env   []string             // The build's environment
+		flags goflags.CommandFlags // The build's go flags
+		key   string               // The cache key for the build's settings
+	}
+)
+
+// SubscribeBuilds handles [RegisterBuildRequest] messages on conn, and returns
+// a context that marks request handlers registered with [HandleRequest] as
+// serving multiple builds, so that the go flags, module root, and environment
+// of each request's build are those registered for its [BuildHeader] rather
+// than those of the job server process itself. The returned [Builds] must be
+// told when clients disconnect.
+func SubscribeBuilds(ctx context.Context, conn *nats.Conn) (context.Context, *Builds, error) {
+	builds := &Builds{byClient: make(map[uint64]*buildContext)}
+	ctx = context.WithValue(ctx, multipleBuildsKey{}, builds)
+	if _, err := conn.Subscribe(RegisterBuildSubject, HandleRequest(ctx, builds.register)); err != nil {
+		return nil, nil, err
+	}
+	return ctx, builds, nil
+}
+
+// Forget removes the build registered by the designated client, if any.
+func (b *Builds) Forget(clientID uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.byClient, clientID)
+}
+
+func (b *Builds) register(ctx context.Context, req RegisterBuildRequest) (*RegisterBuildResponse, error) {
+	build := newBuildContext(ctx, req.Build)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.byClient[req.ClientID] = build
+	return &RegisterBuildResponse{}, nil
+}
+
+func (b *Builds) lookup(clientID uint64) (*buildContext, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	build, found := b.byClient[clientID]
+	return build, found
+}
+
+// BuildDir returns the root directory of the module being built on behalf of
+// the current request. This is "." (the job server's working directory) unless
+// the job server serves multiple builds.
+func BuildDir(ctx context.Context) string {
+	if build, found := ctx.Value(buildKey{}).(*buildContext); found {
+		return build.root
+	}
+	return "."
+}
+
+// BuildEnv returns the environment of the build on whose behalf the current
+// request is made, or nil if it is the job server's own environment.
+func BuildEnv(ctx context.Context) []string {
+	if build, found := ctx.Value(buildKey{}).(*buildContext); found {
+		return build.env
+	}
+	return nil
+}
+
+// BuildKey returns a cache key that identifies the settings of the build on
+// whose behalf the current request is made (module root, go flags, and go
+// environment), or a blank string if the job server serves a single build.
+func BuildKey(ctx context.Context) string {
+	if build, found := ctx.Value(buildKey{}).(*buildContext); found {
+		return build.key
+	}
+	return ""
+}
+
+// ConfigureCommand sets the working directory and environment of cmd to those
+// of the build on whose behalf the current request is made, if the job server
+// serves multiple builds. It returns cmd.
+func ConfigureCommand(ctx context.Context, cmd *exec.Cmd) *exec.Cmd {
+	if build, found := ctx.Value(buildKey{}).(*buildContext); found {
+		cmd.Dir = build.root
+		cmd.Env = build.env
+	}
+	return cmd
+}
+
+// withBuild returns a context carrying the settings of the build designated by
+// the [BuildHeader] of msg, if the job server serves multiple builds.
+func withBuild(ctx context.Context, msg *nats.Msg) (context.Context, error) {
+	builds, _ := ctx.Value(multipleBuildsKey{}).(*Builds)
+	if builds == nil || msg.Header == nil {
+		return ctx, nil
+	}
+	header := msg.Header.Get(BuildHeader)
+	if header == "" {
+		return ctx, nil
+	}
+
+	clientID, err := strconv.ParseUint(header, 10, 64)
+	if err != nil {
+		return ctx, fmt.Errorf("invalid %s header: %w", BuildHeader, err)
+	}
+	build, found := builds.lookup(clientID)
+	if !found {
+		return ctx, fmt.Errorf("invalid %s header: no build is registered for client %d", BuildHeader, clientID)
+	}
+
+	ctx = goflags.WithFlags(ctx, build.flags)
+	return context.WithValue(ctx, buildKey{}, build), nil
+}
+
+// newBuildContext computes the settings of the provided build.
+func newBuildContext(ctx context.Context, build Build) *buildContext {
+	flags, err := goflags.FromProcess(ctx, build.PID, envValue(build.Env, "GOFLAGS"))
+	if err != nil {
+		// Not all clients are run by a go command (e.g, `orchestrion server status`); the job server's
+		// own flags are used for these.
+		zerolog.Ctx(ctx).Debug().Err(err).Int("pid", build.PID).Msg("Failed to obtain go build flags of client process")
+		flags, _ = goflags.Flags(ctx)
+	}
+
+	root := moduleRoot(build.Dir)
+	flagList := flags.Except("-toolexec").Slice()
+	slices.Sort(flagList)
+	var goEnv []string
+	for _, kv := range build.Env {
+		// Only the go environment is relevant to the build's settings.
+		if name, _, _ := strings.Cut(kv, "="); (strings.HasPrefix(name, "GO") || strings.HasPrefix(name, "CGO_")) && name != "GOTMPDIR" {
+			goEnv = append(goEnv, kv)
+		}
+	}
+	slices.Sort(goEnv)
+	keyParts := append(append([]string{"build", root}, flagList...), goEnv...)
+
+	// Clients only send the variables that affect the build, the others (e.g, HOME) are those of the job server,
+	// which runs as the same user.
+	env := make([]string, 0, len(build.Env)+32)
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); !IsBuildEnv(name) {
+			env = append(env, kv)
+		}
+	}
+	env = append(append(env, build.Env...), "TOOLEXEC_IMPORTPATH=") // Child go commands must not believe they are toolexec'd
+
+	return &buildContext{
+		root:  root,
+		env:   env,
+		flags: flags,
+		key:   remotecache.Key(keyParts...),
+	}
+}
+
+// envValue returns the value of the named variable in env, if present.
+func envValue(env []string, name string) string {
+	var val string
+	for _, kv := range env {
+		if n, v, _ := strings.Cut(kv, "="); n == name {
+			val = v // The last occurrence wins, as with [os/exec.Cmd.Env]
+		}
+	}
+	return val
+}
+
+// moduleRoot returns the closest directory containing a go.mod file, starting
+// from dir. If there is none, dir is returned.
+func moduleRoot(dir string) string {
+	for candidate := dir; ; {
+		if _, err := os.Stat(filepath.Join(candidate, "go.mod")); err == nil {
+			return candidate
+		}
+		parent := filepath.Dir(candidate)
+		if parent == candidate {
+			return dir
+		}
+		candidate = parent
+	}
+}
@@ -0,0 +1,140 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package common_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/jobserver"
+	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	buildRequest  struct{}
+	buildResponse struct {
+		Dir string `json:"dir"`
+		Key string `json:"key"`
+	}
+)
+
+func (buildRequest) Subject() string                  { return "test.build" }
+func (buildRequest) ResponseIs(*buildResponse)        {}
+func (buildRequest) ForeachSpanTag(func(string, any)) {}
+
+func TestBuild(t *testing.T) {
+	tmp := t.TempDir()
+	modA := filepath.Join(tmp, "a")
+	modB := filepath.Join(tmp, "b")
+	for _, dir := range []string{filepath.Join(modA, "sub"), modB} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(modA, "go.mod"), []byte("module a\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(modB, "go.mod"), []byte("module b\n"), 0o644))
+
+	for name, multiple := range map[string]bool{"single": false, "multiple": true} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			server, err := jobserver.New(ctx, nil)
+			require.NoError(t, err)
+			defer server.Shutdown()
+
+			conn, err := nats.Connect(server.ClientURL())
+			require.NoError(t, err)
+			defer conn.Close()
+
+			handlerCtx := ctx
+			var builds *common.Builds
+			if multiple {
+				handlerCtx, builds, err = common.SubscribeBuilds(ctx, conn)
+				require.NoError(t, err)
+			}
+			_, err = conn.Subscribe(buildRequest{}.Subject(), common.HandleRequest(handlerCtx, func(ctx context.Context, _ buildRequest) (*buildResponse, error) {
+				return &buildResponse{Dir: common.BuildDir(ctx), Key: common.BuildKey(ctx)}, nil
+			}))
+			require.NoError(t, err)
+			require.NoError(t, conn.Flush())
+
+			// connect returns a new client, which registers build (if not nil).
+			connect := func(t *testing.T, build *common.Build) *client.Client {
+				t.Helper()
+				conn, err := nats.Connect(server.ClientURL())
+				require.NoError(t, err)
+				t.Cleanup(conn.Close)
+				c := client.New(conn)
+				if build != nil {
+					require.NoError(t, client.RegisterBuild(ctx, c, *build))
+				}
+				return c
+			}
+			request := func(t *testing.T, build *common.Build) *buildResponse {
+				t.Helper()
+				res, err := client.Request(ctx, connect(t, build), buildRequest{})
+				require.NoError(t, err)
+				return res
+			}
+
+			env := []string{"GOOS=linux", "HOME=/home/a"}
+			if !multiple {
+				// Servers that serve a single build do not accept build registrations.
+				conn, err := nats.Connect(server.ClientURL())
+				require.NoError(t, err)
+				defer conn.Close()
+				require.Error(t, client.RegisterBuild(ctx, client.New(conn), common.Build{Dir: modA, PID: os.Getpid(), Env: env}))
+				assert.Equal(t, &buildResponse{Dir: "."}, request(t, nil))
+				return
+			}
+
+			inSub := request(t, &common.Build{Dir: filepath.Join(modA, "sub"), PID: os.Getpid(), Env: env})
+			assert.Equal(t, modA, inSub.Dir)
+			assert.NotEmpty(t, inSub.Key)
+
+			// Builds of the same module with the same settings share their key...
+			atRoot := request(t, &common.Build{Dir: modA, PID: os.Getpid(), Env: []string{"GOOS=linux", "HOME=/home/b"}})
+			assert.Equal(t, inSub, atRoot)
+
+			// ... but not with different go settings, or in a different module.
+			otherGOOS := request(t, &common.Build{Dir: modA, PID: os.Getpid(), Env: []string{"GOOS=darwin"}})
+			assert.Equal(t, modA, otherGOOS.Dir)
+			assert.NotEqual(t, inSub.Key, otherGOOS.Key)
+			otherModule := request(t, &common.Build{Dir: modB, PID: os.Getpid(), Env: env})
+			assert.Equal(t, modB, otherModule.Dir)
+			assert.NotEqual(t, inSub.Key, otherModule.Key)
+
+			// Requests without a build header are processed in the server's own context.
+			assert.Equal(t, &buildResponse{Dir: "."}, request(t, nil))
+
+			// Registered builds are used by all requests of their client, until it is forgotten.
+			c := connect(t, &common.Build{Dir: modB, PID: os.Getpid(), Env: env})
+			for range 2 {
+				res, err := client.Request(ctx, c, buildRequest{})
+				require.NoError(t, err)
+				assert.Equal(t, otherModule, res)
+			}
+			clientID, err := c.ID()
+			require.NoError(t, err)
+			builds.Forget(clientID)
+			_, err = client.Request(ctx, c, buildRequest{})
+			require.ErrorContains(t, err, "no build is registered for client")
+		})
+	}
+}
+
+func TestIsBuildEnv(t *testing.T) {
+	for _, name := range []string{"GOOS", "GOFLAGS", "CGO_ENABLED", "CC", "CXX", "PKG_CONFIG", "PATH", "ORCHESTRION_LOG_LEVEL"} {
+		assert.True(t, common.IsBuildEnv(name), name)
+	}
+	for _, name := range []string{"HOME", "DD_API_KEY", "AWS_SECRET_ACCESS_KEY", "GITHUB_TOKEN", "CCACHE_DIR"} {
+		assert.False(t, common.IsBuildEnv(name), name)
+	}
+}
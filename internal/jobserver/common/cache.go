@@ -6,7 +6,9 @@
 package common
 
 import (
+	"context"
 	"fmt"
+	"slices"
 	"sync"
 	"sync/atomic"
 )
@@ -21,11 +23,18 @@ type (
 		mu     sync.Mutex
 		loaded bool
 		value  V
+		flight *flight // Non-nil while a loader is populating this slot
+	}
+	flight struct {
+		done chan struct{} // Closed once the loader has returned
 	}
 
 	CacheStats struct {
 		total atomic.Uint64
 		hits  atomic.Uint64
+
+		parent   *CacheStats // Also records all accesses recorded by this one, if not nil
+		children sync.Map    // Named subsets of this one's accesses (string => *CacheStats)
 	}
 )
 
@@ -41,24 +50,112 @@ func NewCache[V any](stats *CacheStats) Cache[V] {
 // returns an error, the cache slot is not marked as loaded, and the error is
 // returned as-is.
 func (c *Cache[V]) Load(key string, loader func() (V, error)) (V, error) {
-	c.stats.total.Add(1)
-
-	s := c.slot(key)
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	res, err := c.LoadMany(context.Background(), []string{key}, func(context.Context, []string) (map[string]V, error) {
+		v, err := loader()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]V{key: v}, nil
+	})
+	return res[key], err
+}
 
-	if s.loaded {
-		c.stats.hits.Add(1)
-		return s.value, nil
+// LoadMany retrieves the values for all provided keys in the cache. Keys that
+// are neither present nor being loaded by a concurrent call are passed to the
+// loader in a single batch; keys that are already being loaded by a concurrent
+// call are waited on rather than loaded again. If a concurrent load fails (e.g,
+// because its caller was canceled), the affected keys are loaded again by this
+// call. If the loader returns an error, none of the keys it was passed are
+// marked as loaded, and the error is returned as-is.
+//
+// The provided context is passed to the loader, and is used to stop waiting on
+// concurrent loads.
+func (c *Cache[V]) LoadMany(ctx context.Context, keys []string, loader func(ctx context.Context, keys []string) (map[string]V, error)) (map[string]V, error) {
+	res := make(map[string]V, len(keys))
+
+	for {
+		var (
+			claimed []string
+			waiting []*flight
+		)
+		for _, key := range keys {
+			if _, found := res[key]; found || slices.Contains(claimed, key) {
+				continue
+			}
+
+			s := c.slot(key)
+			s.mu.Lock()
+			switch {
+			case s.loaded:
+				c.stats.RecordHit()
+				res[key] = s.value
+			case s.flight != nil:
+				waiting = append(waiting, s.flight)
+			default:
+				c.stats.RecordMiss()
+				s.flight = &flight{done: make(chan struct{})}
+				claimed = append(claimed, key)
+			}
+			s.mu.Unlock()
+		}
+
+		if len(claimed) != 0 {
+			if err := c.loadClaimed(ctx, claimed, loader, res); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(waiting) == 0 {
+			return res, nil
+		}
+		for _, f := range waiting {
+			select {
+			case <-f.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		// Go around again to collect the values loaded by concurrent calls, or to
+		// load them ourselves if those calls failed.
 	}
+}
 
-	v, err := loader()
+// loadClaimed runs the loader for the provided keys, which must all have been
+// claimed by the caller (i.e, their slot has a non-nil flight). The loaded
+// values are stored in the cache as well as in res.
+func (c *Cache[V]) loadClaimed(ctx context.Context, keys []string, loader func(context.Context, []string) (map[string]V, error), res map[string]V) (err error) {
+	var (
+		values map[string]V
+		ok     bool // Whether all values were successfully loaded
+	)
+	defer func() {
+		// Release the claimed slots even if the loader panics, so that concurrent
+		// callers do not wait forever.
+		for _, key := range keys {
+			s := c.slot(key)
+			s.mu.Lock()
+			if ok {
+				s.value = values[key]
+				s.loaded = true
+				res[key] = s.value
+			}
+			close(s.flight.done)
+			s.flight = nil
+			s.mu.Unlock()
+		}
+	}()
+
+	values, err = loader(ctx, keys)
 	if err != nil {
-		return v, err
+		return err
+	}
+	for _, key := range keys {
+		if _, found := values[key]; !found {
+			return fmt.Errorf("no value was loaded for %q", key)
+		}
 	}
-	s.value = v
-	s.loaded = true
-	return v, nil
+	ok = true
+	return nil
 }
 
 // slot returns the cache slot for a given key. If the slot does not exist, a
@@ -84,12 +181,38 @@ func (c *Cache[V]) slot(key string) *slot[V] {
 }
 
 func (c *CacheStats) RecordHit() {
-	c.total.Add(1)
-	c.hits.Add(1)
+	for ; c != nil; c = c.parent {
+		c.total.Add(1)
+		c.hits.Add(1)
+	}
 }
 
 func (c *CacheStats) RecordMiss() {
-	c.total.Add(1)
+	for ; c != nil; c = c.parent {
+		c.total.Add(1)
+	}
+}
+
+// Named returns the statistics for the named subset of the cache accesses
+// recorded by c (e.g, those of a given service). Accesses recorded on the
+// returned value are also recorded on c.
+func (c *CacheStats) Named(name string) *CacheStats {
+	rawChild, _ := c.children.LoadOrStore(name, &CacheStats{parent: c})
+	child, _ := rawChild.(*CacheStats)
+	return child
+}
+
+// Breakdown returns the named subsets of c that were created using
+// [CacheStats.Named], by name.
+func (c *CacheStats) Breakdown() map[string]*CacheStats {
+	res := make(map[string]*CacheStats)
+	c.children.Range(func(rawName, rawChild any) bool {
+		name, _ := rawName.(string)
+		child, _ := rawChild.(*CacheStats)
+		res[name] = child
+		return true
+	})
+	return res
 }
 
 // Hits returns the count of cache accesses that resulted in a hit.
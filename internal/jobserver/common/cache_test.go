@@ -0,0 +1,109 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package common_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheLoadMany(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("shares in-flight loads", func(t *testing.T) {
+		stats := &common.CacheStats{}
+		cache := common.NewCache[string](stats)
+
+		started, release := make(chan struct{}), make(chan struct{})
+		first := make(chan error, 1)
+		go func() {
+			_, err := cache.LoadMany(ctx, []string{"a"}, func(_ context.Context, keys []string) (map[string]string, error) {
+				close(started)
+				<-release
+				return map[string]string{"a": "first"}, nil
+			})
+			first <- err
+		}()
+		<-started
+
+		var loaded []string
+		res, err := cache.LoadMany(ctx, []string{"a", "b", "c"}, func(_ context.Context, keys []string) (map[string]string, error) {
+			// "a" is being loaded by the first call, which we let complete now.
+			close(release)
+			loaded = keys
+			res := make(map[string]string, len(keys))
+			for _, key := range keys {
+				res[key] = "second"
+			}
+			return res, nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, <-first)
+
+		assert.Equal(t, []string{"b", "c"}, loaded)
+		assert.Equal(t, map[string]string{"a": "first", "b": "second", "c": "second"}, res)
+		assert.EqualValues(t, 4, stats.Count())
+		assert.EqualValues(t, 1, stats.Hits())
+	})
+
+	t.Run("retries failed concurrent loads", func(t *testing.T) {
+		cache := common.NewCache[string](nil)
+
+		started, release := make(chan struct{}), make(chan struct{})
+		first := make(chan error, 1)
+		go func() {
+			_, err := cache.LoadMany(ctx, []string{"a"}, func(ctx context.Context, keys []string) (map[string]string, error) {
+				close(started)
+				<-release
+				return nil, context.Canceled
+			})
+			first <- err
+		}()
+		<-started
+
+		second := make(chan error, 1)
+		var res map[string]string
+		go func() {
+			var err error
+			res, err = cache.LoadMany(ctx, []string{"a"}, func(_ context.Context, keys []string) (map[string]string, error) {
+				return map[string]string{"a": "second"}, nil
+			})
+			second <- err
+		}()
+		close(release)
+
+		require.ErrorIs(t, <-first, context.Canceled)
+		require.NoError(t, <-second)
+		assert.Equal(t, map[string]string{"a": "second"}, res)
+	})
+
+	t.Run("stops waiting when canceled", func(t *testing.T) {
+		cache := common.NewCache[string](nil)
+
+		started, release := make(chan struct{}), make(chan struct{})
+		defer close(release)
+		go func() {
+			_, _ = cache.LoadMany(ctx, []string{"a"}, func(context.Context, []string) (map[string]string, error) {
+				close(started)
+				<-release
+				return map[string]string{"a": "first"}, nil
+			})
+		}()
+		<-started
+
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := cache.LoadMany(ctx, []string{"a"}, func(context.Context, []string) (map[string]string, error) {
+			return nil, errors.New("unexpected call")
+		})
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
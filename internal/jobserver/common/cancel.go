@@ -0,0 +1,71 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package common
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// RequestIDHeader is the NATS message header carrying a client-generated
+	// identifier for a request, which can be used to cancel it by publishing
+	// that identifier on [CancelSubject].
+	RequestIDHeader = "Orchestrion-Request-Id"
+	// CancelSubject is the NATS subject on which clients publish the identifier
+	// of requests they are no longer waiting on.
+	CancelSubject = "request.cancel"
+)
+
+// inFlightKey is the context key of the [sync.Map] holding the
+// [context.CancelFunc] of requests being processed, by their [RequestIDHeader]
+// value.
+type inFlightKey struct{}
+
+// SubscribeCancel registers the request cancellation handler on the provided
+// connection, and returns a context to pass to [HandleRequest]. Requests
+// processed by such handlers that carry a [RequestIDHeader] have their context
+// canceled when their identifier is published on [CancelSubject].
+func SubscribeCancel(ctx context.Context, conn *nats.Conn) (context.Context, error) {
+	log := zerolog.Ctx(ctx).With().Str("nats.subject", CancelSubject).Logger()
+	inFlight := &sync.Map{}
+	_, err := conn.Subscribe(CancelSubject, func(msg *nats.Msg) {
+		id := string(msg.Data)
+		rawCancel, found := inFlight.LoadAndDelete(id)
+		if !found {
+			// The request has already completed, nothing to do...
+			return
+		}
+		log.Debug().Str("request.id", id).Msg("Canceling request")
+		cancel, _ := rawCancel.(context.CancelFunc)
+		cancel()
+	})
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, inFlightKey{}, inFlight), nil
+}
+
+// withCancel returns a context that is canceled once a cancellation for the
+// request carried by msg is received, and a function that must be called once
+// the request has been processed.
+func withCancel(ctx context.Context, msg *nats.Msg) (context.Context, func()) {
+	inFlight, _ := ctx.Value(inFlightKey{}).(*sync.Map)
+	id := msg.Header.Get(RequestIDHeader)
+	if inFlight == nil || id == "" {
+		return ctx, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	inFlight.Store(id, cancel)
+	return ctx, func() {
+		inFlight.Delete(id)
+		cancel()
+	}
+}
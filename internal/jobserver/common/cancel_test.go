@@ -0,0 +1,71 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package common_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/jobserver"
+	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	blockingRequest  struct{}
+	blockingResponse struct{}
+)
+
+func (blockingRequest) Subject() string                  { return "test.blocking" }
+func (blockingRequest) ResponseIs(*blockingResponse)     {}
+func (blockingRequest) ForeachSpanTag(func(string, any)) {}
+
+func TestCancel(t *testing.T) {
+	ctx := context.Background()
+
+	server, err := jobserver.New(ctx, nil)
+	require.NoError(t, err)
+	defer server.Shutdown()
+
+	conn, err := nats.Connect(server.ClientURL())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Cancellations are tracked separately for each connection.
+	ctx, err = common.SubscribeCancel(ctx, conn)
+	require.NoError(t, err)
+
+	started, canceled := make(chan struct{}), make(chan struct{})
+	_, err = conn.Subscribe(blockingRequest{}.Subject(), common.HandleRequest(ctx, func(ctx context.Context, _ blockingRequest) (*blockingResponse, error) {
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+		return nil, ctx.Err()
+	}))
+	require.NoError(t, err)
+	require.NoError(t, conn.Flush())
+
+	c, err := server.Connect()
+	require.NoError(t, err)
+	defer c.Close()
+
+	reqCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, err = client.Request(reqCtx, c, blockingRequest{})
+	require.ErrorIs(t, err, context.Canceled)
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "the request handler was not canceled")
+	}
+}
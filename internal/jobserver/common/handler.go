@@ -29,7 +29,8 @@ type (
 )
 
 // HandleRequest returns a NATS subscription target that calls the provided request handler in a new goroutine if the
-// NATS message payload can be parsed into the specified request type, and responds to the client appropriately.
+// NATS message payload can be parsed into the specified request type, and responds to the client appropriately. The
+// context passed to the handler is canceled if the client cancels the request (see [SubscribeCancel]).
 func HandleRequest[Res any, Req Request[Res]](ctx context.Context, handler RequestHandler[Res, Req]) func(*nats.Msg) {
 	return func(msg *nats.Msg) {
 		var req Req
@@ -40,6 +41,15 @@ func HandleRequest[Res any, Req Request[Res]](ctx context.Context, handler Reque
 
 		// Spawn the handler in a new goroutine to avoid blocking the NATS subscription poller.
 		go func() {
+			ctx, done := withCancel(ctx, msg)
+			defer done()
+
+			ctx, err := withBuild(ctx, msg)
+			if err != nil {
+				respond(ctx, msg, errorResponse{Error: err.Error()})
+				return
+			}
+
 			if spanCtx, err := tracer.Extract(traceutil.NATSCarrier{Msg: msg}); err == nil && spanCtx != nil {
 				span := tracer.StartSpan("nats.server",
 					tracer.ServiceName("github.com/DataDog/orchestrion/internal/jobserver"),
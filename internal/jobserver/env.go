@@ -0,0 +1,67 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package jobserver
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/jobserver/nbt"
+	"github.com/DataDog/orchestrion/internal/remotecache"
+	"github.com/rs/zerolog"
+)
+
+// OptionsFromEnvironment returns [Options] with the durable NBT store and
+// remote cache configured from the same environment variables that are
+// honored by the `orchestrion server` command. Invalid values are reported as
+// warnings and otherwise ignored.
+func OptionsFromEnvironment(ctx context.Context) *Options {
+	log := zerolog.Ctx(ctx)
+	opts := &Options{
+		UnixSocket:          UnixSocketByDefault,
+		RemoteCache:         os.Getenv(remotecache.EnvVarURL),
+		RemoteCacheReadOnly: envBool(ctx, remotecache.EnvVarReadOnly),
+	}
+
+	if !envBool(ctx, nbt.EnvVarStore) {
+		return opts
+	}
+	dir, err := nbt.DefaultStoreDir()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to resolve the NBT store directory; it will not be used")
+		return opts
+	}
+	opts.NBTStore = &nbt.StoreOptions{Dir: dir, MaxSize: nbt.DefaultStoreMaxSize, MaxAge: nbt.DefaultStoreMaxAge}
+	if val := os.Getenv(nbt.EnvVarStoreMaxSize); val != "" {
+		if mib, err := strconv.ParseInt(val, 10, 64); err != nil {
+			log.Warn().Err(err).Str(nbt.EnvVarStoreMaxSize, val).Msg("Ignoring invalid environment variable value")
+		} else {
+			opts.NBTStore.MaxSize = mib << 20
+		}
+	}
+	if val := os.Getenv(nbt.EnvVarStoreMaxAge); val != "" {
+		if age, err := time.ParseDuration(val); err != nil {
+			log.Warn().Err(err).Str(nbt.EnvVarStoreMaxAge, val).Msg("Ignoring invalid environment variable value")
+		} else {
+			opts.NBTStore.MaxAge = age
+		}
+	}
+	return opts
+}
+
+func envBool(ctx context.Context, name string) bool {
+	val := os.Getenv(name)
+	if val == "" {
+		return false
+	}
+	res, err := strconv.ParseBool(val)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Str(name, val).Msg("Ignoring invalid environment variable value")
+	}
+	return res
+}
@@ -0,0 +1,95 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package jobserver
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/rs/zerolog"
+)
+
+var (
+	inProcessMu     sync.Mutex
+	inProcessServer *Server
+	inProcessClient *client.Client
+)
+
+// FromEnvironment returns a client connected to the current environment's job
+// server, as determined by [client.FromEnvironment]. If no job server is
+// available (including when job servers are disabled using the
+// ORCHESTRION_JOBSERVER environment variable), or if it cannot be connected to
+// or started, it returns a client connected to an in-process job server that
+// lives as long as the current process instead. The in-process job server
+// provides the same results, but does not share its caches with other
+// processes.
+//
+// When a job server could not be connected to or started, job servers are
+// disabled for child processes, so that they do not attempt to do so again.
+//
+// The returned client is re-used, so callers should NOT call [client.Client.Close]
+// on it.
+func FromEnvironment(ctx context.Context, workDir string) (*client.Client, error) {
+	c, err := client.FromEnvironment(ctx, workDir)
+	if err == nil {
+		return c, nil
+	}
+
+	log := zerolog.Ctx(ctx)
+	if errors.Is(err, client.ErrNoServerAvailable) {
+		log.Debug().Msg("No job server available; using an in-process job server...")
+	} else {
+		log.Warn().Err(err).Msg("Failed to connect to the job server; using an in-process job server instead")
+		client.Disable()
+	}
+
+	return inProcess(ctx)
+}
+
+// inProcess returns a client connected to the in-process job server, starting
+// it if necessary.
+func inProcess(ctx context.Context) (*client.Client, error) {
+	inProcessMu.Lock()
+	defer inProcessMu.Unlock()
+
+	if inProcessClient != nil {
+		return inProcessClient, nil
+	}
+
+	opts := OptionsFromEnvironment(ctx)
+	opts.NoListener = true
+	opts.UnixSocket = false
+
+	server, err := New(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	c, err := server.Connect()
+	if err != nil {
+		server.Shutdown()
+		return nil, err
+	}
+
+	inProcessServer, inProcessClient = server, c
+	return inProcessClient, nil
+}
+
+// ShutdownInProcess shuts the in-process job server down, if one was started,
+// so that the next call to [FromEnvironment] starts a new one. This is mostly
+// useful in tests, which may simulate several processes.
+func ShutdownInProcess() {
+	inProcessMu.Lock()
+	defer inProcessMu.Unlock()
+
+	if inProcessServer == nil {
+		return
+	}
+	inProcessClient.Close()
+	inProcessServer.Shutdown()
+	inProcessServer, inProcessClient = nil, nil
+}
@@ -0,0 +1,116 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package jobserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// UnixSocketByDefault is whether job servers listen on a Unix domain socket by
+// default on this platform. Windows supports Unix domain sockets, but does not
+// restrict access to them based on file system permissions.
+const UnixSocketByDefault = runtime.GOOS != "windows"
+
+// newToken returns a new random authentication token, suitable for use in URLs.
+func newToken() (string, error) {
+	var buf [32]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf[:]), nil
+}
+
+// listenUnix starts listening on a Unix domain socket, and proxies all
+// accepted connections to the NATS server using in-process connections. If
+// socket is blank, the socket is created in a new private directory. It returns
+// the path to the socket.
+func (s *Server) listenUnix(socket string) (string, error) {
+	// The socket is removed on shutdown; and so is its directory if we created it.
+	cleanup := func() error { return os.Remove(socket) }
+	if socket == "" {
+		// The directory is created with mode 0700, which is what actually prevents other users from
+		// connecting to the socket (not all platforms honor permissions on the socket file itself).
+		dir, err := os.MkdirTemp("", "orchestrion-jobserver-")
+		if err != nil {
+			return "", fmt.Errorf("creating socket directory: %w", err)
+		}
+		socket = filepath.Join(dir, "nats.sock")
+		cleanup = func() error { return os.RemoveAll(dir) }
+	} else if err := os.Remove(socket); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		// A previous server may have left its socket behind if it did not shut down cleanly.
+		return "", fmt.Errorf("removing stale socket %q: %w", socket, err)
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return "", errors.Join(fmt.Errorf("listening on %q: %w", socket, err), cleanup())
+	}
+	if err := os.Chmod(socket, 0o600); err != nil {
+		return "", errors.Join(fmt.Errorf("restricting access to %q: %w", socket, err), listener.Close(), cleanup())
+	}
+
+	s.onShutdown(func(context.Context) error {
+		if err := listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			return err
+		}
+		if err := cleanup(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	})
+	go s.serveUnix(listener)
+
+	return socket, nil
+}
+
+// serveUnix accepts connections from the provided listener until it is closed.
+func (s *Server) serveUnix(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.log.Error().Err(err).Msg("Failed to accept connection on Unix socket")
+			}
+			return
+		}
+		go s.proxy(conn)
+	}
+}
+
+// proxy forwards all traffic between the provided connection and a new
+// in-process connection to the NATS server, until either side is closed.
+func (s *Server) proxy(conn net.Conn) {
+	defer conn.Close()
+
+	srvConn, err := s.server.InProcessConn()
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to create in-process connection for Unix socket client")
+		return
+	}
+	defer srvConn.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(srvConn, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, srvConn)
+		done <- struct{}{}
+	}()
+	// Once either direction is done, closing both connections terminates the other.
+	<-done
+}
@@ -13,9 +13,12 @@ import (
 	"path/filepath"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/DataDog/orchestrion/internal/files"
 	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/DataDog/orchestrion/internal/jobserver/status"
+	"github.com/DataDog/orchestrion/internal/remotecache"
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog"
@@ -30,12 +33,28 @@ const (
 
 type (
 	service struct {
-		state sync.Map
+		state sync.Map // Keyed by [stateKey]
 		dir   string
+		store *Store // Optional durable store, shared across job server lifetimes
+
+		remote  *remotecache.Cache // Optional remote cache, shared across machines
+		uploads sync.WaitGroup     // Tracks in-flight uploads to the remote cache
+
+		stats   *common.CacheStats // Records whether artifacts could be re-used
+		slowest status.Slowest     // The slowest compile tasks that have completed
+	}
+	// stateKey identifies a compile task. The job server may serve several builds
+	// (see [common.BuildKey]), which can compile different versions of the same
+	// import path (e.g, `main` packages of different modules, or after source
+	// changes).
+	stateKey struct {
+		build      string
+		importPath string
+		buildID    string
 	}
 	buildState struct {
 		initOnce sync.Once
-		buildID  string
+		started  atomic.Int64    // When the original task was started (Unix nanoseconds), or 0
 		token    string          // Finalization token
 		onDone   func()          // Called once the original task has completed
 		done     <-chan struct{} // Blocks until the original task has completed
@@ -46,7 +65,17 @@ type (
 	}
 )
 
-func Subscribe(ctx context.Context, conn *nats.Conn) (cleanup func(context.Context) error, resErr error) {
+// Service is a handle on a never-build-twice service registered with
+// [Subscribe].
+type Service struct {
+	svc *service
+}
+
+// Subscribe registers the never-build-twice service on the provided connection.
+// If store is not nil, artifacts are additionally persisted to (and re-used
+// from) it, so they survive the job server's lifetime. If remote is not nil,
+// artifacts are also looked up in (and uploaded to) that remote cache.
+func Subscribe(ctx context.Context, conn *nats.Conn, store *Store, remote *remotecache.Cache, stats *common.CacheStats) (_ *Service, resErr error) {
 	dir, err := os.MkdirTemp("", "orchestrion.nbt-*")
 	if err != nil {
 		return nil, fmt.Errorf("creating storage directory: %w", err)
@@ -60,7 +89,7 @@ func Subscribe(ctx context.Context, conn *nats.Conn) (cleanup func(context.Conte
 		}
 	}()
 
-	s := &service{dir: dir}
+	s := &service{dir: dir, store: store, remote: remote, stats: stats.Named("nbt")}
 	_, err = conn.Subscribe(startSubject,
 		common.HandleRequest(
 			zerolog.Ctx(ctx).With().Str("nats.subject", startSubject).Logger().WithContext(ctx),
@@ -81,8 +110,41 @@ func Subscribe(ctx context.Context, conn *nats.Conn) (cleanup func(context.Conte
 		return nil, err
 	}
 
-	cleanup = func(context.Context) error { return os.RemoveAll(dir) }
-	return cleanup, nil
+	return &Service{svc: s}, nil
+}
+
+// Cleanup removes the artifacts kept for the lifetime of the job server, and
+// evicts old entries from the durable store, if any. It must be called once
+// the job server has shut down.
+func (s *Service) Cleanup(ctx context.Context) error {
+	// Wait for uploads to complete, as they read from the storage directory.
+	s.svc.uploads.Wait()
+	err := os.RemoveAll(s.svc.dir)
+	if s.svc.store != nil {
+		if _, _, evictErr := s.svc.store.Evict(ctx); evictErr != nil {
+			err = errors.Join(err, fmt.Errorf("evicting from NBT store: %w", evictErr))
+		}
+	}
+	return err
+}
+
+// InFlight returns the list of compile tasks that are currently in progress.
+func (s *Service) InFlight() []status.Build {
+	var res []status.Build
+	s.svc.state.Range(func(rawKey, rawState any) bool {
+		key, _ := rawKey.(stateKey)
+		state, _ := rawState.(*buildState)
+		if started := state.started.Load(); started != 0 && !state.isDone.Load() {
+			res = append(res, status.Build{ImportPath: key.importPath, Since: time.Unix(0, started)})
+		}
+		return true
+	})
+	return res
+}
+
+// SlowestBuilds returns the compile tasks that took the longest to complete.
+func (s *Service) SlowestBuilds() []status.Timing {
+	return s.svc.slowest.List()
 }
 
 type (
@@ -128,7 +190,8 @@ func (s *service) start(ctx context.Context, req StartRequest) (*StartResponse,
 		return nil, fmt.Errorf("invalid request: %#v", req)
 	}
 
-	rawState, reused := s.state.LoadOrStore(req.ImportPath, &buildState{buildID: req.BuildID})
+	key := stateKey{build: common.BuildKey(ctx), importPath: req.ImportPath, buildID: req.BuildID}
+	rawState, reused := s.state.LoadOrStore(key, &buildState{})
 	state, _ := rawState.(*buildState)
 
 	// Initialize the build state.
@@ -142,10 +205,6 @@ func (s *service) start(ctx context.Context, req StartRequest) (*StartResponse,
 
 	// If the build state is re-used, wait for the original to complete...
 	if reused {
-		if state.buildID != req.BuildID {
-			return nil, fmt.Errorf("mismatched build ID for %q: %q != %q", req.ImportPath, state.buildID, req.BuildID)
-		}
-
 		zerolog.Ctx(ctx).Trace().Str("token", state.token).Str("import-path", req.ImportPath).Msg("Waiting for concurrent task to complete...")
 		defer zerolog.Ctx(ctx).Trace().Str("token", state.token).Str("import-path", req.ImportPath).Msg("Concurrent was completed!")
 
@@ -160,10 +219,57 @@ func (s *service) start(ctx context.Context, req StartRequest) (*StartResponse,
 			return nil, context.Canceled
 		}
 
+		s.stats.RecordHit()
 		return &StartResponse{Files: state.files}, nil
 	}
 
-	// Otherwise, return a finalization token, etc...
+	// Otherwise, try re-using artifacts from a previous job server's lifetime...
+	if s.store != nil {
+		dir := s.storageDir(key)
+		artifacts, err := s.store.Load(ctx, req.ImportPath, req.BuildID, dir)
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("import-path", req.ImportPath).Msg("Failed to load artifacts from the NBT store")
+			// Clear out any partially restored artifacts, so the task can proceed normally.
+			_ = os.RemoveAll(dir)
+		} else if artifacts != nil {
+			state.files = artifacts
+			state.isDone.Store(true)
+			state.onDone()
+			s.stats.RecordHit()
+			zerolog.Ctx(ctx).Debug().Str("import-path", req.ImportPath).Msg("Re-using artifacts from the NBT store")
+			return &StartResponse{Files: artifacts}, nil
+		}
+	}
+
+	// Then, try re-using artifacts from the remote cache...
+	if s.remote != nil {
+		dir := s.storageDir(key)
+		artifacts, err := s.remote.GetFiles(ctx, remoteKey(req.ImportPath, req.BuildID), dir)
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("import-path", req.ImportPath).Msg("Failed to load artifacts from the remote cache")
+			// Clear out any partially restored artifacts, so the task can proceed normally.
+			_ = os.RemoveAll(dir)
+		} else if artifacts != nil {
+			state.files = make(map[Label]string, len(artifacts))
+			for name, path := range artifacts {
+				state.files[Label(name)] = path
+			}
+			state.isDone.Store(true)
+			state.onDone()
+			s.stats.RecordHit()
+			zerolog.Ctx(ctx).Debug().Str("import-path", req.ImportPath).Msg("Re-using artifacts from the remote cache")
+			if s.store != nil {
+				if err := s.store.Save(ctx, req.ImportPath, req.BuildID, state.files); err != nil {
+					zerolog.Ctx(ctx).Warn().Err(err).Str("import-path", req.ImportPath).Msg("Failed to persist artifacts to the NBT store")
+				}
+			}
+			return &StartResponse{Files: state.files}, nil
+		}
+	}
+
+	// Finally, return a finalization token, etc...
+	s.stats.RecordMiss()
+	state.started.Store(time.Now().UnixNano())
 	zerolog.Ctx(ctx).Trace().Str("token", state.token).Str("import-path", req.ImportPath).Msg("Compile task started")
 	return &StartResponse{FinishToken: state.token}, nil
 }
@@ -174,6 +280,9 @@ type (
 	FinishRequest struct {
 		// ImportPath is the import path of the package that was built.
 		ImportPath string `json:"importPath"`
+		// BuildID is the build ID of the package that was built, as specified in
+		// the corresponding [StartRequest].
+		BuildID string `json:"buildID"`
 		// FinishToken is forwarded from [*StartResponse.FinishToken], and cannot be
 		// blank.
 		FinishToken string `json:"token"`
@@ -209,11 +318,12 @@ func (s *service) finish(ctx context.Context, req FinishRequest) (*FinishRespons
 
 	log.Trace().Any("request", req).Msg("Finish request received")
 
-	if req.ImportPath == "" || req.FinishToken == "" {
+	if req.ImportPath == "" || req.BuildID == "" || req.FinishToken == "" {
 		return nil, fmt.Errorf("invalid request: %#v", req)
 	}
 
-	rawState, found := s.state.Load(req.ImportPath)
+	key := stateKey{build: common.BuildKey(ctx), importPath: req.ImportPath, buildID: req.BuildID}
+	rawState, found := s.state.Load(key)
 	if !found {
 		return nil, fmt.Errorf("no build started for %q", req.ImportPath)
 	}
@@ -233,6 +343,7 @@ func (s *service) finish(ctx context.Context, req FinishRequest) (*FinishRespons
 	}
 
 	defer state.onDone()
+	s.slowest.Add(status.Timing{ImportPath: req.ImportPath, Duration: time.Since(time.Unix(0, state.started.Load()))})
 	log.Debug().
 		Any("files", req.Files).
 		Any("error", req.Error).
@@ -248,7 +359,7 @@ func (s *service) finish(ctx context.Context, req FinishRequest) (*FinishRespons
 		return nil, state.error
 	}
 
-	dir := filepath.Join(s.dir, uuid.NewSHA1(ns, []byte(req.ImportPath)).String())
+	dir := s.storageDir(key)
 	if err := os.Mkdir(dir, 0o755); err != nil {
 		state.error = fmt.Errorf("creating storage directory: %w", err)
 		return nil, state.error
@@ -265,9 +376,45 @@ func (s *service) finish(ctx context.Context, req FinishRequest) (*FinishRespons
 		state.files[label] = filename
 	}
 
+	if s.store != nil {
+		if err := s.store.Save(ctx, req.ImportPath, req.BuildID, state.files); err != nil {
+			log.Warn().Err(err).Msg("Failed to persist artifacts to the NBT store")
+		}
+	}
+
+	if s.remote != nil && !s.remote.ReadOnly() {
+		// Uploading happens in the background so as not to delay tasks waiting on
+		// this one; the job server waits for uploads to complete before exiting.
+		uploads := make(map[string]string, len(state.files))
+		for label, path := range state.files {
+			uploads[string(label)] = path
+		}
+		remoteKey := remoteKey(req.ImportPath, req.BuildID)
+		s.uploads.Add(1)
+		go func() {
+			defer s.uploads.Done()
+			if err := s.remote.PutFiles(context.WithoutCancel(ctx), remoteKey, uploads); err != nil {
+				log.Warn().Err(err).Msg("Failed to upload artifacts to the remote cache")
+			}
+		}()
+	}
+
 	return &FinishResponse{}, nil
 }
 
-// ns is an arbitrary UUID used as a namespace for hashing import paths when storing artifacts in
+// remoteKey returns the remote cache key for the artifacts of the specified
+// import path and build ID.
+func remoteKey(importPath string, buildID string) string {
+	return remotecache.Key("nbt", importPath, buildID)
+}
+
+// storageDir returns the directory where artifacts for the specified compile
+// task are kept for the lifetime of the job server.
+func (s *service) storageDir(key stateKey) string {
+	name := fmt.Sprintf("%s\u0000%s\u0000%s", key.build, key.importPath, key.buildID)
+	return filepath.Join(s.dir, uuid.NewSHA1(ns, []byte(name)).String())
+}
+
+// ns is an arbitrary UUID used as a namespace for hashing compile tasks when storing artifacts in
 // the temporary storage location.
 var ns = uuid.MustParse("4BFB6F4B-212C-43A0-A581-A29C8B3D3BE4")
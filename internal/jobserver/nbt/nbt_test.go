@@ -7,11 +7,14 @@ package nbt
 
 import (
 	"context"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 
+	"github.com/DataDog/orchestrion/internal/remotecache"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -30,7 +33,7 @@ func Test(t *testing.T) {
 
 	t.Run("not-started", func(t *testing.T) {
 		subject := &service{dir: t.TempDir()}
-		res, err := subject.finish(ctx, FinishRequest{ImportPath: importPath, FinishToken: "bazinga"})
+		res, err := subject.finish(ctx, FinishRequest{ImportPath: importPath, BuildID: buildID, FinishToken: "bazinga"})
 		require.ErrorContains(t, err, "no build started")
 		require.Nil(t, res)
 	})
@@ -82,6 +85,7 @@ func Test(t *testing.T) {
 
 		res, err := subject.finish(ctx, FinishRequest{
 			ImportPath:  importPath,
+			BuildID:     buildID,
 			FinishToken: start.FinishToken,
 			Files:       map[Label]string{LabelArchive: archive, label: extraFile},
 		})
@@ -89,39 +93,43 @@ func Test(t *testing.T) {
 		require.NotNil(t, res)
 	})
 
-	t.Run("start-conflict-finish", func(t *testing.T) {
+	t.Run("start-distinct-builds", func(t *testing.T) {
 		subject := &service{dir: t.TempDir()}
 
 		start, err := subject.start(ctx, StartRequest{ImportPath: importPath, BuildID: buildID})
 		require.NoError(t, err)
 		require.NotEmpty(t, start.FinishToken)
-		assert.Empty(t, start.Files)
 
-		archiveContent := uuid.NewString()
+		// A different build ID for the same import path is a separate task (e.g, after a source change)...
+		other, err := subject.start(ctx, StartRequest{ImportPath: importPath, BuildID: buildID + "-alt"})
+		require.NoError(t, err)
+		require.NotEmpty(t, other.FinishToken)
+		assert.NotEqual(t, start.FinishToken, other.FinishToken)
 
-		var wg sync.WaitGroup
-		defer wg.Wait()
-		for range 10 {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
+		archives := make(map[string]string, 2)
+		for id, token := range map[string]string{buildID: start.FinishToken, buildID + "-alt": other.FinishToken} {
+			archive := filepath.Join(t.TempDir(), "_pkg_.a")
+			require.NoError(t, os.WriteFile(archive, []byte(id), 0o644))
+			archives[id] = archive
 
-				res, err := subject.start(ctx, StartRequest{ImportPath: importPath, BuildID: buildID + "-alt"})
-				assert.ErrorContains(t, err, buildID)
-				assert.Nil(t, res)
-			}()
+			_, err = subject.finish(ctx, FinishRequest{
+				ImportPath:  importPath,
+				BuildID:     id,
+				FinishToken: token,
+				Files:       map[Label]string{LabelArchive: archive},
+			})
+			require.NoError(t, err)
 		}
 
-		archive := filepath.Join(t.TempDir(), "_pkg_.a")
-		require.NoError(t, os.WriteFile(archive, []byte(archiveContent), 0o644))
-
-		res, err := subject.finish(ctx, FinishRequest{
-			ImportPath:  importPath,
-			FinishToken: start.FinishToken,
-			Files:       map[Label]string{LabelArchive: archive},
-		})
-		require.NoError(t, err)
-		require.NotNil(t, res)
+		// ... and each task's artifacts are re-used separately.
+		for id := range archives {
+			res, err := subject.start(ctx, StartRequest{ImportPath: importPath, BuildID: id})
+			require.NoError(t, err)
+			require.Empty(t, res.FinishToken)
+			content, err := os.ReadFile(res.Files[LabelArchive])
+			require.NoError(t, err)
+			assert.Equal(t, id, string(content))
+		}
 	})
 
 	t.Run("start-finish-finish", func(t *testing.T) {
@@ -140,6 +148,7 @@ func Test(t *testing.T) {
 		for range 10 {
 			res, err := subject.finish(ctx, FinishRequest{
 				ImportPath:  importPath,
+				BuildID:     buildID,
 				FinishToken: start.FinishToken,
 				Files:       map[Label]string{LabelArchive: archive},
 			})
@@ -164,6 +173,7 @@ func Test(t *testing.T) {
 		for range 10 {
 			res, err := subject.finish(ctx, FinishRequest{
 				ImportPath:  importPath,
+				BuildID:     buildID,
 				FinishToken: uuid.NewString(),
 				Files:       map[Label]string{LabelArchive: archive},
 			})
@@ -173,6 +183,7 @@ func Test(t *testing.T) {
 
 		res, err := subject.finish(ctx, FinishRequest{
 			ImportPath:  importPath,
+			BuildID:     buildID,
 			FinishToken: start.FinishToken,
 			Files:       map[Label]string{LabelArchive: archive},
 		})
@@ -206,6 +217,7 @@ func Test(t *testing.T) {
 
 		res, err := subject.finish(ctx, FinishRequest{
 			ImportPath:  importPath,
+			BuildID:     buildID,
 			FinishToken: start.FinishToken,
 			Error:       &errorText,
 		})
@@ -237,6 +249,7 @@ func Test(t *testing.T) {
 
 		res, err := subject.finish(ctx, FinishRequest{
 			ImportPath:  importPath,
+			BuildID:     buildID,
 			FinishToken: start.FinishToken,
 		})
 		require.ErrorIs(t, err, errNoFilesNorError)
@@ -270,6 +283,7 @@ func Test(t *testing.T) {
 
 		res, err := subject.finish(ctx, FinishRequest{
 			ImportPath:  importPath,
+			BuildID:     buildID,
 			FinishToken: start.FinishToken,
 			Files:       map[Label]string{LabelArchive: archive},
 		})
@@ -308,10 +322,87 @@ func Test(t *testing.T) {
 
 		res, err := subject.finish(ctx, FinishRequest{
 			ImportPath:  importPath,
+			BuildID:     buildID,
 			FinishToken: start.FinishToken,
 			Files:       map[Label]string{LabelArchive: archive, label: extraFile},
 		})
 		require.ErrorContains(t, err, extraFile)
 		require.Nil(t, res)
 	})
+
+	t.Run("durable-store", func(t *testing.T) {
+		store, err := OpenStore(StoreOptions{Dir: t.TempDir()})
+		require.NoError(t, err)
+
+		first := &service{dir: t.TempDir(), store: store}
+		start, err := first.start(ctx, StartRequest{ImportPath: importPath, BuildID: buildID})
+		require.NoError(t, err)
+		require.NotEmpty(t, start.FinishToken)
+
+		archiveContent := uuid.NewString()
+		archive := filepath.Join(t.TempDir(), "_pkg_.a")
+		require.NoError(t, os.WriteFile(archive, []byte(archiveContent), 0o644))
+
+		res, err := first.finish(ctx, FinishRequest{
+			ImportPath:  importPath,
+			BuildID:     buildID,
+			FinishToken: start.FinishToken,
+			Files:       map[Label]string{LabelArchive: archive},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, res)
+
+		// A new service (i.e, a new job server lifetime) re-uses the stored artifacts...
+		second := &service{dir: t.TempDir(), store: store}
+		start, err = second.start(ctx, StartRequest{ImportPath: importPath, BuildID: buildID})
+		require.NoError(t, err)
+		assert.Empty(t, start.FinishToken)
+		require.Contains(t, start.Files, LabelArchive)
+		assert.True(t, strings.HasPrefix(start.Files[LabelArchive], second.dir))
+		content, err := os.ReadFile(start.Files[LabelArchive])
+		require.NoError(t, err)
+		assert.Equal(t, archiveContent, string(content))
+
+		// ... but not for a different build ID.
+		third := &service{dir: t.TempDir(), store: store}
+		start, err = third.start(ctx, StartRequest{ImportPath: importPath, BuildID: buildID + "-alt"})
+		require.NoError(t, err)
+		assert.NotEmpty(t, start.FinishToken)
+		assert.Empty(t, start.Files)
+	})
+
+	t.Run("remote-cache", func(t *testing.T) {
+		srv := httptest.NewServer(remotecache.Handler(remotecache.DirBackend(t.TempDir())))
+		defer srv.Close()
+		remote, err := remotecache.Open(srv.URL, false)
+		require.NoError(t, err)
+
+		first := &service{dir: t.TempDir(), remote: remote}
+		start, err := first.start(ctx, StartRequest{ImportPath: importPath, BuildID: buildID})
+		require.NoError(t, err)
+		require.NotEmpty(t, start.FinishToken)
+
+		archiveContent := uuid.NewString()
+		archive := filepath.Join(t.TempDir(), "_pkg_.a")
+		require.NoError(t, os.WriteFile(archive, []byte(archiveContent), 0o644))
+
+		_, err = first.finish(ctx, FinishRequest{
+			ImportPath:  importPath,
+			BuildID:     buildID,
+			FinishToken: start.FinishToken,
+			Files:       map[Label]string{LabelArchive: archive},
+		})
+		require.NoError(t, err)
+		first.uploads.Wait()
+
+		// Another job server (e.g, on another machine) re-uses the uploaded artifacts.
+		second := &service{dir: t.TempDir(), remote: remote}
+		start, err = second.start(ctx, StartRequest{ImportPath: importPath, BuildID: buildID})
+		require.NoError(t, err)
+		assert.Empty(t, start.FinishToken)
+		require.Contains(t, start.Files, LabelArchive)
+		content, err := os.ReadFile(start.Files[LabelArchive])
+		require.NoError(t, err)
+		assert.Equal(t, archiveContent, string(content))
+	})
 }
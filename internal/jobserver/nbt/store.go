@@ -0,0 +1,330 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package nbt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/filelock"
+	"github.com/DataDog/orchestrion/internal/files"
+	"github.com/DataDog/orchestrion/internal/weavecache"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// EnvVarStore is the environment variable that enables the durable NBT
+	// store when set to a truthy value.
+	EnvVarStore = "ORCHESTRION_NBT_STORE"
+	// EnvVarStoreMaxSize is the environment variable that configures the
+	// maximum size of the durable NBT store, in MiB.
+	EnvVarStoreMaxSize = "ORCHESTRION_NBT_STORE_MAX_SIZE"
+	// EnvVarStoreMaxAge is the environment variable that configures how long
+	// unused entries are retained in the durable NBT store.
+	EnvVarStoreMaxAge = "ORCHESTRION_NBT_STORE_MAX_AGE"
+
+	// DefaultStoreMaxSize is the default maximum size of the durable NBT store.
+	DefaultStoreMaxSize = 4 << 30
+	// DefaultStoreMaxAge is the default amount of time unused entries are
+	// retained in the durable NBT store.
+	DefaultStoreMaxAge = 7 * 24 * time.Hour
+
+	storeEntryFile = "entry.json"
+	storeLockFile  = "nbt.lock"
+)
+
+// DefaultStoreDir returns the default location of the durable NBT store, which
+// is the `nbt` directory within orchestrion's cache root (see
+// [weavecache.Root]).
+func DefaultStoreDir() (string, error) {
+	root, err := weavecache.Root()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, "nbt"), nil
+}
+
+type (
+	// Store is a durable, on-disk store of compilation artifacts that survives
+	// the job server's lifetime, so that identical [StartRequest] pairs of
+	// import path and build ID can re-use artifacts across builds. It may be
+	// shared by several job servers at once: entries are read and written while
+	// holding a shared lock, and eviction holds an exclusive lock.
+	Store struct {
+		dir     string
+		maxSize int64
+		maxAge  time.Duration
+	}
+
+	// StoreOptions configures a [Store].
+	StoreOptions struct {
+		// Dir is the directory where the store's entries are kept.
+		Dir string
+		// MaxSize is the maximum total size of the store, in bytes. Least recently
+		// used entries are evicted once this is exceeded. Zero means no limit.
+		MaxSize int64
+		// MaxAge is the maximum amount of time an entry is retained after it was
+		// last used. Zero means no limit.
+		MaxAge time.Duration
+	}
+
+	storeEntry struct {
+		ImportPath string           `json:"importPath"`
+		BuildID    string           `json:"buildID"`
+		Files      map[Label]string `json:"files"`
+	}
+)
+
+// OpenStore returns a [Store] using the provided options, creating its
+// directory if necessary.
+func OpenStore(opts StoreOptions) (*Store, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("no directory specified for the NBT store")
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating NBT store directory: %w", err)
+	}
+	return &Store{dir: opts.Dir, maxSize: opts.MaxSize, maxAge: opts.MaxAge}, nil
+}
+
+// Dir returns the directory containing the store's entries.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Load looks up the artifacts recorded for the specified import path and build
+// ID, and copies them into dir. It returns the paths to the copies by label, or
+// nil if there is no such entry.
+func (s *Store) Load(ctx context.Context, importPath string, buildID string, dir string) (map[Label]string, error) {
+	unlock, err := s.lock(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	entryDir := s.entryDir(importPath, buildID)
+	data, err := os.ReadFile(filepath.Join(entryDir, storeEntryFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entry storeEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("parsing NBT store entry for %q: %w", importPath, err)
+	}
+	if entry.ImportPath != importPath || entry.BuildID != buildID {
+		// Hash collision, or a corrupted entry; ignore it.
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	res := make(map[Label]string, len(entry.Files))
+	for label, name := range entry.Files {
+		filename := filepath.Join(dir, string(label))
+		if err := files.Copy(ctx, filepath.Join(entryDir, name), filename); err != nil {
+			return nil, fmt.Errorf("restoring %q from NBT store: %w", label, err)
+		}
+		res[label] = filename
+	}
+
+	// Record the use of this entry, so that eviction is based on last use.
+	now := time.Now()
+	_ = os.Chtimes(filepath.Join(entryDir, storeEntryFile), now, now)
+
+	return res, nil
+}
+
+// Save records the artifacts produced for the specified import path and build
+// ID. If an entry already exists, it is left untouched.
+func (s *Store) Save(ctx context.Context, importPath string, buildID string, artifacts map[Label]string) (err error) {
+	unlock, err := s.lock(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entryDir := s.entryDir(importPath, buildID)
+	if _, err := os.Stat(filepath.Join(entryDir, storeEntryFile)); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(entryDir), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp(filepath.Dir(entryDir), filepath.Base(entryDir)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(tmp)
+		}
+	}()
+
+	entry := storeEntry{ImportPath: importPath, BuildID: buildID, Files: make(map[Label]string, len(artifacts))}
+	for label, path := range artifacts {
+		if err := files.Copy(ctx, path, filepath.Join(tmp, string(label))); err != nil {
+			return fmt.Errorf("storing %q in NBT store: %w", label, err)
+		}
+		entry.Files[label] = string(label)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, storeEntryFile), data, 0o644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, entryDir); err != nil {
+		if _, statErr := os.Stat(filepath.Join(entryDir, storeEntryFile)); statErr == nil {
+			// Another job server stored the same entry concurrently; keep theirs.
+			_ = os.RemoveAll(tmp)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// Evict removes entries that have not been used within the configured maximum
+// age, then removes the least recently used entries until the store fits within
+// the configured maximum size. It returns the number of entries removed and the
+// number of bytes freed.
+func (s *Store) Evict(ctx context.Context) (removed int, freed int64, err error) {
+	unlock, err := s.lock(ctx, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+
+	type candidate struct {
+		dir  string
+		used time.Time
+		size int64
+	}
+	var (
+		entries []candidate
+		total   int64
+	)
+	shards, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, shard := range shards {
+		if !shard.IsDir() {
+			continue
+		}
+		children, err := os.ReadDir(filepath.Join(s.dir, shard.Name()))
+		if err != nil {
+			return removed, freed, err
+		}
+		for _, child := range children {
+			dir := filepath.Join(s.dir, shard.Name(), child.Name())
+			if strings.Contains(child.Name(), ".tmp-") {
+				// Left over by an interrupted [Store.Save]; no one else can be writing
+				// it as we hold the exclusive lock.
+				_ = os.RemoveAll(dir)
+				continue
+			}
+			stat, err := os.Stat(filepath.Join(dir, storeEntryFile))
+			if err != nil {
+				continue
+			}
+			size, err := dirSize(dir)
+			if err != nil {
+				return removed, freed, err
+			}
+			entries = append(entries, candidate{dir: dir, used: stat.ModTime(), size: size})
+			total += size
+		}
+	}
+
+	slices.SortFunc(entries, func(l, r candidate) int { return l.used.Compare(r.used) })
+
+	var cutoff time.Time
+	if s.maxAge > 0 {
+		cutoff = time.Now().Add(-s.maxAge)
+	}
+	for _, entry := range entries {
+		expired := !cutoff.IsZero() && entry.used.Before(cutoff)
+		oversized := s.maxSize > 0 && total > s.maxSize
+		if !expired && !oversized {
+			// Entries are sorted by last use, so no further entry is expired.
+			break
+		}
+		if err := os.RemoveAll(entry.dir); err != nil {
+			return removed, freed, err
+		}
+		removed++
+		freed += entry.size
+		total -= entry.size
+	}
+
+	zerolog.Ctx(ctx).Debug().
+		Str("dir", s.dir).
+		Int("removed", removed).
+		Int64("freed", freed).
+		Int64("size", total).
+		Msg("Evicted entries from the NBT store")
+
+	return removed, freed, nil
+}
+
+// lock acquires a shared (or exclusive, if exclusive is true) lock on the
+// store, and returns a function that releases it.
+func (s *Store) lock(ctx context.Context, exclusive bool) (func(), error) {
+	mu := filelock.MutexAt(filepath.Join(s.dir, storeLockFile))
+	lock := mu.RLock
+	if exclusive {
+		lock = mu.Lock
+	}
+	if err := lock(ctx); err != nil {
+		return nil, fmt.Errorf("locking NBT store: %w", err)
+	}
+	return func() {
+		if err := mu.Unlock(ctx); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("dir", s.dir).Msg("Failed to unlock NBT store")
+		}
+	}, nil
+}
+
+func (s *Store) entryDir(importPath string, buildID string) string {
+	sum := sha256.Sum256([]byte(importPath + "\x00" + buildID))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(s.dir, key[:2], key)
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
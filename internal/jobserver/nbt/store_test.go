@@ -0,0 +1,80 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package nbt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+
+	save := func(t *testing.T, store *Store, importPath string, content string) {
+		archive := filepath.Join(t.TempDir(), "_pkg_.a")
+		require.NoError(t, os.WriteFile(archive, []byte(content), 0o644))
+		require.NoError(t, store.Save(ctx, importPath, "build-id", map[Label]string{LabelArchive: archive}))
+	}
+
+	t.Run("save-load", func(t *testing.T) {
+		store, err := OpenStore(StoreOptions{Dir: t.TempDir()})
+		require.NoError(t, err)
+
+		files, err := store.Load(ctx, "example.com/pkg", "build-id", t.TempDir())
+		require.NoError(t, err)
+		assert.Nil(t, files)
+
+		save(t, store, "example.com/pkg", "original")
+		// Saving again does not replace the existing entry.
+		save(t, store, "example.com/pkg", "replacement")
+
+		dir := t.TempDir()
+		files, err = store.Load(ctx, "example.com/pkg", "build-id", dir)
+		require.NoError(t, err)
+		require.Equal(t, map[Label]string{LabelArchive: filepath.Join(dir, string(LabelArchive))}, files)
+		content, err := os.ReadFile(files[LabelArchive])
+		require.NoError(t, err)
+		assert.Equal(t, "original", string(content))
+
+		files, err = store.Load(ctx, "example.com/pkg", "other-build-id", t.TempDir())
+		require.NoError(t, err)
+		assert.Nil(t, files)
+	})
+
+	t.Run("evict-max-age", func(t *testing.T) {
+		store, err := OpenStore(StoreOptions{Dir: t.TempDir(), MaxAge: time.Hour})
+		require.NoError(t, err)
+
+		save(t, store, "example.com/old", "old")
+		save(t, store, "example.com/new", "new")
+		old := filepath.Join(store.entryDir("example.com/old", "build-id"), storeEntryFile)
+		past := time.Now().Add(-2 * time.Hour)
+		require.NoError(t, os.Chtimes(old, past, past))
+
+		removed, _, err := store.Evict(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, removed)
+		assert.NoFileExists(t, old)
+		assert.FileExists(t, filepath.Join(store.entryDir("example.com/new", "build-id"), storeEntryFile))
+	})
+
+	t.Run("evict-max-size", func(t *testing.T) {
+		store, err := OpenStore(StoreOptions{Dir: t.TempDir(), MaxSize: 1})
+		require.NoError(t, err)
+
+		save(t, store, "example.com/pkg", "content")
+		removed, freed, err := store.Evict(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, removed)
+		assert.NotZero(t, freed)
+	})
+}
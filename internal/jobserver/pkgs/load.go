@@ -7,19 +7,21 @@ package pkgs
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
 	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
 	"github.com/rs/zerolog"
 	"golang.org/x/tools/go/packages"
 )
 
 type (
 	// LoadRequest is a request to load packages relative to a specific directory. It only loads the
-	// packages' names and (source) files, not their dependencies or export file. The result is cached
-	// for a given Dir+Pattern pair. Each pattern is loaded individually (so that they can be cached
-	// independently).
+	// packages' names, (source) files and module, not their dependencies or export file. The result
+	// is cached for a given Dir+Pattern pair. Each pattern is loaded individually (so that they can
+	// be cached independently).
 	LoadRequest struct {
 		Dir      string   `json:"dir"`      // The directory to resolve from (usually where `go.mod` is)
 		Patterns []string `json:"patterns"` // Package pattern to resolve
@@ -33,6 +35,35 @@ func (s *service) packageLoader(ctx context.Context, dir string, patterns ...str
 	return s.load(ctx, LoadRequest{Dir: dir, Patterns: patterns})
 }
 
+// loadedPackage is the JSON representation of a [packages.Package] within a
+// [LoadResponse]. The [packages.Package.MarshalJSON] method does not include
+// the [packages.Package.Module] field, so it is carried separately.
+type loadedPackage struct {
+	Package *packages.Package `json:"package"`
+	Module  *packages.Module  `json:"module,omitempty"`
+}
+
+func (r LoadResponse) MarshalJSON() ([]byte, error) {
+	pkgs := make([]loadedPackage, len(r))
+	for idx, pkg := range r {
+		pkgs[idx] = loadedPackage{Package: pkg, Module: pkg.Module}
+	}
+	return json.Marshal(pkgs)
+}
+
+func (r *LoadResponse) UnmarshalJSON(data []byte) error {
+	var pkgs []loadedPackage
+	if err := json.Unmarshal(data, &pkgs); err != nil {
+		return err
+	}
+	*r = make(LoadResponse, len(pkgs))
+	for idx, pkg := range pkgs {
+		pkg.Package.Module = pkg.Module
+		(*r)[idx] = pkg.Package
+	}
+	return nil
+}
+
 func (LoadRequest) Subject() string         { return loadSubject }
 func (LoadRequest) ResponseIs(LoadResponse) {}
 func (r LoadRequest) ForeachSpanTag(set func(key string, value any)) {
@@ -47,7 +78,7 @@ func (s *service) load(ctx context.Context, req LoadRequest) (LoadResponse, erro
 
 	for idx, pattern := range req.Patterns {
 		var err error
-		resp[idx], err = s.loaded.Load(fmt.Sprintf("%s\u0000%s", req.Dir, pattern), func() (_ *packages.Package, err error) {
+		resp[idx], err = s.loaded.Load(fmt.Sprintf("%s\u0000%s\u0000%s", common.BuildKey(ctx), req.Dir, pattern), func() (_ *packages.Package, err error) {
 			span, ctx := tracer.StartSpanFromContext(ctx, "Load",
 				tracer.ServiceName("golang.org/x/tools/go/packages"),
 				tracer.ResourceName(pattern),
@@ -66,7 +97,8 @@ func (s *service) load(ctx context.Context, req LoadRequest) (LoadResponse, erro
 			cfg := &packages.Config{
 				Context:    ctx,
 				Dir:        req.Dir,
-				Mode:       packages.NeedName | packages.NeedFiles,
+				Env:        common.BuildEnv(ctx),
+				Mode:       packages.NeedName | packages.NeedFiles | packages.NeedModule,
 				BuildFlags: append(goFlags.Slice(), "-toolexec="), // Explicitly disable toolexec if it's in GOFLAGS
 			}
 
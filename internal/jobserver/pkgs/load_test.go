@@ -0,0 +1,39 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package pkgs_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/jobserver/pkgs"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestLoadResponseJSON(t *testing.T) {
+	resp := pkgs.LoadResponse{
+		{
+			ID:      "example.com/pkg",
+			Name:    "pkg",
+			PkgPath: "example.com/pkg",
+			GoFiles: []string{"/src/pkg/pkg.go"},
+			Module:  &packages.Module{Path: "example.com", Version: "v1.2.3"},
+		},
+		{
+			ID:      "fmt",
+			Name:    "fmt",
+			PkgPath: "fmt",
+		},
+	}
+
+	data, err := json.Marshal(resp)
+	require.NoError(t, err)
+
+	var decoded pkgs.LoadResponse
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, resp, decoded)
+}
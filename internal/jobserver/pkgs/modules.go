@@ -0,0 +1,138 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package pkgs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/rs/zerolog"
+)
+
+type (
+	// ModulesRequest is a request to obtain the versions of modules selected in
+	// the module graph of the main module located in a specific directory. The
+	// result is cached for a given Dir+Path pair.
+	ModulesRequest struct {
+		Dir   string   `json:"dir"`   // The directory to resolve from (usually where `go.mod` is)
+		Paths []string `json:"paths"` // The module paths to look up
+	}
+	// ModulesResponse is the response to a [ModulesRequest]. It maps module paths
+	// to their selected version. Modules that are not part of the module graph
+	// are absent from the map; modules that are part of the main module set
+	// (i.e, the main module or workspace modules) have an empty version.
+	ModulesResponse map[string]string
+
+	module struct {
+		Version string
+		Found   bool
+	}
+)
+
+// moduleResolver can be used as a [ModuleResolver] implementation.
+func (s *service) moduleResolver(ctx context.Context, dir string, paths ...string) (ModulesResponse, error) {
+	return s.modules(ctx, ModulesRequest{Dir: dir, Paths: paths})
+}
+
+func (ModulesRequest) Subject() string            { return modulesSubject }
+func (ModulesRequest) ResponseIs(ModulesResponse) {}
+func (r ModulesRequest) ForeachSpanTag(set func(key string, value any)) {
+	set("request.dir", r.Dir)
+	set("request.paths", r.Paths)
+}
+
+func (s *service) modules(ctx context.Context, req ModulesRequest) (ModulesResponse, error) {
+	resp := make(ModulesResponse, len(req.Paths))
+
+	for _, path := range req.Paths {
+		mod, err := s.moduleVersions.Load(fmt.Sprintf("%s\u0000%s\u0000%s", common.BuildKey(ctx), req.Dir, path), func() (_ module, err error) {
+			span, ctx := tracer.StartSpanFromContext(ctx, "pkgs.Modules",
+				tracer.ResourceName(path),
+			)
+			defer func() { span.Finish(tracer.WithError(err)) }()
+
+			return listModule(ctx, req.Dir, path)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("resolving module %q: %w", path, err)
+		}
+		if mod.Found {
+			resp[path] = mod.Version
+		}
+	}
+
+	return resp, nil
+}
+
+// listModule runs `go list -m` to determine the selected version of the module
+// with the specified path.
+func listModule(ctx context.Context, dir string, path string) (module, error) {
+	log := zerolog.Ctx(ctx)
+
+	goBin, err := goenv.GoBinPath()
+	if err != nil {
+		return module{}, fmt.Errorf("resolving go command path: %w", err)
+	}
+
+	args := []string{"list", "-m", "-json", "-e"}
+	goFlags, err := goflags.Flags(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to obtain go build flags")
+	}
+	// Only the flags that affect the module graph are relevant here.
+	for _, flag := range []string{"-mod", "-modfile"} {
+		if val, found := goFlags.Get(flag); found {
+			args = append(args, fmt.Sprintf("%s=%s", flag, val))
+		}
+	}
+	args = append(args, "--", path)
+
+	var stdout, stderr bytes.Buffer
+	cmd := common.ConfigureCommand(ctx, exec.CommandContext(ctx, goBin, args...))
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return module{}, fmt.Errorf("running %q: %w\n%s", cmd.Args, err, stderr.String())
+	}
+
+	dec := json.NewDecoder(&stdout)
+	for {
+		var info struct {
+			Path    string
+			Version string
+			Main    bool
+			Error   *struct{ Err string }
+		}
+		if err := dec.Decode(&info); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return module{}, fmt.Errorf("parsing output of %q: %w", cmd.Args, err)
+		}
+		if info.Path != path {
+			continue
+		}
+		if info.Error != nil {
+			log.Debug().Str("module", path).Str("error", info.Error.Err).Msg("Module is not part of the module graph")
+			return module{}, nil
+		}
+		if info.Main {
+			return module{Found: true}, nil
+		}
+		return module{Version: info.Version, Found: true}, nil
+	}
+
+	return module{}, nil
+}
@@ -0,0 +1,61 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package pkgs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/DataDog/orchestrion/internal/pgo"
+)
+
+type (
+	// HotFunctionsRequest is a request to obtain the functions marked as hot by
+	// the PGO profile of the build (see [pgo.FromFlags]). The profile is read
+	// only once per build and threshold, so that compile tasks do not each need
+	// to parse it.
+	HotFunctionsRequest struct {
+		// Threshold is the percentage of the profile's total call edge weight
+		// that hot functions account for (see [pgo.EnvVarHotThreshold]).
+		Threshold float64 `json:"threshold"`
+	}
+	// HotFunctionsResponse is the response to a [HotFunctionsRequest].
+	HotFunctionsResponse struct {
+		// Functions are the hot functions, or nil if the build does not use an
+		// explicit PGO profile.
+		Functions pgo.HotFunctions `json:"functions,omitempty"`
+	}
+)
+
+func (HotFunctionsRequest) Subject() string                  { return hotFunctionsSubject }
+func (HotFunctionsRequest) ResponseIs(*HotFunctionsResponse) {}
+func (r HotFunctionsRequest) ForeachSpanTag(set func(key string, value any)) {
+	set("request.threshold", r.Threshold)
+}
+
+func (s *service) hotFunctions(ctx context.Context, req HotFunctionsRequest) (*HotFunctionsResponse, error) {
+	res, err := s.hot.Load(fmt.Sprintf("%s\u0000%g", common.BuildKey(ctx), req.Threshold), func() (_ HotFunctionsResponse, err error) {
+		span, ctx := tracer.StartSpanFromContext(ctx, "pkgs.HotFunctions")
+		defer func() { span.Finish(tracer.WithError(err)) }()
+
+		flags, err := goflags.Flags(ctx)
+		if err != nil {
+			return HotFunctionsResponse{}, err
+		}
+		hot, err := pgo.FromFlags(ctx, flags, req.Threshold)
+		if err != nil {
+			return HotFunctionsResponse{}, err
+		}
+		return HotFunctionsResponse{Functions: hot}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
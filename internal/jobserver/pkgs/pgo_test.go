@@ -0,0 +1,57 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package pkgs_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/DataDog/orchestrion/internal/jobserver"
+	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/jobserver/pkgs"
+	"github.com/DataDog/orchestrion/internal/pgo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHotFunctions(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+
+	tmp := t.TempDir()
+	profile := filepath.Join(tmp, "default.pgo")
+	require.NoError(t, os.WriteFile(profile, []byte("GO PREPROFILE V1\n"+
+		"main.main\nexample.com/app.handle\n3 90\n"+
+		"main.main\nexample.com/app.cleanup\n7 10\n"), 0o644))
+
+	ctx := context.Background()
+	flags, err := goflags.ParseCommandFlags(ctx, tmp, []string{"build", "-pgo=" + profile})
+	require.NoError(t, err)
+
+	server, err := jobserver.New(goflags.WithFlags(ctx, flags), nil)
+	require.NoError(t, err)
+	defer server.Shutdown()
+	c, err := server.Connect()
+	require.NoError(t, err)
+	defer c.Close()
+
+	expected := pgo.HotFunctions{"main.main": {}, "example.com/app.handle": {}}
+	for range 2 {
+		res, err := client.Request(ctx, c, pkgs.HotFunctionsRequest{Threshold: 50})
+		require.NoError(t, err)
+		assert.Equal(t, expected, res.Functions)
+	}
+	// The profile is read only once for the build.
+	stats := server.CacheStats.Breakdown()["pkgs.hotFunctions"]
+	require.NotNil(t, stats)
+	assert.Equal(t, uint64(1), stats.Hits())
+
+	res, err := client.Request(ctx, c, pkgs.HotFunctionsRequest{Threshold: 100})
+	require.NoError(t, err)
+	assert.Equal(t, pgo.HotFunctions{"main.main": {}, "example.com/app.handle": {}, "example.com/app.cleanup": {}}, res.Functions)
+}
@@ -18,33 +18,61 @@ import (
 const (
 	subjectPrefix = "packages."
 
-	resolveSubject = subjectPrefix + "resolve"
-	loadSubject    = subjectPrefix + "load"
+	resolveSubject      = subjectPrefix + "resolve"
+	loadSubject         = subjectPrefix + "load"
+	modulesSubject      = subjectPrefix + "modules"
+	workspaceSubject    = subjectPrefix + "workspace"
+	hotFunctionsSubject = subjectPrefix + "hotFunctions"
 )
 
 type service struct {
-	resolved  common.Cache[ResolveResponse]
-	loaded    common.Cache[*packages.Package]
-	graph     common.Graph
-	serverURL string
+	resolved       common.Cache[ResolveResponse]
+	loaded         common.Cache[*packages.Package]
+	moduleVersions common.Cache[module]
+	workspaces     common.Cache[WorkspaceResponse]    // Keyed by [common.BuildKey]
+	hot            common.Cache[HotFunctionsResponse] // Keyed by [common.BuildKey] and threshold
+	graph          common.Graph
+	serverURL      string // The URL child builds use to connect to this server, if any
 }
 
-func Subscribe(ctx context.Context, serverURL string, conn *nats.Conn, stats *common.CacheStats) (config.PackageLoader, error) {
+// ModuleResolver returns the selected versions of the specified modules in the
+// module graph of the main module located in dir. See [ModulesResponse].
+type ModuleResolver func(ctx context.Context, dir string, paths ...string) (ModulesResponse, error)
+
+func Subscribe(ctx context.Context, serverURL string, conn *nats.Conn, stats *common.CacheStats) (config.PackageLoader, ModuleResolver, error) {
 	s := &service{
-		loaded:    common.NewCache[*packages.Package](stats),
-		resolved:  common.NewCache[ResolveResponse](stats),
-		serverURL: serverURL,
+		loaded:         common.NewCache[*packages.Package](stats.Named("pkgs.load")),
+		resolved:       common.NewCache[ResolveResponse](stats.Named("pkgs.resolve")),
+		moduleVersions: common.NewCache[module](stats.Named("pkgs.modules")),
+		workspaces:     common.NewCache[WorkspaceResponse](stats.Named("pkgs.workspace")),
+		hot:            common.NewCache[HotFunctionsResponse](stats.Named("pkgs.hotFunctions")),
+		serverURL:      serverURL,
 	}
 
 	ctx = zerolog.Ctx(ctx).With().Str("nats.subject", resolveSubject).Logger().WithContext(ctx)
 	_, err := conn.Subscribe(resolveSubject, common.HandleRequest(ctx, s.resolve))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	_, err = conn.Subscribe(loadSubject, common.HandleRequest(ctx, s.load))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	_, err = conn.Subscribe(modulesSubject, common.HandleRequest(ctx, s.modules))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = conn.Subscribe(workspaceSubject, common.HandleRequest(ctx, s.workspace))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = conn.Subscribe(hotFunctionsSubject, common.HandleRequest(ctx, s.hotFunctions))
+	if err != nil {
+		return nil, nil, err
 	}
-	return s.packageLoader, nil
+	return s.packageLoader, s.moduleResolver, nil
 }
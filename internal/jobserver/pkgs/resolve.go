@@ -12,14 +12,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"slices"
 	"strings"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
 	"github.com/DataDog/orchestrion/internal/binpath"
+	"github.com/DataDog/orchestrion/internal/goenv"
 	"github.com/DataDog/orchestrion/internal/goflags"
 	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
 	"github.com/DataDog/orchestrion/internal/traceutil"
 	"github.com/rs/zerolog"
 	"golang.org/x/tools/go/packages"
@@ -27,7 +30,11 @@ import (
 
 const (
 	envVarParentID = "ORCHESTRION_PKG.RESOLVE_PARENT_ID"
-	envVarGotmpdir = "GOTMPDIR"
+	// envVarAncestors lists the import paths of all packages whose resolutions are (transitively)
+	// waiting on the current build. Unlike the job server's resolution graph, it is also available to
+	// in-process job servers, which do not see resolutions made by other processes.
+	envVarAncestors = "ORCHESTRION_PKG.RESOLVE_ANCESTORS"
+	envVarGotmpdir  = "GOTMPDIR"
 )
 
 var envIgnoreList = map[string]func(*ResolveRequest, string){
@@ -43,30 +50,45 @@ var envIgnoreList = map[string]func(*ResolveRequest, string){
 	// Known to change between invocations & irrelevant to the resolution, but can be used to detect cycles.
 	"TOOLEXEC_IMPORTPATH": func(r *ResolveRequest, path string) { r.toolexecImportpath = path },
 	envVarParentID:        func(r *ResolveRequest, id string) { r.resolveParentID = id },
+	envVarAncestors: func(r *ResolveRequest, list string) {
+		if list != "" {
+			r.resolveAncestors = strings.Split(list, ",")
+		}
+	},
 }
 
 type (
 	ResolveRequest struct {
 		Dir     string   `json:"dir"`              // The directory to resolve from (usually where `go.mod` is)
 		Env     []string `json:"env"`              // Environment variables to use during resolution
-		Pattern string   `json:"pattern"`          // Package pattern to resolve
 		TempDir string   `json:"tmpdir,omitempty"` // A temporary directory to use for Go build artifacts
 
+		// Patterns is the list of package patterns to resolve. When more than one pattern is provided,
+		// they must all be package import paths, so that each resolved package can be attributed to the
+		// pattern that requested it. All patterns are resolved using a single `go list` invocation,
+		// except for those that have already been resolved (or are being resolved) by another request.
+		Patterns []string `json:"patterns"`
+
+		// Target is the platform and build tags to resolve packages for. If nil, it is derived from
+		// [ResolveRequest.Env] and the build's go flags.
+		Target *goenv.Target `json:"target,omitempty"`
+
 		// Fields set by canonicalization
-		resolveParentID    string // The value of the [envVarParentID] environment variable
-		toolexecImportpath string // The value of the TOOLEXEC_IMPORTPATH environment variable
-		canonical          bool   // Whether this request was canonicalized yet
+		resolveParentID    string   // The value of the [envVarParentID] environment variable
+		resolveAncestors   []string // The value of the [envVarAncestors] environment variable
+		toolexecImportpath string   // The value of the TOOLEXEC_IMPORTPATH environment variable
+		canonical          bool     // Whether this request was canonicalized yet
 	}
 	// ResolveResponse is a map of package import path to their respective export file, if one is
 	// found. Users should handle possibly missing export files as is relevant to their use-case.
 	ResolveResponse map[string]string
 )
 
-func NewResolveRequest(dir string, pattern string) ResolveRequest {
+func NewResolveRequest(dir string, patterns ...string) ResolveRequest {
 	return ResolveRequest{
-		Dir:     dir,
-		Env:     os.Environ(),
-		Pattern: pattern,
+		Dir:      dir,
+		Env:      os.Environ(),
+		Patterns: patterns,
 	}
 }
 
@@ -74,7 +96,7 @@ func (ResolveRequest) Subject() string            { return resolveSubject }
 func (ResolveRequest) ResponseIs(ResolveResponse) {}
 func (r ResolveRequest) ForeachSpanTag(set func(key string, value any)) {
 	set("request.dir", r.Dir)
-	set("request.pattern", r.Pattern)
+	set("request.patterns", r.Patterns)
 }
 
 func (r *ResolveRequest) canonicalizeEnviron() {
@@ -103,16 +125,45 @@ func (r *ResolveRequest) canonicalizeEnviron() {
 }
 
 func (s *service) resolve(ctx context.Context, req *ResolveRequest) (ResolveResponse, error) {
-	log := zerolog.Ctx(ctx)
-
-	// Make sure all children jobs connect to THIS jobserver; this is more efficient than checking for
-	// the local file system beacon.
-	req.Env = append(req.Env, fmt.Sprintf("%s=%s", client.EnvVarJobserverURL, s.serverURL))
+	if s.serverURL != "" {
+		// Make sure all children jobs connect to THIS jobserver; this is more efficient than checking for
+		// the local file system beacon.
+		req.Env = append(req.Env, fmt.Sprintf("%s=%s", client.EnvVarJobserverURL, s.serverURL))
+	}
 	req.canonicalize()
 
-	reqHash, err := req.hash()
-	if err != nil {
-		return nil, err
+	if len(req.Patterns) == 0 {
+		return nil, errors.New("no patterns to resolve")
+	}
+	if req.Target == nil {
+		// The target is made explicit, so that it is part of the cache key regardless of whether it was
+		// set in the environment, or in the go command's flags.
+		goFlags, err := goflags.Flags(ctx)
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to obtain go build flags")
+		}
+		// Like [packages.Load], the request's environment is applied on top of the job server's own.
+		target, err := goenv.TargetOf(req.Dir, append(os.Environ(), req.Env...), goFlags.Tags())
+		if err != nil {
+			return nil, fmt.Errorf("determining build target: %w", err)
+		}
+		req.Target = &target
+	}
+	if req.toolexecImportpath != "" && slices.Contains(req.resolveAncestors, req.toolexecImportpath) {
+		return nil, fmt.Errorf("cycle detected: %s -> %s", strings.Join(req.resolveAncestors, " -> "), req.toolexecImportpath)
+	}
+
+	// Each pattern is cached individually, so that batched requests can share results (and in-flight
+	// resolutions) with other requests that have some patterns in common.
+	keys := make([]string, len(req.Patterns))
+	patterns := make(map[string]string, len(req.Patterns))
+	for idx, pattern := range req.Patterns {
+		key, err := req.hash(common.BuildKey(ctx), pattern)
+		if err != nil {
+			return nil, err
+		}
+		keys[idx] = key
+		patterns[key] = pattern
 	}
 
 	if req.resolveParentID != "" {
@@ -122,89 +173,138 @@ func (s *service) resolve(ctx context.Context, req *ResolveRequest) (ResolveResp
 		defer s.graph.RemoveEdge(req.resolveParentID, req.toolexecImportpath)
 	}
 
-	resp, err := s.resolved.Load(reqHash, func() (_ ResolveResponse, err error) {
-		log := log.With().Str("pattern", req.Pattern).Logger()
-		ctx := log.WithContext(ctx)
-
-		span, ctx := tracer.StartSpanFromContext(ctx, "pkgs.Resolve")
-		defer func() { span.Finish(tracer.WithError(err)) }()
-
-		log.Trace().Str("dir", req.Dir).Msg("pkgs.Resolve starting")
-
-		env := slices.Clone(req.Env)
-		tracer.Inject(span.Context(), traceutil.EnvVarCarrier{Env: &env})
-		if req.toolexecImportpath != "" {
-			env = make([]string, 0, len(req.Env)+1)
-			env = append(env, req.Env...)
-			env = append(env, fmt.Sprintf("%s=%s", envVarParentID, req.toolexecImportpath))
-		}
-		if req.TempDir != "" {
-			// Make sure the directory exists (go blindly assumes that...)
-			if err := os.MkdirAll(req.TempDir, 0o755); err != nil {
-				return nil, fmt.Errorf("creating temporary directory %q: %w", req.TempDir, err)
-			}
-			env = append(env, fmt.Sprintf("%s=%s", envVarGotmpdir, req.TempDir))
+	resolved, err := s.resolved.LoadMany(ctx, keys, func(ctx context.Context, keys []string) (map[string]ResolveResponse, error) {
+		pending := make([]string, len(keys))
+		for idx, key := range keys {
+			pending[idx] = patterns[key]
 		}
 
-		goFlags, err := goflags.Flags(ctx)
+		byPattern, err := s.resolvePatterns(ctx, req, pending)
 		if err != nil {
-			log.Warn().Err(err).Msg("Failed to obtain go build flags")
+			return nil, err
 		}
-		goFlags = goFlags.Except(
-			"-a",        // Re-building everything here would be VERY expensive, as we'd re-build a lot of stuff multiple times
-			"-toolexec", // We'll override `-toolexec` later with `orchestrion toolexec`, no need to pass multiple times...
-		)
 
-		buildFlags := append(
-			goFlags.Slice(),
-			fmt.Sprintf("-toolexec=%q toolexec", binpath.Orchestrion),
-		)
+		res := make(map[string]ResolveResponse, len(keys))
+		for _, key := range keys {
+			res[key] = byPattern[patterns[key]]
+		}
+		return res, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make(ResolveResponse)
+	for _, key := range keys {
+		maps.Copy(resp, resolved[key])
+	}
+	return resp, nil
+}
 
-		pkgs, err := packages.Load(
-			&packages.Config{
-				Mode:
-				// We need the export file (the whole point of the resolution)
-				packages.NeedExportFile |
-					// We want to also resolve transitive dependencies, so we need Deps & Imports. We also
-					// need CompiledGoFiles in order to see imports possibly added by the toolchain (cgo,
-					// cover, etc...)
-					packages.NeedCompiledGoFiles | packages.NeedDeps | packages.NeedImports |
-					// Finally, we need the resolved package import path
-					packages.NeedName,
-				Dir:        req.Dir,
-				Env:        env,
-				BuildFlags: buildFlags,
-				Logf:       func(format string, args ...any) { log.Trace().Str("operation", "packages.Load").Msgf(format, args...) },
-			},
-			req.Pattern,
+// resolvePatterns resolves the provided patterns using a single [packages.Load] call, and returns
+// the resolution of each pattern.
+func (s *service) resolvePatterns(ctx context.Context, req *ResolveRequest, patterns []string) (_ map[string]ResolveResponse, err error) {
+	log := zerolog.Ctx(ctx).With().Strs("patterns", patterns).Logger()
+	ctx = log.WithContext(ctx)
+
+	span, ctx := tracer.StartSpanFromContext(ctx, "pkgs.Resolve",
+		tracer.Tag("patterns", patterns),
+	)
+	defer func() { span.Finish(tracer.WithError(err)) }()
+
+	log.Trace().Str("dir", req.Dir).Msg("pkgs.Resolve starting")
+
+	env := slices.Clone(req.Env)
+	tracer.Inject(span.Context(), traceutil.EnvVarCarrier{Env: &env})
+	if req.toolexecImportpath != "" {
+		env = append(env,
+			fmt.Sprintf("%s=%s", envVarParentID, req.toolexecImportpath),
+			fmt.Sprintf("%s=%s", envVarAncestors, strings.Join(append(slices.Clip(req.resolveAncestors), req.toolexecImportpath), ",")),
 		)
-		if err != nil {
-			log.Error().Str("pattern", req.Pattern).Err(err).Msg("pkgs.Resolve failed")
-			return nil, err
-		}
-		if len(pkgs) == 0 {
-			return nil, fmt.Errorf("no packages returned for pattern: %q", req.Pattern)
+	}
+	if req.TempDir != "" {
+		// Make sure the directory exists (go blindly assumes that...)
+		if err := os.MkdirAll(req.TempDir, 0o755); err != nil {
+			return nil, fmt.Errorf("creating temporary directory %q: %w", req.TempDir, err)
 		}
+		env = append(env, fmt.Sprintf("%s=%s", envVarGotmpdir, req.TempDir))
+	}
+
+	goFlags, err := goflags.Flags(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to obtain go build flags")
+	}
+	goFlags = goFlags.Except(
+		"-a",        // Re-building everything here would be VERY expensive, as we'd re-build a lot of stuff multiple times
+		"-tags",     // We'll use the request's target's tags instead
+		"-toolexec", // We'll override `-toolexec` later with `orchestrion toolexec`, no need to pass multiple times...
+	)
+
+	buildFlags := append(
+		append(goFlags.Slice(), req.Target.BuildFlags()...),
+		fmt.Sprintf("-toolexec=%q toolexec", binpath.Orchestrion),
+	)
+	env = append(env, req.Target.Env()...)
+
+	pkgs, err := packages.Load(
+		&packages.Config{
+			Mode:
+			// We need the export file (the whole point of the resolution)
+			packages.NeedExportFile |
+				// We want to also resolve transitive dependencies, so we need Deps & Imports. We also
+				// need CompiledGoFiles in order to see imports possibly added by the toolchain (cgo,
+				// cover, etc...)
+				packages.NeedCompiledGoFiles | packages.NeedDeps | packages.NeedImports |
+				// Finally, we need the resolved package import path
+				packages.NeedName,
+			// If the requesting client goes away (e.g, the build was aborted), this stops `go list`, and
+			// hence any child build it may have spawned.
+			Context:    ctx,
+			Dir:        req.Dir,
+			Env:        env,
+			BuildFlags: buildFlags,
+			Logf:       func(format string, args ...any) { log.Trace().Str("operation", "packages.Load").Msgf(format, args...) },
+		},
+		patterns...,
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("pkgs.Resolve failed")
+		return nil, err
+	}
 
-		resp := make(ResolveResponse)
-		var errs error
-		for _, pkg := range pkgs {
-			errs = errors.Join(errs, resp.mergeFrom(pkg))
+	res := make(map[string]ResolveResponse, len(patterns))
+	var errs error
+	for _, pkg := range pkgs {
+		pattern := patterns[0]
+		if len(patterns) > 1 {
+			// Batched patterns are import paths, so the package's import path is its pattern.
+			if !slices.Contains(patterns, pkg.PkgPath) {
+				errs = errors.Join(errs, fmt.Errorf("package %q does not match any of the requested import paths", pkg.PkgPath))
+				continue
+			}
+			pattern = pkg.PkgPath
 		}
 
-		if errs != nil {
-			log.Error().Str("pattern", req.Pattern).Err(errs).Msg("pkgs.Resolve failed")
-			return nil, errs
+		resp := res[pattern]
+		if resp == nil {
+			resp = make(ResolveResponse)
+			res[pattern] = resp
+		}
+		errs = errors.Join(errs, resp.mergeFrom(pkg))
+	}
+	for _, pattern := range patterns {
+		if _, found := res[pattern]; !found {
+			errs = errors.Join(errs, fmt.Errorf("no packages returned for pattern: %q", pattern))
 		}
+	}
 
-		log.Trace().Any("result", resp).Msg("pkgs.Resolve finished")
-		return resp, nil
-	})
-	if err != nil {
-		return nil, err
+	if errs != nil {
+		log.Error().Err(errs).Msg("pkgs.Resolve failed")
+		return nil, errs
 	}
 
-	return resp, nil
+	log.Trace().Any("result", res).Msg("pkgs.Resolve finished")
+	return res, nil
 }
 
 func (r *ResolveRequest) canonicalize() {
@@ -215,12 +315,19 @@ func (r *ResolveRequest) canonicalize() {
 	r.canonical = true
 }
 
-func (r *ResolveRequest) hash() (string, error) {
+// hash returns the cache key for the resolution of the provided pattern with the settings of r, in
+// the build identified by buildKey (see [common.BuildKey]).
+func (r *ResolveRequest) hash(buildKey string, pattern string) (string, error) {
 	hash := sha512.New()
 	encoder := json.NewEncoder(hash)
+	if err := encoder.Encode(buildKey); err != nil {
+		return "", err
+	}
 
 	r.canonicalize()
-	if err := encoder.Encode(r); err != nil {
+	key := *r
+	key.Patterns = []string{pattern}
+	if err := encoder.Encode(key); err != nil {
 		return "", err
 	}
 
@@ -13,6 +13,7 @@ import (
 	"os/exec"
 	"testing"
 
+	"github.com/DataDog/orchestrion/internal/goenv"
 	"github.com/DataDog/orchestrion/internal/goflags"
 	"github.com/DataDog/orchestrion/internal/jobserver"
 	"github.com/DataDog/orchestrion/internal/jobserver/client"
@@ -43,8 +44,8 @@ func Test(t *testing.T) {
 			context.Background(),
 			conn,
 			&pkgs.ResolveRequest{
-				Pattern: "net/http",
-				Env:     env,
+				Patterns: []string{"net/http"},
+				Env:      env,
 			},
 		)
 		require.NoError(t, err)
@@ -60,8 +61,8 @@ func Test(t *testing.T) {
 			context.Background(),
 			conn,
 			&pkgs.ResolveRequest{
-				Pattern: "net/http",
-				Env:     env, // This was shuffled, so it's not the same as before
+				Patterns: []string{"net/http"},
+				Env:      env, // This was shuffled, so it's not the same as before
 			},
 		)
 		require.NoError(t, err)
@@ -74,14 +75,97 @@ func Test(t *testing.T) {
 			context.Background(),
 			conn,
 			&pkgs.ResolveRequest{
-				Pattern: "os", // Not the same package as before...
-				Env:     env,
+				Patterns: []string{"os"}, // Not the same package as before...
+				Env:      env,
 			},
 		)
 		require.NoError(t, err)
 		assert.GreaterOrEqual(t, len(resp), 3)
 		assert.EqualValues(t, 3, server.CacheStats.Count())
 		assert.EqualValues(t, 1, server.CacheStats.Hits())
+
+		// Fourth request targets a different platform, should result in a cache miss again
+		resp, err = client.Request(
+			context.Background(),
+			conn,
+			&pkgs.ResolveRequest{
+				Patterns: []string{"os"},
+				Env:      env,
+				Target:   &goenv.Target{GOOS: "windows", GOARCH: "amd64"},
+			},
+		)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, len(resp), 3)
+		assert.Contains(t, resp, "internal/syscall/windows")
+		assert.EqualValues(t, 4, server.CacheStats.Count())
+		assert.EqualValues(t, 1, server.CacheStats.Hits())
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		server, err := jobserver.New(context.Background(), nil)
+		require.NoError(t, err)
+		defer server.Shutdown()
+
+		conn, err := server.Connect()
+		require.NoError(t, err)
+		defer conn.Close()
+
+		env := os.Environ()
+
+		// Each pattern of a batch is a separate cache entry...
+		resp, err := client.Request(
+			context.Background(),
+			conn,
+			&pkgs.ResolveRequest{
+				Patterns: []string{"os", "net/http"},
+				Env:      env,
+			},
+		)
+		require.NoError(t, err)
+		assert.Contains(t, resp, "os")
+		assert.Contains(t, resp, "net/http")
+		assert.EqualValues(t, 2, server.CacheStats.Count())
+		assert.EqualValues(t, 0, server.CacheStats.Hits())
+
+		// ... so that they can be re-used by requests for a subset of them.
+		resp, err = client.Request(
+			context.Background(),
+			conn,
+			&pkgs.ResolveRequest{
+				Patterns: []string{"os"},
+				Env:      env,
+			},
+		)
+		require.NoError(t, err)
+		assert.Contains(t, resp, "os")
+		assert.NotContains(t, resp, "net/http")
+		assert.EqualValues(t, 3, server.CacheStats.Count())
+		assert.EqualValues(t, 1, server.CacheStats.Hits())
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		server, err := jobserver.New(context.Background(), nil)
+		require.NoError(t, err)
+		defer server.Shutdown()
+
+		conn, err := server.Connect()
+		require.NoError(t, err)
+		defer conn.Close()
+
+		// The requesting package is already waiting on this resolution, possibly from another process.
+		resp, err := client.Request(
+			context.Background(),
+			conn,
+			&pkgs.ResolveRequest{
+				Patterns: []string{"os"},
+				Env: append(os.Environ(),
+					"TOOLEXEC_IMPORTPATH=example.com/a",
+					"ORCHESTRION_PKG.RESOLVE_ANCESTORS=example.com/a,example.com/b",
+				),
+			},
+		)
+		assert.Nil(t, resp)
+		require.ErrorContains(t, err, "cycle detected: example.com/a -> example.com/b -> example.com/a")
 	})
 
 	t.Run("Error", func(t *testing.T) {
@@ -96,7 +180,7 @@ func Test(t *testing.T) {
 		resp, err := client.Request(
 			context.Background(),
 			conn,
-			&pkgs.ResolveRequest{Pattern: "definitely.not/a@valid\x01package"},
+			&pkgs.ResolveRequest{Patterns: []string{"definitely.not/a@valid\x01package"}},
 		)
 		assert.Nil(t, resp)
 		assert.EqualValues(t, 0, server.CacheStats.Hits())
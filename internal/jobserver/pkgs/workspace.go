@@ -0,0 +1,83 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package pkgs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+)
+
+type (
+	// WorkspaceRequest is a request to obtain the `go.mod` and `go.work` files in
+	// use by the build. The result is cached for the lifetime of the build, so
+	// that compile tasks do not each need to run `go env`.
+	WorkspaceRequest struct{}
+	// WorkspaceResponse is the response to a [WorkspaceRequest].
+	WorkspaceResponse struct {
+		// GoMod is the path to the main module's `go.mod` file, or a blank string
+		// if there is none (e.g, in a workspace's root directory).
+		GoMod string `json:"gomod,omitempty"`
+		// GoWork is the path to the `go.work` file in use, or a blank string if
+		// workspace mode is not enabled.
+		GoWork string `json:"gowork,omitempty"`
+	}
+)
+
+func (WorkspaceRequest) Subject() string                  { return workspaceSubject }
+func (WorkspaceRequest) ResponseIs(*WorkspaceResponse)    {}
+func (WorkspaceRequest) ForeachSpanTag(func(string, any)) {}
+
+func (s *service) workspace(ctx context.Context, _ WorkspaceRequest) (*WorkspaceResponse, error) {
+	res, err := s.workspaces.Load(common.BuildKey(ctx), func() (_ WorkspaceResponse, err error) {
+		span, ctx := tracer.StartSpanFromContext(ctx, "pkgs.Workspace")
+		defer func() { span.Finish(tracer.WithError(err)) }()
+
+		return goEnvWorkspace(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// goEnvWorkspace runs `go env` to determine the `go.mod` and `go.work` files in
+// use by the build.
+func goEnvWorkspace(ctx context.Context) (WorkspaceResponse, error) {
+	goBin, err := goenv.GoBinPath()
+	if err != nil {
+		return WorkspaceResponse{}, fmt.Errorf("resolving go command path: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := common.ConfigureCommand(ctx, exec.CommandContext(ctx, goBin, "env", "-json", "GOMOD", "GOWORK"))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return WorkspaceResponse{}, fmt.Errorf("running %q: %w\n%s", cmd.Args, err, stderr.String())
+	}
+
+	var env struct{ GOMOD, GOWORK string }
+	if err := json.Unmarshal(stdout.Bytes(), &env); err != nil {
+		return WorkspaceResponse{}, fmt.Errorf("parsing output of %q: %w", cmd.Args, err)
+	}
+
+	var res WorkspaceResponse
+	if env.GOMOD != os.DevNull {
+		res.GoMod = env.GOMOD
+	}
+	if env.GOWORK != "off" {
+		res.GoWork = env.GOWORK
+	}
+	return res, nil
+}
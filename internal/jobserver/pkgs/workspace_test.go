@@ -0,0 +1,55 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package pkgs_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/jobserver"
+	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/jobserver/pkgs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspace(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "")
+
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	modDir := filepath.Join(tmp, "a")
+	require.NoError(t, os.MkdirAll(modDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "go.work"), []byte("go 1.23\n\nuse ./a\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(modDir, "go.mod"), []byte("module example.com/a\n\ngo 1.23\n"), 0o644))
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(modDir))
+	defer func() { require.NoError(t, os.Chdir(wd)) }()
+
+	ctx := context.Background()
+	server, err := jobserver.New(ctx, nil)
+	require.NoError(t, err)
+	defer server.Shutdown()
+	c, err := server.Connect()
+	require.NoError(t, err)
+	defer c.Close()
+
+	expected := &pkgs.WorkspaceResponse{GoMod: filepath.Join(modDir, "go.mod"), GoWork: filepath.Join(tmp, "go.work")}
+	for range 2 {
+		res, err := client.Request(ctx, c, pkgs.WorkspaceRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, expected, res)
+	}
+	// The workspace is resolved only once for the build.
+	stats := server.CacheStats.Breakdown()["pkgs.workspace"]
+	require.NotNil(t, stats)
+	assert.Equal(t, uint64(1), stats.Hits())
+}
@@ -11,7 +11,9 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -20,6 +22,8 @@ import (
 	"github.com/DataDog/orchestrion/internal/jobserver/common"
 	"github.com/DataDog/orchestrion/internal/jobserver/nbt"
 	"github.com/DataDog/orchestrion/internal/jobserver/pkgs"
+	"github.com/DataDog/orchestrion/internal/jobserver/status"
+	"github.com/DataDog/orchestrion/internal/remotecache"
 	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
 	"github.com/rs/zerolog"
@@ -28,7 +32,11 @@ import (
 const (
 	serverUsername = "server" // User for the server itself
 	sysUser        = "admin"  // User for system event access
-	noPassword     = ""       // We don't need passwords, this is only to have access to system events, not for security.
+
+	// inProcessURL is used for in-process connections; "any" URL will do here, it's not actually used
+	// for connecting.
+	inProcessURL  = "nats://" + inProcessHost
+	inProcessHost = "localhost:0"
 )
 
 var (
@@ -40,11 +48,16 @@ type (
 		server     *server.Server     // The underlying NATS server
 		CacheStats *common.CacheStats // Cache statistics
 		clientURL  string             // The client URL to use for connecting to this server
+		token      string             // The password all users must present when connecting
 		log        zerolog.Logger
 
 		shutdownHooks []func(context.Context) error
 
-		// Tracking connected clients for automatic shutdown on inactivity...
+		// builds are the builds registered by clients, if the server serves
+		// multiple builds (see [Options.Daemon]).
+		builds *common.Builds
+
+		// Tracking connected clients for reporting & automatic shutdown on inactivity...
 		clients           map[uint64]string
 		shutdownTimer     *time.Timer
 		clientsMu         sync.Mutex
@@ -67,11 +80,40 @@ type (
 		// NoListener disables the network listener, only allowing in-process
 		// connections to be made to this server instead.
 		NoListener bool
+		// UnixSocket makes the server listen on a Unix domain socket instead of
+		// the loopback interface. The socket is created in a new directory that
+		// is only accessible to the current user, so that other users of the host
+		// cannot connect to the server at all. Port is ignored if this is set.
+		UnixSocket bool
+		// SocketPath is the path of the Unix domain socket to listen on if
+		// UnixSocket is set. The caller is responsible for making sure its
+		// directory is only accessible to the current user. If blank, the socket
+		// is created in a new private temporary directory.
+		SocketPath string
+		// Daemon makes the server serve builds of any module on behalf of any
+		// client, rather than only the build it was started for. Requests are
+		// processed in the context of the build their client registered (see
+		// [common.RegisterBuildRequest]), and the server can be asked to shut down
+		// with a [ShutdownRequest].
+		Daemon bool
+		// NBTStore enables the durable never-build-twice store with the provided
+		// options, so that compilation artifacts are re-used across job server
+		// lifetimes. If nil, artifacts are only re-used within this server's
+		// lifetime.
+		NBTStore *nbt.StoreOptions
+		// RemoteCache is the URL of a remote cache to consult for compilation
+		// artifacts and version suffixes (see [remotecache.Open]). If blank, no
+		// remote cache is used.
+		RemoteCache string
+		// RemoteCacheReadOnly prevents uploading new entries to the remote cache.
+		RemoteCacheReadOnly bool
 	}
 )
 
 // New initializes and starts a new NATS server with the provided options. The
-// server only listens on the loopback interface.
+// server only listens on the loopback interface (or on a Unix domain socket),
+// and requires clients to present a random token that is part of the URL
+// returned by [Server.ClientURL].
 func New(ctx context.Context, opts *Options) (srv *Server, err error) {
 	log := zerolog.Ctx(ctx).With().Str("process", "server").Logger()
 	ctx = log.WithContext(ctx)
@@ -90,6 +132,13 @@ func New(ctx context.Context, opts *Options) (srv *Server, err error) {
 		startTimeout = 5 * time.Second
 	}
 
+	// All users authenticate with a random token, so that only processes that were given the
+	// client URL can connect to this server.
+	token, err := newToken()
+	if err != nil {
+		return nil, fmt.Errorf("generating authentication token: %w", err)
+	}
+
 	// Creating the server instance
 	userAccount := server.NewAccount("USERS")
 	systemAccount := server.NewAccount("SYS")
@@ -98,12 +147,12 @@ func New(ctx context.Context, opts *Options) (srv *Server, err error) {
 		ServerName: fmt.Sprintf("github.com/DataDog/orchestrion/internal/jobserver[%d]", os.Getpid()),
 		Host:       getLoopback(log),
 		Port:       port,
-		DontListen: opts.NoListener,
+		DontListen: opts.NoListener || opts.UnixSocket, // Unix socket connections are proxied to in-process connections
 		Accounts:   []*server.Account{userAccount, systemAccount},
 		Users: []*server.User{
-			{Username: client.Username, Password: client.NoPassword, Account: userAccount},
-			{Username: serverUsername, Password: noPassword, Account: userAccount},
-			{Username: sysUser, Password: noPassword, Account: systemAccount},
+			{Username: client.Username, Password: token, Account: userAccount},
+			{Username: serverUsername, Password: token, Account: userAccount},
+			{Username: sysUser, Password: token, Account: systemAccount},
 		},
 		SystemAccount: systemAccount.Name,
 		MaxPayload:    server.MAX_PAYLOAD_MAX_SIZE,
@@ -131,72 +180,123 @@ func New(ctx context.Context, opts *Options) (srv *Server, err error) {
 		return nil, errors.New("timed out waiting for NATS server to become available")
 	}
 
-	var clientURL string
-	if opts.NoListener {
-		// "Any" URL will do here, it's not actually used...
-		clientURL = "nats://localhost:0"
-	} else {
+	// Installing the handlers
+	res := Server{
+		server:     server,
+		CacheStats: &common.CacheStats{},
+		token:      token,
+		log:        log,
+	}
+
+	clientURL := url.URL{Scheme: "nats", User: url.UserPassword(client.Username, token)}
+	switch {
+	case opts.NoListener:
+		clientURL.Host = inProcessHost
+	case opts.UnixSocket:
+		socket, err := res.listenUnix(opts.SocketPath)
+		if err != nil {
+			return nil, err
+		}
+		clientURL.Scheme = "unix"
+		clientURL.Path = filepath.ToSlash(socket)
+	default:
 		// We don't use `server.ClientURL()` here because it currently returns an invalid URL is the
 		// listener address is IPv6 (see: https://github.com/nats-io/nats-server/issues/5721)
-		clientURL = fmt.Sprintf("nats://%s", server.Addr())
+		clientURL.Host = server.Addr().String()
 	}
+	res.clientURL = clientURL.String()
 
-	log.Trace().Str("url", clientURL).Msg("NATS Server ready for connections")
+	log.Trace().Str("url", clientURL.Redacted()).Msg("NATS Server ready for connections")
 
 	// Obtaining the local server connection
-	conn, err := nats.Connect(clientURL, nats.UserInfo(serverUsername, noPassword), nats.InProcessServer(server))
+	conn, err := nats.Connect(inProcessURL, nats.UserInfo(serverUsername, token), nats.InProcessServer(server))
 	if err != nil {
 		return nil, fmt.Errorf("connecting to in-process NATS server instance: %w", err)
 	}
 
-	// Installing the handlers
-	res := Server{
-		server:     server,
-		CacheStats: &common.CacheStats{},
-		clientURL:  clientURL,
-		log:        log,
+	ctx, err = common.SubscribeCancel(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Daemon {
+		ctx, res.builds, err = common.SubscribeBuilds(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		if err := res.subscribeShutdown(ctx, conn); err != nil {
+			return nil, err
+		}
 	}
-	pkgLoader, err := pkgs.Subscribe(ctx, clientURL, conn, res.CacheStats)
+	// Child builds cannot connect to a server that does not listen for connections.
+	childURL := res.clientURL
+	if opts.NoListener {
+		childURL = ""
+	}
+	pkgLoader, modResolver, err := pkgs.Subscribe(ctx, childURL, conn, res.CacheStats)
 	if err != nil {
 		return nil, err
 	}
-	if err := buildid.Subscribe(ctx, conn, pkgLoader, res.CacheStats); err != nil {
+	var remote *remotecache.Cache
+	if opts.RemoteCache != "" {
+		remote, err = remotecache.Open(opts.RemoteCache, opts.RemoteCacheReadOnly)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to open the remote cache; it will not be used")
+		}
+	}
+	if err := buildid.Subscribe(ctx, conn, pkgLoader, modResolver, remote, res.CacheStats); err != nil {
 		return nil, err
 	}
-	cleanup, err := nbt.Subscribe(ctx, conn)
+	var nbtStore *nbt.Store
+	if opts.NBTStore != nil {
+		nbtStore, err = nbt.OpenStore(*opts.NBTStore)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to open the NBT store; artifacts will not be persisted")
+		}
+	}
+	nbtService, err := nbt.Subscribe(ctx, conn, nbtStore, remote, res.CacheStats)
 	if err != nil {
 		return nil, err
 	}
-	res.onShutdown(cleanup)
+	res.onShutdown(nbtService.Cleanup)
 	if _, err := conn.Subscribe("clients", res.handleClients); err != nil {
 		return nil, err
 	}
+	if err := status.Subscribe(ctx, conn, status.Sources{
+		Clients:       res.connectedClients,
+		Caches:        res.CacheStats,
+		InFlight:      nbtService.InFlight,
+		SlowestBuilds: nbtService.SlowestBuilds,
+	}); err != nil {
+		return nil, err
+	}
 
 	// Wait until all subscriptions have been processed by the server...
 	if err := conn.Flush(); err != nil {
 		return nil, err
 	}
 
-	if opts.InactivityTimeout > 0 {
-		sysConn, err := nats.Connect(clientURL, nats.Name("server-local-admin"), nats.UserInfo(sysUser, noPassword), nats.InProcessServer(server))
-		if err != nil {
-			return nil, err
-		}
+	// Connected clients are tracked for reporting, and for automatic shutdown on
+	// inactivity if enabled.
+	sysConn, err := nats.Connect(inProcessURL, nats.Name("server-local-admin"), nats.UserInfo(sysUser, token), nats.InProcessServer(server))
+	if err != nil {
+		return nil, err
+	}
 
-		res.inactivityTimeout = opts.InactivityTimeout
-		res.clients = make(map[uint64]string)
-		if _, err := sysConn.Subscribe(fmt.Sprintf("$SYS.ACCOUNT.%s.CONNECT", userAccount.Name), res.handleClientConnect); err != nil {
-			return nil, err
-		}
-		if _, err := sysConn.Subscribe(fmt.Sprintf("$SYS.ACCOUNT.%s.DISCONNECT", userAccount.Name), res.handleClientDisconnect); err != nil {
-			return nil, err
-		}
+	res.inactivityTimeout = opts.InactivityTimeout
+	res.clients = make(map[uint64]string)
+	if _, err := sysConn.Subscribe(fmt.Sprintf("$SYS.ACCOUNT.%s.CONNECT", userAccount.Name), res.handleClientConnect); err != nil {
+		return nil, err
+	}
+	if _, err := sysConn.Subscribe(fmt.Sprintf("$SYS.ACCOUNT.%s.DISCONNECT", userAccount.Name), res.handleClientDisconnect); err != nil {
+		return nil, err
+	}
 
-		// Wait until all subscriptions have been processed by the server...
-		if err := sysConn.Flush(); err != nil {
-			return nil, err
-		}
+	// Wait until all subscriptions have been processed by the server...
+	if err := sysConn.Flush(); err != nil {
+		return nil, err
+	}
 
+	if res.inactivityTimeout > 0 {
 		// We don't have any (external) client just yet (we've not yet advertised our URL!), so we can start the inactivity
 		// timer right away.
 		res.startShutdownTimer()
@@ -213,9 +313,9 @@ func (s *Server) onShutdown(cb func(context.Context) error) {
 // Connect returns a client using the in-process connection to the server.
 func (s *Server) Connect() (*client.Client, error) {
 	conn, err := nats.Connect(
-		s.clientURL,
+		inProcessURL,
 		nats.Name("local-connect"),
-		nats.UserInfo(client.Username, client.NoPassword),
+		nats.UserInfo(client.Username, s.token),
 		nats.InProcessServer(s.server),
 	)
 	if err != nil {
@@ -257,6 +357,17 @@ func (s *Server) handleClients(msg *nats.Msg) {
 	msg.Respond(data)
 }
 
+func (s *Server) connectedClients() []status.Client {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+
+	res := make([]status.Client, 0, len(s.clients))
+	for id, name := range s.clients {
+		res = append(res, status.Client{ID: id, Name: name})
+	}
+	return res
+}
+
 func (s *Server) handleClientConnect(msg *nats.Msg) {
 	defer msg.Ack()
 
@@ -301,9 +412,12 @@ func (s *Server) handleClientDisconnect(msg *nats.Msg) {
 	s.clientsMu.Lock()
 	defer s.clientsMu.Unlock()
 	delete(s.clients, event.Client.ID)
+	if s.builds != nil {
+		s.builds.Forget(event.Client.ID)
+	}
 	s.log.Trace().Uint64("client.id", event.Client.ID).Str("client.name", event.Client.Name).Str("reason", event.Reason).Msg("NATS client disconnected")
 
-	if len(s.clients) == 0 && s.shutdownTimer == nil {
+	if len(s.clients) == 0 && s.shutdownTimer == nil && s.inactivityTimeout > 0 {
 		s.log.Trace().Msg("Last client disconnected, initiating shutdown timer...")
 		s.startShutdownTimer()
 	}
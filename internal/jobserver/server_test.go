@@ -0,0 +1,187 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package jobserver_test
+
+import (
+	"context"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/jobserver"
+	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/DataDog/orchestrion/internal/jobserver/nbt"
+	"github.com/DataDog/orchestrion/internal/jobserver/status"
+	"github.com/DataDog/orchestrion/internal/version"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListen(t *testing.T) {
+	for name, opts := range map[string]*jobserver.Options{
+		"tcp":  {},
+		"unix": {UnixSocket: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if opts.UnixSocket && runtime.GOOS == "windows" {
+				t.Skip("Unix domain socket permissions are not enforced on Windows")
+			}
+
+			ctx := context.Background()
+			server, err := jobserver.New(ctx, opts)
+			require.NoError(t, err)
+			defer server.Shutdown()
+
+			serverURL, err := url.Parse(server.ClientURL())
+			require.NoError(t, err)
+			require.NotNil(t, serverURL.User)
+			token, hasToken := serverURL.User.Password()
+			require.True(t, hasToken)
+			require.NotEmpty(t, token)
+
+			if opts.UnixSocket {
+				assert.Equal(t, "unix", serverURL.Scheme)
+				socket := filepath.FromSlash(serverURL.Path)
+				stat, err := os.Stat(filepath.Dir(socket))
+				require.NoError(t, err)
+				assert.Equal(t, os.FileMode(0o700), stat.Mode().Perm())
+				stat, err = os.Stat(socket)
+				require.NoError(t, err)
+				assert.Equal(t, os.FileMode(0o600), stat.Mode().Perm())
+			}
+
+			// Connecting with the server's URL succeeds...
+			c, err := client.Connect(server.ClientURL())
+			require.NoError(t, err)
+			defer c.Close()
+			res, err := client.Request(ctx, c, status.Request{})
+			require.NoError(t, err)
+			assert.Equal(t, os.Getpid(), res.PID)
+
+			// ... but not without the token!
+			serverURL.User = url.UserPassword(client.Username, "not-the-token")
+			_, err = client.Connect(serverURL.String())
+			require.Error(t, err)
+			serverURL.User = nil
+			_, err = client.Connect(serverURL.String())
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestDaemon(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The daemon job server is not supported on Windows")
+	}
+
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	require.NoError(t, os.MkdirAll(client.DaemonDir(), 0o700))
+
+	_, _, err := client.ConnectDaemon()
+	require.ErrorIs(t, err, client.ErrNoServerAvailable)
+
+	ctx := context.Background()
+	server, err := jobserver.New(ctx, &jobserver.Options{UnixSocket: true, SocketPath: client.DaemonSocket(), Daemon: true})
+	require.NoError(t, err)
+	defer server.Shutdown()
+
+	serverURL, err := url.Parse(server.ClientURL())
+	require.NoError(t, err)
+	assert.Equal(t, client.DaemonSocket(), filepath.FromSlash(serverURL.Path))
+
+	// A daemon running a different version is not used...
+	require.NoError(t, client.WriteDaemonInfo(&client.DaemonInfo{URL: server.ClientURL(), Version: "v0.0.0-other", PID: os.Getpid()}))
+	_, info, err := client.ConnectDaemon()
+	require.ErrorIs(t, err, client.ErrDaemonVersionMismatch)
+	assert.Equal(t, "v0.0.0-other", info.Version)
+
+	// ... but one running the same version is.
+	require.NoError(t, client.WriteDaemonInfo(&client.DaemonInfo{URL: server.ClientURL(), Version: version.Tag(), PID: os.Getpid()}))
+	stat, err := os.Stat(client.DaemonInfoFile())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), stat.Mode().Perm())
+	c, _, err := client.ConnectDaemon()
+	require.NoError(t, err)
+	defer c.Close()
+	res, err := client.Request(ctx, c, status.Request{})
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), res.PID)
+
+	// The daemon shuts down when requested to.
+	_, err = client.Request(ctx, c, jobserver.ShutdownRequest{})
+	require.NoError(t, err)
+	server.WaitForShutdown()
+	_, err = os.Stat(client.DaemonSocket())
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestDaemonBuilds(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The daemon job server is not supported on Windows")
+	}
+
+	tmp := t.TempDir()
+	modA, modB := filepath.Join(tmp, "a"), filepath.Join(tmp, "b")
+	for _, dir := range []string{modA, modB} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module "+filepath.Base(dir)+"\n"), 0o644))
+	}
+
+	ctx := context.Background()
+	server, err := jobserver.New(ctx, &jobserver.Options{Daemon: true})
+	require.NoError(t, err)
+	defer server.Shutdown()
+
+	// clients are connected on behalf of a build of the module in each directory.
+	clients := make(map[string]*client.Client)
+	for _, dir := range []string{modA, modB} {
+		conn, err := nats.Connect(server.ClientURL())
+		require.NoError(t, err)
+		defer conn.Close()
+		c := client.New(conn)
+		require.NoError(t, client.RegisterBuild(ctx, c, common.Build{Dir: dir, PID: os.Getpid(), Env: []string{"GOOS=linux"}}))
+		clients[dir] = c
+	}
+
+	// compile simulates a compile task for the main package of the module in
+	// dir, and returns the content of the archive it produced or re-used.
+	compile := func(t *testing.T, dir string, buildID string) string {
+		t.Helper()
+		start, err := client.Request(ctx, clients[dir], nbt.StartRequest{ImportPath: "main", BuildID: buildID})
+		require.NoError(t, err)
+		if start.FinishToken == "" {
+			content, err := os.ReadFile(start.Files[nbt.LabelArchive])
+			require.NoError(t, err)
+			return string(content)
+		}
+
+		archive := filepath.Join(t.TempDir(), "_pkg_.a")
+		content := dir + "@" + buildID
+		require.NoError(t, os.WriteFile(archive, []byte(content), 0o644))
+		_, err = client.Request(ctx, clients[dir], nbt.FinishRequest{
+			ImportPath:  "main",
+			BuildID:     buildID,
+			FinishToken: start.FinishToken,
+			Files:       map[nbt.Label]string{nbt.LabelArchive: archive},
+		})
+		require.NoError(t, err)
+		return content
+	}
+
+	assert.Equal(t, modA+"@v1", compile(t, modA, "v1"))
+	// A subsequent build after a source change...
+	assert.Equal(t, modA+"@v2", compile(t, modA, "v2"))
+	// ... a build of another module with its own main package...
+	assert.Equal(t, modB+"@v1", compile(t, modB, "v1"))
+	// ... and re-builds of unchanged packages re-use the artifacts of the matching build.
+	assert.Equal(t, modA+"@v1", compile(t, modA, "v1"))
+	assert.Equal(t, modB+"@v1", compile(t, modB, "v1"))
+}
@@ -0,0 +1,53 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package jobserver
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+)
+
+const (
+	shutdownSubject = "server.shutdown"
+
+	// shutdownDelay leaves time for the response to a [ShutdownRequest] to be
+	// delivered before the server stops accepting connections.
+	shutdownDelay = 100 * time.Millisecond
+)
+
+type (
+	// ShutdownRequest asks a daemon job server (see [Options.Daemon]) to shut
+	// down, for example so that it can be replaced by a different version.
+	ShutdownRequest struct{}
+	// ShutdownResponse acknowledges a [ShutdownRequest].
+	ShutdownResponse struct {
+		// PID is the process ID of the job server that is shutting down.
+		PID int `json:"pid"`
+	}
+)
+
+func (ShutdownRequest) Subject() string                  { return shutdownSubject }
+func (ShutdownRequest) ResponseIs(*ShutdownResponse)     {}
+func (ShutdownRequest) ForeachSpanTag(func(string, any)) {}
+
+func (s *Server) subscribeShutdown(ctx context.Context, conn *nats.Conn) error {
+	_, err := conn.Subscribe(shutdownSubject, common.HandleRequest(
+		zerolog.Ctx(ctx).With().Str("nats.subject", shutdownSubject).Logger().WithContext(ctx),
+		s.handleShutdown,
+	))
+	return err
+}
+
+func (s *Server) handleShutdown(ctx context.Context, _ ShutdownRequest) (*ShutdownResponse, error) {
+	zerolog.Ctx(ctx).Info().Msg("Shutdown requested by a client")
+	time.AfterFunc(shutdownDelay, s.Shutdown)
+	return &ShutdownResponse{PID: os.Getpid()}, nil
+}
@@ -0,0 +1,237 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package status implements the job server's observability service, which
+// reports live statistics about the builds being served, and collects timing
+// information reported by clients.
+package status
+
+import (
+	"cmp"
+	"context"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/jobserver/common"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+)
+
+const (
+	subjectPrefix = "status."
+
+	getSubject   = subjectPrefix + "get"
+	weaveSubject = subjectPrefix + "weave"
+
+	// SlowestCount is the number of entries retained in lists of slowest
+	// packages.
+	SlowestCount = 10
+)
+
+type (
+	// Request is a request for the job server's current [Response].
+	Request struct{}
+
+	// Response describes the current state of the job server.
+	Response struct {
+		// PID is the process ID of the job server.
+		PID int `json:"pid"`
+		// StartedAt is the time at which the job server was started.
+		StartedAt time.Time `json:"startedAt"`
+		// Clients is the list of currently connected clients.
+		Clients []Client `json:"clients"`
+		// Caches holds the statistics of each service's cache, by service name.
+		Caches map[string]Cache `json:"caches"`
+		// InFlight is the list of compilation tasks currently in progress.
+		InFlight []Build `json:"inFlight"`
+		// SlowestBuilds is the list of the slowest completed compilation tasks.
+		SlowestBuilds []Timing `json:"slowestBuilds"`
+		// Weaves summarizes the time spent weaving packages.
+		Weaves Weaves `json:"weaves"`
+	}
+
+	// Client is a client connected to the job server.
+	Client struct {
+		ID   uint64 `json:"id"`
+		Name string `json:"name"`
+	}
+
+	// Cache is a summary of a cache's usage.
+	Cache struct {
+		Hits  uint64 `json:"hits"`
+		Count uint64 `json:"count"`
+	}
+
+	// Build is a compilation task that is in progress.
+	Build struct {
+		ImportPath string    `json:"importPath"`
+		Since      time.Time `json:"since"`
+	}
+
+	// Timing is the time spent processing a given package.
+	Timing struct {
+		ImportPath string        `json:"importPath"`
+		Duration   time.Duration `json:"duration"`
+	}
+
+	// Weaves summarizes the time spent weaving packages, as reported by clients
+	// using [WeaveReport].
+	Weaves struct {
+		// Count is the number of packages woven.
+		Count uint64 `json:"count"`
+		// Total is the cumulative time spent weaving packages.
+		Total time.Duration `json:"total"`
+		// Slowest is the list of the packages that took the longest to weave.
+		Slowest []Timing `json:"slowest"`
+	}
+)
+
+func (Request) Subject() string                  { return getSubject }
+func (Request) ResponseIs(*Response)             {}
+func (Request) ForeachSpanTag(func(string, any)) {}
+
+// HitRate returns the ratio of cache accesses that resulted in a hit.
+func (c Cache) HitRate() float64 {
+	if c.Count == 0 {
+		return 0
+	}
+	return float64(c.Hits) / float64(c.Count)
+}
+
+type (
+	// WeaveReport informs the job server about the time spent weaving a package.
+	WeaveReport struct {
+		ImportPath string        `json:"importPath"`
+		Duration   time.Duration `json:"duration"`
+	}
+	WeaveReportResponse struct {
+		/* unused */
+	}
+)
+
+func (WeaveReport) Subject() string                 { return weaveSubject }
+func (WeaveReport) ResponseIs(*WeaveReportResponse) {}
+func (r WeaveReport) ForeachSpanTag(set func(key string, value any)) {
+	set("request.importPath", r.ImportPath)
+}
+
+// Sources provides the information reported by the status service that is
+// owned by other components of the job server.
+type Sources struct {
+	// Clients returns the list of currently connected clients.
+	Clients func() []Client
+	// Caches holds the job server's cache statistics, broken down by service.
+	Caches *common.CacheStats
+	// InFlight returns the list of compilation tasks currently in progress.
+	InFlight func() []Build
+	// SlowestBuilds returns the slowest completed compilation tasks.
+	SlowestBuilds func() []Timing
+}
+
+type service struct {
+	sources   Sources
+	startedAt time.Time
+
+	mu      sync.Mutex // Guards weaves
+	weaves  Weaves
+	slowest Slowest
+}
+
+// Subscribe registers the status service on the provided connection.
+func Subscribe(ctx context.Context, conn *nats.Conn, sources Sources) error {
+	s := &service{sources: sources, startedAt: time.Now()}
+
+	_, err := conn.Subscribe(getSubject, common.HandleRequest(
+		zerolog.Ctx(ctx).With().Str("nats.subject", getSubject).Logger().WithContext(ctx),
+		s.get,
+	))
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Subscribe(weaveSubject, common.HandleRequest(
+		zerolog.Ctx(ctx).With().Str("nats.subject", weaveSubject).Logger().WithContext(ctx),
+		s.weave,
+	))
+	return err
+}
+
+func (s *service) get(context.Context, Request) (*Response, error) {
+	res := &Response{
+		PID:       os.Getpid(),
+		StartedAt: s.startedAt,
+		Caches:    make(map[string]Cache),
+	}
+
+	if s.sources.Clients != nil {
+		res.Clients = s.sources.Clients()
+		sort.Slice(res.Clients, func(i, j int) bool { return res.Clients[i].ID < res.Clients[j].ID })
+	}
+	if s.sources.Caches != nil {
+		for name, stats := range s.sources.Caches.Breakdown() {
+			res.Caches[name] = Cache{Hits: stats.Hits(), Count: stats.Count()}
+		}
+	}
+	if s.sources.InFlight != nil {
+		res.InFlight = s.sources.InFlight()
+		sort.Slice(res.InFlight, func(i, j int) bool { return res.InFlight[i].Since.Before(res.InFlight[j].Since) })
+	}
+	if s.sources.SlowestBuilds != nil {
+		res.SlowestBuilds = s.sources.SlowestBuilds()
+	}
+
+	s.mu.Lock()
+	res.Weaves = s.weaves
+	s.mu.Unlock()
+	res.Weaves.Slowest = s.slowest.List()
+
+	return res, nil
+}
+
+func (s *service) weave(_ context.Context, req WeaveReport) (*WeaveReportResponse, error) {
+	s.mu.Lock()
+	s.weaves.Count++
+	s.weaves.Total += req.Duration
+	s.mu.Unlock()
+
+	s.slowest.Add(Timing(req))
+
+	return &WeaveReportResponse{}, nil
+}
+
+// Slowest retains the [SlowestCount] slowest [Timing] values it is given. The
+// zero value is ready to use.
+type Slowest struct {
+	mu    sync.Mutex
+	items []Timing
+}
+
+// Add records a new [Timing] value.
+func (s *Slowest) Add(timing Timing) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx, _ := slices.BinarySearchFunc(s.items, timing, func(item Timing, target Timing) int {
+		// Sorted in descending order of duration.
+		return cmp.Compare(target.Duration, item.Duration)
+	})
+	if idx >= SlowestCount {
+		return
+	}
+	s.items = slices.Insert(s.items, idx, timing)
+	if len(s.items) > SlowestCount {
+		s.items = s.items[:SlowestCount]
+	}
+}
+
+// List returns the retained [Timing] values, slowest first.
+func (s *Slowest) List() []Timing {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.items)
+}
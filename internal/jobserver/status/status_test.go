@@ -0,0 +1,90 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package status_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/jobserver"
+	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/jobserver/nbt"
+	"github.com/DataDog/orchestrion/internal/jobserver/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test(t *testing.T) {
+	ctx := context.Background()
+
+	server, err := jobserver.New(ctx, nil)
+	require.NoError(t, err)
+	defer server.Shutdown()
+
+	conn, err := server.Connect()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	for i, duration := range []time.Duration{2 * time.Second, 3 * time.Second, time.Second} {
+		_, err := client.Request(ctx, conn, status.WeaveReport{ImportPath: fmt.Sprintf("example.com/pkg%d", i), Duration: duration})
+		require.NoError(t, err)
+	}
+
+	// One completed build, and one in-flight build...
+	start, err := client.Request(ctx, conn, nbt.StartRequest{ImportPath: "example.com/done", BuildID: "done"})
+	require.NoError(t, err)
+	archive := filepath.Join(t.TempDir(), string(nbt.LabelArchive))
+	require.NoError(t, os.WriteFile(archive, []byte("archive"), 0o644))
+	_, err = client.Request(ctx, conn, nbt.FinishRequest{ImportPath: "example.com/done", BuildID: "done", FinishToken: start.FinishToken, Files: map[nbt.Label]string{nbt.LabelArchive: archive}})
+	require.NoError(t, err)
+	_, err = client.Request(ctx, conn, nbt.StartRequest{ImportPath: "example.com/pending", BuildID: "pending"})
+	require.NoError(t, err)
+
+	var res *status.Response
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		res, err = client.Request(ctx, conn, status.Request{})
+		require.NoError(c, err)
+		names := make([]string, 0, len(res.Clients))
+		for _, cl := range res.Clients {
+			names = append(names, cl.Name)
+		}
+		assert.Contains(c, names, "local-connect")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, os.Getpid(), res.PID)
+	assert.Equal(t, status.Weaves{
+		Count: 3,
+		Total: 6 * time.Second,
+		Slowest: []status.Timing{
+			{ImportPath: "example.com/pkg1", Duration: 3 * time.Second},
+			{ImportPath: "example.com/pkg0", Duration: 2 * time.Second},
+			{ImportPath: "example.com/pkg2", Duration: time.Second},
+		},
+	}, res.Weaves)
+
+	require.Len(t, res.InFlight, 1)
+	assert.Equal(t, "example.com/pending", res.InFlight[0].ImportPath)
+	require.Len(t, res.SlowestBuilds, 1)
+	assert.Equal(t, "example.com/done", res.SlowestBuilds[0].ImportPath)
+	assert.Equal(t, status.Cache{Hits: 0, Count: 2}, res.Caches["nbt"])
+}
+
+func TestSlowest(t *testing.T) {
+	var slowest status.Slowest
+	for i := range 2 * status.SlowestCount {
+		slowest.Add(status.Timing{ImportPath: fmt.Sprintf("pkg%d", i), Duration: time.Duration(i) * time.Millisecond})
+	}
+
+	list := slowest.List()
+	require.Len(t, list, status.SlowestCount)
+	for i, timing := range list {
+		assert.Equal(t, time.Duration(2*status.SlowestCount-1-i)*time.Millisecond, timing.Duration)
+	}
+}
@@ -0,0 +1,191 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package overlay
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/DataDog/orchestrion/internal/injector/typed"
+	"github.com/rs/zerolog"
+	"golang.org/x/tools/go/packages"
+)
+
+const (
+	// linkDepsFilename is the name of the file added to main packages to ensure
+	// relocation targets introduced by weaving are linked.
+	linkDepsFilename = "orchestrion_linkdeps.go"
+	// linkDepsTestFilename is the name of the file added to tested packages to
+	// ensure relocation targets introduced by weaving are linked into the test
+	// binary.
+	linkDepsTestFilename = "orchestrion_linkdeps_test.go"
+)
+
+// ensureResolvable makes sure the provided packages can be resolved from the
+// build's module graph. If some cannot, they are added to an overlaid copy of
+// the main module's `go.mod` and `go.sum` files, using `go get`.
+func (w *weaver) ensureResolvable(ctx context.Context, paths []string) error {
+	log := zerolog.Ctx(ctx)
+
+	pkgs, err := packages.Load(
+		&packages.Config{
+			Context:    ctx,
+			Dir:        w.wd,
+			Mode:       packages.NeedName | packages.NeedModule,
+			BuildFlags: w.buildFlags,
+			Overlay:    w.modOverlay,
+		},
+		paths...,
+	)
+	if err != nil {
+		return fmt.Errorf("resolving %s: %w", strings.Join(paths, " "), err)
+	}
+
+	var missing []string
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			missing = append(missing, pkg.PkgPath)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	slices.Sort(missing)
+
+	if w.goMod == "" {
+		return fmt.Errorf("woven code depends on packages that are not provided by any workspace module: %s (run `orchestrion pin` to add them)", strings.Join(missing, ", "))
+	}
+
+	log.Info().Strs("packages", missing).Msg("Adding synthetic dependencies to the overlaid go.mod file")
+	modDir := filepath.Join(w.overlay.dir, "mod")
+	if err := os.MkdirAll(modDir, 0o755); err != nil {
+		return err
+	}
+
+	goSum := strings.TrimSuffix(w.goMod, ".mod") + ".sum"
+	tmpMod := filepath.Join(modDir, "go.mod")
+	tmpSum := filepath.Join(modDir, "go.sum")
+	for src, dst := range map[string]string{w.goMod: tmpMod, goSum: tmpSum} {
+		content, err := w.modFileContent(src)
+		if errors.Is(err, fs.ErrNotExist) && src == goSum {
+			content = nil
+		} else if err != nil {
+			return err
+		}
+		if err := os.WriteFile(dst, content, 0o644); err != nil {
+			return err
+		}
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", append([]string{"get", "-modfile=" + tmpMod}, missing...)...)
+	cmd.Dir = w.wd
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local", "GOFLAGS=-mod=mod")
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("adding synthetic dependencies (%s): %w\n%s", strings.Join(missing, ", "), err, stderr.String())
+	}
+
+	for original, path := range map[string]string{w.goMod: tmpMod, goSum: tmpSum} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		w.modOverlay[original] = content
+		w.overlay.add(original, path)
+	}
+	return nil
+}
+
+// modFileContent returns the current content of the designated file, taking
+// into account previous changes made to it in the overlay.
+func (w *weaver) modFileContent(path string) ([]byte, error) {
+	if content, found := w.modOverlay[path]; found {
+		return content, nil
+	}
+	return os.ReadFile(path)
+}
+
+// addLinkDeps adds a file importing all relocation targets introduced by
+// weaving to the main packages (or test packages) of the build, so that they
+// are linked into the resulting binaries.
+func (w *weaver) addLinkDeps(roots []*packages.Package) error {
+	var linkDeps []string
+	for path, kind := range w.references {
+		if kind == typed.RelocationTarget && path != "unsafe" {
+			linkDeps = append(linkDeps, path)
+		}
+	}
+	if len(linkDeps) == 0 {
+		return nil
+	}
+	slices.Sort(linkDeps)
+
+	for _, pkg := range roots {
+		if len(pkg.GoFiles) == 0 {
+			continue
+		}
+		var filename string
+		switch {
+		case pkg.Name == "main" && strings.HasSuffix(pkg.PkgPath, ".test"):
+			// The generated test main package cannot be overlaid; the tested package's test files are instead.
+			continue
+		case strings.HasSuffix(pkg.ID, ".test]"):
+			if slices.ContainsFunc(roots, func(other *packages.Package) bool {
+				return other != pkg && strings.HasSuffix(other.ID, ".test]") && other.PkgPath+"_test" == pkg.PkgPath
+			}) {
+				// The test binary also contains the internal test package, which gets the file.
+				continue
+			}
+			filename = linkDepsTestFilename
+		case pkg.Name == "main" && pkg.ID == pkg.PkgPath:
+			filename = linkDepsFilename
+		default:
+			continue
+		}
+
+		original := filepath.Join(filepath.Dir(pkg.GoFiles[0]), filename)
+		if w.overlay.has(original) {
+			continue
+		}
+		if err := w.writeLinkDeps(original, pkg.Name, linkDeps); err != nil {
+			return fmt.Errorf("adding %s to %s: %w", filename, pkg.ID, err)
+		}
+	}
+	return nil
+}
+
+// writeLinkDeps writes a file declaring package name and importing all
+// provided packages, and registers it in the overlay at original.
+func (w *weaver) writeLinkDeps(original string, name string, imports []string) error {
+	var src bytes.Buffer
+	_, _ = fmt.Fprintf(&src, "// Code generated by orchestrion; DO NOT EDIT.\n\npackage %s\n\nimport (\n", name)
+	for _, path := range imports {
+		_, _ = fmt.Fprintf(&src, "\t_ %q\n", path)
+	}
+	_, _ = src.WriteString(")\n")
+
+	sum := sha256.Sum256([]byte(original))
+	path := filepath.Join(w.overlay.dir, "linkdeps", hex.EncodeToString(sum[:8]), filepath.Base(original))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, src.Bytes(), 0o644); err != nil {
+		return err
+	}
+	w.overlay.add(original, path)
+	return nil
+}
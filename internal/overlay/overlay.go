@@ -0,0 +1,282 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package overlay implements weaving packages ahead of a go command's
+// execution, producing a file suitable for use with the go command's `-overlay`
+// flag. This is an alternative to weaving during compilation using `-toolexec`,
+// which is not compatible with build drivers that already use `-toolexec`.
+package overlay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goflags"
+)
+
+const (
+	// filename is the name of the overlay file within an [Overlay]'s directory.
+	filename = "overlay.json"
+	// markerFilename is the name of the file that marks a directory passed to
+	// [PrepareDir] as managed by orchestrion, so that its contents can safely be
+	// removed when it is re-used.
+	markerFilename = ".orchestrion-overlay"
+)
+
+// Overlay is a set of woven source files, which replace the original files when
+// the go command is invoked with the `-overlay` flag set to [Overlay.File].
+type Overlay struct {
+	// File is the path to the overlay file, to be passed to the go command's
+	// `-overlay` flag.
+	File string
+
+	dir     string
+	temp    bool // Whether dir is a temporary directory, which is removed by [Overlay.Close]
+	replace map[string]string
+	mu      sync.Mutex
+}
+
+// Prepare weaves the packages targeted by the provided go command arguments
+// (e.g, `build -tags=integration ./...`), including all their dependencies,
+// and returns the resulting [Overlay]. The caller is responsible for calling
+// [Overlay.Close] once the go command has completed.
+func Prepare(ctx context.Context, goArgs []string) (*Overlay, error) {
+	return prepare(ctx, "", goArgs)
+}
+
+// PrepareDir is like [Prepare], but writes the overlay to the designated
+// directory instead of a temporary one, so that it can outlive the current
+// process (e.g, for use by gopls). The directory must either not exist, be
+// empty, or have been prepared by a previous call to PrepareDir, in which case
+// its previous contents are removed. Non-empty directories that were not
+// prepared by orchestrion are never modified.
+func PrepareDir(ctx context.Context, dir string, goArgs []string) (*Overlay, error) {
+	if dir == "" {
+		return nil, errors.New("no directory to prepare an overlay in")
+	}
+	return prepare(ctx, dir, goArgs)
+}
+
+// prepare implements [Prepare] and [PrepareDir]. If dir is blank, a temporary
+// directory is created.
+func prepare(ctx context.Context, dir string, goArgs []string) (_ *Overlay, err error) {
+	span, ctx := tracer.StartSpanFromContext(ctx, "overlay.Prepare",
+		tracer.ResourceName(strings.Join(goArgs, " ")),
+	)
+	defer func() { span.Finish(tracer.WithError(err)) }()
+
+	if len(goArgs) == 0 {
+		return nil, errors.New("no go command to prepare an overlay for")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	flags, err := goflags.ParseCommandFlags(ctx, wd, goArgs)
+	if err != nil {
+		return nil, fmt.Errorf("parsing go command flags: %w", err)
+	}
+	if _, found := flags.Get("-overlay"); found {
+		return nil, errors.New("the -overlay flag cannot be used in overlay mode")
+	}
+
+	if flags.Coverage() {
+		// The go command instruments the overlaid (woven) files for coverage, so code injected by orchestrion would be
+		// counted, and reported line numbers would be those of the woven files.
+		return nil, errors.New("coverage instrumentation (-cover, -covermode, -coverpkg) is not supported in overlay mode; use the default toolexec mode instead")
+	}
+
+	patterns := targetPatterns(goArgs[0], flags.Args)
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, "@") {
+			return nil, fmt.Errorf("package %q: version queries are not supported in overlay mode", pattern)
+		}
+	}
+
+	temp := dir == ""
+	if temp {
+		dir, err = os.MkdirTemp("", "orchestrion-overlay-*")
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if dir, err = filepath.Abs(dir); err != nil {
+			return nil, err
+		}
+		if err := claimDir(dir); err != nil {
+			return nil, err
+		}
+	}
+	o := &Overlay{File: filepath.Join(dir, filename), dir: dir, temp: temp, replace: make(map[string]string)}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, o.Close())
+		}
+	}()
+
+	w, err := newWeaver(ctx, o, wd, flags)
+	if err != nil {
+		return nil, err
+	}
+	// Like the go command, `vet` also checks test files.
+	if err := w.weave(ctx, patterns, goArgs[0] == "test" || goArgs[0] == "vet"); err != nil {
+		return nil, err
+	}
+	span.SetTag("files", len(o.replace))
+
+	if err := o.write(); err != nil {
+		return nil, fmt.Errorf("writing %q: %w", o.File, err)
+	}
+	return o, nil
+}
+
+// Close removes all files created for this overlay. The directory passed to
+// [PrepareDir] itself is retained.
+func (o *Overlay) Close() error {
+	if o.temp {
+		return os.RemoveAll(o.dir)
+	}
+	return clearDir(o.dir)
+}
+
+// claimDir prepares dir to hold an overlay: it is created if it does not exist,
+// and its previous contents are removed if it was already prepared by
+// orchestrion. Any other non-empty directory is rejected. The directory is then
+// marked as managed by orchestrion.
+func claimDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case len(entries) == 0:
+		// Nothing to do, the directory is empty.
+	default:
+		if _, err := os.Stat(filepath.Join(dir, markerFilename)); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("refusing to prepare an overlay in %q: the directory is not empty, and was not created by orchestrion", dir)
+			}
+			return err
+		}
+		if err := clearDir(dir); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(filepath.Join(dir, markerFilename), nil, 0o644)
+}
+
+// clearDir removes the contents of dir, which must have been prepared by
+// [claimDir], except for its marker file.
+func clearDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == markerFilename {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replace returns the woven files that replace original files (or are added
+// to the build), keyed by the path of the original file.
+func (o *Overlay) Replace() map[string]string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return maps.Clone(o.replace)
+}
+
+// Exclude removes the replacements of all files within dir from the overlay
+// and updates [Overlay.File] accordingly. This is used to omit files of the
+// module cache, which recent go toolchains refuse to overlay, when woven code
+// is only inspected (as opposed to built).
+func (o *Overlay) Exclude(dir string) error {
+	o.mu.Lock()
+	prefix := filepath.Clean(dir) + string(filepath.Separator)
+	maps.DeleteFunc(o.replace, func(original string, _ string) bool {
+		return strings.HasPrefix(original, prefix)
+	})
+	o.mu.Unlock()
+
+	return o.write()
+}
+
+// add registers the file at path as a replacement for the original file.
+func (o *Overlay) add(original string, path string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.replace[original] = path
+}
+
+// has returns true if a replacement is registered for the original file.
+func (o *Overlay) has(original string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_, found := o.replace[original]
+	return found
+}
+
+// write writes the overlay file in the format expected by the go command.
+func (o *Overlay) write() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	data, err := json.Marshal(struct{ Replace map[string]string }{o.replace})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(o.File, data, 0o644)
+}
+
+// targetPatterns returns the package patterns targeted by the go command with
+// the provided positional arguments.
+func targetPatterns(command string, args []string) []string {
+	var patterns []string
+	switch command {
+	case "run":
+		// The first argument is the package to run (or a list of .go files), subsequent ones are for the program.
+		for _, arg := range args {
+			if !strings.HasSuffix(arg, ".go") {
+				if len(patterns) == 0 {
+					patterns = append(patterns, arg)
+				}
+				break
+			}
+			patterns = append(patterns, arg)
+		}
+	case "test":
+		// Flags for the test binary may follow the package patterns.
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "-") {
+				break
+			}
+			patterns = append(patterns, arg)
+		}
+	default:
+		patterns = args
+	}
+
+	if len(patterns) == 0 {
+		return []string{"."}
+	}
+	return patterns
+}
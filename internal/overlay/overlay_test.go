@@ -0,0 +1,152 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package overlay
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetPatterns(t *testing.T) {
+	for name, tc := range map[string]struct {
+		command  string
+		args     []string
+		expected []string
+	}{
+		"build-default":  {command: "build", expected: []string{"."}},
+		"build-patterns": {command: "build", args: []string{"./cmd/...", "./internal/..."}, expected: []string{"./cmd/...", "./internal/..."}},
+		"run-package":    {command: "run", args: []string{"./cmd/app", "arg1", "arg2"}, expected: []string{"./cmd/app"}},
+		"run-files":      {command: "run", args: []string{"main.go", "util.go", "arg1"}, expected: []string{"main.go", "util.go"}},
+		"test-flags":     {command: "test", args: []string{"./...", "-run", "TestFoo"}, expected: []string{"./..."}},
+		"test-default":   {command: "test", args: []string{"-run", "TestFoo"}, expected: []string{"."}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, targetPatterns(tc.command, tc.args))
+		})
+	}
+}
+
+func TestExclude(t *testing.T) {
+	dir := t.TempDir()
+	o := &Overlay{
+		File: filepath.Join(dir, filename),
+		dir:  dir,
+		replace: map[string]string{
+			"/app/main.go":                           filepath.Join(dir, "main.go"),
+			"/go/pkg/mod/example.com/lib@v1/lib.go":  filepath.Join(dir, "lib.go"),
+			"/go/pkg/mod-other/example.com/other.go": filepath.Join(dir, "other.go"),
+		},
+	}
+	require.NoError(t, o.Exclude("/go/pkg/mod"))
+
+	expected := map[string]string{
+		"/app/main.go":                           filepath.Join(dir, "main.go"),
+		"/go/pkg/mod-other/example.com/other.go": filepath.Join(dir, "other.go"),
+	}
+	assert.Equal(t, expected, o.Replace())
+
+	data, err := os.ReadFile(o.File)
+	require.NoError(t, err)
+	var file struct{ Replace map[string]string }
+	require.NoError(t, json.Unmarshal(data, &file))
+	assert.Equal(t, expected, file.Replace)
+}
+
+func TestPrepareUnsupported(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "off")
+
+	tmp := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "go.mod"), []byte("module example.com/app\n\ngo 1.23\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644))
+	chdir(t, tmp)
+
+	for name, tc := range map[string]struct {
+		args     []string
+		expected string
+	}{
+		"overlay":       {args: []string{"build", "-overlay=overlay.json", "."}, expected: "the -overlay flag cannot be used in overlay mode"},
+		"cover":         {args: []string{"test", "-cover", "."}, expected: "coverage instrumentation (-cover, -covermode, -coverpkg) is not supported in overlay mode"},
+		"covermode":     {args: []string{"build", "-covermode=atomic", "."}, expected: "coverage instrumentation (-cover, -covermode, -coverpkg) is not supported in overlay mode"},
+		"version-query": {args: []string{"install", "example.com/cmd@v1.2.3"}, expected: "version queries are not supported in overlay mode"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Prepare(context.Background(), tc.args)
+			require.ErrorContains(t, err, tc.expected)
+		})
+	}
+}
+
+// chdir changes the current working directory to dir for the duration of the
+// test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { require.NoError(t, os.Chdir(wd)) })
+}
+
+func TestPrepareDir(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "off")
+
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	app := filepath.Join(tmp, "app")
+	require.NoError(t, os.MkdirAll(app, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(app, "go.mod"), []byte("module example.com/app\n\ngo 1.23\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(app, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644))
+	chdir(t, app)
+	ctx := context.Background()
+
+	t.Run("not-empty", func(t *testing.T) {
+		// The working directory is not empty, and was not created by orchestrion.
+		_, err := PrepareDir(ctx, ".", []string{"build", "."})
+		require.ErrorContains(t, err, "is not empty, and was not created by orchestrion")
+		assert.FileExists(t, filepath.Join(app, "go.mod"))
+		assert.FileExists(t, filepath.Join(app, "main.go"))
+	})
+
+	t.Run("re-use", func(t *testing.T) {
+		dir := filepath.Join(tmp, "overlay")
+		o, err := PrepareDir(ctx, dir, []string{"build", "."})
+		require.NoError(t, err)
+		assert.FileExists(t, o.File)
+		assert.FileExists(t, filepath.Join(dir, markerFilename))
+
+		stale := filepath.Join(dir, "stale.go")
+		require.NoError(t, os.WriteFile(stale, nil, 0o644))
+		o, err = PrepareDir(ctx, dir, []string{"build", "."})
+		require.NoError(t, err)
+		assert.FileExists(t, o.File)
+		assert.NoFileExists(t, stale)
+
+		require.NoError(t, o.Close())
+		assert.NoFileExists(t, o.File)
+		assert.DirExists(t, dir)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		dir := filepath.Join(tmp, "empty")
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		// An invalid configuration causes weaving to fail.
+		config := filepath.Join(app, "orchestrion.yml")
+		require.NoError(t, os.WriteFile(config, []byte("aspects: [{ id: invalid }]\n"), 0o644))
+		defer func() { require.NoError(t, os.Remove(config)) }()
+
+		_, err := PrepareDir(ctx, dir, []string{"build", "."})
+		require.ErrorContains(t, err, "loading injector configuration")
+		assert.DirExists(t, dir)
+		assert.NoFileExists(t, filepath.Join(dir, filename))
+	})
+}
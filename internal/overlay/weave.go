@@ -0,0 +1,369 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package overlay
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	goversion "go/version"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/DataDog/orchestrion/internal/injector"
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/DataDog/orchestrion/internal/injector/typed"
+	"github.com/DataDog/orchestrion/internal/pgo"
+	toolexecaspect "github.com/DataDog/orchestrion/internal/toolexec/aspect"
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/tools/go/packages"
+)
+
+const loadMode = packages.NeedName |
+	packages.NeedFiles |
+	packages.NeedCompiledGoFiles |
+	packages.NeedImports |
+	packages.NeedDeps |
+	packages.NeedExportFile |
+	packages.NeedModule
+
+// weaver weaves all packages of a build into an [Overlay].
+type weaver struct {
+	overlay *Overlay
+	wd      string
+	goMod   string
+	goWork  string
+	// modDir is the root directory of the main module, which is not that of
+	// goMod if the `-modfile` flag is used.
+	modDir     string
+	buildFlags []string
+	// hot contains the functions that are left untouched because the PGO
+	// profile marks them as hot.
+	hot pgo.HotFunctions
+	// target is the platform and build tags the packages are built for.
+	target goenv.Target
+
+	// modOverlay contains the overlaid content of the `go.mod` and `go.sum`
+	// files, if synthetic dependencies had to be added to them.
+	modOverlay map[string][]byte
+
+	// configs caches the aspects loaded from each configuration directory.
+	configs map[string][]*aspect.Aspect
+	// seen contains the IDs of all packages that were already processed.
+	seen map[string]struct{}
+	// pkgPaths contains the import paths of all packages that are part of the build.
+	pkgPaths map[string]struct{}
+	// modules associates the path of all modules that are part of the build to
+	// their selected version.
+	modules map[string]string
+	// references contains all synthetic references introduced by weaving.
+	references map[string]typed.ReferenceKind
+
+	mu sync.Mutex
+}
+
+func newWeaver(ctx context.Context, o *Overlay, wd string, flags goflags.CommandFlags) (*weaver, error) {
+	goWork, err := goenv.GOWORK(wd)
+	if err != nil {
+		return nil, fmt.Errorf("go env GOWORK: %w", err)
+	}
+	goMod, err := goenv.GOMOD(wd)
+	if err != nil && !(errors.Is(err, goenv.ErrNoGoMod) && goWork != "") {
+		return nil, fmt.Errorf("go env GOMOD: %w", err)
+	}
+	var modDir string
+	if goMod != "" {
+		modDir = filepath.Dir(goMod)
+	}
+	if modFile, found := flags.Get("-modfile"); found {
+		goMod = modFile
+		if !filepath.IsAbs(goMod) {
+			goMod = filepath.Join(wd, goMod)
+		}
+	}
+
+	threshold, err := pgo.HotThreshold()
+	if err != nil {
+		return nil, err
+	}
+	hot, err := pgo.FromFlags(ctx, flags, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := goenv.TargetOf(wd, nil, flags.Tags())
+	if err != nil {
+		return nil, err
+	}
+
+	// Dependencies must be loaded without any weaving applied to them.
+	buildFlags := append(flags.Except("-overlay", "-toolexec").Slice(), "-toolexec=")
+	zerolog.Ctx(ctx).Debug().Strs("build-flags", buildFlags).Str("go.mod", goMod).Str("go.work", goWork).Msg("Preparing overlay")
+
+	return &weaver{
+		overlay:    o,
+		wd:         wd,
+		goMod:      goMod,
+		goWork:     goWork,
+		modDir:     modDir,
+		buildFlags: buildFlags,
+		hot:        hot,
+		target:     target,
+		modOverlay: make(map[string][]byte),
+		configs:    make(map[string][]*aspect.Aspect),
+		seen:       make(map[string]struct{}),
+		pkgPaths:   make(map[string]struct{}),
+		modules:    make(map[string]string),
+		references: make(map[string]typed.ReferenceKind),
+	}, nil
+}
+
+// weave weaves all packages matched by the provided patterns and their
+// dependencies, as well as all packages introduced by weaving, then ensures
+// relocation targets introduced by weaving are linked into the final binaries.
+func (w *weaver) weave(ctx context.Context, patterns []string, tests bool) error {
+	roots, err := w.load(ctx, patterns, tests)
+	if err != nil {
+		return err
+	}
+	if err := w.weavePackages(ctx, roots); err != nil {
+		return err
+	}
+
+	// Packages introduced by weaving must themselves be woven, and may introduce further packages.
+	requested := make(map[string]struct{})
+	for {
+		pending := w.pendingReferences(requested)
+		if len(pending) == 0 {
+			break
+		}
+		if err := w.ensureResolvable(ctx, pending); err != nil {
+			return err
+		}
+		pkgs, err := w.load(ctx, pending, false)
+		if err != nil {
+			return err
+		}
+		if err := w.weavePackages(ctx, pkgs); err != nil {
+			return err
+		}
+	}
+
+	return w.addLinkDeps(roots)
+}
+
+// load loads the packages matching the provided patterns, including their
+// dependencies and their export data.
+func (w *weaver) load(ctx context.Context, patterns []string, tests bool) (_ []*packages.Package, err error) {
+	span, ctx := tracer.StartSpanFromContext(ctx, "overlay.load",
+		tracer.ResourceName(strings.Join(patterns, " ")),
+	)
+	defer func() { span.Finish(tracer.WithError(err)) }()
+
+	log := zerolog.Ctx(ctx)
+	pkgs, err := packages.Load(
+		&packages.Config{
+			Context:    ctx,
+			Dir:        w.wd,
+			Mode:       loadMode,
+			Tests:      tests,
+			BuildFlags: w.buildFlags,
+			Overlay:    w.modOverlay,
+			Logf:       func(format string, args ...any) { log.Trace().Str("operation", "packages.Load").Msgf(format, args...) },
+		},
+		patterns...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", strings.Join(patterns, " "), err)
+	}
+	return pkgs, nil
+}
+
+// weavePackages weaves all packages in the provided package graphs that were
+// not processed already.
+func (w *weaver) weavePackages(ctx context.Context, roots []*packages.Package) error {
+	log := zerolog.Ctx(ctx)
+
+	var todo []*packages.Package
+	packages.Visit(roots, nil, func(pkg *packages.Package) {
+		if pkg.Module != nil {
+			w.modules[pkg.Module.Path] = pkg.Module.Version
+		}
+		w.pkgPaths[pkg.PkgPath] = struct{}{}
+
+		if _, seen := w.seen[pkg.ID]; seen {
+			return
+		}
+		w.seen[pkg.ID] = struct{}{}
+
+		for _, err := range pkg.Errors {
+			// Let the go command report errors in its canonical way.
+			log.Debug().Str("package", pkg.ID).Err(err).Msg("Not weaving package with errors")
+			return
+		}
+		todo = append(todo, pkg)
+	})
+
+	// Configuration is loaded up-front, as packages from the same module share it.
+	for _, pkg := range todo {
+		dir := w.configDir(pkg)
+		if _, loaded := w.configs[dir]; loaded {
+			continue
+		}
+		cfg, err := config.NewLoader(nil, dir, false).WithTarget(w.target).Load(ctx)
+		if err != nil {
+			return fmt.Errorf("loading injector configuration from %q: %w", dir, err)
+		}
+		w.configs[dir] = aspect.FilterTarget(ctx, w.target, cfg.Aspects())
+	}
+
+	var group errgroup.Group
+	group.SetLimit(runtime.GOMAXPROCS(0))
+	for _, pkg := range todo {
+		group.Go(func() error {
+			if err := w.weavePackage(ctx, pkg); err != nil {
+				return fmt.Errorf("weaving %s: %w", pkg.ID, err)
+			}
+			return nil
+		})
+	}
+	return group.Wait()
+}
+
+// weavePackage weaves a single package, and registers the modified files in
+// the overlay.
+func (w *weaver) weavePackage(ctx context.Context, pkg *packages.Package) error {
+	log := zerolog.Ctx(ctx).With().Str("package", pkg.ID).Logger()
+
+	if pkg.Name == "main" && strings.HasSuffix(pkg.PkgPath, ".test") {
+		// The test main package is generated by the go command, so it cannot be overlaid.
+		log.Debug().Msg("Not weaving generated test main package")
+		return nil
+	}
+	if len(pkg.GoFiles) == 0 {
+		return nil
+	}
+	if slices.ContainsFunc(pkg.CompiledGoFiles, func(file string) bool { return !slices.Contains(pkg.GoFiles, file) }) {
+		// The go command compiles files generated by cgo, which cannot be overlaid.
+		log.Debug().Msg("Not weaving package using cgo")
+		return nil
+	}
+
+	aspects, canWeave := toolexecaspect.SpecialCaseAspects(ctx, pkg.PkgPath, w.configs[w.configDir(pkg)])
+	if !canWeave {
+		return nil
+	}
+	// The aspects of each configuration directory are shared by all its packages.
+	aspects = aspect.FilterRequirements(ctx, w.modules, slices.Clone(aspects))
+
+	sum := sha256.Sum256([]byte(pkg.ID))
+	outDir := filepath.Join(w.overlay.dir, "src", hex.EncodeToString(sum[:8]))
+	inj := injector.Injector{
+		ImportPath: pkg.PkgPath,
+		Name:       pkg.Name,
+		ImportMap:  make(map[string]string, len(pkg.Imports)),
+		Lookup:     lookup(pkg),
+		RootConfig: toolexecaspect.RootConfig,
+		ModifiedFile: func(file string) string {
+			return filepath.Join(outDir, filepath.Base(file))
+		},
+	}
+	if len(w.hot) != 0 {
+		inj.SkipFunction = w.hot.Contains
+	}
+	if pkg.Module != nil && pkg.Module.GoVersion != "" {
+		inj.GoVersion = "go" + pkg.Module.GoVersion
+	}
+	for path, dep := range pkg.Imports {
+		inj.ImportMap[path] = dep.ExportFile
+	}
+
+	results, goLang, err := inj.InjectFiles(ctx, pkg.GoFiles, aspects)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return nil
+	}
+	if inj.GoVersion != "" && !goLang.IsAny() && goversion.Compare(goversion.Lang(inj.GoVersion), goLang.String()) < 0 {
+		// In toolexec mode, the language version of the compilation is raised; this cannot be done with an overlay.
+		log.Warn().Str("go.version", inj.GoVersion).Stringer("required", goLang).Msg("Woven code requires a newer Go language version than the package's module declares")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for original, res := range results {
+		if w.overlay.has(original) {
+			// The file is shared by several variants of the same package (e.g, with or without tests).
+			continue
+		}
+		log.Debug().Str("original", original).Str("updated", res.Filename).Msg("Overlaying modified source file")
+		w.overlay.add(original, res.Filename)
+		for path, kind := range res.References.Map() {
+			// Import statements supersede relocation targets, as they already ensure the package is linked.
+			w.references[path] = w.references[path] || kind
+		}
+	}
+	return nil
+}
+
+// configDir returns the directory from which the configuration applicable to
+// the provided package is loaded: that of the main module it belongs to; or
+// that of the build's main module (or workspace) for dependencies.
+func (w *weaver) configDir(pkg *packages.Package) string {
+	if pkg.Module != nil && pkg.Module.Main && pkg.Module.Dir != "" {
+		return pkg.Module.Dir
+	}
+	if w.modDir != "" {
+		return w.modDir
+	}
+	return filepath.Dir(w.goWork)
+}
+
+// pendingReferences returns the synthetic references that are not part of the
+// build yet, and were not requested before. They are marked as requested.
+func (w *weaver) pendingReferences(requested map[string]struct{}) []string {
+	var pending []string
+	for path := range w.references {
+		if path == "unsafe" {
+			continue
+		}
+		if _, found := w.pkgPaths[path]; found {
+			continue
+		}
+		if _, found := requested[path]; found {
+			continue
+		}
+		requested[path] = struct{}{}
+		pending = append(pending, path)
+	}
+	slices.Sort(pending)
+	return pending
+}
+
+// lookup returns an [importer.Lookup] function that resolves the export data
+// of the direct dependencies of pkg.
+func lookup(pkg *packages.Package) func(string) (io.ReadCloser, error) {
+	return func(path string) (io.ReadCloser, error) {
+		dep, found := pkg.Imports[path]
+		if !found || dep.ExportFile == "" {
+			return nil, fmt.Errorf("no export data found for %q", path)
+		}
+		return os.Open(dep.ExportFile)
+	}
+}
@@ -0,0 +1,99 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package overlay
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeaveTracerInternal(t *testing.T) {
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOWORK", "off")
+	t.Setenv("GOPROXY", "off")
+
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	for name, content := range map[string]string{
+		"go.mod":                  "module example.com/app\n\ngo 1.23\n\nrequire github.com/DataDog/dd-trace-go/v2 v2.0.0\n\nreplace github.com/DataDog/dd-trace-go/v2 => ./tracer\n",
+		"main.go":                 "package main\n\nimport (\n\t\"example.com/app/lib\"\n\t\"github.com/DataDog/dd-trace-go/v2/ddtrace\"\n)\n\nfunc main() {\n\tddtrace.Start()\n\tlib.Run()\n}\n",
+		"lib/run.go":              "package lib\n\nfunc Run() {\n\tprintln(\"run\")\n}\n",
+		"tracer/go.mod":           "module github.com/DataDog/dd-trace-go/v2\n\ngo 1.23\n",
+		"tracer/ddtrace/start.go": "package ddtrace\n\nfunc Start() {\n\tprintln(\"start\")\n}\n",
+		"orchestrion.yml": `aspects:
+  - id: internal
+    tracer-internal: true
+    join-point: { function-body: { function: [{ name: Start }] } }
+    advice: [{ prepend-statements: { template: println("internal") } }]
+  - id: normal
+    join-point: { function-body: { function: [{ name: Run }] } }
+    advice: [{ prepend-statements: { template: println("normal") } }]
+`,
+	} {
+		filename := filepath.Join(tmp, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0o755))
+		require.NoError(t, os.WriteFile(filename, []byte(content), 0o644))
+	}
+
+	chdir(t, tmp)
+
+	// Tracer-internal packages are woven concurrently with others, and must not
+	// affect the aspects applied to them (run with -race to detect data races).
+	o, err := Prepare(context.Background(), []string{"build", "."})
+	require.NoError(t, err)
+	defer o.Close()
+
+	woven := func(original string) string {
+		t.Helper()
+		path, found := o.Replace()[filepath.Join(tmp, original)]
+		require.True(t, found, "%s was not woven", original)
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(content)
+	}
+	assert.Contains(t, woven(filepath.Join("lib", "run.go")), `println("normal")`)
+	assert.Contains(t, woven(filepath.Join("tracer", "ddtrace", "start.go")), `println("internal")`)
+}
+
+func TestWeaveFileArguments(t *testing.T) {
+	t.Setenv("GOFLAGS", "")
+	t.Setenv("GOWORK", "off")
+
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	for name, content := range map[string]string{
+		"go.mod":              "module example.com/app\n\ngo 1.23\n",
+		"orchestrion.tool.go": "//go:build tools\n\npackage tools\n",
+		"scripts/hello.go":    "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n",
+		"orchestrion.yml": `aspects:
+  - id: main
+    join-point: { function-body: { function: [{ name: main }] } }
+    advice: [{ prepend-statements: { template: println("woven") } }]
+`,
+	} {
+		filename := filepath.Join(tmp, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0o755))
+		require.NoError(t, os.WriteFile(filename, []byte(content), 0o644))
+	}
+	chdir(t, tmp)
+
+	// Files named on the command line form an ad-hoc package, which is woven
+	// using the configuration of the current module.
+	o, err := Prepare(context.Background(), []string{"run", filepath.Join("scripts", "hello.go"), "arg"})
+	require.NoError(t, err)
+	defer o.Close()
+
+	path, found := o.Replace()[filepath.Join(tmp, "scripts", "hello.go")]
+	require.True(t, found, "scripts/hello.go was not woven")
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `println("woven")`)
+}
@@ -0,0 +1,229 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package pgo identifies the hottest functions of a profile used for
+// profile-guided optimization (PGO), so that weaving can leave them untouched.
+// Weaving changes the shape of the functions it modifies, which can reduce the
+// benefits of PGO (most notably, inlining) on hot paths.
+package pgo
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/google/pprof/profile"
+	"github.com/rs/zerolog"
+)
+
+// EnvVarHotThreshold is the environment variable that enables skipping aspects
+// on functions marked as hot by the PGO profile. Its value is a percentage of
+// the profile's total call edge weight: the heaviest call edges that together
+// account for this percentage are hot, as are their callers and callees.
+const EnvVarHotThreshold = "ORCHESTRION_PGO_HOT_THRESHOLD"
+
+// preprofileHeader is the header of profiles pre-processed by `go tool
+// preprofile`, which the go command accepts for its `-pgo` flag.
+const preprofileHeader = "GO PREPROFILE V1\n"
+
+// HotThreshold returns the threshold configured via [EnvVarHotThreshold], or 0
+// if it is not set (or set to "off").
+func HotThreshold() (float64, error) {
+	val := os.Getenv(EnvVarHotThreshold)
+	if val == "" || val == "off" {
+		return 0, nil
+	}
+	threshold, err := strconv.ParseFloat(strings.TrimSuffix(val, "%"), 64)
+	if err != nil || threshold <= 0 || threshold > 100 {
+		return 0, fmt.Errorf("invalid value for %s: %q (expected a percentage between 0 and 100)", EnvVarHotThreshold, val)
+	}
+	return threshold, nil
+}
+
+// HotFunctions is the set of symbol names of hot functions (e.g,
+// `example.com/pkg.(*T).Method`).
+type HotFunctions map[string]struct{}
+
+// Contains returns true if the function with the designated symbol name is
+// hot.
+func (h HotFunctions) Contains(symbol string) bool {
+	_, found := h[symbol]
+	return found
+}
+
+// Sorted returns the symbol names of all hot functions, in lexicographic order.
+func (h HotFunctions) Sorted() []string {
+	res := make([]string, 0, len(h))
+	for symbol := range h {
+		res = append(res, symbol)
+	}
+	slices.Sort(res)
+	return res
+}
+
+// FromFlags returns the hot functions of the profile designated by the `-pgo`
+// flag of the go command, or nil if threshold is 0 or no profile is
+// explicitly designated (`-pgo=auto` is not supported).
+func FromFlags(ctx context.Context, flags goflags.CommandFlags, threshold float64) (HotFunctions, error) {
+	if threshold == 0 {
+		return nil, nil
+	}
+
+	log := zerolog.Ctx(ctx)
+	path := flags.PGOProfile()
+	if path == "" {
+		log.Debug().Str("-pgo", flags.Long["-pgo"]).Msg("No explicit PGO profile; not skipping hot functions")
+		return nil, nil
+	}
+
+	hot, err := Load(path, threshold)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug().Str("-pgo", path).Int("hot", len(hot)).Msg("Loaded hot functions from PGO profile")
+	return hot, nil
+}
+
+type edge struct {
+	caller string
+	callee string
+}
+
+// Load reads the profile at path, which is either a pprof CPU profile or a
+// profile pre-processed by `go tool preprofile`, and returns the functions
+// involved in its heaviest call edges, which together account for threshold
+// percent of the profile's total call edge weight.
+func Load(path string, threshold float64) (HotFunctions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var weights map[edge]int64
+	if bytes.HasPrefix(data, []byte(preprofileHeader)) {
+		weights, err = preprofileEdges(data[len(preprofileHeader):])
+	} else {
+		weights, err = pprofEdges(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading PGO profile %q: %w", path, err)
+	}
+
+	return hotFunctions(weights, threshold), nil
+}
+
+// hotFunctions returns the callers and callees of the heaviest edges, which
+// together account for threshold percent of the total weight.
+func hotFunctions(weights map[edge]int64, threshold float64) HotFunctions {
+	var total int64
+	edges := make([]edge, 0, len(weights))
+	for e, weight := range weights {
+		edges = append(edges, e)
+		total += weight
+	}
+	slices.SortFunc(edges, func(l, r edge) int {
+		if wl, wr := weights[l], weights[r]; wl != wr {
+			return cmp.Compare(wr, wl) // Heaviest first
+		}
+		if l.caller != r.caller {
+			return strings.Compare(l.caller, r.caller)
+		}
+		return strings.Compare(l.callee, r.callee)
+	})
+
+	hot := make(HotFunctions)
+	var cumulative int64
+	for _, e := range edges {
+		if total == 0 || float64(cumulative)*100/float64(total) >= threshold {
+			break
+		}
+		cumulative += weights[e]
+		hot[e.caller] = struct{}{}
+		hot[e.callee] = struct{}{}
+	}
+	return hot
+}
+
+// pprofEdges computes call edge weights from a pprof CPU profile, the same way
+// the go toolchain does.
+func pprofEdges(data []byte) (map[edge]int64, error) {
+	if len(data) == 0 {
+		// The go toolchain treats an empty file as a profile without samples.
+		return nil, nil
+	}
+	prof, err := profile.ParseData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	valueIndex := -1
+	for i, s := range prof.SampleType {
+		// Samples count is the raw data collected, and CPU nanoseconds is just
+		// a scaled version of it, so either one we can find is fine.
+		if (s.Type == "samples" && s.Unit == "count") || (s.Type == "cpu" && s.Unit == "nanoseconds") {
+			valueIndex = i
+			break
+		}
+	}
+	if valueIndex == -1 {
+		return nil, errors.New(`profile does not contain a sample index with value/type "samples/count" or "cpu/nanoseconds"`)
+	}
+
+	weights := make(map[edge]int64)
+	var frames []string
+	for _, sample := range prof.Sample {
+		// Frames are listed from the leaf to the root, including inlined ones.
+		frames = frames[:0]
+		for _, loc := range sample.Location {
+			for _, line := range loc.Line {
+				if line.Function != nil {
+					frames = append(frames, line.Function.Name)
+				}
+			}
+		}
+		for i := 1; i < len(frames); i++ {
+			weights[edge{caller: frames[i], callee: frames[i-1]}] += sample.Value[valueIndex]
+		}
+	}
+	return weights, nil
+}
+
+// preprofileEdges reads call edge weights from a profile pre-processed by `go
+// tool preprofile`, with the header already removed. Each edge is represented
+// by three lines: the caller name, the callee name, and the call site offset
+// followed by the edge weight.
+func preprofileEdges(data []byte) (map[edge]int64, error) {
+	weights := make(map[edge]int64)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		caller := scanner.Text()
+		if !scanner.Scan() {
+			return nil, io.ErrUnexpectedEOF
+		}
+		callee := scanner.Text()
+		if !scanner.Scan() {
+			return nil, io.ErrUnexpectedEOF
+		}
+		_, weightText, found := strings.Cut(scanner.Text(), " ")
+		if !found {
+			return nil, fmt.Errorf("malformed call edge line: %q", scanner.Text())
+		}
+		weight, err := strconv.ParseInt(weightText, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed call edge weight: %w", err)
+		}
+		weights[edge{caller: caller, callee: callee}] += weight
+	}
+	return weights, scanner.Err()
+}
@@ -0,0 +1,94 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package pgo_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/pgo"
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	tmp := t.TempDir()
+
+	var (
+		main    = &profile.Function{ID: 1, Name: "main.main"}
+		handle  = &profile.Function{ID: 2, Name: "example.com/app.(*Server).handle"}
+		encode  = &profile.Function{ID: 3, Name: "example.com/app.encode"}
+		cleanup = &profile.Function{ID: 4, Name: "example.com/app.cleanup"}
+		loc     = func(id uint64, fns ...*profile.Function) *profile.Location {
+			lines := make([]profile.Line, len(fns))
+			for i, fn := range fns {
+				lines[i] = profile.Line{Function: fn, Line: 42}
+			}
+			return &profile.Location{ID: id, Line: lines}
+		}
+		encodeLoc  = loc(1, encode)
+		handleLoc  = loc(2, handle)
+		mainLoc    = loc(3, main)
+		cleanupLoc = loc(4, cleanup, main) // cleanup is inlined into main
+	)
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{encodeLoc, handleLoc, mainLoc}, Value: []int64{90, 900}},
+			{Location: []*profile.Location{cleanupLoc}, Value: []int64{10, 100}},
+		},
+		Location: []*profile.Location{encodeLoc, handleLoc, mainLoc, cleanupLoc},
+		Function: []*profile.Function{main, handle, encode, cleanup},
+	}
+	pprofFile := filepath.Join(tmp, "cpu.pprof")
+	file, err := os.Create(pprofFile)
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(file))
+	require.NoError(t, file.Close())
+
+	preprofileFile := filepath.Join(tmp, "cpu.preprofile")
+	require.NoError(t, os.WriteFile(preprofileFile, []byte("GO PREPROFILE V1\n"+
+		"example.com/app.(*Server).handle\nexample.com/app.encode\n3 90\n"+
+		"main.main\nexample.com/app.(*Server).handle\n7 90\n"+
+		"main.main\nexample.com/app.cleanup\n2 10\n"), 0o644))
+
+	for _, path := range []string{pprofFile, preprofileFile} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			hot, err := pgo.Load(path, 40)
+			require.NoError(t, err)
+			// Edges are (handle -> encode, 90), (main -> handle, 90), (main -> cleanup, 10); so the 40% threshold is
+			// reached after the first edge (90/190 = 47%).
+			assert.Equal(t, []string{"example.com/app.(*Server).handle", "example.com/app.encode"}, hot.Sorted())
+
+			hot, err = pgo.Load(path, 100)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"example.com/app.(*Server).handle", "example.com/app.cleanup", "example.com/app.encode", "main.main"}, hot.Sorted())
+			assert.True(t, hot.Contains("main.main"))
+			assert.False(t, hot.Contains("main.other"))
+		})
+	}
+}
+
+func TestHotThreshold(t *testing.T) {
+	for val, expected := range map[string]float64{"": 0, "off": 0, "75": 75, "12.5%": 12.5} {
+		t.Run(val, func(t *testing.T) {
+			t.Setenv(pgo.EnvVarHotThreshold, val)
+			threshold, err := pgo.HotThreshold()
+			require.NoError(t, err)
+			assert.Equal(t, expected, threshold)
+		})
+	}
+
+	for _, val := range []string{"hot", "0", "101"} {
+		t.Run(val, func(t *testing.T) {
+			t.Setenv(pgo.EnvVarHotThreshold, val)
+			_, err := pgo.HotThreshold()
+			require.ErrorContains(t, err, pgo.EnvVarHotThreshold)
+		})
+	}
+}
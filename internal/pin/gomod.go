@@ -74,11 +74,13 @@ func (m *goMod) requires(path string) (string, bool) {
 }
 
 // runGoGet executes the `go get <modSpecs...>` subcommand with the provided
-// module specifications on the designated `go.mod` file.
+// module specifications on the designated `go.mod` file. Workspace mode is
+// disabled, as the `-modfile` flag cannot be used with it.
 func runGoGet(ctx context.Context, modfile string, modSpecs ...string) error {
 	cmd := exec.CommandContext(ctx, "go", "get", "-modfile", modfile)
 	cmd.Args = append(cmd.Args, modSpecs...)
-	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local")
+	cmd.Dir = filepath.Dir(modfile)
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local", "GOWORK=off")
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -87,11 +89,13 @@ func runGoGet(ctx context.Context, modfile string, modSpecs ...string) error {
 
 // runGoMod executes the `go mod <command> <args...>` subcommand with the
 // provided arguments on the designated `go.mod` file, sending standard output
-// to the provided writer.
+// to the provided writer. Workspace mode is disabled, as the `-modfile` flag
+// cannot be used with it.
 func runGoMod(ctx context.Context, command string, modfile string, stdout io.Writer, args ...string) error {
 	cmd := exec.CommandContext(ctx, "go", "mod", command, "-modfile", modfile)
 	cmd.Args = append(cmd.Args, args...)
-	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local")
+	cmd.Dir = filepath.Dir(modfile)
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local", "GOWORK=off")
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = stdout
 	cmd.Stderr = os.Stderr
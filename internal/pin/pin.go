@@ -57,7 +57,9 @@ type Options struct {
 }
 
 // PinOrchestrion applies or update the orchestrion pin file in the current
-// working directory, according to the supplied [Options].
+// working directory, according to the supplied [Options]. In workspace mode,
+// the pin file of every module listed in the `go.work` file's `use` directives
+// is applied or updated.
 func PinOrchestrion(ctx context.Context, opts Options) error {
 	// Ensure we have an [Options.Writer] and [Options.ErrWriter] set.
 	if opts.Writer == nil {
@@ -67,12 +69,37 @@ func PinOrchestrion(ctx context.Context, opts Options) error {
 		opts.ErrWriter = os.Stderr
 	}
 
-	log := zerolog.Ctx(ctx)
+	goWork, err := goenv.GOWORK("")
+	if err != nil {
+		return fmt.Errorf("getting GOWORK: %w", err)
+	}
+	if goWork == "" {
+		goMod, err := goenv.GOMOD("")
+		if err != nil {
+			return fmt.Errorf("getting GOMOD: %w", err)
+		}
+		return pinModule(ctx, goMod, opts)
+	}
 
-	goMod, err := goenv.GOMOD("")
+	dirs, err := goenv.WorkspaceModules(goWork)
 	if err != nil {
-		return fmt.Errorf("getting GOMOD: %w", err)
+		return fmt.Errorf("listing workspace modules: %w", err)
 	}
+	log := zerolog.Ctx(ctx)
+	for _, dir := range dirs {
+		log.Debug().Str("module.dir", dir).Msg("Pinning orchestrion in workspace module")
+		if err := pinModule(ctx, filepath.Join(dir, "go.mod"), opts); err != nil {
+			return fmt.Errorf("in workspace module %q: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// pinModule applies or update the orchestrion pin file of the module defined
+// by the designated `go.mod` file.
+func pinModule(ctx context.Context, goMod string, opts Options) error {
+	log := zerolog.Ctx(ctx).With().Str("go.mod", goMod).Logger()
+	ctx = log.WithContext(ctx)
 
 	// Acquire an advisory lock on the `go.mod` file, so that in `-toolexec` mode,
 	// multiple attempts to auto-pin don't try to modify the files at the same
@@ -142,7 +169,7 @@ func PinOrchestrion(ctx context.Context, opts Options) error {
 		return fmt.Errorf("editing %q: %w", goMod, err)
 	}
 
-	pruned, err := pruneImports(ctx, importSet, opts)
+	pruned, err := pruneImports(ctx, filepath.Dir(goMod), importSet, opts)
 	if err != nil {
 		return fmt.Errorf("pruning imports from %q: %w", toolFile, err)
 	}
@@ -281,9 +308,9 @@ func updateGoGenerateDirective(opts Options, file *dst.File) {
 }
 
 // pruneImports removes unnecessary or invalid imports from the provided
-// [*importSet]; unless the [*Options.NoPrune] field is true, in which case it
+// [*importSet], resolving them from the designated directory; unless the [*Options.NoPrune] field is true, in which case it
 // only outputs a message informing the user about uncalled-for imports.
-func pruneImports(ctx context.Context, importSet *importSet, opts Options) (bool, error) {
+func pruneImports(ctx context.Context, dir string, importSet *importSet, opts Options) (bool, error) {
 	importPaths := importSet.Except(orchestrionImportPath)
 	if len(importPaths) == 0 {
 		// Nothing to do!
@@ -294,6 +321,7 @@ func pruneImports(ctx context.Context, importSet *importSet, opts Options) (bool
 	pkgs, err := packages.Load(
 		&packages.Config{
 			BuildFlags: []string{"-toolexec="},
+			Dir:        dir,
 			Logf:       func(format string, args ...any) { log.Trace().Str("operation", "packages.Load").Msgf(format, args...) },
 			Mode:       packages.NeedName | packages.NeedFiles,
 		},
@@ -65,6 +65,31 @@ func TestPin(t *testing.T) {
 		assert.Contains(t, data.Require, goModRequire{"github.com/DataDog/orchestrion", rawTag})
 	})
 
+	t.Run("workspace", func(t *testing.T) {
+		// Workspace mode is not available with `-mod=mod`.
+		t.Setenv("GOFLAGS", "")
+
+		modA := scaffold(t, make(map[string]string))
+		modB := scaffold(t, make(map[string]string))
+		// Modules of a workspace must have distinct paths.
+		require.NoError(t, runGoMod(ctx, "edit", filepath.Join(modB, "go.mod"), io.Discard, "-module=github.com/DataDog/orchestrion/pin-test/b"))
+		tmp := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, "go.work"), []byte("go "+runtime.Version()[2:6]+"\n\nuse (\n\t"+modA+"\n\t"+modB+"\n)\n"), 0o644))
+		chdir(t, tmp)
+
+		require.NoError(t, PinOrchestrion(ctx, Options{Writer: io.Discard, ErrWriter: io.Discard}))
+
+		rawTag, _ := version.TagInfo()
+		for _, dir := range []string{modA, modB} {
+			assert.FileExists(t, filepath.Join(dir, config.FilenameOrchestrionToolGo))
+
+			data, err := parseGoMod(ctx, filepath.Join(dir, "go.mod"))
+			require.NoError(t, err)
+			assert.Contains(t, data.Require, goModRequire{"github.com/DataDog/orchestrion", rawTag})
+		}
+		assert.NoFileExists(t, filepath.Join(tmp, config.FilenameOrchestrionToolGo))
+	})
+
 	t.Run("no-generate", func(t *testing.T) {
 		tmp := scaffold(t, make(map[string]string))
 		chdir(t, tmp)
@@ -0,0 +1,184 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package remotecache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// HTTPBackend is a [Backend] that uses `GET` and `PUT` requests on
+// `<BaseURL>/<kind>/<key>`. Credentials present in BaseURL are sent using basic
+// authentication.
+type HTTPBackend struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func (b *HTTPBackend) Get(ctx context.Context, kind Kind, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.url(kind, key), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.Body, nil
+	case http.StatusNotFound:
+		res.Body.Close()
+		return nil, fmt.Errorf("%s/%s: %w", kind, key, ErrNotFound)
+	default:
+		res.Body.Close()
+		return nil, fmt.Errorf("GET %s/%s: unexpected status %s", kind, key, res.Status)
+	}
+}
+
+func (b *HTTPBackend) Put(ctx context.Context, kind Kind, key string, size int64, content io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, b.url(kind, key), io.NopCloser(content))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	res, err := b.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("PUT %s/%s: unexpected status %s", kind, key, res.Status)
+	}
+	return nil
+}
+
+func (b *HTTPBackend) url(kind Kind, key string) string {
+	return fmt.Sprintf("%s/%s/%s", b.BaseURL, kind, key)
+}
+
+func (b *HTTPBackend) client() *http.Client {
+	if b.Client != nil {
+		return b.Client
+	}
+	return http.DefaultClient
+}
+
+// DirBackend is a [Backend] that stores objects in a local (or network-mounted)
+// directory, at `<dir>/<kind>/<key[:2]>/<key>`. Objects are written to a
+// temporary file that is then atomically renamed into place, so that concurrent
+// readers never observe partially written objects.
+type DirBackend string
+
+func (d DirBackend) Get(_ context.Context, kind Kind, key string) (io.ReadCloser, error) {
+	if !validKey(key) {
+		return nil, fmt.Errorf("invalid key %q", key)
+	}
+	file, err := os.Open(d.path(kind, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s/%s: %w", kind, key, ErrNotFound)
+	}
+	return file, err
+}
+
+func (d DirBackend) Put(_ context.Context, kind Kind, key string, _ int64, content io.Reader) (resErr error) {
+	if !validKey(key) {
+		return fmt.Errorf("invalid key %q", key)
+	}
+	path := d.path(kind, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmp.Close()
+		if resErr != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := io.Copy(tmp, content); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (d DirBackend) path(kind Kind, key string) string {
+	return filepath.Join(string(d), string(kind), key[:2], key)
+}
+
+var keyPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func validKey(key string) bool {
+	return keyPattern.MatchString(key)
+}
+
+// Handler returns an [http.Handler] that serves the provided [Backend] using
+// the protocol expected by [HTTPBackend]. Uploads to the content addressable
+// store are rejected unless their content matches their key. This can be used
+// to share a [DirBackend] over the network, or as a local stand-in for a remote
+// cache server in tests.
+func Handler(backend Backend) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kind, key, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if !ok || (Kind(kind) != KindAction && Kind(kind) != KindContent) || !validKey(key) {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			rd, err := backend.Get(r.Context(), Kind(kind), key)
+			if errors.Is(err, ErrNotFound) {
+				http.NotFound(w, r)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer rd.Close()
+			_, _ = io.Copy(w, rd)
+
+		case http.MethodPut:
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if Kind(kind) == KindContent {
+				if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != key {
+					http.Error(w, ErrIntegrity.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			if err := backend.Put(r.Context(), Kind(kind), key, int64(len(data)), bytes.NewReader(data)); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
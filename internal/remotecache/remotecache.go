@@ -0,0 +1,267 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package remotecache implements a client for a shared, content-addressed cache
+// that the job server can consult before performing expensive work, so that
+// results can be shared across developer machines and CI workers.
+//
+// The cache is made of two namespaces: the action cache ("ac"), which maps
+// arbitrary keys to small JSON documents describing outputs, and the content
+// addressable store ("cas"), which holds output blobs keyed by the hex-encoded
+// SHA-256 digest of their content. Blobs downloaded from the content
+// addressable store are always verified against their digest and size before
+// being used. Over HTTP, objects are accessed using `GET` and `PUT` requests on
+// `<base>/ac/<key>` and `<base>/cas/<digest>`, which is compatible with common
+// remote build cache servers (e.g, bazel-remote).
+package remotecache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// EnvVarURL is the environment variable that configures the remote cache.
+	// Its value is either an `http://` or `https://` URL, or a `file://` URL or
+	// absolute path to a (possibly network-mounted) directory.
+	EnvVarURL = "ORCHESTRION_REMOTE_CACHE"
+	// EnvVarReadOnly is the environment variable that can be set to a truthy
+	// value to prevent uploading new entries to the remote cache.
+	EnvVarReadOnly = "ORCHESTRION_REMOTE_CACHE_READ_ONLY"
+)
+
+// Kind is a namespace within the remote cache.
+type Kind string
+
+const (
+	// KindAction is the action cache namespace.
+	KindAction Kind = "ac"
+	// KindContent is the content addressable store namespace.
+	KindContent Kind = "cas"
+)
+
+var (
+	// ErrNotFound is returned by [Backend.Get] when the requested object does
+	// not exist.
+	ErrNotFound = errors.New("not found in remote cache")
+	// ErrIntegrity is returned when a blob downloaded from the remote cache does
+	// not match its expected digest or size.
+	ErrIntegrity = errors.New("remote cache integrity check failed")
+)
+
+// Backend is the storage underlying a [Cache].
+type Backend interface {
+	// Get returns the content of the object with the specified key. It returns
+	// an error wrapping [ErrNotFound] if there is no such object.
+	Get(ctx context.Context, kind Kind, key string) (io.ReadCloser, error)
+	// Put stores an object with the specified key and size.
+	Put(ctx context.Context, kind Kind, key string, size int64, content io.Reader) error
+}
+
+type (
+	// Cache is a client for a remote cache.
+	Cache struct {
+		backend  Backend
+		readOnly bool
+	}
+
+	// Output describes a blob in the content addressable store.
+	Output struct {
+		Digest string `json:"digest"`
+		Size   int64  `json:"size"`
+	}
+)
+
+// Open returns a [Cache] using the backend designated by rawURL.
+func Open(rawURL string, readOnly bool) (*Cache, error) {
+	backend, err := backendFor(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return New(backend, readOnly), nil
+}
+
+// New returns a [Cache] using the provided [Backend].
+func New(backend Backend, readOnly bool) *Cache {
+	return &Cache{backend: backend, readOnly: readOnly}
+}
+
+func backendFor(rawURL string) (Backend, error) {
+	if filepath.IsAbs(rawURL) {
+		return DirBackend(rawURL), nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote cache URL %q: %w", rawURL, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return &HTTPBackend{BaseURL: strings.TrimSuffix(u.String(), "/")}, nil
+	case "file":
+		return DirBackend(filepath.FromSlash(u.Path)), nil
+	default:
+		return nil, fmt.Errorf("unsupported remote cache URL %q: expected an http(s):// or file:// URL, or an absolute path", rawURL)
+	}
+}
+
+// ReadOnly returns true if this cache does not upload new entries.
+func (c *Cache) ReadOnly() bool {
+	return c.readOnly
+}
+
+// GetValue retrieves the action cache document stored for key, and decodes it
+// into dest. It returns false if there is no such document.
+func (c *Cache) GetValue(ctx context.Context, key string, dest any) (bool, error) {
+	rd, err := c.backend.Get(ctx, KindAction, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer rd.Close()
+
+	if err := json.NewDecoder(rd).Decode(dest); err != nil {
+		return false, fmt.Errorf("decoding remote cache entry %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// PutValue stores val as the action cache document for key. It does nothing if
+// the cache is read-only.
+func (c *Cache) PutValue(ctx context.Context, key string, val any) error {
+	if c.readOnly {
+		return nil
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return c.backend.Put(ctx, KindAction, key, int64(len(data)), bytes.NewReader(data))
+}
+
+// GetFiles retrieves the files recorded for key with [Cache.PutFiles], and
+// writes them into dir. It returns the paths to the written files by name, or
+// nil if there is no entry for key. Each file's content is verified before the
+// file is made available.
+func (c *Cache) GetFiles(ctx context.Context, key string, dir string) (map[string]string, error) {
+	var outputs map[string]Output
+	if found, err := c.GetValue(ctx, key, &outputs); err != nil || !found {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	res := make(map[string]string, len(outputs))
+	for name, output := range outputs {
+		if name != filepath.Base(name) || name == "." || name == ".." {
+			return nil, fmt.Errorf("invalid file name %q in remote cache entry %s", name, key)
+		}
+		filename := filepath.Join(dir, name)
+		if err := c.getBlob(ctx, output, filename); err != nil {
+			return nil, fmt.Errorf("downloading %q: %w", name, err)
+		}
+		res[name] = filename
+	}
+	return res, nil
+}
+
+// PutFiles uploads the provided files (by name) to the content addressable
+// store, and records them under key. It does nothing if the cache is read-only.
+func (c *Cache) PutFiles(ctx context.Context, key string, files map[string]string) error {
+	if c.readOnly {
+		return nil
+	}
+
+	outputs := make(map[string]Output, len(files))
+	for name, path := range files {
+		output, err := c.putBlob(ctx, path)
+		if err != nil {
+			return fmt.Errorf("uploading %q: %w", name, err)
+		}
+		outputs[name] = output
+	}
+	return c.PutValue(ctx, key, outputs)
+}
+
+// getBlob downloads the specified blob to filename, after verifying its
+// integrity.
+func (c *Cache) getBlob(ctx context.Context, output Output, filename string) (resErr error) {
+	rd, err := c.backend.Get(ctx, KindContent, output.Digest)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmp.Close()
+		if resErr != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	sha := sha256.New()
+	// Read one byte past the expected size, so oversized blobs are detected.
+	size, err := io.Copy(io.MultiWriter(tmp, sha), io.LimitReader(rd, output.Size+1))
+	if err != nil {
+		return err
+	}
+	if digest := hex.EncodeToString(sha.Sum(nil)); size != output.Size || digest != output.Digest {
+		return fmt.Errorf("%w: expected %s (%d bytes), got %s (%d bytes)", ErrIntegrity, output.Digest, output.Size, digest, size)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// putBlob uploads the content of the specified file to the content addressable
+// store.
+func (c *Cache) putBlob(ctx context.Context, path string) (Output, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Output{}, err
+	}
+	defer file.Close()
+
+	sha := sha256.New()
+	size, err := io.Copy(sha, file)
+	if err != nil {
+		return Output{}, err
+	}
+	output := Output{Digest: hex.EncodeToString(sha.Sum(nil)), Size: size}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return Output{}, err
+	}
+	if err := c.backend.Put(ctx, KindContent, output.Digest, output.Size, file); err != nil {
+		return Output{}, err
+	}
+	return output, nil
+}
+
+// Key derives a remote cache key from the provided parts.
+func Key(parts ...string) string {
+	sha := sha256.New()
+	for _, part := range parts {
+		_, _ = io.WriteString(sha, part)
+		_, _ = sha.Write([]byte{0})
+	}
+	return hex.EncodeToString(sha.Sum(nil))
+}
@@ -0,0 +1,109 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package remotecache_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/remotecache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+
+	backends := map[string]func(t *testing.T, dir string) string{
+		"http": func(t *testing.T, dir string) string {
+			srv := httptest.NewServer(remotecache.Handler(remotecache.DirBackend(dir)))
+			t.Cleanup(srv.Close)
+			return srv.URL
+		},
+		"dir":  func(_ *testing.T, dir string) string { return dir },
+		"file": func(_ *testing.T, dir string) string { return "file://" + filepath.ToSlash(dir) },
+	}
+
+	for name, url := range backends {
+		t.Run(name, func(t *testing.T) {
+			storage := t.TempDir()
+			cache, err := remotecache.Open(url(t, storage), false)
+			require.NoError(t, err)
+
+			key := remotecache.Key("test", name)
+			files, err := cache.GetFiles(ctx, key, t.TempDir())
+			require.NoError(t, err)
+			assert.Nil(t, files)
+
+			archive := filepath.Join(t.TempDir(), "_pkg_.a")
+			require.NoError(t, os.WriteFile(archive, []byte("archive content"), 0o644))
+			require.NoError(t, cache.PutFiles(ctx, key, map[string]string{"_pkg_.a": archive}))
+
+			dir := t.TempDir()
+			files, err = cache.GetFiles(ctx, key, dir)
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{"_pkg_.a": filepath.Join(dir, "_pkg_.a")}, files)
+			content, err := os.ReadFile(files["_pkg_.a"])
+			require.NoError(t, err)
+			assert.Equal(t, "archive content", string(content))
+
+			var val string
+			found, err := cache.GetValue(ctx, remotecache.Key("value"), &val)
+			require.NoError(t, err)
+			assert.False(t, found)
+			require.NoError(t, cache.PutValue(ctx, remotecache.Key("value"), "hello"))
+			found, err = cache.GetValue(ctx, remotecache.Key("value"), &val)
+			require.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, "hello", val)
+		})
+	}
+
+	t.Run("integrity", func(t *testing.T) {
+		storage := t.TempDir()
+		srv := httptest.NewServer(remotecache.Handler(remotecache.DirBackend(storage)))
+		defer srv.Close()
+		cache, err := remotecache.Open(srv.URL, false)
+		require.NoError(t, err)
+
+		key := remotecache.Key("integrity")
+		archive := filepath.Join(t.TempDir(), "_pkg_.a")
+		require.NoError(t, os.WriteFile(archive, []byte("archive content"), 0o644))
+		require.NoError(t, cache.PutFiles(ctx, key, map[string]string{"_pkg_.a": archive}))
+
+		// Corrupt every blob in the content addressable store...
+		blobs, err := filepath.Glob(filepath.Join(storage, "cas", "*", "*"))
+		require.NoError(t, err)
+		require.NotEmpty(t, blobs)
+		for _, blob := range blobs {
+			require.NoError(t, os.WriteFile(blob, []byte("tampered content"), 0o644))
+		}
+
+		dir := t.TempDir()
+		_, err = cache.GetFiles(ctx, key, dir)
+		require.ErrorIs(t, err, remotecache.ErrIntegrity)
+		assert.NoFileExists(t, filepath.Join(dir, "_pkg_.a"))
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		storage := t.TempDir()
+		cache, err := remotecache.Open(storage, true)
+		require.NoError(t, err)
+
+		require.NoError(t, cache.PutValue(ctx, remotecache.Key("value"), "hello"))
+		entries, err := os.ReadDir(storage)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := remotecache.Open("ftp://example.com/cache", false)
+		require.ErrorContains(t, err, "unsupported remote cache URL")
+	})
+}
@@ -16,6 +16,7 @@ import (
 	"path/filepath"
 	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
 	"github.com/DataDog/orchestrion/internal/toolexec/aspect/linkdeps"
@@ -60,17 +61,16 @@ func (w Weaver) OnCompileMain(ctx context.Context, cmd *proxy.CompileCommand) (e
 
 	newDeps := linkDeps.Dependencies()
 
-	// Add package resolutions of link-time dependencies to the importcfg file:
-	stack := append(make([]string, 0, len(newDeps)), newDeps...)
-	for len(stack) > 0 {
-		// Pop from the stack of things to process...
-		linkDepPath := stack[len(stack)-1]
-		stack = stack[:len(stack)-1]
-
-		deps, err := resolvePackageFiles(ctx, linkDepPath, cmd.WorkDir)
+	// Add package resolutions of link-time dependencies to the importcfg file. All pending link-time
+	// dependencies are resolved together, so that this requires as few `go list` invocations as
+	// possible.
+	pending := slices.Clone(newDeps)
+	for len(pending) > 0 {
+		deps, err := resolvePackageFiles(ctx, cmd.WorkDir, pending...)
 		if err != nil {
-			return fmt.Errorf("resolving %q: %w", linkDepPath, err)
+			return fmt.Errorf("resolving %s: %w", strings.Join(pending, ", "), err)
 		}
+		pending = pending[:0]
 
 		for p, a := range deps {
 			if _, found := reg.PackageFile[p]; found {
@@ -85,13 +85,15 @@ func (w Weaver) OnCompileMain(ctx context.Context, cmd *proxy.CompileCommand) (e
 				return fmt.Errorf("reading %s from %s[%s]: %w", linkdeps.Filename, p, a, err)
 			}
 			for _, tDep := range tDeps.Dependencies() {
-				if reg.PackageFile[tDep] != "" || slices.Contains(stack, tDep) {
+				if reg.PackageFile[tDep] != "" || slices.Contains(newDeps, tDep) {
 					// Already resolved, or already going to be resolved...
 					continue
 				}
-				stack = append(stack, tDep)     // Push it to the stack
-				newDeps = append(newDeps, tDep) // Record it as asynthetic import to add
+				newDeps = append(newDeps, tDep) // Record it as a synthetic import to add
 				cmd.LinkDeps.Add(tDep)          // Record it as a link-time dependency
+				if _, found := deps[tDep]; !found {
+					pending = append(pending, tDep) // Resolve it in the next batch
+				}
 			}
 		}
 	}
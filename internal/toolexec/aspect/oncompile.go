@@ -12,15 +12,20 @@ import (
 	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
 	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/goflags"
 	"github.com/DataDog/orchestrion/internal/injector"
 	"github.com/DataDog/orchestrion/internal/injector/aspect"
 	"github.com/DataDog/orchestrion/internal/injector/config"
 	"github.com/DataDog/orchestrion/internal/injector/typed"
+	"github.com/DataDog/orchestrion/internal/jobserver"
 	"github.com/DataDog/orchestrion/internal/jobserver/client"
 	"github.com/DataDog/orchestrion/internal/jobserver/pkgs"
+	"github.com/DataDog/orchestrion/internal/jobserver/status"
+	"github.com/DataDog/orchestrion/internal/pgo"
 	"github.com/DataDog/orchestrion/internal/toolexec/aspect/linkdeps"
 	"github.com/DataDog/orchestrion/internal/toolexec/importcfg"
 	"github.com/DataDog/orchestrion/internal/toolexec/proxy"
@@ -58,6 +63,10 @@ func (sc *specialCase) matches(importPath string) bool {
 	return sc.prefix && strings.HasPrefix(importPath, sc.path+"/")
 }
 
+// RootConfig is the root configuration of the injector when weaving packages
+// (see [injector.Injector.RootConfig]), which must not be modified.
+var RootConfig = map[string]string{"httpmode": "wrap"}
+
 // weavingSpecialCase defines special behavior to be applied to certain package
 // paths. They are evaluated in order, and the first matching override is
 // applied, stopping evaluation of any further overrides.
@@ -75,6 +84,57 @@ var weavingSpecialCase = []specialCase{
 	{path: "github.com/DataDog/go-tuf/client", prefix: false, behavior: neverWeave},
 }
 
+// hotFunctions returns the functions that must be left untouched because the
+// PGO profile of the build marks them as hot, if [pgo.EnvVarHotThreshold] is
+// set. The profile is read by the job server only once for the whole build.
+func hotFunctions(ctx context.Context, js *client.Client) (pgo.HotFunctions, error) {
+	threshold, err := pgo.HotThreshold()
+	if err != nil || threshold == 0 {
+		return nil, err
+	}
+	res, err := client.Request(ctx, js, pkgs.HotFunctionsRequest{Threshold: threshold})
+	if err != nil {
+		return nil, err
+	}
+	return res.Functions, nil
+}
+
+// SpecialCaseAspects applies the special behavior defined for the package with
+// the designated import path (if any) to the provided aspects, and returns the
+// aspects that can be woven into it. It returns false if the package must not
+// be woven at all. The provided slice is not modified, as it may be shared.
+func SpecialCaseAspects(ctx context.Context, importPath string, aspects []*aspect.Aspect) ([]*aspect.Aspect, bool) {
+	log := zerolog.Ctx(ctx)
+	for _, sc := range weavingSpecialCase {
+		if !sc.matches(importPath) {
+			continue
+		}
+
+		switch sc.behavior {
+		case neverWeave:
+			log.Debug().Str("import-path", importPath).Msg("Not weaving aspects to prevent circular instrumentation")
+			return nil, false
+
+		case weaveTracerInternal:
+			log.Debug().Str("import-path", importPath).Msg("Enabling tracer-internal mode")
+			aspects = slices.DeleteFunc(slices.Clone(aspects), func(a *aspect.Aspect) bool {
+				return !a.TracerInternal
+			})
+
+		case noOverride:
+			// No-op
+
+		default:
+			// Unreachable
+			panic(fmt.Sprintf("un-handled behavior override: %d", sc.behavior))
+		}
+
+		// We matched an override; so we'll not evaluate any other.
+		break
+	}
+	return aspects, true
+}
+
 func (w Weaver) OnCompile(ctx context.Context, cmd *proxy.CompileCommand) (resErr error) {
 	span, ctx := tracer.StartSpanFromContext(ctx, "Weaver.OnCompile",
 		tracer.ResourceName(w.ImportPath),
@@ -90,55 +150,45 @@ func (w Weaver) OnCompile(ctx context.Context, cmd *proxy.CompileCommand) (resEr
 		return fmt.Errorf("parsing %q: %w", cmd.Flags.ImportCfg, err)
 	}
 
-	goMod, err := goenv.GOMOD(".")
+	js, err := jobserver.FromEnvironment(ctx, cmd.WorkDir)
 	if err != nil {
-		return fmt.Errorf("go env GOMOD: %w", err)
+		return err
 	}
-	goModDir := filepath.Dir(goMod)
-	log.Trace().Str("module.dir", goModDir).Msg("Identified module directory")
+	pkgLoader := packageLoader(js)
 
-	js, err := client.FromEnvironment(ctx, cmd.WorkDir)
+	// The job server resolves the build's go.mod & go.work files only once, so
+	// compile tasks do not each need to run `go env`.
+	ws, err := client.Request(ctx, js, pkgs.WorkspaceRequest{})
 	if err != nil {
 		return err
 	}
-	pkgLoader := packageLoader(js)
+	cfgDir, err := configDir(cmd, ws)
+	if err != nil {
+		return err
+	}
+	log.Trace().Str("config.dir", cfgDir).Msg("Identified configuration directory")
 
-	cfg, resErr := config.NewLoader(pkgLoader, goModDir, false).Load(ctx)
+	cfg, resErr := config.NewLoader(pkgLoader, cfgDir, false).WithGOWORK(ws.GoWork).Load(ctx)
 	if resErr != nil {
 		return fmt.Errorf("loading injector configuration: %w", resErr)
 	}
 
-	aspects := cfg.Aspects()
-	for _, sc := range weavingSpecialCase {
-		if !sc.matches(w.ImportPath) {
-			continue
-		}
-
-		switch sc.behavior {
-		case neverWeave:
-			log.Debug().Str("import-path", w.ImportPath).Msg("Not weaving aspects to prevent circular instrumentation")
-			return nil
-
-		case weaveTracerInternal:
-			log.Debug().Str("import-path", w.ImportPath).Msg("Enabling tracer-internal mode")
-			aspects = slices.DeleteFunc(aspects, func(a *aspect.Aspect) bool {
-				return !a.TracerInternal
-			})
-
-		case noOverride:
-			// No-op
-
-		default:
-			// Unreachable
-			panic(fmt.Sprintf("un-handled behavior override: %d", sc.behavior))
-		}
+	aspects, canWeave := SpecialCaseAspects(ctx, w.ImportPath, cfg.Aspects())
+	if !canWeave {
+		return nil
+	}
 
-		// We matched an override; so we'll not evaluate any other.
-		break
+	aspects, resErr = filterRequirements(ctx, js, cfgDir, aspects)
+	if resErr != nil {
+		return resErr
+	}
+	aspects, resErr = filterTarget(ctx, cfgDir, aspects)
+	if resErr != nil {
+		return resErr
 	}
 
 	injector := injector.Injector{
-		RootConfig: map[string]string{"httpmode": "wrap"},
+		RootConfig: RootConfig,
 		Lookup:     imports.Lookup,
 		ImportPath: w.ImportPath,
 		TestMain:   cmd.TestMain() && strings.HasSuffix(w.ImportPath, ".test"),
@@ -149,24 +199,32 @@ func (w Weaver) OnCompile(ctx context.Context, cmd *proxy.CompileCommand) (resEr
 		},
 	}
 
-	goFiles := cmd.GoFiles()
-	results, goLang, resErr := injector.InjectFiles(ctx, goFiles, aspects)
+	hot, resErr := hotFunctions(ctx, js)
+	if resErr != nil {
+		return resErr
+	}
+	if len(hot) != 0 {
+		injector.SkipFunction = hot.Contains
+	}
+
+	weaveStart := time.Now()
+	modified, references, goLang, resErr := weave(ctx, &injector, cmd, imports, aspects, hot)
 	if resErr != nil {
 		return resErr
 	}
+	reportWeave(ctx, js, w.ImportPath, time.Since(weaveStart))
+
+	recordCacheProgMetadata(ctx, cmd, aspects, modified)
 
 	if err := cmd.SetLang(goLang); err != nil {
 		return err
 	}
 
-	references := typed.ReferenceMap{}
-	for gofile, modFile := range results {
-		log.Debug().Str("original", gofile).Str("updated", modFile.Filename).Msg("Replacing argument for modified source code")
-		if err := cmd.ReplaceParam(gofile, modFile.Filename); err != nil {
-			return fmt.Errorf("replacing %q with %q: %w", gofile, modFile.Filename, err)
+	for gofile, modFile := range modified {
+		log.Debug().Str("original", gofile).Str("updated", modFile).Msg("Replacing argument for modified source code")
+		if err := cmd.ReplaceParam(gofile, modFile); err != nil {
+			return fmt.Errorf("replacing %q with %q: %w", gofile, modFile, err)
 		}
-
-		references.Merge(modFile.References)
 	}
 
 	if references.Count() == 0 {
@@ -199,7 +257,7 @@ func (w Weaver) OnCompile(ctx context.Context, cmd *proxy.CompileCommand) (resEr
 		}
 
 		// Imported packages need to be provided in the compilation's importcfg file
-		deps, err := resolvePackageFiles(ctx, depImportPath, cmd.WorkDir)
+		deps, err := resolvePackageFiles(ctx, cmd.WorkDir, depImportPath)
 		if err != nil {
 			return fmt.Errorf("resolving woven dependency on %s: %w", depImportPath, err)
 		}
@@ -252,8 +310,81 @@ func writeUpdatedImportConfig(log zerolog.Logger, reg importcfg.ImportConfig, fi
 	return nil
 }
 
+// reportWeave informs the job server about the time spent weaving a package.
+// Failures are logged but do not cause the compilation to fail.
+func reportWeave(ctx context.Context, js *client.Client, importPath string, duration time.Duration) {
+	if _, err := client.Request(ctx, js, status.WeaveReport{ImportPath: importPath, Duration: duration}); err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Msg("Failed to report weave duration to the job server")
+	}
+}
+
+// filterRequirements removes aspects whose [aspect.Aspect.Requires] is not
+// satisfied by the module graph of the main module in dir.
+func filterRequirements(ctx context.Context, js *client.Client, dir string, aspects []*aspect.Aspect) ([]*aspect.Aspect, error) {
+	required := aspect.RequiredModules(aspects)
+	if len(required) == 0 {
+		return aspects, nil
+	}
+
+	versions, err := client.Request(ctx, js, pkgs.ModulesRequest{Dir: dir, Paths: required})
+	if err != nil {
+		return nil, fmt.Errorf("resolving required module versions: %w", err)
+	}
+
+	return aspect.FilterRequirements(ctx, versions, aspects), nil
+}
+
+// filterTarget removes aspects whose [aspect.Aspect.When] condition is not
+// satisfied by the target of the build. The go command sets the target platform
+// in the environment of the tools it runs, but the build tags must be obtained
+// from its flags, so this is only done if some aspects are conditional.
+func filterTarget(ctx context.Context, dir string, aspects []*aspect.Aspect) ([]*aspect.Aspect, error) {
+	if !aspect.Conditional(aspects) {
+		return aspects, nil
+	}
+	flags, err := goflags.Flags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	target, err := goenv.TargetOf(dir, nil, flags.Tags())
+	if err != nil {
+		return nil, err
+	}
+	return aspect.FilterTarget(ctx, target, aspects), nil
+}
+
 func packageLoader(js *client.Client) config.PackageLoader {
 	return func(ctx context.Context, dir string, patterns ...string) ([]*packages.Package, error) {
 		return client.Request(ctx, js, pkgs.LoadRequest{Dir: dir, Patterns: patterns})
 	}
 }
+
+// configDir returns the directory from which the injector configuration
+// applicable to the package being compiled is loaded. This is the main module's
+// directory; unless in workspace mode, where this is the directory of the
+// workspace module the package belongs to. Packages that do not belong to any
+// workspace module (e.g, dependencies) use the configuration of the module the
+// build was started from, or of the workspace's root directory.
+func configDir(cmd *proxy.CompileCommand, ws *pkgs.WorkspaceResponse) (string, error) {
+	if ws.GoWork != "" {
+		modules, err := goenv.WorkspaceModules(ws.GoWork)
+		if err != nil {
+			return "", err
+		}
+		if files := cmd.GoFiles(); len(files) > 0 {
+			if dir := goenv.OwningModule(modules, files[0]); dir != "" {
+				return dir, nil
+			}
+		}
+	}
+
+	switch {
+	case ws.GoMod != "":
+		return filepath.Dir(ws.GoMod), nil
+	case ws.GoWork != "":
+		// The build was started from the workspace's root directory, outside of any module.
+		return filepath.Dir(ws.GoWork), nil
+	default:
+		return "", fmt.Errorf("go env GOMOD: %w", goenv.ErrNoGoMod)
+	}
+}
@@ -10,18 +10,19 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/jobserver"
 	"github.com/DataDog/orchestrion/internal/jobserver/client"
 	"github.com/DataDog/orchestrion/internal/jobserver/pkgs"
 )
 
-// resolvePackageFiles attempts to retrieve the archive for the designated import path. It attempts
-// to locate the archive for `importPath` and its dependencies using `go list`. If that fails, it
-// will try to resolve it using `go get`.
-func resolvePackageFiles(ctx context.Context, importPath string, workDir string) (_ map[string]string, err error) {
+// resolvePackageFiles attempts to retrieve the archives for the designated import paths and their
+// dependencies using `go list`. All import paths are resolved using a single job server request.
+func resolvePackageFiles(ctx context.Context, workDir string, importPaths ...string) (_ map[string]string, err error) {
 	span, ctx := tracer.StartSpanFromContext(ctx, "aspect.resolvePackageFiles",
-		tracer.ResourceName(importPath),
+		tracer.ResourceName(strings.Join(importPaths, " ")),
 	)
 	defer func() { span.Finish(tracer.WithError(err)) }()
 
@@ -30,12 +31,12 @@ func resolvePackageFiles(ctx context.Context, importPath string, workDir string)
 		return nil, err
 	}
 
-	conn, err := client.FromEnvironment(ctx, workDir)
+	conn, err := jobserver.FromEnvironment(ctx, workDir)
 	if err != nil {
 		return nil, err
 	}
 
-	req := pkgs.NewResolveRequest(cwd, importPath)
+	req := pkgs.NewResolveRequest(cwd, importPaths...)
 	if workDir != "" {
 		// Nest the future GOTMPDIR under this $WORK directory, so that builds with `-work` are nested,
 		// and the root work tree contains all child work trees involved in resolutions.
@@ -51,18 +52,15 @@ func resolvePackageFiles(ctx context.Context, importPath string, workDir string)
 	}
 
 	// Check for missing archives...
-	var found bool
 	for ip, arch := range archives {
 		if arch == "" {
 			return nil, fmt.Errorf("no archive found for %q", ip)
 		}
-		if ip == importPath {
-			found = true
-		}
 	}
-
-	if !found {
-		return nil, fmt.Errorf("resolution did not include requested package %q", importPath)
+	for _, importPath := range importPaths {
+		if _, found := archives[importPath]; !found {
+			return nil, fmt.Errorf("resolution did not include requested package %q", importPath)
+		}
 	}
 
 	return archives, nil
@@ -0,0 +1,257 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package aspect
+
+import (
+	"bufio"
+	"bytes"
+	gocontext "context"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/cacheprog"
+	"github.com/DataDog/orchestrion/internal/fingerprint"
+	"github.com/DataDog/orchestrion/internal/injector"
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
+	"github.com/DataDog/orchestrion/internal/injector/typed"
+	"github.com/DataDog/orchestrion/internal/pgo"
+	"github.com/DataDog/orchestrion/internal/toolexec/importcfg"
+	"github.com/DataDog/orchestrion/internal/toolexec/proxy"
+	"github.com/DataDog/orchestrion/internal/version"
+	"github.com/DataDog/orchestrion/internal/weavecache"
+	"github.com/rs/zerolog"
+)
+
+// weave applies the aspects to the package's source files, using the weave
+// cache when possible. It returns a map of original to modified source files,
+// the references added by the woven code, and the minimum go language version
+// it requires. Failures to use the weave cache are logged but never cause the
+// compilation to fail.
+func weave(ctx gocontext.Context, inj *injector.Injector, cmd *proxy.CompileCommand, imports importcfg.ImportConfig, aspects []*aspect.Aspect, hot pgo.HotFunctions) (_ map[string]string, _ typed.ReferenceMap, _ context.GoLangVersion, err error) {
+	log := zerolog.Ctx(ctx)
+	goFiles := cmd.GoFiles()
+
+	cache, err := weavecache.Open()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to open weave cache")
+	}
+	var key string
+	if cache != nil {
+		key, err = weaveCacheKey(inj, cmd, goFiles, imports, aspects, hot)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to compute weave cache key")
+		}
+	}
+
+	if key != "" {
+		span, _ := tracer.StartSpanFromContext(ctx, "weavecache.Get", tracer.ResourceName(inj.ImportPath))
+		entry, found, err := cache.Get(ctx, key, inj.ModifiedFile)
+		span.Finish(tracer.WithError(err))
+		if err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("Failed to read weave cache entry")
+		} else if found {
+			goLang, err := context.ParseGoLangVersion(entry.GoLang)
+			if entry.GoLang == "" || err == nil {
+				log.Debug().Str("key", key).Msg("Weave cache hit")
+				return entry.Files, entry.References, goLang, nil
+			}
+			log.Warn().Err(err).Str("key", key).Msg("Invalid weave cache entry")
+		}
+	}
+
+	results, goLang, err := inj.InjectFiles(ctx, goFiles, aspects)
+	if err != nil {
+		return nil, typed.ReferenceMap{}, context.GoLangVersion{}, err
+	}
+
+	modified := make(map[string]string, len(results))
+	var references typed.ReferenceMap
+	for gofile, modFile := range results {
+		modified[gofile] = modFile.Filename
+		references.Merge(modFile.References)
+	}
+
+	if key != "" {
+		span, _ := tracer.StartSpanFromContext(ctx, "weavecache.Put", tracer.ResourceName(inj.ImportPath))
+		err := cache.Put(ctx, key, weavecache.Entry{Files: modified, References: references, GoLang: goLang.String()})
+		span.Finish(tracer.WithError(err))
+		if err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("Failed to write weave cache entry")
+		}
+	}
+
+	return modified, references, goLang, nil
+}
+
+// weaveCacheKey computes the weave cache key for the package being compiled.
+// It covers the orchestrion build, the aspects, the package's identity and
+// source files, the hot functions skipped due to PGO, and the build IDs of the
+// archives of all its dependencies.
+func weaveCacheKey(inj *injector.Injector, cmd *proxy.CompileCommand, goFiles []string, imports importcfg.ImportConfig, aspects []*aspect.Aspect, hot pgo.HotFunctions) (string, error) {
+	h := fingerprint.New()
+	defer h.Close()
+
+	binary, err := binaryID()
+	if err != nil {
+		return "", err
+	}
+	if err := h.Named("orchestrion", fingerprint.String(version.Tag()), fingerprint.String(binary)); err != nil {
+		return "", err
+	}
+
+	if err := h.Named(
+		"package",
+		fingerprint.String(inj.ImportPath),
+		fingerprint.String(cmd.Flags.Package),
+		fingerprint.String(cmd.Flags.Lang),
+		fingerprint.Bool(inj.TestMain),
+	); err != nil {
+		return "", err
+	}
+
+	if err := h.Named("aspects", fingerprint.List[*aspect.Aspect](aspects)); err != nil {
+		return "", err
+	}
+
+	if len(hot) != 0 {
+		sorted := hot.Sorted()
+		names := make(fingerprint.List[fingerprint.String], len(sorted))
+		for i, name := range sorted {
+			names[i] = fingerprint.String(name)
+		}
+		if err := h.Named("pgo", names); err != nil {
+			return "", err
+		}
+	}
+
+	files := make(fingerprint.List[fingerprint.String], 0, 2*len(goFiles))
+	for _, file := range goFiles {
+		sum, err := fileHash(file)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, fingerprint.String(file), fingerprint.String(sum))
+	}
+	if err := h.Named("files", files); err != nil {
+		return "", err
+	}
+
+	archives := make(map[string]string, len(imports.PackageFile))
+	for path, archive := range imports.PackageFile {
+		id, err := archiveID(archive)
+		if err != nil {
+			return "", fmt.Errorf("reading build ID of %s[%s]: %w", path, archive, err)
+		}
+		archives[path] = id
+	}
+	if err := h.Named(
+		"imports",
+		fingerprint.Map(archives, func(k string, v string) (string, fingerprint.String) { return k, fingerprint.String(v) }),
+		fingerprint.Map(imports.ImportMap, func(k string, v string) (string, fingerprint.String) { return k, fingerprint.String(v) }),
+	); err != nil {
+		return "", err
+	}
+
+	return h.Finish(), nil
+}
+
+// binaryID returns an identifier for the running orchestrion binary in
+// development builds, where the version tag does not reliably identify the
+// code. It is blank for release builds.
+func binaryID() (string, error) {
+	if _, isDev := version.TagInfo(); !isDev {
+		return "", nil
+	}
+	path, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s;%d;%d", path, stat.Size(), stat.ModTime().UnixNano()), nil
+}
+
+func fileHash(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	sha := sha512.New()
+	if _, err := io.Copy(sha, file); err != nil {
+		return "", err
+	}
+	var buf [sha512.Size]byte
+	return base64.URLEncoding.EncodeToString(sha.Sum(buf[:0])), nil
+}
+
+// archiveID returns the build ID recorded in the export data header of the
+// specified archive file, falling back to the hash of the file's contents if
+// none can be found.
+func archiveID(archive string) (string, error) {
+	file, err := os.Open(archive)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// The build ID is recorded at the very beginning of the `__.PKGDEF` entry,
+	// which is the first member of the archive.
+	const prefix = "\nbuild id \""
+	head := make([]byte, 1024)
+	n, err := io.ReadFull(bufio.NewReader(file), head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	head = head[:n]
+	if idx := bytes.Index(head, []byte(prefix)); idx >= 0 {
+		rest := head[idx+len(prefix):]
+		if end := bytes.IndexByte(rest, '"'); end > 0 {
+			return string(rest[:end]), nil
+		}
+	}
+
+	return fileHash(archive)
+}
+
+// recordCacheProgMetadata records how the package was woven, so that the
+// GOCACHEPROG can report on it, if orchestrion is configured as such. Failures
+// are logged but never cause the compilation to fail.
+func recordCacheProgMetadata(ctx gocontext.Context, cmd *proxy.CompileCommand, aspects []*aspect.Aspect, modified map[string]string) {
+	if os.Getenv(cacheprog.EnvVarDir) == "" {
+		return
+	}
+	log := zerolog.Ctx(ctx)
+
+	aspectsHash, err := fingerprint.Fingerprint(fingerprint.List[*aspect.Aspect](aspects))
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to compute aspects fingerprint for GOCACHEPROG metadata")
+		return
+	}
+	woven := make([]string, 0, len(modified))
+	for original := range modified {
+		woven = append(woven, original)
+	}
+	slices.Sort(woven)
+
+	if err := cacheprog.RecordMetadata(cacheprog.Metadata{
+		ImportPath: cmd.Flags.Package,
+		BuildID:    cmd.Flags.BuildID,
+		Aspects:    aspectsHash,
+		Woven:      woven,
+	}); err != nil {
+		log.Warn().Err(err).Msg("Failed to record GOCACHEPROG metadata")
+	}
+}
@@ -36,7 +36,7 @@ func (f *compileFlagSet) parse(args []string) ([]string, error) {
 	flagSet.Bool("clobberdead", false, "clobber dead stack slots (for debugging)")
 	flagSet.Bool("clobberdeadreg", false, "clobber dead registers (for debugging)")
 	flagSet.Bool("complete", false, "compiling complete package (no C or assembly)")
-	flagSet.String("coveragecfg", "", "read coverage configuration from file")
+	flagSet.StringVar(&f.CoverageCfg, "coveragecfg", "", "read coverage configuration from file")
 	flagSet.String("cpuprofile", "", "write cpu profile to file")
 	flagSet.String("d", "", "enable debugging settings; try -d help")
 	flagSet.Bool("dwarf", false, "generate DWARF symbols")
@@ -16,6 +16,8 @@ import (
 
 	"github.com/DataDog/orchestrion/internal/files"
 	"github.com/DataDog/orchestrion/internal/injector/aspect/context"
+	"github.com/DataDog/orchestrion/internal/injector/parse"
+	"github.com/DataDog/orchestrion/internal/jobserver"
 	"github.com/DataDog/orchestrion/internal/jobserver/client"
 	"github.com/DataDog/orchestrion/internal/jobserver/nbt"
 	"github.com/DataDog/orchestrion/internal/toolexec/aspect/linkdeps"
@@ -29,6 +31,7 @@ import (
 type compileFlagSet struct {
 	Asmhdr      string `ddflag:"-asmhdr"`
 	BuildID     string `ddflag:"-buildid"`
+	CoverageCfg string `ddflag:"-coveragecfg"`
 	ImportCfg   string `ddflag:"-importcfg"`
 	Lang        string `ddflag:"-lang"`
 	Output      string `ddflag:"-o"`
@@ -67,7 +70,9 @@ func (c *CompileCommand) ShowVersion() bool {
 // Go files are rooted in the same directory as the importcfg file. This
 // indicates the package being compiled is a synthetic "main" package generated
 // by `go test`. For more accurate readings, users should also validate the
-// declared package import path ends in `.test`.
+// declared package import path ends in `.test`. Files produced by cgo and by
+// coverage instrumentation are also rooted in that directory, so these are
+// not considered evidence of a synthetic "main" package.
 func (c *CompileCommand) TestMain() bool {
 	if c.Flags.Package != "main" {
 		return false
@@ -75,7 +80,11 @@ func (c *CompileCommand) TestMain() bool {
 
 	stageDir := filepath.Dir(c.Flags.ImportCfg)
 	for _, f := range c.GoFiles() {
-		if filepath.Dir(f) != stageDir {
+		if filepath.Dir(f) != stageDir || parse.IsCgoGlue(f) {
+			return false
+		}
+		if c.Coverage() && strings.HasSuffix(f, coverageFileSuffix) && filepath.Base(f) != "_testmain"+coverageFileSuffix {
+			// Coverage-instrumented copy of a user source file.
 			return false
 		}
 	}
@@ -83,6 +92,19 @@ func (c *CompileCommand) TestMain() bool {
 	return true
 }
 
+// coverageFileSuffix is the suffix of files produced by `go tool cover`, which
+// are named after the original source file.
+const coverageFileSuffix = ".cover.go"
+
+// Coverage returns true if the package is compiled with coverage
+// instrumentation (e.g, `go test -cover`). The source files of such packages
+// were rewritten by `go tool cover` before compilation, and contain coverage
+// counters computed from the original sources. Code injected by orchestrion is
+// hence never instrumented for coverage.
+func (c *CompileCommand) Coverage() bool {
+	return c.Flags.CoverageCfg != ""
+}
+
 func (cmd *CompileCommand) SetLang(to context.GoLangVersion) error {
 	if to.IsAny() {
 		// No minimal language requirement change, nothing to do...
@@ -193,7 +215,7 @@ func (cmd *CompileCommand) notifyJobServer(ctx gocontext.Context, cmdErr error)
 		return nil
 	}
 
-	jobs, err := client.FromEnvironment(ctx, cmd.WorkDir)
+	jobs, err := jobserver.FromEnvironment(ctx, cmd.WorkDir)
 	if err != nil {
 		return err
 	}
@@ -217,6 +239,7 @@ func (cmd *CompileCommand) notifyJobServer(ctx gocontext.Context, cmdErr error)
 
 	_, err = client.Request(ctx, jobs, nbt.FinishRequest{
 		ImportPath:  cmd.importPath,
+		BuildID:     cmd.Flags.BuildID,
 		FinishToken: cmd.finishToken,
 		Files:       files,
 		Error:       errorMessage,
@@ -247,7 +270,7 @@ func parseCompileCommand(ctx gocontext.Context, importPath string, args []string
 	// The WorkDir is the parent of the stage directory, which is where the importcfg file is located.
 	cmd.WorkDir = filepath.Dir(filepath.Dir(cmd.Flags.ImportCfg))
 
-	jobs, err := client.FromEnvironment(ctx, cmd.WorkDir)
+	jobs, err := jobserver.FromEnvironment(ctx, cmd.WorkDir)
 	if err != nil {
 		return nil, err
 	}
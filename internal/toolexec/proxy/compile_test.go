@@ -155,3 +155,48 @@ func TestSetLang(t *testing.T) {
 		require.Equal(t, args, cmd.Args())
 	})
 }
+
+func TestCompileTestMain(t *testing.T) {
+	const stageDir = "/work/b001"
+
+	for name, tc := range map[string]struct {
+		files       []string
+		coverageCfg string
+		expected    bool
+	}{
+		"testmain": {
+			files:    []string{stageDir + "/_testmain.go"},
+			expected: true,
+		},
+		"main": {
+			files:    []string{"/source/dir/main.go"},
+			expected: false,
+		},
+		"cgo": {
+			files:    []string{stageDir + "/_cgo_gotypes.go", stageDir + "/main.cgo1.go"},
+			expected: false,
+		},
+		"cover": {
+			files:       []string{stageDir + "/covervars.go", stageDir + "/main.cover.go"},
+			coverageCfg: stageDir + "/coveragecfg",
+			expected:    false,
+		},
+		"cover-testmain": {
+			files:       []string{stageDir + "/covervars.go", stageDir + "/_testmain.cover.go"},
+			coverageCfg: stageDir + "/coveragecfg",
+			expected:    true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cmd := CompileCommand{
+				Files: tc.files,
+				Flags: compileFlagSet{
+					Package:     "main",
+					ImportCfg:   stageDir + "/importcfg",
+					CoverageCfg: tc.coverageCfg,
+				},
+			}
+			require.Equal(t, tc.expected, cmd.TestMain())
+		})
+	}
+}
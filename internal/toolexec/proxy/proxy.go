@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
 
 	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
@@ -138,7 +139,9 @@ func (cmd *command) ReplaceParam(param string, val string) error {
 // to capture the output of the command instead of forwarding it to the host process' STDIO.
 type RunCommandOption func(*exec.Cmd)
 
-// RunCommand executes the underlying go tool command and forwards the program's standard fluxes
+// RunCommand executes the underlying go tool command and forwards the program's standard fluxes. If a
+// user-provided `-toolexec` command is set in [EnvVarToolexecWrapper], the go tool command is executed
+// through it.
 func RunCommand(ctx context.Context, cmd Command, opts ...RunCommandOption) (err error) {
 	span, _ := tracer.StartSpanFromContext(ctx, cmd.Type().String(),
 		tracer.ServiceName("go-tool"),
@@ -146,7 +149,15 @@ func RunCommand(ctx context.Context, cmd Command, opts ...RunCommandOption) (err
 	)
 	defer func() { span.Finish(tracer.WithError(err)) }()
 
-	args := cmd.Args()
+	wrapper, err := toolexecWrapper()
+	if err != nil {
+		return err
+	}
+	if len(wrapper) > 0 {
+		span.SetTag("toolexec.wrapper", wrapper[0])
+	}
+
+	args := slices.Concat(wrapper, cmd.Args())
 	c := exec.Command(args[0], args[1:]...)
 	if c == nil {
 		return errors.New("command couldn't build")
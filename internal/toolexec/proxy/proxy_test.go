@@ -7,7 +7,10 @@ package proxy_test
 
 import (
 	"context"
+	"os/exec"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/DataDog/orchestrion/internal/toolexec/proxy"
@@ -76,3 +79,33 @@ func TestParseCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestRunCommandWrapper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test relies on the echo command")
+	}
+
+	for name, tc := range map[string]struct {
+		wrapper  string
+		expected string
+	}{
+		"none":   {expected: "compile -V=full\n"},
+		"simple": {wrapper: "echo", expected: "compile -V=full\n"},
+		"quoted": {wrapper: `echo "wrapped by"`, expected: "wrapped by compile -V=full\n"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(proxy.EnvVarToolexecWrapper, tc.wrapper)
+
+			// Without a wrapper, the command is executed directly; so we use `echo` as the tool.
+			args := []string{"compile", "-V=full"}
+			if tc.wrapper == "" {
+				args = append([]string{"echo"}, args...)
+			}
+			cmd := proxy.NewCommand(args)
+
+			var stdout strings.Builder
+			require.NoError(t, proxy.RunCommand(context.Background(), &cmd, func(c *exec.Cmd) { c.Stdout = &stdout }))
+			require.Equal(t, tc.expected, stdout.String())
+		})
+	}
+}
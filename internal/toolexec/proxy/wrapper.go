@@ -0,0 +1,33 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package proxy
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/DataDog/orchestrion/internal/goflags/quoted"
+)
+
+// EnvVarToolexecWrapper is the environment variable containing a user-provided
+// `-toolexec` command, which go tool commands are executed through, after they
+// have been processed by orchestrion. It is quoted the same way as the value of
+// the go command's `-toolexec` flag.
+const EnvVarToolexecWrapper = "ORCHESTRION_TOOLEXEC_WRAPPER"
+
+// toolexecWrapper returns the arguments of the user-provided `-toolexec`
+// command set in [EnvVarToolexecWrapper], if any.
+func toolexecWrapper() ([]string, error) {
+	val := os.Getenv(EnvVarToolexecWrapper)
+	if val == "" {
+		return nil, nil
+	}
+	args, err := quoted.Split(val)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for %s: %w", EnvVarToolexecWrapper, err)
+	}
+	return args, nil
+}
@@ -7,7 +7,6 @@ package toolexec
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"os/exec"
 	"strings"
@@ -15,8 +14,8 @@ import (
 	"github.com/DataDog/orchestrion/internal/jobserver"
 	"github.com/DataDog/orchestrion/internal/jobserver/buildid"
 	"github.com/DataDog/orchestrion/internal/jobserver/client"
+	"github.com/DataDog/orchestrion/internal/pgo"
 	"github.com/DataDog/orchestrion/internal/toolexec/proxy"
-	"github.com/rs/zerolog"
 )
 
 // ComputeVersion returns the complete version string to be produced when the toolexec is invoked
@@ -27,29 +26,17 @@ import (
 // - the orchestrion binary is different (instrumentation process may have changed)
 // - the injector configuration is different
 // - injected dependencies versions are different
+// - the PGO hot function threshold is different (see [pgo.EnvVarHotThreshold])
 func ComputeVersion(ctx context.Context, cmd proxy.Command) (string, error) {
-	log := zerolog.Ctx(ctx)
-
 	// Get the output of the raw `-V=full` invocation
 	stdout := strings.Builder{}
 	if err := proxy.RunCommand(ctx, cmd, func(cmd *exec.Cmd) { cmd.Stdout = &stdout }); err != nil {
 		return "", err
 	}
 
-	conn, err := client.FromEnvironment(ctx, "")
+	conn, err := jobserver.FromEnvironment(ctx, "")
 	if err != nil {
-		if !errors.Is(err, client.ErrNoServerAvailable) {
-			return "", err
-		}
-		log.Debug().Msg("No job server available; starting an in-process temporary server...")
-		server, err := jobserver.New(ctx, &jobserver.Options{NoListener: true})
-		if err != nil {
-			return "", err
-		}
-		defer server.Shutdown()
-		if conn, err = server.Connect(); err != nil {
-			return "", err
-		}
+		return "", err
 	}
 
 	res, err := client.Request(ctx, conn, buildid.VersionSuffixRequest{})
@@ -57,6 +44,17 @@ func ComputeVersion(ctx context.Context, cmd proxy.Command) (string, error) {
 		return "", err
 	}
 
+	// Skipping hot functions changes the woven code, but the profile itself is
+	// already part of the go toolchain's action IDs; so only the threshold needs
+	// to be accounted for here.
+	threshold, err := pgo.HotThreshold()
+	if err != nil {
+		return "", err
+	}
+	if threshold > 0 {
+		res += buildid.VersionSuffixResponse(fmt.Sprintf(";pgo-hot=%g", threshold))
+	}
+
 	// Produce the complete version string
 	return fmt.Sprintf("%s:%s", strings.TrimSpace(stdout.String()), res), nil
 }
@@ -16,6 +16,7 @@ import (
 
 	"github.com/DataDog/orchestrion/internal/goflags"
 	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/DataDog/orchestrion/internal/jobserver"
 	"github.com/DataDog/orchestrion/internal/jobserver/client"
 	"github.com/DataDog/orchestrion/internal/toolexec/proxy"
 	"github.com/otiai10/copy"
@@ -193,6 +194,9 @@ func inDir[T any](t *testing.T, wd string, cb func() T) T {
 	defer func() { require.NoError(t, os.Chdir(orig)) }()
 
 	require.NoError(t, os.Chdir(wd))
+	// Each call simulates a separate toolexec process, which does not share the
+	// in-process job server's caches with the others.
+	defer jobserver.ShutdownInProcess()
 	return cb()
 }
 
@@ -0,0 +1,294 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package vet runs static analyzers over woven source code, so that issues
+// introduced by aspects are reported, too. Diagnostics are mapped back to the
+// original source files using the `//line` directives present in woven files.
+package vet
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/goflags"
+	"github.com/DataDog/orchestrion/internal/injector/lineinfo"
+	"github.com/DataDog/orchestrion/internal/overlay"
+	"github.com/rs/zerolog"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/analysis/passes/appends"
+	"golang.org/x/tools/go/analysis/passes/asmdecl"
+	"golang.org/x/tools/go/analysis/passes/assign"
+	"golang.org/x/tools/go/analysis/passes/atomic"
+	"golang.org/x/tools/go/analysis/passes/bools"
+	"golang.org/x/tools/go/analysis/passes/buildtag"
+	"golang.org/x/tools/go/analysis/passes/cgocall"
+	"golang.org/x/tools/go/analysis/passes/composite"
+	"golang.org/x/tools/go/analysis/passes/copylock"
+	"golang.org/x/tools/go/analysis/passes/defers"
+	"golang.org/x/tools/go/analysis/passes/directive"
+	"golang.org/x/tools/go/analysis/passes/errorsas"
+	"golang.org/x/tools/go/analysis/passes/framepointer"
+	"golang.org/x/tools/go/analysis/passes/httpresponse"
+	"golang.org/x/tools/go/analysis/passes/ifaceassert"
+	"golang.org/x/tools/go/analysis/passes/loopclosure"
+	"golang.org/x/tools/go/analysis/passes/lostcancel"
+	"golang.org/x/tools/go/analysis/passes/nilfunc"
+	"golang.org/x/tools/go/analysis/passes/printf"
+	"golang.org/x/tools/go/analysis/passes/shift"
+	"golang.org/x/tools/go/analysis/passes/sigchanyzer"
+	"golang.org/x/tools/go/analysis/passes/slog"
+	"golang.org/x/tools/go/analysis/passes/stdmethods"
+	"golang.org/x/tools/go/analysis/passes/stdversion"
+	"golang.org/x/tools/go/analysis/passes/stringintconv"
+	"golang.org/x/tools/go/analysis/passes/structtag"
+	"golang.org/x/tools/go/analysis/passes/testinggoroutine"
+	"golang.org/x/tools/go/analysis/passes/tests"
+	"golang.org/x/tools/go/analysis/passes/timeformat"
+	"golang.org/x/tools/go/analysis/passes/unmarshal"
+	"golang.org/x/tools/go/analysis/passes/unreachable"
+	"golang.org/x/tools/go/analysis/passes/unsafeptr"
+	"golang.org/x/tools/go/analysis/passes/unusedresult"
+	"golang.org/x/tools/go/packages"
+)
+
+// Analyzers is the list of analyzers run by [Run]. It matches the analyzers
+// run by `go vet`.
+var Analyzers = []*analysis.Analyzer{
+	appends.Analyzer,
+	asmdecl.Analyzer,
+	assign.Analyzer,
+	atomic.Analyzer,
+	bools.Analyzer,
+	buildtag.Analyzer,
+	cgocall.Analyzer,
+	composite.Analyzer,
+	copylock.Analyzer,
+	defers.Analyzer,
+	directive.Analyzer,
+	errorsas.Analyzer,
+	framepointer.Analyzer,
+	httpresponse.Analyzer,
+	ifaceassert.Analyzer,
+	loopclosure.Analyzer,
+	lostcancel.Analyzer,
+	nilfunc.Analyzer,
+	printf.Analyzer,
+	shift.Analyzer,
+	sigchanyzer.Analyzer,
+	slog.Analyzer,
+	stdmethods.Analyzer,
+	stdversion.Analyzer,
+	stringintconv.Analyzer,
+	structtag.Analyzer,
+	testinggoroutine.Analyzer,
+	tests.Analyzer,
+	timeformat.Analyzer,
+	unmarshal.Analyzer,
+	unreachable.Analyzer,
+	unsafeptr.Analyzer,
+	unusedresult.Analyzer,
+}
+
+// Diagnostic is a finding reported by one of the [Analyzers].
+type Diagnostic struct {
+	// Position is the location of the finding in the original source file. For
+	// findings in woven code, this is the closest preceding location of the
+	// original source file.
+	Position token.Position
+	// Analyzer is the name of the analyzer that reported the finding.
+	Analyzer string
+	// Message is the description of the finding.
+	Message string
+	// Woven is true if the finding is about code woven by orchestrion.
+	Woven bool
+}
+
+func (d Diagnostic) String() string {
+	if d.Woven {
+		return fmt.Sprintf("%s: %s (in code woven by orchestrion)", d.Position, d.Message)
+	}
+	return fmt.Sprintf("%s: %s", d.Position, d.Message)
+}
+
+// Run weaves the packages targeted by the provided `go vet` arguments (build
+// flags and package patterns), and runs the [Analyzers] over the woven source
+// code. It returns the resulting diagnostics, sorted by position.
+func Run(ctx context.Context, args []string) (_ []Diagnostic, err error) {
+	span, ctx := tracer.StartSpanFromContext(ctx, "vet.Run",
+		tracer.ResourceName(strings.Join(args, " ")),
+	)
+	defer func() { span.Finish(tracer.WithError(err)) }()
+
+	log := zerolog.Ctx(ctx)
+
+	goArgs := append([]string{"vet"}, args...)
+	ov, err := overlay.Prepare(ctx, goArgs)
+	if err != nil {
+		return nil, fmt.Errorf("weaving packages: %w", err)
+	}
+	defer func() {
+		if err := ov.Close(); err != nil {
+			log.Warn().Err(err).Msg("Failed to remove overlay files")
+		}
+	}()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	// Analyzers only report findings in the targeted packages, so dependencies
+	// from the module cache can be type-checked from their original source.
+	modCache, err := goenv.GOMODCACHE(wd)
+	if err != nil {
+		return nil, err
+	}
+	if err := ov.Exclude(modCache); err != nil {
+		return nil, err
+	}
+
+	replace := ov.Replace()
+	contents := make(map[string][]byte, len(replace))
+	for original, woven := range replace {
+		content, err := os.ReadFile(woven)
+		if err != nil {
+			return nil, err
+		}
+		contents[original] = content
+	}
+	flags, err := goflags.ParseCommandFlags(ctx, wd, goArgs)
+	if err != nil {
+		return nil, fmt.Errorf("parsing go command flags: %w", err)
+	}
+	patterns := flags.Args
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	pkgs, err := packages.Load(
+		&packages.Config{
+			Context:    ctx,
+			Dir:        wd,
+			Mode:       packages.LoadAllSyntax,
+			Tests:      true,
+			BuildFlags: flags.Except("-overlay", "-toolexec").Slice(),
+			Overlay:    contents,
+			Logf:       func(format string, args ...any) { log.Trace().Msgf(format, args...) },
+		},
+		patterns...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("loading packages: %w", err)
+	}
+	var loadErrs []error
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		for _, err := range pkg.Errors {
+			loadErrs = append(loadErrs, err)
+		}
+	})
+	if len(loadErrs) != 0 {
+		return nil, errors.Join(loadErrs...)
+	}
+
+	// The generated test main packages are not checked by `go vet`.
+	pkgs = slices.DeleteFunc(pkgs, func(pkg *packages.Package) bool { return strings.HasSuffix(pkg.ID, ".test") })
+
+	graph, err := checker.Analyze(Analyzers, pkgs, nil)
+	if err != nil {
+		return nil, err
+	}
+	return diagnostics(graph)
+}
+
+// diagnostics collects the diagnostics reported by the root actions of graph.
+// Packages that are compiled both with and without test files report the same
+// diagnostics twice; duplicates are removed.
+func diagnostics(graph *checker.Graph) ([]Diagnostic, error) {
+	var (
+		res  []Diagnostic
+		errs []error
+		seen = make(map[Diagnostic]struct{})
+	)
+	for _, act := range graph.Roots {
+		if act.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", act, act.Err))
+			continue
+		}
+		for _, diag := range act.Diagnostics {
+			pos, woven := position(act.Package.Fset, act.Package.Syntax, diag.Pos)
+			d := Diagnostic{Position: pos, Analyzer: act.Analyzer.Name, Message: diag.Message, Woven: woven}
+			if _, dup := seen[d]; dup {
+				continue
+			}
+			seen[d] = struct{}{}
+			res = append(res, d)
+		}
+	}
+
+	slices.SortFunc(res, func(l, r Diagnostic) int {
+		return cmp.Or(
+			strings.Compare(l.Position.Filename, r.Position.Filename),
+			cmp.Compare(l.Position.Line, r.Position.Line),
+			cmp.Compare(l.Position.Column, r.Position.Column),
+			strings.Compare(l.Message, r.Message),
+		)
+	})
+	return res, errors.Join(errs...)
+}
+
+// position returns the position of pos in the original source file, according
+// to `//line` directives. If pos is in code woven by orchestrion, it returns the
+// closest preceding position that maps to the original source file, and true.
+func position(fset *token.FileSet, files []*ast.File, pos token.Pos) (token.Position, bool) {
+	adjusted := fset.Position(pos)
+	if !isGenerated(adjusted) {
+		return adjusted, false
+	}
+
+	// Lines holding `//line` directives are attributed to the location following
+	// the previous directive's, so they must be skipped.
+	file := fset.File(pos)
+	directives := make(map[int]struct{})
+	for _, astFile := range files {
+		if pos < astFile.FileStart || pos > astFile.FileEnd {
+			continue
+		}
+		for _, group := range astFile.Comments {
+			for _, comment := range group.List {
+				if strings.HasPrefix(comment.Text, "//line ") {
+					directives[file.PositionFor(comment.Pos(), false).Line] = struct{}{}
+				}
+			}
+		}
+	}
+
+	for line := file.PositionFor(pos, false).Line - 1; line > 0; line-- {
+		if _, isDirective := directives[line]; isDirective {
+			continue
+		}
+		if adjusted := file.PositionFor(file.LineStart(line), true); !isGenerated(adjusted) {
+			return adjusted, true
+		}
+	}
+	return file.PositionFor(pos, false), true
+}
+
+// isGenerated returns true if pos is attributed to code woven by orchestrion.
+// The parser resolves relative file names in `//line` directives against the
+// directory of the file containing them, so only the base name is checked.
+func isGenerated(pos token.Position) bool {
+	return filepath.Base(pos.Filename) == lineinfo.GeneratedFilename
+}
@@ -0,0 +1,64 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package vet
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPosition(t *testing.T) {
+	const woven = `//line /app/main.go:1:1
+package main
+
+func main() {
+//line <generated>:1
+	println("woven")
+//line /app/main.go:4
+	println("original")
+//line <generated>:1
+	println("woven")
+//line /app/main.go:5
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "/tmp/overlay/main.go", woven, parser.ParseComments)
+	require.NoError(t, err)
+
+	var calls []*ast.CallExpr
+	ast.Inspect(file, func(node ast.Node) bool {
+		if call, ok := node.(*ast.CallExpr); ok {
+			calls = append(calls, call)
+		}
+		return true
+	})
+	require.Len(t, calls, 3)
+
+	for i, expected := range []struct {
+		line  int
+		woven bool
+	}{
+		{line: 3, woven: true},
+		{line: 4, woven: false},
+		{line: 4, woven: true},
+	} {
+		pos, isWoven := position(fset, []*ast.File{file}, calls[i].Pos())
+		assert.Equal(t, "/app/main.go", pos.Filename, "call #%d", i)
+		assert.Equal(t, expected.line, pos.Line, "call #%d", i)
+		assert.Equal(t, expected.woven, isWoven, "call #%d", i)
+	}
+}
+
+func TestDiagnosticString(t *testing.T) {
+	pos := token.Position{Filename: "/app/main.go", Line: 4, Column: 2}
+	assert.Equal(t, "/app/main.go:4:2: unreachable code", Diagnostic{Position: pos, Message: "unreachable code"}.String())
+	assert.Equal(t, "/app/main.go:4:2: unreachable code (in code woven by orchestrion)", Diagnostic{Position: pos, Message: "unreachable code", Woven: true}.String())
+}
@@ -0,0 +1,125 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package weave
+
+import (
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// orchestrionPkgPath is the import path of the orchestrion package, the
+// configuration of which is built into orchestrion itself.
+const orchestrionPkgPath = "github.com/DataDog/orchestrion"
+
+// packageLoader is a [config.PackageLoader] that resolves packages from an
+// explicit mapping of import paths to directories, instead of using the go
+// command.
+type packageLoader struct {
+	dirs    map[string]string
+	modules map[string]string
+}
+
+func (l packageLoader) load(_ context.Context, dir string, patterns ...string) ([]*packages.Package, error) {
+	pkgs := make([]*packages.Package, 0, len(patterns))
+	for _, pattern := range patterns {
+		var (
+			pkgPath string
+			pkgDir  string
+		)
+		switch {
+		case pattern == orchestrionPkgPath:
+			pkgs = append(pkgs, &packages.Package{ID: pattern, PkgPath: pattern, Name: "orchestrion"})
+			continue
+		case filepath.IsAbs(pattern) || pattern == "." || strings.HasPrefix(pattern, "./") || strings.HasPrefix(pattern, "../"):
+			pkgDir = pattern
+			if !filepath.IsAbs(pkgDir) {
+				pkgDir = filepath.Join(dir, pkgDir)
+			}
+			pkgPath = l.importPath(pkgDir)
+		default:
+			var found bool
+			if pkgDir, found = l.dirs[pattern]; !found {
+				return nil, fmt.Errorf("package %q: no directory provided for this package (use --package %s=<dir>)", pattern, pattern)
+			}
+			pkgPath = pattern
+		}
+
+		pkg, err := l.loadDir(pkgDir, pkgPath)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
+
+// loadDir creates a [packages.Package] for the package with the designated
+// import path, the sources of which are in dir.
+func (l packageLoader) loadDir(dir string, pkgPath string) (*packages.Package, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("package %q: %w", pkgPath, err)
+	}
+
+	id := pkgPath
+	if id == "" {
+		id = dir
+	}
+	pkg := &packages.Package{ID: id, PkgPath: pkgPath, Module: l.module(pkgPath)}
+	for _, entry := range entries {
+		if name := entry.Name(); !entry.IsDir() && strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+			pkg.GoFiles = append(pkg.GoFiles, filepath.Join(dir, name))
+		}
+	}
+	if len(pkg.GoFiles) == 0 {
+		return nil, fmt.Errorf("package %q: no Go files in %s", pkgPath, dir)
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), pkg.GoFiles[0], nil, parser.PackageClauseOnly)
+	if err != nil {
+		return nil, fmt.Errorf("package %q: %w", pkgPath, err)
+	}
+	pkg.Name = file.Name.Name
+
+	return pkg, nil
+}
+
+// importPath returns the import path of the package in dir, if it is one of
+// the provided package directories.
+func (l packageLoader) importPath(dir string) string {
+	for path, pkgDir := range l.dirs {
+		if abs, err := filepath.Abs(pkgDir); err == nil && abs == filepath.Clean(dir) {
+			return path
+		}
+	}
+	return ""
+}
+
+// module returns the module providing the package with the designated import
+// path, if it is one of the provided modules.
+func (l packageLoader) module(pkgPath string) *packages.Module {
+	var res *packages.Module
+	for path, version := range l.modules {
+		if pkgPath != path && !strings.HasPrefix(pkgPath, path+"/") {
+			continue
+		}
+		if res == nil || len(path) > len(res.Path) {
+			res = &packages.Module{Path: path, Version: version}
+		}
+	}
+	return res
+}
@@ -0,0 +1,254 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package weave implements weaving a single package in a hermetic way: the
+// configuration and all dependencies are explicitly provided, and neither the
+// job server nor the go command are used. This is intended for build systems
+// that drive the go toolchain themselves (such as Bazel's rules_go), which then
+// compile the woven files and resolve the reported dependencies on their own.
+package weave
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/DataDog/dd-trace-go/v2/ddtrace/tracer"
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/injector"
+	"github.com/DataDog/orchestrion/internal/injector/aspect"
+	"github.com/DataDog/orchestrion/internal/injector/config"
+	"github.com/DataDog/orchestrion/internal/injector/typed"
+	toolexecaspect "github.com/DataDog/orchestrion/internal/toolexec/aspect"
+	"github.com/DataDog/orchestrion/internal/toolexec/importcfg"
+	"github.com/rs/zerolog"
+)
+
+// ManifestFilename is the default name of the manifest file written in the
+// output directory.
+const ManifestFilename = "orchestrion.manifest.json"
+
+type Options struct {
+	// ImportPath is the import path of the package being woven.
+	ImportPath string
+	// ImportCfg is the path to the `importcfg` file listing the archives of the
+	// package's dependencies, as provided to `go tool compile`.
+	ImportCfg string
+	// GoFiles are the source files of the package being woven.
+	GoFiles []string
+	// OutDir is the directory where woven files are written. Source files that
+	// share the same base name are written in distinct sub-directories of it.
+	OutDir string
+	// Manifest is the path to the manifest file. Defaults to [ManifestFilename]
+	// in [Options.OutDir].
+	Manifest string
+	// ConfigDir is the directory containing the configuration to be loaded (its
+	// `orchestrion.tool.go` and `orchestrion.yml` files). Defaults to the current
+	// working directory.
+	ConfigDir string
+	// PackageDirs associates the import paths of packages referenced by the
+	// configuration (imports of `orchestrion.tool.go` files, `extends` entries)
+	// to the directory containing their sources.
+	PackageDirs map[string]string
+	// Modules associates module paths to their version. These are used to
+	// evaluate aspects' module requirements, and version constraints of
+	// `extends` entries.
+	Modules map[string]string
+	// GoVersion is the Go language version the package is compiled with (e.g,
+	// `go1.22`), if any.
+	GoVersion string
+	// TestMain must be set when weaving the generated test main package.
+	TestMain bool
+	// Target is the platform and build tags the package is compiled for. It is
+	// used to evaluate aspects' `when` conditions.
+	Target goenv.Target
+}
+
+// Manifest describes the result of weaving a package, so that the build system
+// can compile and link it.
+type Manifest struct {
+	// Files associates the original source files to the woven files that must
+	// be compiled instead. Files that were not modified are omitted.
+	Files map[string]string `json:"files"`
+	// GoVersion is the Go language version required by the woven code, if it
+	// is newer than [Options.GoVersion].
+	GoVersion string `json:"goVersion,omitempty"`
+	// Imports lists packages imported by the woven code that are not listed in
+	// the `importcfg` file. Their archives must be added to it before the
+	// package is compiled.
+	Imports []string `json:"imports"`
+	// LinkDeps lists packages introduced by the woven code that are not listed
+	// in the `importcfg` file, and which must be linked into any executable that
+	// depends on this package. This includes all [Manifest.Imports].
+	LinkDeps []string `json:"linkDeps"`
+}
+
+// Weave weaves the package described by opts, writes the modified files to
+// [Options.OutDir], and writes the resulting [Manifest].
+func Weave(ctx context.Context, opts Options) (err error) {
+	span, ctx := tracer.StartSpanFromContext(ctx, "weave",
+		tracer.ResourceName(opts.ImportPath),
+	)
+	defer func() { span.Finish(tracer.WithError(err)) }()
+
+	log := zerolog.Ctx(ctx).With().Str("import-path", opts.ImportPath).Logger()
+	ctx = log.WithContext(ctx)
+
+	if opts.ImportPath == "" {
+		return errors.New("missing import path")
+	}
+	if opts.ImportCfg == "" {
+		return errors.New("missing importcfg file")
+	}
+	if opts.OutDir == "" {
+		return errors.New("missing output directory")
+	}
+	if opts.Manifest == "" {
+		opts.Manifest = filepath.Join(opts.OutDir, ManifestFilename)
+	}
+	if opts.ConfigDir == "" {
+		opts.ConfigDir = "."
+	}
+	configDir, err := filepath.Abs(opts.ConfigDir)
+	if err != nil {
+		return err
+	}
+
+	imports, err := importcfg.ParseFile(ctx, opts.ImportCfg)
+	if err != nil {
+		return fmt.Errorf("parsing %q: %w", opts.ImportCfg, err)
+	}
+
+	loader := packageLoader{dirs: opts.PackageDirs, modules: opts.Modules}
+	cfg, err := config.NewLoader(loader.load, configDir, false).LoadPackage(ctx)
+	if err != nil {
+		return fmt.Errorf("loading injector configuration: %w", err)
+	}
+
+	manifest := Manifest{Files: make(map[string]string), Imports: []string{}, LinkDeps: []string{}}
+	aspects, canWeave := toolexecaspect.SpecialCaseAspects(ctx, opts.ImportPath, cfg.Aspects())
+	if !canWeave {
+		return writeManifest(opts.Manifest, manifest)
+	}
+	aspects = aspect.FilterRequirements(ctx, opts.Modules, aspects)
+	aspects = aspect.FilterTarget(ctx, opts.Target, aspects)
+
+	pkgName, err := packageName(opts.GoFiles)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(opts.OutDir, 0o755); err != nil {
+		return err
+	}
+	outputs := outputFilenames(opts.OutDir, opts.GoFiles)
+	inj := injector.Injector{
+		RootConfig: toolexecaspect.RootConfig,
+		Lookup:     imports.Lookup,
+		ImportPath: opts.ImportPath,
+		Name:       pkgName,
+		TestMain:   opts.TestMain,
+		ImportMap:  imports.PackageFile,
+		GoVersion:  opts.GoVersion,
+		ModifiedFile: func(file string) string {
+			if output, found := outputs[file]; found {
+				return output
+			}
+			return filepath.Join(opts.OutDir, filepath.Base(file))
+		},
+	}
+	results, goLang, err := inj.InjectFiles(ctx, opts.GoFiles, aspects)
+	if err != nil {
+		return err
+	}
+
+	var references typed.ReferenceMap
+	for gofile, res := range results {
+		log.Debug().Str("original", gofile).Str("updated", res.Filename).Msg("Woven source file")
+		manifest.Files[gofile] = res.Filename
+		references.Merge(res.References)
+	}
+	if !goLang.IsAny() {
+		manifest.GoVersion = goLang.String()
+	}
+
+	for path, kind := range references.Map() {
+		if path == "unsafe" {
+			// Unsafe isn't like other go packages, and it does not have an associated archive file.
+			continue
+		}
+		if _, satisfied := imports.PackageFile[path]; satisfied {
+			// Already part of natural dependencies, nothing to do...
+			continue
+		}
+		if kind == typed.ImportStatement {
+			manifest.Imports = append(manifest.Imports, path)
+		}
+		manifest.LinkDeps = append(manifest.LinkDeps, path)
+	}
+	slices.Sort(manifest.Imports)
+	slices.Sort(manifest.LinkDeps)
+
+	return writeManifest(opts.Manifest, manifest)
+}
+
+// packageName returns the name of the package the provided files belong to, as
+// declared by the package clause of the first one of them.
+func packageName(files []string) (string, error) {
+	if len(files) == 0 {
+		return "", errors.New("missing source files")
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), files[0], nil, parser.PackageClauseOnly)
+	if err != nil {
+		return "", err
+	}
+	return file.Name.Name, nil
+}
+
+// outputFilenames determines where the woven version of each of the provided
+// source files is written. Files are written directly in outDir, unless several
+// of them share the same base name (e.g, generated and hand-written files from
+// different directories), in which case each of those is written in a
+// sub-directory named after a hash of its original directory.
+func outputFilenames(outDir string, files []string) map[string]string {
+	count := make(map[string]int, len(files))
+	for _, file := range files {
+		count[filepath.Base(file)]++
+	}
+
+	outputs := make(map[string]string, len(files))
+	for _, file := range files {
+		base := filepath.Base(file)
+		if count[base] == 1 {
+			outputs[file] = filepath.Join(outDir, base)
+			continue
+		}
+		dir, err := filepath.Abs(filepath.Dir(file))
+		if err != nil {
+			dir = filepath.Dir(file)
+		}
+		sum := sha256.Sum256([]byte(dir))
+		outputs[file] = filepath.Join(outDir, hex.EncodeToString(sum[:8]), base)
+	}
+	return outputs
+}
+
+func writeManifest(filename string, manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,163 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package weave_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/orchestrion/internal/goenv"
+	"github.com/DataDog/orchestrion/internal/weave"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeave(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"config/orchestrion.tool.go": "//go:build tools\n\npackage tools\n\nimport _ \"example.com/integration\"\n",
+		"integration/integration.go": "package integration\n",
+		"integration/orchestrion.yml": `aspects:
+  - id: imports
+    join-point: { function-body: { function: [{ name: main }] } }
+    advice:
+      - inject-declarations:
+          imports: { dep: example.com/dep }
+          template: var _ = dep.Hello
+  - id: links
+    join-point: { function-body: { function: [{ name: main }] } }
+    advice:
+      - inject-declarations:
+          links: [example.com/link]
+          template: var _ = 1337
+  - id: unsatisfied
+    join-point: { function-body: { function: [{ name: main }] } }
+    requires: { module: example.com/lib, version: v2.0.0 }
+    advice:
+      - inject-declarations:
+          imports: { other: example.com/other }
+          template: var _ = other.Hello
+  - id: untargeted
+    join-point: { function-body: { function: [{ name: main }] } }
+    when: { goos: [windows], tags: [cgo] }
+    advice:
+      - inject-declarations:
+          imports: { win: example.com/windows }
+          template: var _ = win.Hello
+`,
+		"app/main.go": "package main\n\nfunc main() {}\n",
+		"importcfg":   "# import config\n",
+	})
+
+	out := filepath.Join(tmp, "out")
+	err := weave.Weave(context.Background(), weave.Options{
+		ImportPath:  "example.com/app",
+		ImportCfg:   filepath.Join(tmp, "importcfg"),
+		GoFiles:     []string{filepath.Join(tmp, "app", "main.go")},
+		OutDir:      out,
+		ConfigDir:   filepath.Join(tmp, "config"),
+		PackageDirs: map[string]string{"example.com/integration": filepath.Join(tmp, "integration")},
+		Modules:     map[string]string{"example.com/lib": "v1.2.3"},
+		Target:      goenv.Target{GOOS: "linux", GOARCH: "amd64", CgoEnabled: true},
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(out, weave.ManifestFilename))
+	require.NoError(t, err)
+	var manifest weave.Manifest
+	require.NoError(t, json.Unmarshal(data, &manifest))
+
+	assert.Equal(t, map[string]string{filepath.Join(tmp, "app", "main.go"): filepath.Join(out, "main.go")}, manifest.Files)
+	assert.Equal(t, []string{"example.com/dep"}, manifest.Imports)
+	assert.Equal(t, []string{"example.com/dep", "example.com/link"}, manifest.LinkDeps)
+
+	woven, err := os.ReadFile(filepath.Join(out, "main.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(woven), "dep.Hello")
+	assert.NotContains(t, string(woven), "other.Hello")
+	assert.NotContains(t, string(woven), "win.Hello")
+}
+
+func TestWeaveSameBaseName(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"config/orchestrion.tool.go": "//go:build tools\n\npackage tools\n\nimport _ \"example.com/integration\"\n",
+		"integration/integration.go": "package integration\n",
+		"integration/orchestrion.yml": `aspects:
+  - id: main
+    join-point: { function-body: { function: [{ name: main }] } }
+    advice:
+      - prepend-statements: { template: println("woven") }
+  - id: helper
+    join-point: { function-body: { function: [{ name: helper }] } }
+    advice:
+      - prepend-statements: { template: println("woven") }
+`,
+		"app/main.go":           "package main\n\nfunc main() {\n\thelper()\n}\n",
+		"generated/app/main.go": "package main\n\nfunc helper() {}\n",
+		"importcfg":             "# import config\n",
+	})
+
+	out := filepath.Join(tmp, "out")
+	sources := []string{filepath.Join(tmp, "app", "main.go"), filepath.Join(tmp, "generated", "app", "main.go")}
+	err := weave.Weave(context.Background(), weave.Options{
+		ImportPath:  "example.com/app",
+		ImportCfg:   filepath.Join(tmp, "importcfg"),
+		GoFiles:     sources,
+		OutDir:      out,
+		ConfigDir:   filepath.Join(tmp, "config"),
+		PackageDirs: map[string]string{"example.com/integration": filepath.Join(tmp, "integration")},
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(out, weave.ManifestFilename))
+	require.NoError(t, err)
+	var manifest weave.Manifest
+	require.NoError(t, json.Unmarshal(data, &manifest))
+
+	require.Len(t, manifest.Files, 2)
+	assert.NotEqual(t, manifest.Files[sources[0]], manifest.Files[sources[1]])
+	for _, source := range sources {
+		woven := manifest.Files[source]
+		assert.Equal(t, "main.go", filepath.Base(woven))
+		assert.True(t, strings.HasPrefix(woven, out+string(filepath.Separator)), "%s is not in %s", woven, out)
+
+		content, err := os.ReadFile(woven)
+		require.NoError(t, err)
+		assert.Contains(t, string(content), `println("woven")`)
+	}
+}
+
+func TestWeaveMissingPackage(t *testing.T) {
+	tmp := t.TempDir()
+	writeFiles(t, tmp, map[string]string{
+		"config/orchestrion.tool.go": "//go:build tools\n\npackage tools\n\nimport _ \"example.com/integration\"\n",
+		"app/main.go":                "package main\n\nfunc main() {}\n",
+		"importcfg":                  "# import config\n",
+	})
+
+	err := weave.Weave(context.Background(), weave.Options{
+		ImportPath: "example.com/app",
+		ImportCfg:  filepath.Join(tmp, "importcfg"),
+		GoFiles:    []string{filepath.Join(tmp, "app", "main.go")},
+		OutDir:     filepath.Join(tmp, "out"),
+		ConfigDir:  filepath.Join(tmp, "config"),
+	})
+	require.ErrorContains(t, err, "--package example.com/integration=<dir>")
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
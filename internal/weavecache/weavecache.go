@@ -0,0 +1,293 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+// Package weavecache implements a persistent, content-addressed cache of woven
+// source files. Entries are keyed by a fingerprint of everything that
+// influences the outcome of weaving a package (its source files, the export
+// data of its dependencies, and the aspects being applied), so that unchanged
+// packages do not need to be re-parsed, type-checked and re-woven when the go
+// build cache is invalidated for unrelated reasons.
+package weavecache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/files"
+	"github.com/DataDog/orchestrion/internal/injector/typed"
+)
+
+const (
+	// EnvVarCacheDir is the environment variable that can be used to override
+	// the root directory of orchestrion's persistent caches.
+	EnvVarCacheDir = "ORCHESTRION_CACHE_DIR"
+	// EnvVarWeaveCache is the environment variable that can be set to "off" to
+	// disable the weave cache entirely.
+	EnvVarWeaveCache = "ORCHESTRION_WEAVE_CACHE"
+
+	entryFile = "entry.json"
+)
+
+// Root returns the root directory of orchestrion's persistent caches. This is
+// the value of the [EnvVarCacheDir] environment variable if set, and the
+// `orchestrion` directory within [os.UserCacheDir] otherwise.
+func Root() (string, error) {
+	if dir := os.Getenv(EnvVarCacheDir); dir != "" {
+		return filepath.Abs(dir)
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "orchestrion"), nil
+}
+
+// Cache is a handle on the weave cache directory.
+type Cache struct {
+	dir string
+}
+
+type (
+	// Entry is the outcome of weaving a package, as recorded in the cache.
+	Entry struct {
+		// Files maps the original source files to the name of their woven
+		// counterpart. Only modified files are present.
+		Files map[string]string `json:"files"`
+		// References holds the new references created while weaving the package,
+		// from which the package's synthetic link-time dependencies are derived.
+		References typed.ReferenceMap `json:"references"`
+		// GoLang is the minimum go language version required by the woven code.
+		GoLang string `json:"go-lang,omitempty"`
+	}
+
+	// Stats summarizes the contents of the cache.
+	Stats struct {
+		// Dir is the directory containing the cache.
+		Dir string
+		// Entries is the number of entries in the cache.
+		Entries int
+		// Size is the total size of the cache's contents, in bytes.
+		Size int64
+		// Oldest is the last time the least recently used entry was used.
+		Oldest time.Time
+		// Newest is the last time the most recently used entry was used.
+		Newest time.Time
+	}
+)
+
+// Open returns a handle on the weave cache. It returns nil if the cache has
+// been disabled by setting [EnvVarWeaveCache] to "off".
+func Open() (*Cache, error) {
+	if os.Getenv(EnvVarWeaveCache) == "off" {
+		return nil, nil
+	}
+	root, err := Root()
+	if err != nil {
+		return nil, fmt.Errorf("resolving cache directory: %w", err)
+	}
+	return &Cache{dir: filepath.Join(root, "weave")}, nil
+}
+
+// Dir returns the directory containing the cache's entries.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+func (c *Cache) entryDir(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// Get looks up the entry for key. If found, the woven files are copied to the
+// path returned by dest for each original file, and the returned entry's
+// [Entry.Files] map is updated to refer to these copies. The boolean result is
+// false if there is no entry for key.
+func (c *Cache) Get(ctx context.Context, key string, dest func(original string) string) (Entry, bool, error) {
+	dir := c.entryDir(key)
+	data, err := os.ReadFile(filepath.Join(dir, entryFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Entry{}, false, nil
+	} else if err != nil {
+		return Entry{}, false, err
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return Entry{}, false, fmt.Errorf("parsing cache entry %s: %w", key, err)
+	}
+
+	for original, cached := range entry.Files {
+		target := dest(original)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return Entry{}, false, err
+		}
+		if err := files.Copy(ctx, filepath.Join(dir, cached), target); err != nil {
+			return Entry{}, false, fmt.Errorf("restoring %q from cache entry %s: %w", original, key, err)
+		}
+		entry.Files[original] = target
+	}
+
+	// Record the use of this entry, so that trimming is based on last use.
+	now := time.Now()
+	_ = os.Chtimes(filepath.Join(dir, entryFile), now, now)
+
+	return entry, true, nil
+}
+
+// Put records entry for key. The [Entry.Files] map must refer to the woven
+// files on disk, which are copied into the cache. Concurrent writers of the
+// same key are safe, as the entry is prepared in a temporary directory that is
+// then atomically renamed into place.
+func (c *Cache) Put(ctx context.Context, key string, entry Entry) (err error) {
+	dir := c.entryDir(key)
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), key+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(tmp)
+		}
+	}()
+
+	stored := entry
+	stored.Files = make(map[string]string, len(entry.Files))
+	idx := 0
+	for original, woven := range entry.Files {
+		name := strconv.Itoa(idx) + ".go"
+		idx++
+		if err := files.Copy(ctx, woven, filepath.Join(tmp, name)); err != nil {
+			return err
+		}
+		stored.Files[original] = name
+	}
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, entryFile), data, 0o644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		if _, statErr := os.Stat(filepath.Join(dir, entryFile)); statErr == nil {
+			// Another process populated the same entry concurrently; keep theirs.
+			_ = os.RemoveAll(tmp)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// Stats walks the cache directory and summarizes its contents.
+func (c *Cache) Stats() (Stats, error) {
+	stats := Stats{Dir: c.dir}
+	err := c.walkEntries(func(dir string, used time.Time) error {
+		size, err := dirSize(dir)
+		if err != nil {
+			return err
+		}
+		stats.Entries++
+		stats.Size += size
+		if stats.Oldest.IsZero() || used.Before(stats.Oldest) {
+			stats.Oldest = used
+		}
+		if used.After(stats.Newest) {
+			stats.Newest = used
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// Trim removes all entries that were last used before the specified time. It
+// returns the number of entries removed, and the number of bytes freed.
+func (c *Cache) Trim(before time.Time) (removed int, freed int64, err error) {
+	err = c.walkEntries(func(dir string, used time.Time) error {
+		if !used.Before(before) {
+			return nil
+		}
+		size, err := dirSize(dir)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		removed++
+		freed += size
+		return nil
+	})
+	return removed, freed, err
+}
+
+// Clean removes all entries from the cache.
+func (c *Cache) Clean() error {
+	return os.RemoveAll(c.dir)
+}
+
+// walkEntries calls fn for each entry in the cache, with the entry's directory
+// and the time it was last used. Incomplete entries are ignored.
+func (c *Cache) walkEntries(fn func(dir string, used time.Time) error) error {
+	shards, err := os.ReadDir(c.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, shard := range shards {
+		if !shard.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(c.dir, shard.Name()))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() || strings.Contains(entry.Name(), ".tmp-") {
+				continue
+			}
+			dir := filepath.Join(c.dir, shard.Name(), entry.Name())
+			stat, err := os.Stat(filepath.Join(dir, entryFile))
+			if err != nil {
+				continue
+			}
+			if err := fn(dir, stat.ModTime()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,81 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023-present Datadog, Inc.
+
+package weavecache_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DataDog/orchestrion/internal/weavecache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	t.Setenv(weavecache.EnvVarCacheDir, t.TempDir())
+	ctx := context.Background()
+
+	cache, err := weavecache.Open()
+	require.NoError(t, err)
+	require.NotNil(t, cache)
+
+	const key = "0123456789abcdef"
+	_, found, err := cache.Get(ctx, key, nil)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	work := t.TempDir()
+	woven := filepath.Join(work, "woven.go")
+	require.NoError(t, os.WriteFile(woven, []byte("package main\n"), 0o644))
+	require.NoError(t, cache.Put(ctx, key, weavecache.Entry{
+		Files:  map[string]string{"/src/main.go": woven},
+		GoLang: "go1.22",
+	}))
+	// Putting the same key again is not an error.
+	require.NoError(t, cache.Put(ctx, key, weavecache.Entry{Files: map[string]string{"/src/main.go": woven}}))
+
+	restored := filepath.Join(t.TempDir(), "restored")
+	entry, found, err := cache.Get(ctx, key, func(original string) string {
+		return filepath.Join(restored, filepath.Base(original))
+	})
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "go1.22", entry.GoLang)
+	assert.Equal(t, map[string]string{"/src/main.go": filepath.Join(restored, "main.go")}, entry.Files)
+	content, err := os.ReadFile(filepath.Join(restored, "main.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n", string(content))
+
+	stats, err := cache.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Entries)
+	assert.NotZero(t, stats.Size)
+
+	removed, _, err := cache.Trim(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+
+	removed, freed, err := cache.Trim(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, stats.Size, freed)
+
+	require.NoError(t, cache.Put(ctx, key, weavecache.Entry{}))
+	require.NoError(t, cache.Clean())
+	stats, err = cache.Stats()
+	require.NoError(t, err)
+	assert.Zero(t, stats.Entries)
+}
+
+func TestDisabled(t *testing.T) {
+	t.Setenv(weavecache.EnvVarWeaveCache, "off")
+	cache, err := weavecache.Open()
+	require.NoError(t, err)
+	require.Nil(t, cache)
+}
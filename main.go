@@ -141,6 +141,12 @@ func main() {
 		Commands: []*cli.Command{
 			cmd.Go,
 			cmd.Pin,
+			cmd.Explain,
+			cmd.Weave,
+			cmd.Vet,
+			cmd.GoplsOverlay,
+			cmd.Cache,
+			cmd.CacheProg,
 			cmd.Toolexec,
 			cmd.Version,
 			cmd.Server,